@@ -1,7 +1,35 @@
 package main
 
-import gidbig "github.com/toksikk/gidbig/internal/core"
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/toksikk/gidbig/internal/cfg"
+	gidbig "github.com/toksikk/gidbig/internal/core"
+)
 
 func main() {
-	gidbig.StartGidbig()
+	configPath := flag.String("config", cfg.DefaultPath, "path to the config file; *.yaml in config.d/ next to it is merged on top")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		_, _ = fmt.Fprintf(out, "Usage:\n  gidbig [--config path]\n  gidbig config check [--config path]\n\n")
+		_, _ = fmt.Fprintf(out, "Every config field can be overridden by a %s_* environment variable,\ne.g. %s_DISCORD_TOKEN or %s_WEB_OAUTH_CLIENT_SECRET.\n\nFlags:\n", cfg.EnvPrefix, cfg.EnvPrefix, cfg.EnvPrefix)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	switch {
+	case len(args) == 0:
+		gidbig.StartGidbig(*configPath)
+	case len(args) >= 2 && args[0] == "config" && args[1] == "check":
+		sub := flag.NewFlagSet("config check", flag.ExitOnError)
+		sub.StringVar(configPath, "config", *configPath, "path to the config file")
+		_ = sub.Parse(args[2:])
+		os.Exit(gidbig.CheckConfig(*configPath, os.Stdout))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 }
@@ -1,18 +1,16 @@
 package admin
 
 import (
-	"fmt"
 	"log/slog"
-	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/toksikk/gidbig/internal/bot"
-	"github.com/toksikk/gidbig/internal/gippity"
 )
 
 var (
 	ownerID   string
 	infoFn    func(s *discordgo.Session) string
+	reloadFn  func() string
 	providers []bot.AdminProvider
 )
 
@@ -22,54 +20,34 @@ func RegisterProvider(p bot.AdminProvider) {
 	providers = append(providers, p)
 }
 
-// Start registers the /admin interaction handler.
-func Start(s *discordgo.Session, oid string, info func(s *discordgo.Session) string) {
+// Start configures the /admin command and returns its interaction handler
+// for registration with the bot Router. reload re-reads the config and
+// returns a summary for /admin reload.
+func Start(oid string, info func(s *discordgo.Session) string, reload func() string) bot.HandlerFunc {
 	ownerID = oid
 	infoFn = info
-	s.AddHandler(onAdminInteractionCreate)
+	reloadFn = reload
 	slog.Info("admin commands registered")
+	return onAdminInteractionCreate
 }
 
 // Commands returns the /admin slash command definition.
 func Commands() []*discordgo.ApplicationCommand {
-	userOpt := func(desc string) *discordgo.ApplicationCommandOption {
-		return &discordgo.ApplicationCommandOption{
-			Type:        discordgo.ApplicationCommandOptionUser,
-			Name:        "user",
-			Description: desc,
-			Required:    false,
-		}
-	}
-
 	opts := make([]*discordgo.ApplicationCommandOption, 0, len(providers)+2)
 	for _, p := range providers {
 		opts = append(opts, p.AdminSubcommandGroup())
 	}
 	opts = append(opts,
-		&discordgo.ApplicationCommandOption{
-			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
-			Name:        "gippity",
-			Description: "Gippity admin queries",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        "privacy",
-					Description: "Show gippity privacy setting for a user or all users",
-					Options:     []*discordgo.ApplicationCommandOption{userOpt("Target user (omit for all)")},
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        "history",
-					Description: "Show whether a user has stored conversation history",
-					Options:     []*discordgo.ApplicationCommandOption{userOpt("Target user (omit for all)")},
-				},
-			},
-		},
 		&discordgo.ApplicationCommandOption{
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
 			Name:        "info",
 			Description: "General bot info: uptime, guild count, loaded plugins",
 		},
+		&discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "reload",
+			Description: "Re-read the config and apply changes that do not need a restart",
+		},
 	)
 
 	return []*discordgo.ApplicationCommand{
@@ -139,10 +117,12 @@ func onAdminInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCrea
 	switch top.Name {
 	case "info":
 		editEphemeral(s, i, "```"+infoFn(s)+"```")
-	case "gippity":
-		if len(top.Options) > 0 {
-			handleGippityAdmin(s, i, top.Options[0])
+	case "reload":
+		if reloadFn == nil {
+			editEphemeral(s, i, "Reload is not available.")
+			return
 		}
+		editEphemeral(s, i, reloadFn())
 	default:
 		for _, p := range providers {
 			if p.AdminSubcommandGroup().Name == top.Name {
@@ -154,63 +134,3 @@ func onAdminInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCrea
 		}
 	}
 }
-
-func optUserID(s *discordgo.Session, opts []*discordgo.ApplicationCommandInteractionDataOption) string {
-	for _, o := range opts {
-		if o.Name == "user" {
-			u := o.UserValue(s)
-			if u == nil {
-				return ""
-			}
-			return u.ID
-		}
-	}
-	return ""
-}
-
-func handleGippityAdmin(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	switch sub.Name {
-	case "privacy":
-		targetID := optUserID(s, sub.Options)
-		if targetID != "" {
-			privacy := gippity.AdminGetUserPrivacy(targetID)
-			editEphemeral(s, i, fmt.Sprintf("<@%s> privacy: %v (true = messages anonymized in AI context)", targetID, privacy))
-			return
-		}
-		settings, err := gippity.AdminGetAllUserPrivacy()
-		if err != nil {
-			editEphemeral(s, i, fmt.Sprintf("Error querying privacy settings: %v", err))
-			return
-		}
-		if len(settings) == 0 {
-			editEphemeral(s, i, "No explicit privacy settings stored (all users default to: on).")
-			return
-		}
-		var sb strings.Builder
-		for uid, enabled := range settings {
-			fmt.Fprintf(&sb, "<@%s>: %v\n", uid, enabled)
-		}
-		editEphemeral(s, i, sb.String())
-	case "history":
-		targetID := optUserID(s, sub.Options)
-		if targetID != "" {
-			has := gippity.AdminHasConversationHistory(targetID)
-			editEphemeral(s, i, fmt.Sprintf("<@%s> has history: %v", targetID, has))
-			return
-		}
-		users, err := gippity.AdminGetUsersWithHistory()
-		if err != nil {
-			editEphemeral(s, i, fmt.Sprintf("Error querying history: %v", err))
-			return
-		}
-		if len(users) == 0 {
-			editEphemeral(s, i, "No conversation history stored.")
-			return
-		}
-		var sb strings.Builder
-		for _, uid := range users {
-			fmt.Fprintf(&sb, "<@%s>\n", uid)
-		}
-		editEphemeral(s, i, "Users with stored history:\n"+sb.String())
-	}
-}
@@ -50,7 +50,7 @@ func TestCommands_Structure(t *testing.T) {
 	for _, opt := range cmd.Options {
 		names[opt.Name] = true
 	}
-	for _, want := range []string{"coffee", "gippity", "info"} {
+	for _, want := range []string{"coffee", "info", "reload"} {
 		if !names[want] {
 			t.Errorf("missing top-level option %q", want)
 		}
@@ -89,31 +89,6 @@ func TestCommands_CoffeeBeveragesSubcommand(t *testing.T) {
 	}
 }
 
-func TestCommands_GippitySubcommands(t *testing.T) {
-	cmds := Commands()
-	cmd := cmds[0]
-	var gippityGroup *discordgo.ApplicationCommandOption
-	for _, o := range cmd.Options {
-		if o.Name == "gippity" {
-			gippityGroup = o
-		}
-	}
-	if gippityGroup == nil {
-		t.Fatal("no gippity subcommand group")
-		return
-	}
-
-	subNames := make(map[string]bool)
-	for _, o := range gippityGroup.Options {
-		subNames[o.Name] = true
-	}
-	for _, want := range []string{"privacy", "history"} {
-		if !subNames[want] {
-			t.Errorf("missing gippity subcommand %q", want)
-		}
-	}
-}
-
 func TestCommands_InfoSubcommand(t *testing.T) {
 	cmds := Commands()
 	cmd := cmds[0]
@@ -167,26 +142,3 @@ func TestCallerID_Neither(t *testing.T) {
 		t.Errorf("callerID = %q, want empty string", got)
 	}
 }
-
-func TestOptUserID_Present(t *testing.T) {
-	user := &discordgo.User{ID: "target-user"}
-	opts := []*discordgo.ApplicationCommandInteractionDataOption{
-		{
-			Name:  "user",
-			Type:  discordgo.ApplicationCommandOptionUser,
-			Value: user.ID,
-		},
-	}
-	got := optUserID(nil, opts)
-	if got != user.ID {
-		t.Errorf("optUserID = %q, want %q", got, user.ID)
-	}
-}
-
-func TestOptUserID_Absent(t *testing.T) {
-	opts := []*discordgo.ApplicationCommandInteractionDataOption{}
-	got := optUserID(nil, opts)
-	if got != "" {
-		t.Errorf("optUserID = %q, want empty string", got)
-	}
-}
@@ -2,42 +2,174 @@ package bot
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+const (
+	// commandCooldown is the default per-user, per-command rate limit.
+	commandCooldown = 2 * time.Second
+
+	// defaultShutdownTimeout bounds how long Shutdown waits for teardown.
+	defaultShutdownTimeout = 10 * time.Second
 )
 
 // Bot wires together a Router, BackgroundSupervisor, and registered Modules.
 type Bot struct {
 	deps       Deps
+	config     atomic.Pointer[cfg.Config]
 	Router     *Router
 	background *BackgroundSupervisor
 	cancel     context.CancelFunc
 	modules    []Module
+	commands   []*discordgo.ApplicationCommand
+	middleware []Middleware
+
+	shutdownTimeout time.Duration
+	reloadMu        sync.Mutex
 }
 
 // New creates a Bot from the given Deps.
 func New(d Deps) *Bot {
-	return &Bot{
-		deps:       d,
-		Router:     newRouter(d),
-		background: newBackgroundSupervisor(),
+	b := &Bot{
+		deps:            d,
+		Router:          newRouter(d),
+		background:      newBackgroundSupervisor(),
+		middleware:      []Middleware{Recover(), WithCorrelationID(), RateLimit(commandCooldown)},
+		shutdownTimeout: defaultShutdownTimeout,
 	}
+	b.config.Store(d.Config)
+	return b
 }
 
 // RegisterModule wires a Module's commands, listeners, and background tasks into the Bot.
+// Modules that declare commands must implement CommandProvider.
 func (b *Bot) RegisterModule(m Module) error {
-	if err := b.Router.register(m, b.deps); err != nil {
+	cmds := m.Commands()
+	var handlers map[string]HandlerFunc
+	if p, ok := m.(CommandProvider); ok {
+		handlers = p.CommandHandlers()
+	}
+	for _, cmd := range cmds {
+		if handlers[cmd.Name] == nil {
+			return fmt.Errorf("bot: module %s has no handler for command %q", m.Name(), cmd.Name)
+		}
+	}
+
+	gate := b.guildGate(m.Name())
+	if err := b.Router.register(m, b.deps, gate); err != nil {
 		return err
 	}
+	componentMW, commandMW := []Middleware{Recover()}, b.middleware
+	if gate != nil {
+		componentMW = append(componentMW, GuildEnabled(gate))
+		commandMW = append(append([]Middleware{}, b.middleware...), GuildEnabled(gate))
+	}
 	for _, comp := range m.Components() {
-		b.Router.AddComponent(comp.Prefix, comp.Handler)
+		b.Router.AddComponent(comp.Prefix, applyMiddleware(comp.Handler, componentMW))
 	}
-	for _, cmd := range m.Commands() {
-		b.Router.AddCommand(cmd.Name, nil)
+	for _, cmd := range cmds {
+		b.Router.AddCommand(cmd.Name, handlers[cmd.Name], commandMW...)
 	}
+	b.commands = append(b.commands, cmds...)
 	b.modules = append(b.modules, m)
 	return nil
 }
 
+// guildGate reports per guild whether the named module is enabled in
+// modules: of the config. It returns nil when no config is loaded.
+func (b *Bot) guildGate(name string) func(guildID string) bool {
+	if b.config.Load() == nil {
+		return nil
+	}
+	return func(guildID string) bool { return b.config.Load().Modules.EnabledIn(name, guildID) }
+}
+
+// applyMiddleware wraps h so that mw[0] runs first.
+func applyMiddleware(h HandlerFunc, mw []Middleware) HandlerFunc {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// AddCommand registers a slash command that does not belong to a Module.
+// The default middleware runs before mw.
+func (b *Bot) AddCommand(cmd *discordgo.ApplicationCommand, h HandlerFunc, mw ...Middleware) {
+	chain := append(append([]Middleware{}, b.middleware...), mw...)
+	b.Router.AddCommand(cmd.Name, h, chain...)
+	b.commands = append(b.commands, cmd)
+}
+
+// AddAutocomplete registers the autocomplete handler of a slash command.
+// Panics in h are recovered like in command handlers.
+func (b *Bot) AddAutocomplete(name string, h HandlerFunc) {
+	b.Router.AddAutocomplete(name, Recover()(h))
+}
+
+// Commands returns every registered slash command definition in registration order.
+func (b *Bot) Commands() []*discordgo.ApplicationCommand {
+	return b.commands
+}
+
+// AdminProviders returns the registered modules that expose an /admin subcommand group.
+func (b *Bot) AdminProviders() []AdminProvider {
+	var providers []AdminProvider
+	for _, m := range b.modules {
+		if p, ok := m.(AdminProvider); ok {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// Config returns the active config. It changes after a successful Reload.
+func (b *Bot) Config() *cfg.Config {
+	return b.config.Load()
+}
+
+// ReloadReport describes what a Reload changed.
+type ReloadReport struct {
+	cfg.Diff
+	// Errors holds one entry per module whose Reconfigure failed.
+	Errors []error
+}
+
+// Reload swaps in next, keeping restart-only fields at their current values,
+// and pushes the result to every Reconfigurable module.
+func (b *Bot) Reload(next *cfg.Config) ReloadReport {
+	b.reloadMu.Lock()
+	defer b.reloadMu.Unlock()
+
+	cur := b.config.Load()
+	if cur == nil {
+		cur = &cfg.Config{}
+	}
+	merged, diff := cfg.MergeLive(cur, next)
+	report := ReloadReport{Diff: diff}
+	if len(diff.Live) == 0 {
+		return report
+	}
+	b.config.Store(merged)
+	for _, m := range b.modules {
+		r, ok := m.(Reconfigurable)
+		if !ok {
+			continue
+		}
+		if err := r.Reconfigure(merged); err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("%s: %w", m.Name(), err))
+		}
+	}
+	slog.Info("bot: config reloaded", "live", diff.Live, "restart_required", diff.Restart, "errors", len(report.Errors))
+	return report
+}
+
 // Run registers the router on the Discord session and blocks until ctx is cancelled.
 func (b *Bot) Run(ctx context.Context) error {
 	ctx, b.cancel = context.WithCancel(ctx)
@@ -56,16 +188,34 @@ func (b *Bot) Run(ctx context.Context) error {
 	return nil
 }
 
-// Shutdown cancels the context, waits for background tasks, and shuts down modules.
+// Shutdown tears the bot down in order: background tasks are stopped and awaited,
+// the Discord session is closed so no new events arrive, and finally modules are
+// shut down in reverse registration order. It gives up after the shutdown timeout.
 func (b *Bot) Shutdown() {
-	if b.cancel != nil {
-		b.cancel()
-	}
-	b.background.Wait()
-	for _, m := range b.modules {
-		if err := m.Shutdown(); err != nil {
-			slog.Error("bot: module shutdown error", "module", m.Name(), "error", err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if b.cancel != nil {
+			b.cancel()
+		}
+		b.background.Wait()
+		if b.deps.Session != nil {
+			if err := b.deps.Session.Close(); err != nil {
+				slog.Error("bot: error closing discord session", "error", err)
+			}
 		}
+		for i := len(b.modules) - 1; i >= 0; i-- {
+			m := b.modules[i]
+			if err := m.Shutdown(); err != nil {
+				slog.Error("bot: module shutdown error", "module", m.Name(), "error", err)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+		slog.Info("bot: shutdown complete")
+	case <-time.After(b.shutdownTimeout):
+		slog.Warn("bot: shutdown timed out, forcing exit", "timeout", b.shutdownTimeout)
 	}
-	slog.Info("bot: shutdown complete")
 }
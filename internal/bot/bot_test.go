@@ -2,9 +2,12 @@ package bot
 
 import (
 	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/cfg"
 )
 
 // stubModule is a minimal Module implementation for testing.
@@ -13,7 +16,7 @@ type stubModule struct {
 	initErr error
 }
 
-func (s *stubModule) Name() string                               { return s.name }
+func (s *stubModule) Name() string                              { return s.name }
 func (s *stubModule) Init(_ Deps) error                         { return s.initErr }
 func (s *stubModule) Commands() []*discordgo.ApplicationCommand { return nil }
 func (s *stubModule) Listeners() []EventListener                { return nil }
@@ -21,6 +24,53 @@ func (s *stubModule) Components() []ComponentHandler            { return nil }
 func (s *stubModule) Background() []BackgroundTask              { return nil }
 func (s *stubModule) Shutdown() error                           { return nil }
 
+// commandModule is a stubModule that declares a slash command, a component and a message listener.
+type commandModule struct {
+	stubModule
+	handler   HandlerFunc
+	component func(*discordgo.Session, *discordgo.InteractionCreate)
+	onMessage func(*discordgo.Session, *discordgo.MessageCreate)
+	inited    bool
+	shutdown  func()
+}
+
+func (c *commandModule) Init(_ Deps) error {
+	c.inited = true
+	return nil
+}
+
+func (c *commandModule) Commands() []*discordgo.ApplicationCommand {
+	return []*discordgo.ApplicationCommand{{Name: c.name}}
+}
+
+func (c *commandModule) CommandHandlers() map[string]HandlerFunc {
+	if c.handler == nil {
+		return nil
+	}
+	return map[string]HandlerFunc{c.name: c.handler}
+}
+
+func (c *commandModule) Listeners() []EventListener {
+	if c.onMessage == nil {
+		return nil
+	}
+	return []EventListener{c.onMessage}
+}
+
+func (c *commandModule) Components() []ComponentHandler {
+	if c.component == nil {
+		return nil
+	}
+	return []ComponentHandler{{Prefix: c.name + "_", Handler: c.component}}
+}
+
+func (c *commandModule) Shutdown() error {
+	if c.shutdown != nil {
+		c.shutdown()
+	}
+	return nil
+}
+
 func TestBot_RegisterModule_Success(t *testing.T) {
 	b := New(Deps{})
 	if err := b.RegisterModule(&stubModule{name: "ok"}); err != nil {
@@ -43,3 +93,311 @@ func TestBot_RegisterModule_InitErrorDoesNotAddModule(t *testing.T) {
 		t.Fatalf("failed module should not be appended, got %d modules", len(b.modules))
 	}
 }
+
+func TestBot_RegisterModule_MissingHandler(t *testing.T) {
+	b := New(Deps{})
+	m := &commandModule{stubModule: stubModule{name: "nohandler"}}
+	if err := b.RegisterModule(m); err == nil {
+		t.Fatal("expected error for command without handler")
+	}
+	if m.inited {
+		t.Fatal("module should not be initialised when a handler is missing")
+	}
+	if len(b.Commands()) != 0 {
+		t.Fatalf("Commands() len = %d, want 0", len(b.Commands()))
+	}
+}
+
+func TestBot_RegisterModule_RoutesCommand(t *testing.T) {
+	b := New(Deps{})
+	var called atomic.Bool
+	m := &commandModule{
+		stubModule: stubModule{name: "ping"},
+		handler:    func(_ *discordgo.Session, _ *discordgo.InteractionCreate) { called.Store(true) },
+	}
+	if err := b.RegisterModule(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b.Router.onInteractionCreate(nil, fakeInteraction("user", "ping"))
+	if !called.Load() {
+		t.Fatal("module command handler not called")
+	}
+	if got := b.Commands(); len(got) != 1 || got[0].Name != "ping" {
+		t.Fatalf("Commands() = %v, want [ping]", got)
+	}
+}
+
+func TestBot_RegisterModule_CommandPanicRecovered(t *testing.T) {
+	b := New(Deps{})
+	m := &commandModule{
+		stubModule: stubModule{name: "boom"},
+		handler:    func(_ *discordgo.Session, _ *discordgo.InteractionCreate) { panic("boom") },
+	}
+	if err := b.RegisterModule(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b.Router.onInteractionCreate(nil, fakeInteraction("user", "boom"))
+}
+
+func TestBot_RegisterModule_CommandRateLimited(t *testing.T) {
+	captured := captureRespond(t)
+	b := New(Deps{})
+	var calls atomic.Int32
+	m := &commandModule{
+		stubModule: stubModule{name: "ping"},
+		handler:    func(_ *discordgo.Session, _ *discordgo.InteractionCreate) { calls.Add(1) },
+	}
+	if err := b.RegisterModule(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b.Router.onInteractionCreate(nil, fakeInteraction("user", "ping"))
+	b.Router.onInteractionCreate(nil, fakeInteraction("user", "ping"))
+	if calls.Load() != 1 {
+		t.Fatalf("handler called %d times, want 1", calls.Load())
+	}
+	if len(*captured) != 1 {
+		t.Fatalf("expected 1 rate-limit denial, got %d", len(*captured))
+	}
+}
+
+func TestBot_AddCommand_SubcommandsRateLimitedApart(t *testing.T) {
+	captured := captureRespond(t)
+	b := New(Deps{})
+	var calls []string
+	b.AddCommand(&discordgo.ApplicationCommand{Name: "sound"}, func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+		calls = append(calls, i.ApplicationCommandData().Options[0].Name)
+	})
+	sub := func(name string) *discordgo.InteractionCreate {
+		i := fakeInteraction("user", "sound")
+		i.Data = discordgo.ApplicationCommandInteractionData{Name: "sound", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: name, Type: discordgo.ApplicationCommandOptionSubCommand},
+		}}
+		return i
+	}
+
+	for _, name := range []string{"play", "skip", "stop", "play"} {
+		b.Router.onInteractionCreate(nil, sub(name))
+	}
+	if len(calls) != 3 || calls[0] != "play" || calls[1] != "skip" || calls[2] != "stop" {
+		t.Errorf("handled %v, want play, skip and stop", calls)
+	}
+	if len(*captured) != 1 {
+		t.Errorf("expected the second play to be rate limited, got %d denials", len(*captured))
+	}
+}
+
+func TestBot_RegisterModule_RoutesComponentsAndMessages(t *testing.T) {
+	b := New(Deps{})
+	var compCalled atomic.Bool
+	msgCalled := make(chan struct{})
+	m := &commandModule{
+		stubModule: stubModule{name: "coffee"},
+		handler:    func(_ *discordgo.Session, _ *discordgo.InteractionCreate) {},
+		component:  func(_ *discordgo.Session, _ *discordgo.InteractionCreate) { compCalled.Store(true) },
+		onMessage:  func(_ *discordgo.Session, _ *discordgo.MessageCreate) { close(msgCalled) },
+	}
+	if err := b.RegisterModule(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b.Router.onInteractionCreate(nil, componentInteraction("coffee_take"))
+	if !compCalled.Load() {
+		t.Fatal("component handler not called")
+	}
+
+	b.Router.onMessageCreate(nil, &discordgo.MessageCreate{Message: &discordgo.Message{}})
+	select {
+	case <-msgCalled:
+	case <-time.After(time.Second):
+		t.Fatal("message listener not dispatched by the router")
+	}
+}
+
+func TestBot_RegisterModule_DisabledGuild(t *testing.T) {
+	captured := captureRespond(t)
+	conf := &cfg.Config{}
+	conf.Modules.Coffee.DisabledGuilds = []string{"guild-off"}
+	b := New(Deps{Config: conf})
+	var cmdCalls, compCalls, msgCalls atomic.Int32
+	m := &commandModule{
+		stubModule: stubModule{name: "coffee"},
+		handler:    func(_ *discordgo.Session, _ *discordgo.InteractionCreate) { cmdCalls.Add(1) },
+		component:  func(_ *discordgo.Session, _ *discordgo.InteractionCreate) { compCalls.Add(1) },
+		onMessage:  func(_ *discordgo.Session, _ *discordgo.MessageCreate) { msgCalls.Add(1) },
+	}
+	if err := b.RegisterModule(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cmd := fakeInteraction("user", "coffee")
+	cmd.GuildID = "guild-off"
+	b.Router.onInteractionCreate(nil, cmd)
+	comp := componentInteraction("coffee_take")
+	comp.GuildID = "guild-off"
+	b.Router.onInteractionCreate(nil, comp)
+	b.Router.onMessageCreate(nil, &discordgo.MessageCreate{Message: &discordgo.Message{GuildID: "guild-off"}})
+	time.Sleep(50 * time.Millisecond)
+
+	if cmdCalls.Load() != 0 || compCalls.Load() != 0 || msgCalls.Load() != 0 {
+		t.Fatalf("disabled guild reached handlers: cmd=%d comp=%d msg=%d", cmdCalls.Load(), compCalls.Load(), msgCalls.Load())
+	}
+	if len(*captured) != 2 {
+		t.Fatalf("expected 2 ephemeral denials, got %d", len(*captured))
+	}
+
+	cmd = fakeInteraction("other-user", "coffee")
+	cmd.GuildID = "guild-on"
+	b.Router.onInteractionCreate(nil, cmd)
+	if cmdCalls.Load() != 1 {
+		t.Fatal("command not routed for an enabled guild")
+	}
+}
+
+func TestBot_AddCommand(t *testing.T) {
+	b := New(Deps{})
+	var called atomic.Bool
+	b.AddCommand(&discordgo.ApplicationCommand{Name: "status"},
+		func(_ *discordgo.Session, _ *discordgo.InteractionCreate) { called.Store(true) })
+
+	b.Router.onInteractionCreate(nil, fakeInteraction("user", "status"))
+	if !called.Load() {
+		t.Fatal("handler not called")
+	}
+	if len(b.Commands()) != 1 {
+		t.Fatalf("Commands() len = %d, want 1", len(b.Commands()))
+	}
+}
+
+func TestBot_Shutdown_ReverseOrder(t *testing.T) {
+	b := New(Deps{})
+	var order []string
+	for _, name := range []string{"first", "second", "third"} {
+		m := &commandModule{
+			stubModule: stubModule{name: name},
+			handler:    func(_ *discordgo.Session, _ *discordgo.InteractionCreate) {},
+			shutdown:   func() { order = append(order, name) },
+		}
+		if err := b.RegisterModule(m); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	b.Shutdown()
+	want := []string{"third", "second", "first"}
+	if len(order) != len(want) {
+		t.Fatalf("shutdown order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("shutdown order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestBot_Shutdown_Timeout(t *testing.T) {
+	b := New(Deps{})
+	b.shutdownTimeout = 10 * time.Millisecond
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	m := &commandModule{
+		stubModule: stubModule{name: "slow"},
+		handler:    func(_ *discordgo.Session, _ *discordgo.InteractionCreate) {},
+		shutdown:   func() { <-release },
+	}
+	if err := b.RegisterModule(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	b.Shutdown()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Shutdown blocked for %v despite timeout", elapsed)
+	}
+}
+
+func TestBot_AdminProviders(t *testing.T) {
+	b := New(Deps{})
+	if err := b.RegisterModule(&stubModule{name: "plain"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := b.RegisterModule(&adminModule{stubModule: stubModule{name: "admin"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := b.AdminProviders(); len(got) != 1 {
+		t.Fatalf("AdminProviders() len = %d, want 1", len(got))
+	}
+}
+
+type adminModule struct{ stubModule }
+
+func (adminModule) AdminSubcommandGroup() *discordgo.ApplicationCommandOption { return nil }
+func (adminModule) HandleAdminSubcommand(_ *discordgo.Session, _ *discordgo.InteractionCreate, _ *discordgo.ApplicationCommandInteractionDataOption) {
+}
+
+type reconfigModule struct {
+	stubModule
+	got *cfg.Config
+	err error
+}
+
+func (r *reconfigModule) Reconfigure(c *cfg.Config) error {
+	r.got = c
+	return r.err
+}
+
+func TestBot_Reload(t *testing.T) {
+	conf := &cfg.Config{}
+	conf.Discord.Token = "old-token"
+	b := New(Deps{Config: conf})
+	ok := &reconfigModule{stubModule: stubModule{name: "coffee"}}
+	failing := &reconfigModule{stubModule: stubModule{name: "wttrin"}, err: errors.New("boom")}
+	for _, m := range []Module{ok, failing, &stubModule{name: "plain"}} {
+		if err := b.RegisterModule(m); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	next := &cfg.Config{}
+	next.Discord.Token = "new-token"
+	next.Modules.Coffee.DisabledGuilds = []string{"guild-off"}
+	report := b.Reload(next)
+
+	if len(report.Live) != 1 || report.Live[0] != "modules.coffee.disabled_guilds" {
+		t.Errorf("Live = %v, want [modules.coffee.disabled_guilds]", report.Live)
+	}
+	if len(report.Restart) != 1 || report.Restart[0] != "discord.token" {
+		t.Errorf("Restart = %v, want [discord.token]", report.Restart)
+	}
+	if len(report.Errors) != 1 {
+		t.Errorf("Errors = %v, want one entry for wttrin", report.Errors)
+	}
+	if ok.got == nil || ok.got != b.Config() {
+		t.Fatal("Reconfigure not called with the active config")
+	}
+	if got := b.Config().Discord.Token; got != "old-token" {
+		t.Errorf("Discord.Token = %q, restart-only field must keep its value", got)
+	}
+	if b.guildGate("coffee")("guild-off") {
+		t.Error("guild gate should see the reloaded disabled_guilds")
+	}
+}
+
+func TestBot_Reload_NoChanges(t *testing.T) {
+	conf := &cfg.Config{}
+	b := New(Deps{Config: conf})
+	m := &reconfigModule{stubModule: stubModule{name: "coffee"}}
+	if err := b.RegisterModule(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report := b.Reload(&cfg.Config{}); report.Changed() {
+		t.Errorf("unexpected changes: %+v", report.Diff)
+	}
+	if m.got != nil {
+		t.Error("Reconfigure should not run when nothing changed")
+	}
+	if b.Config() != conf {
+		t.Error("active config should not be replaced when nothing changed")
+	}
+}
@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"context"
 	"log/slog"
 
 	"github.com/bwmarrin/discordgo"
@@ -15,4 +16,13 @@ type Deps struct {
 	LLM     *openai.Client
 	Logger  *slog.Logger
 	OwnerID string
+	// Speaker queues speech through the soundboard. It is set even while
+	// text to speech is off, as a config reload may turn it on, and then
+	// fails to speak; it is nil only where no soundboard is wired up.
+	Speaker Speaker
+}
+
+// Speaker speaks text in the voice channel a guild member is in.
+type Speaker interface {
+	Speak(ctx context.Context, guildID, userID, text string) error
 }
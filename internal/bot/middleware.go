@@ -53,7 +53,39 @@ func OwnerOnly(ownerID string) Middleware {
 	}
 }
 
-// RateLimit rejects interactions that arrive faster than d per user per command.
+// GuildEnabled rejects interactions from guilds in which enabled reports false.
+func GuildEnabled(enabled func(guildID string) bool) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+			if !enabled(i.GuildID) {
+				denyEphemeral(s, i, "This feature is disabled on this server.")
+				return
+			}
+			next(s, i)
+		}
+	}
+}
+
+// commandPath returns the name of the command of i followed by its
+// subcommand group and subcommand, e.g. "sound skip".
+func commandPath(i *discordgo.InteractionCreate) string {
+	data := i.ApplicationCommandData()
+	path := data.Name
+	opts := data.Options
+	for len(opts) > 0 {
+		opt := opts[0]
+		if opt.Type != discordgo.ApplicationCommandOptionSubCommandGroup && opt.Type != discordgo.ApplicationCommandOptionSubCommand {
+			break
+		}
+		path += " " + opt.Name
+		opts = opt.Options
+	}
+	return path
+}
+
+// RateLimit rejects interactions that arrive faster than d per user per
+// command. Each subcommand is limited on its own, so that e.g. /sound skip
+// right after /sound play goes through.
 func RateLimit(d time.Duration) Middleware {
 	type bucket struct {
 		mu   sync.Mutex
@@ -68,7 +100,7 @@ func RateLimit(d time.Duration) Middleware {
 				next(s, i)
 				return
 			}
-			key := interactionUserID(i) + ":" + i.ApplicationCommandData().Name
+			key := interactionUserID(i) + ":" + commandPath(i)
 
 			mu.Lock()
 			b, ok := buckets[key]
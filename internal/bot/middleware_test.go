@@ -146,6 +146,32 @@ func TestRateLimit_DifferentUsersIndependent(t *testing.T) {
 
 // --- Recover ---
 
+// --- GuildEnabled ---
+
+func TestGuildEnabled(t *testing.T) {
+	captured := captureRespond(t)
+	var calls atomic.Int32
+	h := applyChain(func(_ *discordgo.Session, _ *discordgo.InteractionCreate) {
+		calls.Add(1)
+	}, GuildEnabled(func(guildID string) bool { return guildID != "off" }))
+
+	i := fakeInteraction("user", "cmd")
+	i.GuildID = "off"
+	h(nil, i)
+	if calls.Load() != 0 || len(*captured) != 1 {
+		t.Fatalf("disabled guild: calls=%d denials=%d, want 0/1", calls.Load(), len(*captured))
+	}
+	if (*captured)[0].Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Error("denial should be ephemeral")
+	}
+
+	i.GuildID = "on"
+	h(nil, i)
+	if calls.Load() != 1 {
+		t.Fatal("enabled guild should pass")
+	}
+}
+
 func TestRecover_CatchesPanic(t *testing.T) {
 	h := applyChain(func(_ *discordgo.Session, _ *discordgo.InteractionCreate) {
 		panic("test panic")
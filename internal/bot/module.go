@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/cfg"
 )
 
 // EventListener is a Discord event listener compatible with discordgo.AddHandler.
@@ -37,3 +38,16 @@ type AdminProvider interface {
 	AdminSubcommandGroup() *discordgo.ApplicationCommandOption
 	HandleAdminSubcommand(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption)
 }
+
+// CommandProvider allows a Module to route its slash commands through the Router.
+// Every command returned by Commands must have a handler under the same name.
+type CommandProvider interface {
+	CommandHandlers() map[string]HandlerFunc
+}
+
+// Reconfigurable allows a Module to pick up config changes without a restart.
+// Reconfigure receives the merged config after a reload; fields that need a
+// restart still hold their startup values.
+type Reconfigurable interface {
+	Reconfigure(c *cfg.Config) error
+}
@@ -3,6 +3,7 @@ package bot
 import (
 	"log/slog"
 	"strings"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -13,72 +14,156 @@ type commandEntry struct {
 	middleware []Middleware
 }
 
+// MessageHandler is the type for MessageCreate listeners dispatched by the Router.
+type MessageHandler func(*discordgo.Session, *discordgo.MessageCreate)
+
 // Router dispatches Discord interactions and messages to registered Module handlers.
-// It is a no-op until modules migrate.
 type Router struct {
-	deps       Deps
-	commands   map[string]commandEntry
-	components map[string]func(*discordgo.Session, *discordgo.InteractionCreate)
+	deps          Deps
+	mu            sync.RWMutex
+	commands      map[string]commandEntry
+	autocompletes map[string]HandlerFunc
+	components    map[string]func(*discordgo.Session, *discordgo.InteractionCreate)
+	messages      []MessageHandler
 }
 
 func newRouter(d Deps) *Router {
 	return &Router{
-		deps:       d,
-		commands:   make(map[string]commandEntry),
-		components: make(map[string]func(*discordgo.Session, *discordgo.InteractionCreate)),
+		deps:          d,
+		commands:      make(map[string]commandEntry),
+		autocompletes: make(map[string]HandlerFunc),
+		components:    make(map[string]func(*discordgo.Session, *discordgo.InteractionCreate)),
 	}
 }
 
-// register wires a Module's listeners into the session.
+// register initialises a Module and wires its listeners.
+// MessageCreate listeners are dispatched by the Router; all others go straight to the session.
+// When enabled is non-nil, message listeners skip events from guilds it rejects.
 // Command and component dispatch wiring happens via AddCommand / AddComponent.
-func (r *Router) register(m Module, d Deps) error {
+func (r *Router) register(m Module, d Deps, enabled func(guildID string) bool) error {
 	if err := m.Init(d); err != nil {
 		return err
 	}
 	for _, l := range m.Listeners() {
-		d.Session.AddHandler(l)
+		switch h := l.(type) {
+		case func(*discordgo.Session, *discordgo.MessageCreate):
+			r.AddMessageHandler(gateMessages(h, enabled))
+		case MessageHandler:
+			r.AddMessageHandler(gateMessages(h, enabled))
+		case func(*discordgo.Session, *discordgo.MessageUpdate):
+			if enabled != nil {
+				d.Session.AddHandler(func(s *discordgo.Session, mu *discordgo.MessageUpdate) {
+					if enabled(mu.GuildID) {
+						h(s, mu)
+					}
+				})
+				continue
+			}
+			d.Session.AddHandler(h)
+		default:
+			d.Session.AddHandler(l)
+		}
 	}
 	slog.Info("bot/router: module registered", "module", m.Name())
 	return nil
 }
 
+// gateMessages wraps h so it only sees messages from guilds enabled accepts.
+func gateMessages(h MessageHandler, enabled func(guildID string) bool) MessageHandler {
+	if enabled == nil {
+		return h
+	}
+	return func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		if enabled(m.GuildID) {
+			h(s, m)
+		}
+	}
+}
+
 // AddCommand registers a slash-command handler with optional middleware.
 func (r *Router) AddCommand(name string, h HandlerFunc, mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.commands[name] = commandEntry{handler: h, middleware: mw}
 	slog.Debug("bot/router: command registered", "name", name)
 }
 
+// AddAutocomplete registers the handler that answers autocomplete requests
+// for the options of the named slash command.
+func (r *Router) AddAutocomplete(name string, h HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.autocompletes[name] = h
+	slog.Debug("bot/router: autocomplete registered", "name", name)
+}
+
 // AddComponent registers a component handler matched by custom-ID prefix.
 func (r *Router) AddComponent(prefix string, h func(*discordgo.Session, *discordgo.InteractionCreate)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.components[prefix] = h
 	slog.Debug("bot/router: component registered", "prefix", prefix)
 }
 
+// AddMessageHandler registers a MessageCreate listener.
+// Handlers run concurrently and a panic in one does not affect the others.
+func (r *Router) AddMessageHandler(h MessageHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, h)
+}
+
 func (r *Router) onInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	switch i.Type {
 	case discordgo.InteractionApplicationCommand:
 		name := i.ApplicationCommandData().Name
+		r.mu.RLock()
 		entry, ok := r.commands[name]
-		if !ok {
+		r.mu.RUnlock()
+		if !ok || entry.handler == nil {
 			return
 		}
-		chain := entry.handler
-		for j := len(entry.middleware) - 1; j >= 0; j-- {
-			chain = entry.middleware[j](chain)
+		applyMiddleware(entry.handler, entry.middleware)(s, i)
+
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		name := i.ApplicationCommandData().Name
+		r.mu.RLock()
+		h := r.autocompletes[name]
+		r.mu.RUnlock()
+		if h != nil {
+			h(s, i)
 		}
-		chain(s, i)
 
 	case discordgo.InteractionMessageComponent:
 		customID := i.MessageComponentData().CustomID
-		for prefix, handler := range r.components {
+		r.mu.RLock()
+		var handler func(*discordgo.Session, *discordgo.InteractionCreate)
+		for prefix, h := range r.components {
 			if strings.HasPrefix(customID, prefix) {
-				handler(s, i)
-				return
+				handler = h
+				break
 			}
 		}
+		r.mu.RUnlock()
+		if handler != nil {
+			handler(s, i)
+		}
 	}
 }
 
-func (r *Router) onMessageCreate(_ *discordgo.Session, _ *discordgo.MessageCreate) {
-	// No-op until legacy message handler migration.
+func (r *Router) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+	r.mu.RLock()
+	handlers := r.messages
+	r.mu.RUnlock()
+
+	for _, h := range handlers {
+		go func(h MessageHandler) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					slog.Error("bot/router: message handler panicked", "panic", rec)
+				}
+			}()
+			h(s, m)
+		}(h)
+	}
 }
@@ -3,6 +3,7 @@ package bot
 import (
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -102,11 +103,49 @@ func TestRouter_MiddlewareApplied(t *testing.T) {
 	}
 }
 
-func TestRouter_MessageCreateIsNoop(t *testing.T) {
+func TestRouter_MessageCreateNoHandlers(t *testing.T) {
 	r := makeRouter()
 	r.onMessageCreate(nil, &discordgo.MessageCreate{})
 }
 
+func TestRouter_MessageCreateDispatchesAll(t *testing.T) {
+	r := makeRouter()
+	var calls atomic.Int32
+	done := make(chan struct{}, 2)
+	for range 2 {
+		r.AddMessageHandler(func(_ *discordgo.Session, _ *discordgo.MessageCreate) {
+			calls.Add(1)
+			done <- struct{}{}
+		})
+	}
+
+	r.onMessageCreate(nil, &discordgo.MessageCreate{})
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("message handler not called")
+		}
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("handlers called %d times, want 2", calls.Load())
+	}
+}
+
+func TestRouter_MessageHandlerPanicIsolated(t *testing.T) {
+	r := makeRouter()
+	done := make(chan struct{})
+	r.AddMessageHandler(func(_ *discordgo.Session, _ *discordgo.MessageCreate) { panic("boom") })
+	r.AddMessageHandler(func(_ *discordgo.Session, _ *discordgo.MessageCreate) { close(done) })
+
+	r.onMessageCreate(nil, &discordgo.MessageCreate{})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("healthy handler not called after sibling panic")
+	}
+}
+
 func TestRouter_MultipleCommands(t *testing.T) {
 	r := makeRouter()
 	var pingCalled, pongCalled atomic.Bool
@@ -123,3 +162,24 @@ func TestRouter_MultipleCommands(t *testing.T) {
 		t.Fatal("pong handler not called")
 	}
 }
+
+func TestRouter_DispatchesAutocomplete(t *testing.T) {
+	r := makeRouter()
+	var commandCalled, autocompleteCalled atomic.Bool
+	r.AddCommand("sound", func(_ *discordgo.Session, _ *discordgo.InteractionCreate) { commandCalled.Store(true) })
+	r.AddAutocomplete("sound", func(_ *discordgo.Session, _ *discordgo.InteractionCreate) { autocompleteCalled.Store(true) })
+
+	i := slashInteraction("sound")
+	i.Type = discordgo.InteractionApplicationCommandAutocomplete
+	r.onInteractionCreate(nil, i)
+	if !autocompleteCalled.Load() {
+		t.Fatal("autocomplete handler not called")
+	}
+	if commandCalled.Load() {
+		t.Fatal("autocomplete must not run the command handler")
+	}
+
+	unknown := slashInteraction("other")
+	unknown.Type = discordgo.InteractionApplicationCommandAutocomplete
+	r.onInteractionCreate(nil, unknown) // must not panic
+}
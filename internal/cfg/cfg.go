@@ -3,10 +3,7 @@ package cfg
 import (
 	"errors"
 	"io"
-	"log/slog"
-	"os"
-
-	"gopkg.in/yaml.v3"
+	"reflect"
 )
 
 // Config struct with all parameters
@@ -25,6 +22,14 @@ type Config struct {
 		} `yaml:"oauth"`
 		SessionSecret string `yaml:"session_secret"`
 		Port          int    `yaml:"port,omitempty" default:"8080"`
+		// RateLimit caps the requests per minute to the web UI and /api/*,
+		// per anonymized client address and per logged-in user or token. A
+		// negative value turns the limit off.
+		RateLimit struct {
+			IP      int `yaml:"ip,omitempty" default:"600"`
+			Session int `yaml:"session,omitempty" default:"120"`
+		} `yaml:"rate_limit,omitempty"`
+		Sessions WebSessions `yaml:"sessions,omitempty"`
 	} `yaml:"web"`
 	Database struct {
 		Path string `yaml:"path,omitempty"`
@@ -47,50 +52,58 @@ type Config struct {
 		// Used only when Personality is empty. Unknown values fall back to the default.
 		Preset string `yaml:"personality_preset,omitempty"`
 	} `yaml:"llm,omitempty"`
-	DevMode bool `yaml:"dev_mode,omitempty" default:"false"`
+	Modules    Modules          `yaml:"modules,omitempty"`
+	Soundboard SoundboardConfig `yaml:"soundboard,omitempty"`
+	TTS        TTSConfig        `yaml:"tts,omitempty"`
+	DevMode    bool             `yaml:"dev_mode,omitempty" default:"false"`
 }
 
-var initializedConfig *Config
-
-// GetConfig returns the config struct
-func GetConfig() *Config {
-	if initializedConfig == nil {
-		initializedConfig = loadFile()
+// decodeConfig decodes YAML from r into a Config, validates it and applies
+// default tags.
+func decodeConfig(r io.Reader) (*Config, error) {
+	var cfg Config
+	if err := decodeInto(&cfg, r); err != nil {
+		return nil, err
 	}
-	return initializedConfig
-}
-
-func loadFile() *Config {
-	configFile, err := os.Open("config.yaml")
-	if err != nil {
-		slog.Error("Could not load config file.", "error", err)
-		os.Exit(1)
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
-	defer func() { _ = configFile.Close() }()
+	applyDefaults(reflect.ValueOf(&cfg).Elem())
+	return &cfg, nil
+}
 
-	cfg, err := decodeConfig(configFile)
-	if err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
-	}
-	initializedConfig = cfg
-	return initializedConfig
+// WebServerEnabled reports whether the web server starts: OAuth is fully set
+// up and web.port is not negative. An omitted port defaults to 8080, so this
+// holds before and after defaults are applied.
+func (c *Config) WebServerEnabled() bool {
+	o := c.Web.Oauth
+	return c.Web.Port >= 0 && o.ClientID != "" && o.ClientSecret != "" && o.RedirectURI != ""
 }
 
-// decodeConfig decodes YAML from r into a Config and validates required fields.
-func decodeConfig(r io.Reader) (*Config, error) {
-	var cfg Config
-	if err := yaml.NewDecoder(r).Decode(&cfg); err != nil {
-		return nil, errors.New("could not decode config: " + err.Error())
+// validate checks required fields and reports every problem at once. It runs
+// before defaults are applied so that explicitly set values can be told apart.
+func (c *Config) validate() error {
+	var errs []error
+	if c.Discord.Token == "" {
+		errs = append(errs, errors.New("discord.token is required but not set"))
 	}
-	if cfg.Discord.Token == "" {
-		return nil, errors.New("discord.token is required but not set in config.yaml")
+	if (c.Web.Port > 0 || c.WebServerEnabled()) && c.Web.SessionSecret == "" {
+		errs = append(errs, errors.New("web.session_secret is required when web.port or web.oauth is set"))
 	}
-	if cfg.Web.Port != 0 && cfg.Web.SessionSecret == "" {
-		return nil, errors.New("web.session_secret is required when web.port is set")
+	if len(c.Gippity.AllowedGuilds) == 0 {
+		errs = append(errs, errors.New("gippity.allowed_guilds is required and cannot be empty"))
 	}
-	if len(cfg.Gippity.AllowedGuilds) == 0 {
-		return nil, errors.New("gippity.allowed_guilds is required and cannot be empty")
+	if err := c.Modules.validate(); err != nil {
+		errs = append(errs, err)
 	}
-	return &cfg, nil
+	if err := c.Soundboard.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.TTS.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Web.Sessions.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
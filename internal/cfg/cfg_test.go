@@ -3,6 +3,7 @@ package cfg
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestDecodeConfig_validConfig(t *testing.T) {
@@ -176,6 +177,49 @@ gippity:
 	}
 }
 
+func TestDecodeConfig_webOAuthPortOmittedMissingSessionSecret(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+web:
+  oauth:
+    client_id: "cid"
+    client_secret: "csec"
+    redirect_uri: "http://localhost/callback"
+gippity:
+  allowed_guilds: ["456"]
+`
+	_, err := decodeConfig(strings.NewReader(yaml))
+	if err == nil {
+		t.Fatal("expected error for missing session_secret when OAuth is set and web.port defaults, got nil")
+	}
+	if !strings.Contains(err.Error(), "session_secret") {
+		t.Errorf("error should mention session_secret, got: %v", err)
+	}
+}
+
+func TestDecodeConfig_webNegativePortNoSessionSecretRequired(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+web:
+  port: -1
+  oauth:
+    client_id: "cid"
+    client_secret: "csec"
+    redirect_uri: "http://localhost/callback"
+gippity:
+  allowed_guilds: ["456"]
+`
+	cfg, err := decodeConfig(strings.NewReader(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error when web server is turned off: %v", err)
+	}
+	if cfg.WebServerEnabled() {
+		t.Error("web server enabled with a negative port")
+	}
+}
+
 func TestDecodeConfig_webDisabledNoSessionSecretRequired(t *testing.T) {
 	yaml := `
 discord:
@@ -207,6 +251,35 @@ gippity:
 	}
 }
 
+func TestDecodeConfig_unknownKeys(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+  ownerid: "123"
+web:
+  sesion_secret: "typo"
+dev_mod: true
+gippity:
+  allowed_guilds: ["456"]
+modules:
+  teapot: {}
+`
+	_, err := decodeConfig(strings.NewReader(yaml))
+	if err == nil {
+		t.Fatal("expected unknown key errors, got nil")
+	}
+	for _, want := range []string{
+		`discord: unknown key "ownerid" (line 4)`,
+		`web: unknown key "sesion_secret" (line 6)`,
+		`top level: unknown key "dev_mod" (line 7)`,
+		`modules: unknown key "teapot" (line 11)`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q, got:\n%v", want, err)
+		}
+	}
+}
+
 func TestDecodeConfig_missingGippityAllowedGuilds(t *testing.T) {
 	yaml := `
 discord:
@@ -220,3 +293,338 @@ discord:
 		t.Errorf("error should mention gippity.allowed_guilds, got: %v", err)
 	}
 }
+
+func TestDecodeConfig_modules(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+modules:
+  coffee:
+    disabled_guilds: ["789"]
+    water_ml: 3000
+  leetoclock:
+    time: "04:20"
+    channels: ["111", "222"]
+  wttrin:
+    default_location: "Hamburg"
+  stoll:
+    enabled: false
+`
+	cfg, err := decodeConfig(strings.NewReader(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Modules.Coffee.WaterMl != 3000 {
+		t.Errorf("modules.coffee.water_ml = %d, want 3000", cfg.Modules.Coffee.WaterMl)
+	}
+	if !cfg.Modules.Enabled("coffee") || cfg.Modules.EnabledIn("coffee", "789") || !cfg.Modules.EnabledIn("coffee", "456") {
+		t.Error("coffee should be enabled everywhere except guild 789")
+	}
+	if cfg.Modules.Enabled("stoll") || cfg.Modules.EnabledIn("stoll", "456") {
+		t.Error("stoll should be disabled")
+	}
+	if !cfg.Modules.Enabled("eso") || !cfg.Modules.Enabled("unknown") {
+		t.Error("modules without a block should default to enabled")
+	}
+	if h, m, ok := cfg.Modules.Leetoclock.Clock(); !ok || h != 4 || m != 20 {
+		t.Errorf("leetoclock clock = %d:%d (%v), want 4:20", h, m, ok)
+	}
+	if len(cfg.Modules.Leetoclock.Channels) != 2 {
+		t.Errorf("leetoclock channels = %v, want 2 entries", cfg.Modules.Leetoclock.Channels)
+	}
+	if cfg.Modules.Wttrin.DefaultLocation != "Hamburg" {
+		t.Errorf("wttrin default_location = %q, want Hamburg", cfg.Modules.Wttrin.DefaultLocation)
+	}
+}
+
+func TestDecodeConfig_modulesUnknownKeys(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+modules:
+  coffee:
+    water_litres: 2
+  teapot:
+    enabled: true
+`
+	_, err := decodeConfig(strings.NewReader(yaml))
+	if err == nil {
+		t.Fatal("expected error for unknown module keys, got nil")
+	}
+	for _, want := range []string{`modules.coffee: unknown key "water_litres" (line 8)`, `modules: unknown key "teapot" (line 9)`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should contain %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestDecodeConfig_modulesValidation(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+modules:
+  coffee:
+    milk_ml: -1
+  leetoclock:
+    time: "25:00"
+    channels: [""]
+`
+	_, err := decodeConfig(strings.NewReader(yaml))
+	if err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+	for _, want := range []string{"modules.coffee.milk_ml", "modules.leetoclock.time", "modules.leetoclock.channels[0]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestDecodeConfig_soundboard(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+soundboard:
+  cooldown: 10s
+  daily_cap: 100
+  guilds:
+    "456":
+      cooldown: 1m
+      daily_cap: 0
+      allowed_roles: ["dj"]
+      denied_roles: ["muted"]
+      entrances: true
+      entrance_cooldown: 1h
+      clips: true
+  collections:
+    nsfw:
+      channels: ["voice-late"]
+  normalize:
+    command: ["loudnorm.sh"]
+    target: -18
+`
+	cfg, err := decodeConfig(strings.NewReader(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sb := cfg.Soundboard
+	if sb.CooldownIn("456") != time.Minute || sb.CooldownIn("789") != 10*time.Second {
+		t.Errorf("cooldowns = %v / %v, want 1m for 456 and 10s elsewhere", sb.CooldownIn("456"), sb.CooldownIn("789"))
+	}
+	if sb.DailyCapIn("456") != 0 || sb.DailyCapIn("789") != 100 {
+		t.Errorf("daily caps = %d / %d, want 0 for 456 and 100 elsewhere", sb.DailyCapIn("456"), sb.DailyCapIn("789"))
+	}
+	if !sb.HasRoleRules("456") || sb.HasRoleRules("789") {
+		t.Error("only guild 456 should have role rules")
+	}
+	for _, c := range []struct {
+		roles []string
+		want  bool
+	}{
+		{[]string{"dj"}, true},
+		{[]string{"other"}, false},
+		{[]string{"dj", "muted"}, false},
+		{nil, false},
+	} {
+		if got := sb.RolesAllowed("456", c.roles); got != c.want {
+			t.Errorf("RolesAllowed(456, %v) = %v, want %v", c.roles, got, c.want)
+		}
+	}
+	if !sb.RolesAllowed("789", nil) {
+		t.Error("guilds without role rules should allow everyone")
+	}
+	if !sb.EntrancesIn("456") || sb.EntrancesIn("789") {
+		t.Error("entrances should only play in guild 456")
+	}
+	if sb.EntranceCooldownIn("456") != time.Hour || sb.EntranceCooldownIn("789") != 10*time.Minute {
+		t.Errorf("entrance cooldowns = %v / %v, want 1h for 456 and the 10m default elsewhere", sb.EntranceCooldownIn("456"), sb.EntranceCooldownIn("789"))
+	}
+	if sb.MaxUploadSize != 2<<20 || sb.UploadLength() != 30*time.Second {
+		t.Errorf("upload limits = %d bytes / %v, want the 2 MiB and 30s defaults", sb.MaxUploadSize, sb.UploadLength())
+	}
+	if !sb.ClipsIn("456") || sb.ClipsIn("789") || sb.ClipWindow() != 30*time.Second {
+		t.Errorf("clips in 456/789 = %v/%v with window %v, want only 456 keeping the 30s default", sb.ClipsIn("456"), sb.ClipsIn("789"), sb.ClipWindow())
+	}
+	if got := sb.ChannelsFor("nsfw"); len(got) != 1 || got[0] != "voice-late" {
+		t.Errorf("ChannelsFor(nsfw) = %v, want [voice-late]", got)
+	}
+	if sb.ChannelsFor("horn") != nil {
+		t.Error("unrestricted collections should have no channels")
+	}
+	if n := sb.Normalize; !n.Enabled() || n.Target != -18 || n.Tolerance != 2 || n.RunTimeout() != time.Minute {
+		t.Errorf("normalize = %+v, want enabled at -18 LUFS keeping the 2 LU and 60s defaults", n)
+	}
+}
+
+func TestDecodeConfig_soundboardValidation(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+soundboard:
+  cooldown: soon
+  daily_cap: -1
+  clip_length: 1h
+  max_upload_length: forever
+  managers: [""]
+  normalize:
+    target: 5
+    tolerance: -1
+    timeout: 0s
+  guilds:
+    "456":
+      cooldown: -5s
+      entrance_cooldown: often
+      denied_roles: [""]
+  collections:
+    nsfw:
+      channels: [""]
+`
+	_, err := decodeConfig(strings.NewReader(yaml))
+	if err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+	for _, want := range []string{
+		"soundboard.cooldown",
+		"soundboard.daily_cap",
+		"soundboard.clip_length",
+		"soundboard.max_upload_length",
+		"soundboard.managers[0]",
+		"soundboard.normalize.target",
+		"soundboard.normalize.tolerance",
+		"soundboard.normalize.timeout",
+		"soundboard.guilds.456.cooldown",
+		"soundboard.guilds.456.entrance_cooldown",
+		"soundboard.guilds.456.denied_roles[0]",
+		"soundboard.collections.nsfw.channels[0]",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestDecodeConfig_soundboardUnknownKeys(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+soundboard:
+  guilds:
+    "456":
+      allowed_role: ["dj"]
+`
+	_, err := decodeConfig(strings.NewReader(yaml))
+	if err == nil || !strings.Contains(err.Error(), `soundboard.guilds.456: unknown key "allowed_role" (line 9)`) {
+		t.Errorf("expected an unknown key error, got: %v", err)
+	}
+}
+
+func TestDecodeConfig_tts(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+tts:
+  backend: command
+  command: ["espeak-ng", "--stdout"]
+  gippity: true
+`
+	cfg, err := decodeConfig(strings.NewReader(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.TTS.Enabled() || len(cfg.TTS.Command) != 2 || !cfg.TTS.Gippity {
+		t.Errorf("tts = %+v", cfg.TTS)
+	}
+	if cfg.TTS.RunTimeout() != 20*time.Second || cfg.TTS.MaxLength != 300 || cfg.TTS.CacheSize != 64 {
+		t.Errorf("tts defaults = %v, %d, %d; want 20s, 300 and 64", cfg.TTS.RunTimeout(), cfg.TTS.MaxLength, cfg.TTS.CacheSize)
+	}
+}
+
+func TestDecodeConfig_ttsValidation(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+tts:
+  backend: command
+  timeout: 0s
+  max_length: -1
+`
+	_, err := decodeConfig(strings.NewReader(yaml))
+	if err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+	for _, want := range []string{"tts.command", "tts.timeout", "tts.max_length"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %s, got: %v", want, err)
+		}
+	}
+
+	_, err = decodeConfig(strings.NewReader(strings.Replace(yaml, "backend: command", "backend: festival", 1)))
+	if err == nil || !strings.Contains(err.Error(), "tts.backend") {
+		t.Errorf("error should mention tts.backend, got: %v", err)
+	}
+}
+
+func TestDecodeConfig_webSessions(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+web:
+  sessions:
+    store: sqlite
+    idle_timeout: 12h
+`
+	cfg, err := decodeConfig(strings.NewReader(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := cfg.Web.Sessions
+	if !s.ServerSide() || s.Idle() != 12*time.Hour || s.Absolute() != 720*time.Hour {
+		t.Errorf("sessions = %+v", s)
+	}
+
+	cfg, err = decodeConfig(strings.NewReader(minimalConfig))
+	if err != nil || cfg.Web.Sessions.ServerSide() {
+		t.Errorf("default sessions = %+v, %v; want cookies", cfg.Web.Sessions, err)
+	}
+}
+
+func TestDecodeConfig_webSessionsValidation(t *testing.T) {
+	yaml := `
+discord:
+  token: "tok"
+gippity:
+  allowed_guilds: ["456"]
+web:
+  sessions:
+    store: redis
+    idle_timeout: 10s
+    absolute_timeout: forever
+`
+	_, err := decodeConfig(strings.NewReader(yaml))
+	if err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+	for _, want := range []string{"web.sessions.store", "web.sessions.idle_timeout", "web.sessions.absolute_timeout"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %s, got: %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultPath is the config file read when no --config flag is given.
+	DefaultPath = "config.yaml"
+
+	// EnvPrefix prefixes every environment override, e.g. GIDBIG_DISCORD_TOKEN.
+	EnvPrefix = "GIDBIG"
+
+	// overlayDir is the directory next to the config file whose *.yaml files
+	// are merged over it in lexical order.
+	overlayDir = "config.d"
+)
+
+// lookupEnv is swappable in tests.
+var lookupEnv = os.LookupEnv
+
+// Load reads the config file at path, merges config.d/ overlays and GIDBIG_*
+// environment overrides, validates the result and applies default tags.
+// The returned error joins every problem found, not just the first.
+func Load(path string) (*Config, error) {
+	var cfg Config
+	var errs []error
+
+	if err := decodeFile(&cfg, path); err != nil {
+		errs = append(errs, err)
+	}
+	overlays, err := filepath.Glob(filepath.Join(filepath.Dir(path), overlayDir, "*.y*ml"))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	slices.Sort(overlays)
+	for _, overlay := range overlays {
+		if err := decodeFile(&cfg, overlay); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	applyDefaults(reflect.ValueOf(&cfg).Elem())
+	return &cfg, nil
+}
+
+// decodeFile merges the YAML file at path into cfg. Keys absent from the file
+// keep their current value, which is what makes overlays work.
+func decodeFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not load config file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := decodeInto(cfg, f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// decodeInto merges the YAML document in r into cfg, rejecting keys that
+// match no config field.
+func decodeInto(cfg *Config, r io.Reader) error {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return errors.New("could not decode config: " + err.Error())
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	errs := []error{checkKnownKeys(doc.Content[0], reflect.TypeFor[Config](), "")}
+	if err := doc.Decode(cfg); err != nil {
+		errs = append(errs, errors.New("could not decode config: "+err.Error()))
+	}
+	return errors.Join(errs...)
+}
+
+// applyEnv overrides every leaf field whose GIDBIG_* variable is set. The
+// variable name is the upper-cased yaml path joined by underscores; lists are
+// comma-separated.
+func applyEnv(v reflect.Value) error {
+	var errs []error
+	walkFields(v, nil, func(f reflect.Value, path []string) {
+		name := envName(path)
+		raw, ok := lookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := setFromString(f, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// applyDefaults fills zero-valued fields from their default:"..." struct tag.
+func applyDefaults(v reflect.Value) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f, sf := v.Field(i), t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		if f.Kind() == reflect.Struct {
+			applyDefaults(f)
+			continue
+		}
+		def, ok := sf.Tag.Lookup("default")
+		if !ok || !f.IsZero() {
+			continue
+		}
+		// Default tags are compile-time constants; a bad one is caught by tests.
+		_ = setFromString(f, def)
+	}
+}
+
+// envName returns the GIDBIG_* variable for a yaml path.
+func envName(path []string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.Join(path, "_"))
+}
+
+// walkFields calls fn for every settable leaf field of the struct v together
+// with its yaml path below prefix. Inline structs share their parent's path.
+func walkFields(v reflect.Value, prefix []string, fn func(reflect.Value, []string)) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f, sf := v.Field(i), t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		if f.Kind() == reflect.Struct && strings.Contains(opts, "inline") {
+			walkFields(f, prefix, fn)
+			continue
+		}
+		path := append(slices.Clip(prefix), name)
+		if f.Kind() == reflect.Struct {
+			walkFields(f, path, fn)
+			continue
+		}
+		fn(f, path)
+	}
+}
+
+func setFromString(f reflect.Value, raw string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", raw)
+		}
+		f.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", raw)
+		}
+		f.SetBool(b)
+	case reflect.Pointer:
+		p := reflect.New(f.Type().Elem())
+		if err := setFromString(p.Elem(), raw); err != nil {
+			return err
+		}
+		f.Set(p)
+	case reflect.Slice:
+		if f.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", f.Type())
+		}
+		var items []string
+		for item := range strings.SplitSeq(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
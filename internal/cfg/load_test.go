@@ -0,0 +1,175 @@
+package cfg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes files (relative path -> content) into a temp dir and
+// returns the path of config.yaml inside it.
+func writeConfig(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+// fakeEnv replaces lookupEnv with a fixed map for the duration of the test.
+func fakeEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	orig := lookupEnv
+	t.Cleanup(func() { lookupEnv = orig })
+	lookupEnv = func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+const minimalConfig = `
+discord:
+  token: "file-token"
+gippity:
+  allowed_guilds: ["456"]
+`
+
+func TestLoad_AppliesDefaults(t *testing.T) {
+	fakeEnv(t, nil)
+	cfg, err := Load(writeConfig(t, map[string]string{"config.yaml": minimalConfig}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Web.Port != 8080 {
+		t.Errorf("web.port = %d, want default 8080", cfg.Web.Port)
+	}
+	if cfg.Web.RateLimit.IP != 600 || cfg.Web.RateLimit.Session != 120 {
+		t.Errorf("web.rate_limit = %+v, want defaults 600/120", cfg.Web.RateLimit)
+	}
+}
+
+func TestLoad_OverlaysMergeInOrder(t *testing.T) {
+	fakeEnv(t, nil)
+	path := writeConfig(t, map[string]string{
+		"config.yaml":            minimalConfig,
+		"config.d/10-llm.yaml":   "llm:\n  model: \"first\"\n  title: \"Gidbig\"\n",
+		"config.d/20-llm.yaml":   "llm:\n  model: \"second\"\n",
+		"config.d/30-coffee.yml": "modules:\n  coffee:\n    enabled: false\n",
+		"config.d/notes.txt":     "ignored",
+	})
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LLM.Model != "second" {
+		t.Errorf("llm.model = %q, want the later overlay to win", cfg.LLM.Model)
+	}
+	if cfg.LLM.Title != "Gidbig" || cfg.Discord.Token != "file-token" {
+		t.Errorf("overlay dropped keys it did not set: title=%q token=%q", cfg.LLM.Title, cfg.Discord.Token)
+	}
+	if cfg.Modules.Enabled("coffee") {
+		t.Error("coffee should be disabled by the .yml overlay")
+	}
+}
+
+func TestLoad_EnvOverrides(t *testing.T) {
+	fakeEnv(t, map[string]string{
+		"GIDBIG_DISCORD_TOKEN":                   "env-token",
+		"GIDBIG_WEB_OAUTH_CLIENT_SECRET":         "env-secret",
+		"GIDBIG_WEB_SESSION_SECRET":              "session",
+		"GIDBIG_WEB_PORT":                        "9090",
+		"GIDBIG_GIPPITY_ALLOWED_GUILDS":          "1, 2,",
+		"GIDBIG_MODULES_STOLL_ENABLED":           "false",
+		"GIDBIG_MODULES_COFFEE_WATER_ML":         "3000",
+		"GIDBIG_MODULES_WTTRIN_DEFAULT_LOCATION": "Berlin",
+		"GIDBIG_DEV_MODE":                        "true",
+	})
+	cfg, err := Load(writeConfig(t, map[string]string{"config.yaml": minimalConfig}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Discord.Token != "env-token" || cfg.Web.Oauth.ClientSecret != "env-secret" {
+		t.Errorf("secrets not overridden: token=%q secret=%q", cfg.Discord.Token, cfg.Web.Oauth.ClientSecret)
+	}
+	if cfg.Web.Port != 9090 || !cfg.DevMode {
+		t.Errorf("port=%d dev_mode=%v, want 9090/true", cfg.Web.Port, cfg.DevMode)
+	}
+	if got := strings.Join(cfg.Gippity.AllowedGuilds, ","); got != "1,2" {
+		t.Errorf("allowed_guilds = %q, want 1,2", got)
+	}
+	if cfg.Modules.Enabled("stoll") || cfg.Modules.Coffee.WaterMl != 3000 || cfg.Modules.Wttrin.DefaultLocation != "Berlin" {
+		t.Errorf("module overrides not applied: %+v", cfg.Modules)
+	}
+}
+
+func TestLoad_ReportsAllErrors(t *testing.T) {
+	fakeEnv(t, map[string]string{"GIDBIG_WEB_PORT": "eighty"})
+	path := writeConfig(t, map[string]string{
+		"config.yaml":          "modules:\n  coffee:\n    water_litres: 2\n",
+		"config.d/broken.yaml": "llm: [",
+	})
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected errors, got nil")
+	}
+	for _, want := range []string{
+		"water_litres",
+		"broken.yaml",
+		"GIDBIG_WEB_PORT",
+		"discord.token",
+		"gippity.allowed_guilds",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoad_OAuthWithoutSessionSecret(t *testing.T) {
+	fakeEnv(t, map[string]string{
+		"GIDBIG_WEB_OAUTH_CLIENT_ID":     "cid",
+		"GIDBIG_WEB_OAUTH_CLIENT_SECRET": "csec",
+		"GIDBIG_WEB_OAUTH_REDIRECT_URI":  "http://localhost/callback",
+	})
+	_, err := Load(writeConfig(t, map[string]string{"config.yaml": minimalConfig}))
+	if err == nil || !strings.Contains(err.Error(), "web.session_secret") {
+		t.Fatalf("expected a session_secret error with OAuth set and web.port omitted, got %v", err)
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	fakeEnv(t, nil)
+	_, err := Load(filepath.Join(t.TempDir(), "nope.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "could not load config file") {
+		t.Fatalf("expected missing file error, got %v", err)
+	}
+}
+
+func TestDefaultTagsParse(t *testing.T) {
+	var check func(v reflect.Value)
+	check = func(v reflect.Value) {
+		typ := v.Type()
+		for i := range typ.NumField() {
+			f, sf := v.Field(i), typ.Field(i)
+			if f.Kind() == reflect.Struct {
+				check(f)
+				continue
+			}
+			if def, ok := sf.Tag.Lookup("default"); ok {
+				if err := setFromString(f, def); err != nil {
+					t.Errorf("%s: bad default tag: %v", sf.Name, err)
+				}
+			}
+		}
+	}
+	check(reflect.ValueOf(&Config{}).Elem())
+}
@@ -0,0 +1,236 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ModuleToggle switches a module on or off, globally or for single guilds.
+// Every module block under modules: embeds it.
+type ModuleToggle struct {
+	// Enabled defaults to true when omitted.
+	Enabled *bool `yaml:"enabled,omitempty"`
+	// DisabledGuilds lists guild IDs in which the module stays silent.
+	DisabledGuilds []string `yaml:"disabled_guilds,omitempty"`
+}
+
+// IsEnabled reports whether the module should be started at all.
+func (t ModuleToggle) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// EnabledIn reports whether the module should handle events from guildID.
+// Direct messages (empty guildID) follow the global toggle.
+func (t ModuleToggle) EnabledIn(guildID string) bool {
+	return t.IsEnabled() && (guildID == "" || !slices.Contains(t.DisabledGuilds, guildID))
+}
+
+// CoffeeConfig holds the coffee machine settings. Zero capacities keep the
+// built-in defaults.
+type CoffeeConfig struct {
+	ModuleToggle     `yaml:",inline"`
+	BeansMildG       int `yaml:"beans_mild_g,omitempty"`
+	BeansEspressoG   int `yaml:"beans_espresso_g,omitempty"`
+	WaterMl          int `yaml:"water_ml,omitempty"`
+	MilkMl           int `yaml:"milk_ml,omitempty"`
+	GroundsG         int `yaml:"grounds_g,omitempty"`
+	TeaBagsPerFlavor int `yaml:"tea_bags_per_flavor,omitempty"`
+}
+
+// LeetoclockConfig holds the Leet o'Clock game settings.
+type LeetoclockConfig struct {
+	ModuleToggle `yaml:",inline"`
+	// Time is the daily target as HH:MM in the bot's local time zone.
+	Time string `yaml:"time,omitempty"`
+	// Channels receive the preparation and winner announcements.
+	Channels []string `yaml:"channels,omitempty"`
+}
+
+// Clock returns the configured target hour and minute. ok is false when Time
+// is unset.
+func (c LeetoclockConfig) Clock() (hour, minute int, ok bool) {
+	t, err := time.Parse("15:04", c.Time)
+	if err != nil {
+		return 0, 0, false
+	}
+	return t.Hour(), t.Minute(), true
+}
+
+// WttrinConfig holds the weather plugin settings.
+type WttrinConfig struct {
+	ModuleToggle `yaml:",inline"`
+	// DefaultLocation is looked up when !wttr is sent without a location.
+	DefaultLocation string `yaml:"default_location,omitempty"`
+}
+
+// Modules holds one settings block per bot module, keyed by module name.
+type Modules struct {
+	Coffee      CoffeeConfig     `yaml:"coffee"`
+	Eso         ModuleToggle     `yaml:"eso"`
+	Gamerstatus ModuleToggle     `yaml:"gamerstatus"`
+	Gippity     ModuleToggle     `yaml:"gippity"`
+	Leetoclock  LeetoclockConfig `yaml:"leetoclock"`
+	Stoll       ModuleToggle     `yaml:"stoll"`
+	Wttrin      WttrinConfig     `yaml:"wttrin"`
+}
+
+// UnmarshalYAML decodes the modules: block, rejecting unknown module names
+// and unknown keys inside each module block.
+func (m *Modules) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkKnownKeys(node, reflect.TypeFor[Modules](), "modules"); err != nil {
+		return err
+	}
+	type plain Modules
+	return node.Decode((*plain)(m))
+}
+
+// toggle returns the ModuleToggle of the named module.
+func (m *Modules) toggle(name string) (ModuleToggle, bool) {
+	switch name {
+	case "coffee":
+		return m.Coffee.ModuleToggle, true
+	case "eso":
+		return m.Eso, true
+	case "gamerstatus":
+		return m.Gamerstatus, true
+	case "gippity":
+		return m.Gippity, true
+	case "leetoclock":
+		return m.Leetoclock.ModuleToggle, true
+	case "stoll":
+		return m.Stoll, true
+	case "wttrin":
+		return m.Wttrin.ModuleToggle, true
+	}
+	return ModuleToggle{}, false
+}
+
+// Enabled reports whether the named module should be started.
+// Modules without a settings block are always enabled.
+func (m *Modules) Enabled(name string) bool {
+	t, _ := m.toggle(name)
+	return t.IsEnabled()
+}
+
+// EnabledIn reports whether the named module should handle events from guildID.
+func (m *Modules) EnabledIn(name, guildID string) bool {
+	t, _ := m.toggle(name)
+	return t.EnabledIn(guildID)
+}
+
+// validate checks the value ranges of every module block.
+func (m *Modules) validate() error {
+	var errs []error
+	c := m.Coffee
+	for _, f := range []struct {
+		key string
+		v   int
+	}{
+		{"beans_mild_g", c.BeansMildG},
+		{"beans_espresso_g", c.BeansEspressoG},
+		{"water_ml", c.WaterMl},
+		{"milk_ml", c.MilkMl},
+		{"grounds_g", c.GroundsG},
+		{"tea_bags_per_flavor", c.TeaBagsPerFlavor},
+	} {
+		if f.v < 0 {
+			errs = append(errs, fmt.Errorf("modules.coffee.%s must not be negative, got %d", f.key, f.v))
+		}
+	}
+	if m.Leetoclock.Time != "" {
+		if _, _, ok := m.Leetoclock.Clock(); !ok {
+			errs = append(errs, fmt.Errorf("modules.leetoclock.time must be HH:MM, got %q", m.Leetoclock.Time))
+		}
+	}
+	for i, ch := range m.Leetoclock.Channels {
+		if strings.TrimSpace(ch) == "" {
+			errs = append(errs, fmt.Errorf("modules.leetoclock.channels[%d] is empty", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkKnownKeys walks a mapping node and reports every key that has no
+// matching yaml tag on t, recursing into nested structs, inline fields and
+// the values of maps. Blocks with their own UnmarshalYAML check themselves
+// and are skipped. An empty path is the top level of the config.
+func checkKnownKeys(node *yaml.Node, t reflect.Type, path string) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	if t.Kind() == reflect.Map {
+		var errs []error
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := checkNestedKeys(node.Content[i+1], t.Elem(), keyPath(path, node.Content[i].Value)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	fields := make(map[string]reflect.Type)
+	collectYAMLFields(t, fields)
+
+	var errs []error
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		ft, ok := fields[key.Value]
+		if !ok {
+			at := path
+			if at == "" {
+				at = "top level"
+			}
+			errs = append(errs, fmt.Errorf("%s: unknown key %q (line %d)", at, key.Value, key.Line))
+			continue
+		}
+		if err := checkNestedKeys(val, ft, keyPath(path, key.Value)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkNestedKeys is checkKnownKeys for a value inside a block, leaving
+// values of types with their own UnmarshalYAML to it.
+func checkNestedKeys(node *yaml.Node, t reflect.Type, path string) error {
+	if reflect.PointerTo(t).Implements(reflect.TypeFor[yaml.Unmarshaler]()) {
+		return nil
+	}
+	return checkKnownKeys(node, t, path)
+}
+
+func keyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func collectYAMLFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			collectYAMLFields(f.Type, fields)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+}
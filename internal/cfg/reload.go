@@ -0,0 +1,84 @@
+package cfg
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// restartOnly lists the yaml paths that are read once at startup and cannot
+// change while the bot is connected. A path matches itself and everything
+// below it; "*" matches any single segment.
+var restartOnly = [][]string{
+	{"discord"},
+	{"web"},
+	{"database"},
+	{"llm", "provider"},
+	{"llm", "model"},
+	{"llm", "vision_model"},
+	{"llm", "base_url"},
+	{"llm", "http_referer"},
+	{"llm", "title"},
+	{"modules", "*", "enabled"},
+	{"dev_mode"},
+}
+
+// Diff is the result of comparing a running config with a freshly loaded one.
+type Diff struct {
+	// Live holds the changed paths that were taken over.
+	Live []string
+	// Restart holds the changed paths that were kept at their old value
+	// because they only take effect after a restart.
+	Restart []string
+}
+
+// Changed reports whether the two configs differed at all.
+func (d Diff) Changed() bool { return len(d.Live)+len(d.Restart) > 0 }
+
+// MergeLive returns a copy of next in which every field that cannot change
+// at runtime keeps its value from cur, together with the list of changes.
+func MergeLive(cur, next *Config) (*Config, Diff) {
+	merged := *next
+	old := make(map[string]reflect.Value)
+	walkFields(reflect.ValueOf(cur).Elem(), nil, func(f reflect.Value, path []string) {
+		old[strings.Join(path, ".")] = f
+	})
+
+	var d Diff
+	walkFields(reflect.ValueOf(&merged).Elem(), nil, func(f reflect.Value, path []string) {
+		key := strings.Join(path, ".")
+		prev := old[key]
+		if equalValues(f, prev) {
+			return
+		}
+		if isRestartOnly(path) {
+			f.Set(prev)
+			d.Restart = append(d.Restart, key)
+			return
+		}
+		d.Live = append(d.Live, key)
+	})
+	return &merged, d
+}
+
+// equalValues compares two leaf fields, treating nil and empty lists as equal.
+func equalValues(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+func isRestartOnly(path []string) bool {
+	return slices.ContainsFunc(restartOnly, func(pattern []string) bool {
+		if len(path) < len(pattern) {
+			return false
+		}
+		for i, seg := range pattern {
+			if seg != "*" && seg != path[i] {
+				return false
+			}
+		}
+		return true
+	})
+}
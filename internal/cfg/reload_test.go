@@ -0,0 +1,78 @@
+package cfg
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func mustDecode(t *testing.T, yaml string) *Config {
+	t.Helper()
+	c, err := decodeConfig(strings.NewReader(yaml))
+	if err != nil {
+		t.Fatalf("decodeConfig: %v", err)
+	}
+	return c
+}
+
+func TestMergeLive(t *testing.T) {
+	cur := mustDecode(t, `
+discord:
+  token: "old-token"
+gippity:
+  allowed_guilds: ["1"]
+llm:
+  model: "old-model"
+  personality_preset: "dry"
+modules:
+  wttrin:
+    default_location: "Berlin"
+`)
+	next := mustDecode(t, `
+discord:
+  token: "new-token"
+gippity:
+  allowed_guilds: ["1", "2"]
+  ignored_users: []
+llm:
+  model: "new-model"
+  personality_preset: "hal"
+modules:
+  stoll:
+    enabled: false
+    disabled_guilds: ["9"]
+  wttrin:
+    default_location: "Hamburg"
+`)
+
+	merged, diff := MergeLive(cur, next)
+
+	wantLive := []string{"gippity.allowed_guilds", "llm.personality_preset", "modules.stoll.disabled_guilds", "modules.wttrin.default_location"}
+	if !slices.Equal(diff.Live, wantLive) {
+		t.Errorf("Live = %v, want %v", diff.Live, wantLive)
+	}
+	wantRestart := []string{"discord.token", "llm.model", "modules.stoll.enabled"}
+	if !slices.Equal(diff.Restart, wantRestart) {
+		t.Errorf("Restart = %v, want %v", diff.Restart, wantRestart)
+	}
+
+	if merged.Discord.Token != "old-token" || merged.LLM.Model != "old-model" || !merged.Modules.Enabled("stoll") {
+		t.Errorf("restart-only fields changed: token=%q model=%q stoll=%v", merged.Discord.Token, merged.LLM.Model, merged.Modules.Enabled("stoll"))
+	}
+	if len(merged.Gippity.AllowedGuilds) != 2 || merged.LLM.Preset != "hal" || merged.Modules.Wttrin.DefaultLocation != "Hamburg" {
+		t.Errorf("live fields not taken over: %+v", merged)
+	}
+	if merged.Modules.EnabledIn("stoll", "9") {
+		t.Error("disabled_guilds should apply live")
+	}
+	if cur.Modules.Wttrin.DefaultLocation != "Berlin" {
+		t.Error("MergeLive must not modify cur")
+	}
+}
+
+func TestMergeLive_NoChanges(t *testing.T) {
+	c := mustDecode(t, "discord:\n  token: tok\ngippity:\n  allowed_guilds: [\"1\"]\n")
+	if _, diff := MergeLive(c, c); diff.Changed() {
+		t.Errorf("identical configs reported changes: %+v", diff)
+	}
+}
@@ -0,0 +1,263 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SoundboardConfig limits who may play sounds, how often and where. Every
+// limit is off while unset.
+type SoundboardConfig struct {
+	// Cooldown is how long a user has to wait between two sounds in a guild,
+	// as a Go duration such as "10s".
+	Cooldown string `yaml:"cooldown,omitempty"`
+	// DailyCap is how many sounds a guild may play per day, 0 means no cap.
+	DailyCap int `yaml:"daily_cap,omitempty"`
+	// Guilds holds per-guild overrides and role rules, keyed by guild ID.
+	Guilds map[string]SoundboardGuild `yaml:"guilds,omitempty"`
+	// Collections restricts collections to voice channels, keyed by prefix.
+	Collections map[string]SoundboardCollection `yaml:"collections,omitempty"`
+	// Entrances plays the entrance sound of users joining a voice channel.
+	Entrances bool `yaml:"entrances,omitempty"`
+	// EntranceCooldown is how long after an entrance sound the same user
+	// joining again stays quiet, so reconnects do not replay it.
+	EntranceCooldown string `yaml:"entrance_cooldown,omitempty" default:"10m"`
+	// Clips keeps the last ClipLength of what consenting users say while the
+	// bot is in a voice channel, so /clip can turn it into a sound.
+	Clips bool `yaml:"clips,omitempty"`
+	// ClipLength is how much audio is kept per user, as a Go duration. It is
+	// also the longest clip.
+	ClipLength string `yaml:"clip_length,omitempty" default:"30s"`
+	// Managers lists the user IDs that may upload and edit sounds in the web
+	// UI besides the owner and the admins of guilds the bot is in.
+	Managers []string `yaml:"managers,omitempty"`
+	// MaxUploadSize is the largest sound file in bytes the web UI accepts.
+	MaxUploadSize int `yaml:"max_upload_size,omitempty" default:"2097152"`
+	// MaxUploadLength is the longest sound the web UI accepts, as a Go
+	// duration.
+	MaxUploadLength string `yaml:"max_upload_length,omitempty" default:"30s"`
+	// Normalize evens out the loudness of the loaded sounds.
+	Normalize SoundboardNormalize `yaml:"normalize,omitempty"`
+}
+
+// SoundboardNormalize runs the loaded sounds through an external encoder to
+// bring them to the same loudness. It is off while Command is unset.
+type SoundboardNormalize struct {
+	// Command is run once per sound with Ogg Opus on stdin; it has to write
+	// the normalized sound as Ogg Opus at 48 kHz to stdout. It finds the
+	// target in $GIDBIG_TARGET_LUFS and the volume override of the sound in
+	// $GIDBIG_GAIN_DB.
+	Command []string `yaml:"command,omitempty"`
+	// Measure is run once per sound for the loudness report with Ogg Opus on
+	// stdin; it has to print the integrated loudness in LUFS to stdout.
+	Measure []string `yaml:"measure,omitempty"`
+	// Target is the integrated loudness in LUFS sounds are brought to.
+	Target int `yaml:"target,omitempty" default:"-16"`
+	// Tolerance is how many LU a sound may be off Target before the loudness
+	// report lists it.
+	Tolerance int `yaml:"tolerance,omitempty" default:"2"`
+	// Timeout bounds a single run of Command or Measure, as a Go duration.
+	Timeout string `yaml:"timeout,omitempty" default:"60s"`
+}
+
+// Enabled reports whether sounds are normalized.
+func (c SoundboardNormalize) Enabled() bool {
+	return len(c.Command) > 0
+}
+
+// RunTimeout returns how long a single run of Command or Measure may take.
+func (c SoundboardNormalize) RunTimeout() time.Duration {
+	d, _ := time.ParseDuration(c.Timeout)
+	return d
+}
+
+// MaxClipLength bounds soundboard.clip_length.
+const MaxClipLength = 5 * time.Minute
+
+// SoundboardGuild holds the soundboard settings of a single guild.
+type SoundboardGuild struct {
+	// Cooldown replaces the global cooldown when set; "0s" turns it off.
+	Cooldown string `yaml:"cooldown,omitempty"`
+	// DailyCap replaces the global cap when set; 0 turns it off.
+	DailyCap *int `yaml:"daily_cap,omitempty"`
+	// AllowedRoles, when set, limits playing sounds to members holding at
+	// least one of these role IDs.
+	AllowedRoles []string `yaml:"allowed_roles,omitempty"`
+	// DeniedRoles lists role IDs whose members may not play sounds. They win
+	// over AllowedRoles.
+	DeniedRoles []string `yaml:"denied_roles,omitempty"`
+	// Entrances replaces the global entrance toggle when set.
+	Entrances *bool `yaml:"entrances,omitempty"`
+	// EntranceCooldown replaces the global entrance cooldown when set.
+	EntranceCooldown string `yaml:"entrance_cooldown,omitempty"`
+	// Clips replaces the global clip toggle when set.
+	Clips *bool `yaml:"clips,omitempty"`
+}
+
+// SoundboardCollection holds the settings of a single sound collection.
+type SoundboardCollection struct {
+	// Channels lists the voice channel IDs the collection may be played in.
+	// Empty means everywhere.
+	Channels []string `yaml:"channels,omitempty"`
+}
+
+// UnmarshalYAML decodes the soundboard: block, rejecting unknown keys.
+func (c *SoundboardConfig) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkKnownKeys(node, reflect.TypeFor[SoundboardConfig](), "soundboard"); err != nil {
+		return err
+	}
+	type plain SoundboardConfig
+	return node.Decode((*plain)(c))
+}
+
+// CooldownIn returns the cooldown between two sounds of a user in guildID.
+func (c SoundboardConfig) CooldownIn(guildID string) time.Duration {
+	return overrideDuration(c.Cooldown, c.Guilds[guildID].Cooldown)
+}
+
+// EntrancesIn reports whether entrance sounds play in guildID.
+func (c SoundboardConfig) EntrancesIn(guildID string) bool {
+	if g, ok := c.Guilds[guildID]; ok && g.Entrances != nil {
+		return *g.Entrances
+	}
+	return c.Entrances
+}
+
+// EntranceCooldownIn returns how long a user's entrance sound stays quiet in
+// guildID after it played.
+func (c SoundboardConfig) EntranceCooldownIn(guildID string) time.Duration {
+	return overrideDuration(c.EntranceCooldown, c.Guilds[guildID].EntranceCooldown)
+}
+
+// ClipsIn reports whether voice is kept for /clip in guildID.
+func (c SoundboardConfig) ClipsIn(guildID string) bool {
+	if g, ok := c.Guilds[guildID]; ok && g.Clips != nil {
+		return *g.Clips
+	}
+	return c.Clips
+}
+
+// ClipWindow returns how much audio is kept per user for /clip.
+func (c SoundboardConfig) ClipWindow() time.Duration {
+	d, _ := time.ParseDuration(c.ClipLength)
+	return d
+}
+
+// UploadLength returns the longest sound the web UI accepts.
+func (c SoundboardConfig) UploadLength() time.Duration {
+	d, _ := time.ParseDuration(c.MaxUploadLength)
+	return d
+}
+
+// overrideDuration parses the guild value, or the global one when the guild
+// leaves it unset. Both were checked by validate.
+func overrideDuration(global, guild string) time.Duration {
+	if guild != "" {
+		global = guild
+	}
+	d, _ := time.ParseDuration(global)
+	return d
+}
+
+// DailyCapIn returns how many sounds guildID may play per day, 0 means no cap.
+func (c SoundboardConfig) DailyCapIn(guildID string) int {
+	if g, ok := c.Guilds[guildID]; ok && g.DailyCap != nil {
+		return *g.DailyCap
+	}
+	return c.DailyCap
+}
+
+// HasRoleRules reports whether guildID allows or denies roles at all.
+func (c SoundboardConfig) HasRoleRules(guildID string) bool {
+	g := c.Guilds[guildID]
+	return len(g.AllowedRoles)+len(g.DeniedRoles) > 0
+}
+
+// RolesAllowed reports whether a member holding roles may play sounds in
+// guildID.
+func (c SoundboardConfig) RolesAllowed(guildID string, roles []string) bool {
+	g := c.Guilds[guildID]
+	if slices.ContainsFunc(roles, func(r string) bool { return slices.Contains(g.DeniedRoles, r) }) {
+		return false
+	}
+	return len(g.AllowedRoles) == 0 ||
+		slices.ContainsFunc(roles, func(r string) bool { return slices.Contains(g.AllowedRoles, r) })
+}
+
+// ChannelsFor returns the voice channels the collection with prefix is
+// restricted to; nil means it plays everywhere.
+func (c SoundboardConfig) ChannelsFor(prefix string) []string {
+	return c.Collections[prefix].Channels
+}
+
+// validate checks the durations, caps and IDs of the soundboard block.
+func (c *SoundboardConfig) validate() error {
+	var errs []error
+	checkCooldown := func(path, s string) {
+		if s == "" {
+			return
+		}
+		if d, err := time.ParseDuration(s); err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("%s must be a non-negative duration such as 10s, got %q", path, s))
+		}
+	}
+	checkIDs := func(path string, ids []string) {
+		for i, id := range ids {
+			if strings.TrimSpace(id) == "" {
+				errs = append(errs, fmt.Errorf("%s[%d] is empty", path, i))
+			}
+		}
+	}
+
+	checkCooldown("soundboard.cooldown", c.Cooldown)
+	checkCooldown("soundboard.entrance_cooldown", c.EntranceCooldown)
+	if c.ClipLength != "" {
+		if d, err := time.ParseDuration(c.ClipLength); err != nil || d < time.Second || d > MaxClipLength {
+			errs = append(errs, fmt.Errorf("soundboard.clip_length must be a duration between 1s and %v, got %q", MaxClipLength, c.ClipLength))
+		}
+	}
+	if c.MaxUploadSize < 0 {
+		errs = append(errs, fmt.Errorf("soundboard.max_upload_size must not be negative, got %d", c.MaxUploadSize))
+	}
+	if c.MaxUploadLength != "" {
+		if d, err := time.ParseDuration(c.MaxUploadLength); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("soundboard.max_upload_length must be a positive duration such as 30s, got %q", c.MaxUploadLength))
+		}
+	}
+	checkIDs("soundboard.managers", c.Managers)
+	if n := c.Normalize; n.Target < -70 || n.Target > 0 {
+		errs = append(errs, fmt.Errorf("soundboard.normalize.target must be between -70 and 0 LUFS, got %d", n.Target))
+	}
+	if c.Normalize.Tolerance < 0 {
+		errs = append(errs, fmt.Errorf("soundboard.normalize.tolerance must not be negative, got %d", c.Normalize.Tolerance))
+	}
+	if t := c.Normalize.Timeout; t != "" {
+		if d, err := time.ParseDuration(t); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("soundboard.normalize.timeout must be a positive duration such as 60s, got %q", t))
+		}
+	}
+	if c.DailyCap < 0 {
+		errs = append(errs, fmt.Errorf("soundboard.daily_cap must not be negative, got %d", c.DailyCap))
+	}
+	for _, id := range slices.Sorted(maps.Keys(c.Guilds)) {
+		g, path := c.Guilds[id], "soundboard.guilds."+id
+		checkCooldown(path+".cooldown", g.Cooldown)
+		checkCooldown(path+".entrance_cooldown", g.EntranceCooldown)
+		if g.DailyCap != nil && *g.DailyCap < 0 {
+			errs = append(errs, fmt.Errorf("%s.daily_cap must not be negative, got %d", path, *g.DailyCap))
+		}
+		checkIDs(path+".allowed_roles", g.AllowedRoles)
+		checkIDs(path+".denied_roles", g.DeniedRoles)
+	}
+	for _, prefix := range slices.Sorted(maps.Keys(c.Collections)) {
+		checkIDs("soundboard.collections."+prefix+".channels", c.Collections[prefix].Channels)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,76 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TTSBackends lists the speech engines tts.backend accepts.
+var TTSBackends = []string{"command", "silence"}
+
+// TTSConfig holds the text to speech settings used by /say and spoken
+// gippity answers.
+type TTSConfig struct {
+	// Backend selects the speech engine: "command" runs Command, "silence"
+	// renders silence for testing. Empty turns text to speech off.
+	Backend string `yaml:"backend,omitempty"`
+	// Command is run for every phrase with the text on stdin; it has to write
+	// Ogg Opus at 48 kHz to stdout.
+	Command []string `yaml:"command,omitempty"`
+	// Timeout bounds a single run of Command, as a Go duration.
+	Timeout string `yaml:"timeout,omitempty" default:"20s"`
+	// MaxLength is the longest text in characters that is spoken.
+	MaxLength int `yaml:"max_length,omitempty" default:"300"`
+	// CacheSize is how many rendered phrases are kept in memory.
+	CacheSize int `yaml:"cache_size,omitempty" default:"64"`
+	// Gippity speaks gippity answers in the voice channel of the user asking.
+	Gippity bool `yaml:"gippity,omitempty"`
+}
+
+// UnmarshalYAML decodes the tts: block, rejecting unknown keys.
+func (c *TTSConfig) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkKnownKeys(node, reflect.TypeFor[TTSConfig](), "tts"); err != nil {
+		return err
+	}
+	type plain TTSConfig
+	return node.Decode((*plain)(c))
+}
+
+// Enabled reports whether a speech engine is configured.
+func (c TTSConfig) Enabled() bool {
+	return c.Backend != ""
+}
+
+// RunTimeout returns how long a single run of Command may take.
+func (c TTSConfig) RunTimeout() time.Duration {
+	d, _ := time.ParseDuration(c.Timeout)
+	return d
+}
+
+// validate checks the backend and its settings.
+func (c *TTSConfig) validate() error {
+	var errs []error
+	if c.Backend != "" && !slices.Contains(TTSBackends, c.Backend) {
+		errs = append(errs, fmt.Errorf("tts.backend must be one of %v, got %q", TTSBackends, c.Backend))
+	}
+	if c.Backend == "command" && len(c.Command) == 0 {
+		errs = append(errs, errors.New("tts.command is required when tts.backend is command"))
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("tts.timeout must be a positive duration such as 20s, got %q", c.Timeout))
+		}
+	}
+	if c.MaxLength < 0 {
+		errs = append(errs, fmt.Errorf("tts.max_length must not be negative, got %d", c.MaxLength))
+	}
+	if c.CacheSize < 0 {
+		errs = append(errs, fmt.Errorf("tts.cache_size must not be negative, got %d", c.CacheSize))
+	}
+	return errors.Join(errs...)
+}
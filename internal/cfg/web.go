@@ -0,0 +1,62 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SessionStores lists the stores web.sessions.store accepts.
+var SessionStores = []string{"cookie", "sqlite"}
+
+// WebSessions selects where the login sessions of the web UI are kept.
+type WebSessions struct {
+	// Store is "cookie" to keep the whole session in an encrypted cookie, or
+	// "sqlite" to keep it in the database with only its ID in the cookie,
+	// which adds the timeouts and signing out of all devices.
+	Store string `yaml:"store,omitempty" default:"cookie"`
+	// IdleTimeout ends a database session unused this long, as a Go
+	// duration.
+	IdleTimeout string `yaml:"idle_timeout,omitempty" default:"168h"`
+	// AbsoluteTimeout ends a database session this long after the login, as
+	// a Go duration.
+	AbsoluteTimeout string `yaml:"absolute_timeout,omitempty" default:"720h"`
+}
+
+// ServerSide reports whether sessions are kept in the database.
+func (c WebSessions) ServerSide() bool {
+	return c.Store == "sqlite"
+}
+
+// Idle returns how long a database session may go unused.
+func (c WebSessions) Idle() time.Duration {
+	d, _ := time.ParseDuration(c.IdleTimeout)
+	return d
+}
+
+// Absolute returns how long a database session lasts at most.
+func (c WebSessions) Absolute() time.Duration {
+	d, _ := time.ParseDuration(c.AbsoluteTimeout)
+	return d
+}
+
+// validate checks the store and its timeouts.
+func (c *WebSessions) validate() error {
+	var errs []error
+	if c.Store != "" && !slices.Contains(SessionStores, c.Store) {
+		errs = append(errs, fmt.Errorf("web.sessions.store must be one of %v, got %q", SessionStores, c.Store))
+	}
+	for _, t := range []struct{ path, value string }{
+		{"web.sessions.idle_timeout", c.IdleTimeout},
+		{"web.sessions.absolute_timeout", c.AbsoluteTimeout},
+	} {
+		if t.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(t.value); err != nil || d < time.Minute {
+			errs = append(errs, fmt.Errorf("%s must be a duration of at least 1m such as 24h, got %q", t.path, t.value))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/toksikk/gidbig/internal/bot"
+	"github.com/toksikk/gidbig/internal/cfg"
 	"github.com/toksikk/gidbig/internal/llm"
 	"github.com/toksikk/gidbig/internal/util"
 	"gorm.io/gorm"
@@ -47,6 +48,10 @@ type Module struct {
 	// machineMu serializes mutations to the per-guild machine inventory.
 	machineMu sync.Mutex
 
+	// capsMu guards caps, which a config reload may replace.
+	capsMu sync.RWMutex
+	caps   capacities
+
 	// UI translations are warmed asynchronously so interaction acknowledgements
 	// never wait for the LLM provider.
 	uiMu        sync.Mutex
@@ -77,6 +82,7 @@ type Module struct {
 // New returns a Module with production-default hook implementations.
 func New() *Module {
 	m := &Module{
+		caps:        defaultCapacities,
 		nowFunc:     time.Now,
 		uiCache:     make(map[string]cachedUIText),
 		uiWarming:   make(map[string]struct{}),
@@ -103,11 +109,18 @@ func New() *Module {
 // Name returns the module's identifier.
 func (m *Module) Name() string { return "coffee" }
 
-// Init opens the beverage-preference store using the DB path from Deps.Config.
+// Init applies the configured machine capacities and opens the
+// beverage-preference store using the DB path from Deps.Config.
 func (m *Module) Init(d bot.Deps) error {
 	dbPath := "gidbig.db"
-	if d.Config != nil && d.Config.Database.Path != "" {
-		dbPath = d.Config.Database.Path
+	if d.Config != nil {
+		if d.Config.Database.Path != "" {
+			dbPath = d.Config.Database.Path
+		}
+		m.caps = capacitiesFromConfig(d.Config.Modules.Coffee)
+	}
+	if err := m.caps.validate(); err != nil {
+		return fmt.Errorf("coffee: %w", err)
 	}
 	if err := m.openStore(dbPath); err != nil {
 		return fmt.Errorf("coffee: open store: %w", err)
@@ -116,6 +129,25 @@ func (m *Module) Init(d bot.Deps) error {
 	return nil
 }
 
+// Reconfigure applies changed machine capacities. Stock above a reduced
+// capacity is kept and simply counts as full.
+func (m *Module) Reconfigure(c *cfg.Config) error {
+	caps := capacitiesFromConfig(c.Modules.Coffee)
+	if err := caps.validate(); err != nil {
+		return fmt.Errorf("coffee: %w", err)
+	}
+	m.capsMu.Lock()
+	m.caps = caps
+	m.capsMu.Unlock()
+	return nil
+}
+
+func (m *Module) machineCaps() capacities {
+	m.capsMu.RLock()
+	defer m.capsMu.RUnlock()
+	return m.caps
+}
+
 // Commands returns the slash command definitions for this plugin.
 func (m *Module) Commands() []*discordgo.ApplicationCommand {
 	return []*discordgo.ApplicationCommand{
@@ -215,20 +247,35 @@ func brewChoices() []*discordgo.ApplicationCommandOptionChoice {
 // refillChoices builds the /coffeemachine refill part option choices (machine
 // parts + tea bag varieties).
 func refillChoices() []*discordgo.ApplicationCommandOptionChoice {
-	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(refillParts))
-	for _, p := range refillParts {
+	parts := defaultCapacities.refillParts()
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(parts))
+	for _, p := range parts {
 		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: p.label, Value: p.key})
 	}
 	return choices
 }
 
+// CommandHandlers returns the slash command handlers keyed by command name.
+func (m *Module) CommandHandlers() map[string]bot.HandlerFunc {
+	return map[string]bot.HandlerFunc{
+		"brew":          m.handleBrewInteraction,
+		"coffeemachine": m.handleMachineInteraction,
+		"setbeverage":   m.handleSetBeverageInteraction,
+	}
+}
+
 // Listeners returns the Discord event listeners for this module.
 func (m *Module) Listeners() []bot.EventListener {
-	return []bot.EventListener{m.onMessageCreate, m.onInteractionCreate}
+	return []bot.EventListener{m.onMessageCreate}
 }
 
-// Components returns no message-component handlers for this module.
-func (m *Module) Components() []bot.ComponentHandler { return nil }
+// Components returns the brew-menu and take-cup button handlers.
+func (m *Module) Components() []bot.ComponentHandler {
+	return []bot.ComponentHandler{
+		{Prefix: brewCfgPrefix, Handler: m.handleBrewComponent},
+		{Prefix: takeCupPrefix, Handler: m.handleTakeCupComponent},
+	}
+}
 
 // Background returns the persistent drink-expiry sweeper.
 func (m *Module) Background() []bot.BackgroundTask {
@@ -429,34 +476,11 @@ func (m *Module) onMessageCreate(s *discordgo.Session, mc *discordgo.MessageCrea
 	}
 }
 
-func (m *Module) onInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	if i.Type == discordgo.InteractionMessageComponent {
-		id := i.MessageComponentData().CustomID
-		switch {
-		case strings.HasPrefix(id, brewCfgPrefix):
-			m.handleBrewComponent(s, i)
-		case strings.HasPrefix(id, takeCupPrefix):
-			m.handleTakeCupComponent(s, i)
-		}
-		return
-	}
-	if i.Type != discordgo.InteractionApplicationCommand {
-		return
-	}
-
+func (m *Module) handleSetBeverageInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	data := i.ApplicationCommandData()
-	switch data.Name {
-	case "brew":
-		m.handleBrewInteraction(s, i)
-		return
-	case "coffeemachine":
-		m.handleMachineInteraction(s, i)
-		return
-	case "setbeverage":
-	default:
+	if len(data.Options) == 0 {
 		return
 	}
-
 	emoji := data.Options[0].StringValue()
 
 	if !isValidBeverageEmoji(emoji) {
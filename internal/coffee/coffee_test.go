@@ -424,3 +424,25 @@ func TestLocalizeUIDoesNotCacheFailures(t *testing.T) {
 		t.Fatalf("translation calls = %d, want retry after failure", got)
 	}
 }
+
+func TestCommandHandlers_CoverCommands(t *testing.T) {
+	m := New()
+	handlers := m.CommandHandlers()
+	for _, cmd := range m.Commands() {
+		if handlers[cmd.Name] == nil {
+			t.Errorf("no handler for command %q", cmd.Name)
+		}
+	}
+}
+
+func TestComponents_CoverButtonPrefixes(t *testing.T) {
+	prefixes := make(map[string]bool)
+	for _, c := range New().Components() {
+		prefixes[c.Prefix] = true
+	}
+	for _, want := range []string{brewCfgPrefix, takeCupPrefix} {
+		if !prefixes[want] {
+			t.Errorf("missing component handler for prefix %q", want)
+		}
+	}
+}
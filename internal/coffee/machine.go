@@ -11,10 +11,11 @@ import (
 	"unicode"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/cfg"
 	"gorm.io/gorm"
 )
 
-// Tank and hopper capacities for the bean-to-cup machine. Metric units: beans
+// Default tank and hopper capacities for the bean-to-cup machine. Metric units: beans
 // and grounds in grams, water and milk in milliliters.
 const (
 	maxBeansMildG     = 1000
@@ -99,18 +100,98 @@ func teaFlavorLabel(flavor string) string {
 // Built in init so tea recipes are derived from teaFlavors.
 var menu []recipe
 
-// refillParts are the machine tanks/hoppers refillable via /coffeemachine refill.
-// teaRefillParts are appended in init from teaFlavors.
-var (
-	machineRefillParts = []refillPart{
-		{key: "beans_mild", label: "Mild beans", max: maxBeansMildG, unit: "g"},
-		{key: "beans_espresso", label: "Espresso beans", max: maxBeansEspressoG, unit: "g"},
-		{key: "water", label: "Water", max: maxWaterMl, unit: "ml"},
-		{key: "milk", label: "Milk", max: maxMilkMl, unit: "ml"},
-	}
-	teaRefillParts []refillPart
-	refillParts    []refillPart // machineRefillParts + teaRefillParts, built in init
-)
+// capacities holds the tank and hopper sizes of a guild's machine. The
+// constants above are the defaults; modules.coffee in config.yaml overrides them.
+type capacities struct {
+	beansMildG       int
+	beansEspressoG   int
+	waterMl          int
+	milkMl           int
+	groundsG         int
+	teaBagsPerFlavor int
+}
+
+var defaultCapacities = capacities{
+	beansMildG:       maxBeansMildG,
+	beansEspressoG:   maxBeansEspressoG,
+	waterMl:          maxWaterMl,
+	milkMl:           maxMilkMl,
+	groundsG:         maxGroundsG,
+	teaBagsPerFlavor: maxTeaBagsPerFlavor,
+}
+
+// capacitiesFromConfig overlays the non-zero capacities from modules.coffee
+// onto the defaults.
+func capacitiesFromConfig(c cfg.CoffeeConfig) capacities {
+	caps := defaultCapacities
+	for _, o := range []struct {
+		dst *int
+		v   int
+	}{
+		{&caps.beansMildG, c.BeansMildG},
+		{&caps.beansEspressoG, c.BeansEspressoG},
+		{&caps.waterMl, c.WaterMl},
+		{&caps.milkMl, c.MilkMl},
+		{&caps.groundsG, c.GroundsG},
+		{&caps.teaBagsPerFlavor, c.TeaBagsPerFlavor},
+	} {
+		if o.v > 0 {
+			*o.dst = o.v
+		}
+	}
+	return caps
+}
+
+// validate rejects capacities too small to ever brew some drink on the menu.
+func (c capacities) validate() error {
+	for _, p := range []struct {
+		part string
+		have int
+	}{
+		{"beans_mild", c.beansMildG},
+		{"beans_espresso", c.beansEspressoG},
+		{"water", c.waterMl},
+		{"milk", c.milkMl},
+		{partGrounds, c.groundsG},
+	} {
+		if need := maxPartDemand(p.part); p.have < need {
+			return fmt.Errorf("%s capacity %d is below the %d a single drink needs", p.part, p.have, need)
+		}
+	}
+	if c.teaBagsPerFlavor < 1 {
+		return fmt.Errorf("tea bag capacity must be at least 1, got %d", c.teaBagsPerFlavor)
+	}
+	return nil
+}
+
+// refillParts returns the machine tanks/hoppers followed by one entry per tea
+// variety, all refillable via /coffeemachine refill.
+func (c capacities) refillParts() []refillPart {
+	parts := []refillPart{
+		{key: "beans_mild", label: "Mild beans", max: c.beansMildG, unit: "g"},
+		{key: "beans_espresso", label: "Espresso beans", max: c.beansEspressoG, unit: "g"},
+		{key: "water", label: "Water", max: c.waterMl, unit: "ml"},
+		{key: "milk", label: "Milk", max: c.milkMl, unit: "ml"},
+	}
+	for _, t := range teaFlavors {
+		parts = append(parts, refillPart{
+			key:   "tea_" + t.key,
+			label: "Tea bags (" + t.label + ")",
+			max:   c.teaBagsPerFlavor,
+			unit:  " bags",
+		})
+	}
+	return parts
+}
+
+func (c capacities) refillPartByKey(key string) (refillPart, bool) {
+	for _, p := range c.refillParts() {
+		if p.key == key {
+			return p, true
+		}
+	}
+	return refillPart{}, false
+}
 
 func init() {
 	// Build full drink menu: coffee recipes + one recipe per tea flavor.
@@ -125,17 +206,6 @@ func init() {
 			brewSecs:   20,
 		})
 	}
-
-	// Build tea refill parts list.
-	for _, t := range teaFlavors {
-		teaRefillParts = append(teaRefillParts, refillPart{
-			key:   "tea_" + t.key,
-			label: "Tea bags (" + t.label + ")",
-			max:   maxTeaBagsPerFlavor,
-			unit:  " bags",
-		})
-	}
-	refillParts = append(machineRefillParts, teaRefillParts...)
 }
 
 // refillPart describes a refillable tank/hopper or tea bag variety.
@@ -146,15 +216,6 @@ type refillPart struct {
 	unit  string // "g", "ml", or " bags"
 }
 
-func refillPartByKey(key string) (refillPart, bool) {
-	for _, p := range refillParts {
-		if p.key == key {
-			return p, true
-		}
-	}
-	return refillPart{}, false
-}
-
 // brewTime is how long the machine pretends to take dispensing a drink.
 func brewTime(r recipe) time.Duration {
 	return time.Duration(r.brewSecs) * time.Second
@@ -178,7 +239,7 @@ func partLabel(key string) string {
 	if flavor, ok := strings.CutPrefix(key, "tea_"); ok {
 		return strings.ToLower(teaFlavorLabel(flavor)) + " tea bags"
 	}
-	if p, ok := refillPartByKey(key); ok {
+	if p, ok := defaultCapacities.refillPartByKey(key); ok {
 		return strings.ToLower(p.label)
 	}
 	return key
@@ -220,7 +281,7 @@ func maxPartDemand(part string) int {
 // partsNeedingService reports which parts the given inventory has left low (or,
 // for grounds, too full) enough that the next brew of some drink would be
 // blocked. The order matches the machine status display.
-func partsNeedingService(inv MachineInventory) []string {
+func (c capacities) partsNeedingService(inv MachineInventory) []string {
 	var parts []string
 	if inv.BeansMildGrams < maxPartDemand("beans_mild") {
 		parts = append(parts, "beans_mild")
@@ -234,7 +295,7 @@ func partsNeedingService(inv MachineInventory) []string {
 	if inv.MilkMl < maxPartDemand("milk") {
 		parts = append(parts, "milk")
 	}
-	if inv.GroundsGrams+maxPartDemand(partGrounds) > maxGroundsG {
+	if inv.GroundsGrams+maxPartDemand(partGrounds) > c.groundsG {
 		parts = append(parts, partGrounds)
 	}
 	return parts
@@ -242,14 +303,14 @@ func partsNeedingService(inv MachineInventory) []string {
 
 // seedInventoryTx loads the guild's inventory, creating a full machine on first
 // use. Works on any *gorm.DB (a live handle or an open transaction).
-func seedInventoryTx(db *gorm.DB, guildID string) (MachineInventory, error) {
+func seedInventoryTx(db *gorm.DB, guildID string, c capacities) (MachineInventory, error) {
 	var inv MachineInventory
 	err := db.Where(MachineInventory{GuildID: guildID}).
 		Attrs(MachineInventory{
-			BeansMildGrams:     maxBeansMildG,
-			BeansEspressoGrams: maxBeansEspressoG,
-			WaterMl:            maxWaterMl,
-			MilkMl:             maxMilkMl,
+			BeansMildGrams:     c.beansMildG,
+			BeansEspressoGrams: c.beansEspressoG,
+			WaterMl:            c.waterMl,
+			MilkMl:             c.milkMl,
 			GroundsGrams:       0,
 		}).
 		FirstOrCreate(&inv).Error
@@ -263,7 +324,7 @@ func (m *Module) getOrSeedInventory(guildID string) (MachineInventory, error) {
 	if d == nil {
 		return MachineInventory{}, errors.New("store not initialized")
 	}
-	return seedInventoryTx(d, guildID)
+	return seedInventoryTx(d, guildID, m.machineCaps())
 }
 
 // dispenseOutcome is the result of attempting to brew one drink.
@@ -350,7 +411,7 @@ func (m *Module) dispense(guildID, userID, drinkKey string, addMilk, addSugar bo
 			out.failMsg = "You already have a drink waiting. Pick it up before using `/brew` again."
 			return nil
 		}
-		inv, e := seedInventoryTx(tx, guildID)
+		inv, e := seedInventoryTx(tx, guildID, m.machineCaps())
 		if e != nil {
 			return e
 		}
@@ -358,7 +419,7 @@ func (m *Module) dispense(guildID, userID, drinkKey string, addMilk, addSugar bo
 		// Load tea bag inventory up front so we can check stock in the switch below.
 		var teaBag *TeaBagInventory
 		if teaBagFlavor != "" {
-			tb, e2 := getOrSeedTeaBagTx(tx, guildID, teaBagFlavor)
+			tb, e2 := getOrSeedTeaBagTx(tx, guildID, teaBagFlavor, m.machineCaps())
 			if e2 != nil {
 				return e2
 			}
@@ -375,7 +436,7 @@ func (m *Module) dispense(guildID, userID, drinkKey string, addMilk, addSugar bo
 			out.failMsg, blockPart = outOfMsg("water", "water"), "water"
 		case inv.MilkMl < milkNeeded:
 			out.failMsg, blockPart = outOfMsg("milk", "milk"), "milk"
-		case inv.GroundsGrams+r.groundsG > maxGroundsG:
+		case inv.GroundsGrams+r.groundsG > m.machineCaps().groundsG:
 			out.failMsg, blockPart = "The grounds container is full. Empty it with `/coffeemachine empty`.", partGrounds
 		case teaBag != nil && teaBag.Count < 1:
 			partKey := "tea_" + teaBagFlavor
@@ -434,7 +495,7 @@ func (m *Module) dispense(guildID, userID, drinkKey string, addMilk, addSugar bo
 		}
 		// Record which parts this brew left needing service and pin the brewer as
 		// responsible, so a later blocked brew can blame them.
-		out.serviceNeeded = partsNeedingService(inv)
+		out.serviceNeeded = m.machineCaps().partsNeedingService(inv)
 		if teaBag != nil && teaBag.Count == 0 {
 			out.serviceNeeded = append(out.serviceNeeded, "tea_"+teaBagFlavor)
 		}
@@ -492,7 +553,7 @@ type refillOutcome struct {
 // refill tops the named tank/hopper to its maximum and records a RefillEvent for
 // the amount added. A full tank is a no-op (alreadyFull=true).
 func (m *Module) refill(guildID, userID, partKey string) (refillOutcome, error) {
-	p, found := refillPartByKey(partKey)
+	p, found := m.machineCaps().refillPartByKey(partKey)
 	if !found {
 		return refillOutcome{}, fmt.Errorf("unknown part %q", partKey)
 	}
@@ -507,7 +568,7 @@ func (m *Module) refill(guildID, userID, partKey string) (refillOutcome, error)
 	defer m.machineMu.Unlock()
 
 	err := d.Transaction(func(tx *gorm.DB) error {
-		inv, e := seedInventoryTx(tx, guildID)
+		inv, e := seedInventoryTx(tx, guildID, m.machineCaps())
 		if e != nil {
 			return e
 		}
@@ -572,7 +633,7 @@ func (m *Module) emptyGrounds(guildID, userID string) (emptyOutcome, error) {
 	defer m.machineMu.Unlock()
 
 	err := d.Transaction(func(tx *gorm.DB) error {
-		inv, e := seedInventoryTx(tx, guildID)
+		inv, e := seedInventoryTx(tx, guildID, m.machineCaps())
 		if e != nil {
 			return e
 		}
@@ -702,21 +763,21 @@ func blockedFallback(out dispenseOutcome) string {
 // formatStatus renders the machine status, levels, and stat leaderboards. The
 // per-drink and per-part breakdowns live in /coffeemachine stats; this view
 // keeps one headline number per leaderboard.
-func formatStatus(inv MachineInventory, drinkers, refillers []userCount, emptiers []groundsEmptier, slackers []userCount, teaBags []TeaBagInventory) string {
+func formatStatus(c capacities, inv MachineInventory, drinkers, refillers []userCount, emptiers []groundsEmptier, slackers []userCount, teaBags []TeaBagInventory) string {
 	var sb strings.Builder
 	sb.WriteString("☕ **Coffee machine status**\n")
-	fmt.Fprintf(&sb, "Mild beans: %d/%dg (%d%%)\n", inv.BeansMildGrams, maxBeansMildG, percent(inv.BeansMildGrams, maxBeansMildG))
-	fmt.Fprintf(&sb, "Espresso beans: %d/%dg (%d%%)\n", inv.BeansEspressoGrams, maxBeansEspressoG, percent(inv.BeansEspressoGrams, maxBeansEspressoG))
-	fmt.Fprintf(&sb, "Water: %d/%dml (%d%%)\n", inv.WaterMl, maxWaterMl, percent(inv.WaterMl, maxWaterMl))
-	fmt.Fprintf(&sb, "Milk: %d/%dml (%d%%)\n", inv.MilkMl, maxMilkMl, percent(inv.MilkMl, maxMilkMl))
-	fmt.Fprintf(&sb, "Grounds: %d/%dg (%d%%)\n", inv.GroundsGrams, maxGroundsG, percent(inv.GroundsGrams, maxGroundsG))
+	fmt.Fprintf(&sb, "Mild beans: %d/%dg (%d%%)\n", inv.BeansMildGrams, c.beansMildG, percent(inv.BeansMildGrams, c.beansMildG))
+	fmt.Fprintf(&sb, "Espresso beans: %d/%dg (%d%%)\n", inv.BeansEspressoGrams, c.beansEspressoG, percent(inv.BeansEspressoGrams, c.beansEspressoG))
+	fmt.Fprintf(&sb, "Water: %d/%dml (%d%%)\n", inv.WaterMl, c.waterMl, percent(inv.WaterMl, c.waterMl))
+	fmt.Fprintf(&sb, "Milk: %d/%dml (%d%%)\n", inv.MilkMl, c.milkMl, percent(inv.MilkMl, c.milkMl))
+	fmt.Fprintf(&sb, "Grounds: %d/%dg (%d%%)\n", inv.GroundsGrams, c.groundsG, percent(inv.GroundsGrams, c.groundsG))
 
 	if len(teaBags) > 0 {
 		sb.WriteString("\n**Tea bags**\n")
 		for _, tb := range teaBags {
 			fmt.Fprintf(&sb, "🍵 %s: %d/%d bags (%d%%)\n",
-				teaFlavorLabel(tb.Flavor)+" tea", tb.Count, maxTeaBagsPerFlavor,
-				percent(tb.Count, maxTeaBagsPerFlavor))
+				teaFlavorLabel(tb.Flavor)+" tea", tb.Count, c.teaBagsPerFlavor,
+				percent(tb.Count, c.teaBagsPerFlavor))
 		}
 	}
 
@@ -1054,7 +1115,7 @@ func (m *Module) handleMachineInteraction(s *discordgo.Session, i *discordgo.Int
 		emptiers, _ := m.topGroundsEmptiers(i.GuildID, 3)
 		slackers, _ := m.topSlackers(i.GuildID, 3)
 		teaBags, _ := m.getTeaBagInventory(i.GuildID)
-		m.finishMachineInteraction(s, i, formatStatus(inv, drinkers, refillers, emptiers, slackers, teaBags), true)
+		m.finishMachineInteraction(s, i, formatStatus(m.machineCaps(), inv, drinkers, refillers, emptiers, slackers, teaBags), true)
 
 	case "stats":
 		targetID := userID
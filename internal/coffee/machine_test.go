@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/bot"
+	"github.com/toksikk/gidbig/internal/cfg"
 )
 
 // setLevels mutates the guild's inventory directly, for arranging test states.
@@ -321,6 +323,76 @@ func TestRefill_TopsToMaxAndRecords(t *testing.T) {
 	}
 }
 
+func TestConfiguredCapacities_SeedAndRefill(t *testing.T) {
+	m := newTestModule(t)
+	m.caps = capacitiesFromConfig(cfg.CoffeeConfig{WaterMl: 3000, TeaBagsPerFlavor: 10})
+
+	inv, err := m.getOrSeedInventory("g1")
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if inv.WaterMl != 3000 || inv.MilkMl != maxMilkMl {
+		t.Errorf("seeded inventory = %+v, want 3000ml water and default milk", inv)
+	}
+	setLevels(m, t, "g1", func(inv *MachineInventory) { inv.WaterMl = 500 })
+	out, err := m.refill("g1", "user1", "water")
+	if err != nil {
+		t.Fatalf("refill: %v", err)
+	}
+	if out.inventory.WaterMl != 3000 || out.added != 2500 {
+		t.Errorf("refill = %d (+%d), want 3000 (+2500)", out.inventory.WaterMl, out.added)
+	}
+
+	teaBags, err := m.getTeaBagInventory("g1")
+	if err != nil {
+		t.Fatalf("tea bags: %v", err)
+	}
+	if teaBags[0].Count != 10 {
+		t.Errorf("seeded tea bags = %d, want capped seed of 10", teaBags[0].Count)
+	}
+	if got := formatStatus(m.caps, inv, nil, nil, nil, nil, nil); !strings.Contains(got, "Water: 3000/3000ml (100%)") {
+		t.Errorf("status should use configured capacity: %q", got)
+	}
+}
+
+func TestReconfigure_Capacities(t *testing.T) {
+	m := newTestModule(t)
+	var _ bot.Reconfigurable = m
+
+	bad := &cfg.Config{}
+	bad.Modules.Coffee.MilkMl = 10
+	if err := m.Reconfigure(bad); err == nil {
+		t.Fatal("expected too-small milk capacity to be rejected")
+	}
+	if m.machineCaps() != defaultCapacities {
+		t.Fatal("a rejected reload must keep the previous capacities")
+	}
+
+	good := &cfg.Config{}
+	good.Modules.Coffee.MilkMl = 1500
+	if err := m.Reconfigure(good); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	setLevels(m, t, "g1", func(inv *MachineInventory) { inv.MilkMl = 0 })
+	out, err := m.refill("g1", "user1", "milk")
+	if err != nil {
+		t.Fatalf("refill: %v", err)
+	}
+	if out.inventory.MilkMl != 1500 {
+		t.Errorf("milk = %d, want reloaded capacity 1500", out.inventory.MilkMl)
+	}
+}
+
+func TestCapacitiesValidate(t *testing.T) {
+	if err := defaultCapacities.validate(); err != nil {
+		t.Fatalf("default capacities invalid: %v", err)
+	}
+	tiny := capacitiesFromConfig(cfg.CoffeeConfig{WaterMl: 100})
+	if err := tiny.validate(); err == nil || !strings.Contains(err.Error(), "water") {
+		t.Errorf("expected water capacity error, got %v", err)
+	}
+}
+
 func TestRefill_AlreadyFull(t *testing.T) {
 	m := newTestModule(t)
 	out, err := m.refill("g1", "user1", "milk") // fresh machine, milk already full
@@ -651,7 +723,7 @@ func TestTeaFlavorLabel(t *testing.T) {
 
 func TestFormatStatus(t *testing.T) {
 	inv := MachineInventory{BeansMildGrams: 500, BeansEspressoGrams: 1000, WaterMl: 1000, MilkMl: 1000, GroundsGrams: 250}
-	got := formatStatus(inv,
+	got := formatStatus(defaultCapacities, inv,
 		[]userCount{{UserID: "A", Count: 3}},
 		nil,
 		[]groundsEmptier{{UserID: "A", Count: 2, TotalGrams: 480}},
@@ -679,7 +751,7 @@ func TestFormatStatus(t *testing.T) {
 
 func TestFormatStatus_NoSlackersHidesSection(t *testing.T) {
 	inv := MachineInventory{}
-	got := formatStatus(inv, nil, nil, nil, nil, nil)
+	got := formatStatus(defaultCapacities, inv, nil, nil, nil, nil, nil)
 	if strings.Contains(got, "Slackers") {
 		t.Errorf("slacker section should be hidden when there are none: %q", got)
 	}
@@ -1136,11 +1208,11 @@ func TestMaxPartDemand(t *testing.T) {
 
 func TestPartsNeedingService(t *testing.T) {
 	full := MachineInventory{BeansMildGrams: maxBeansMildG, BeansEspressoGrams: maxBeansEspressoG, WaterMl: maxWaterMl, MilkMl: maxMilkMl, GroundsGrams: 0}
-	if parts := partsNeedingService(full); len(parts) != 0 {
+	if parts := defaultCapacities.partsNeedingService(full); len(parts) != 0 {
 		t.Errorf("a full machine needs no service, got %v", parts)
 	}
 	low := MachineInventory{BeansMildGrams: 0, BeansEspressoGrams: maxBeansEspressoG, WaterMl: maxWaterMl, MilkMl: maxMilkMl, GroundsGrams: maxGroundsG}
-	parts := partsNeedingService(low)
+	parts := defaultCapacities.partsNeedingService(low)
 	if !slices.Contains(parts, "beans_mild") || !slices.Contains(parts, partGrounds) {
 		t.Errorf("expected beans_mild and grounds to need service, got %v", parts)
 	}
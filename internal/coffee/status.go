@@ -0,0 +1,84 @@
+package coffee
+
+import "strings"
+
+// statusLeaders is how many users each leaderboard of Status lists.
+const statusLeaders = 3
+
+// MachineStatus is a snapshot of a guild's coffee machine for the web API.
+type MachineStatus struct {
+	Levels []PartLevel `json:"levels"`
+	// NeedsService lists the parts low (or, for grounds, full) enough to
+	// block the next brew of some drink.
+	NeedsService []string    `json:"needs_service"`
+	TopBaristas  []UserTally `json:"top_baristas"`
+	TopRefillers []UserTally `json:"top_refillers"`
+	TopSlackers  []UserTally `json:"top_slackers"`
+}
+
+// PartLevel is the fill level of a tank, hopper, tea variety or the grounds
+// container.
+type PartLevel struct {
+	Part     string `json:"part"`
+	Label    string `json:"label"`
+	Level    int    `json:"level"`
+	Capacity int    `json:"capacity"`
+	Unit     string `json:"unit"`
+	Percent  int    `json:"percent"`
+}
+
+// UserTally is a leaderboard entry.
+type UserTally struct {
+	UserID string `json:"user_id"`
+	Count  int    `json:"count"`
+}
+
+// Status returns the machine of guildID with the same leaderboards as
+// /coffeemachine status, seeding a full machine on first use.
+func (m *Module) Status(guildID string) (MachineStatus, error) {
+	inv, err := m.getOrSeedInventory(guildID)
+	if err != nil {
+		return MachineStatus{}, err
+	}
+	teaBags, err := m.getTeaBagInventory(guildID)
+	if err != nil {
+		return MachineStatus{}, err
+	}
+	caps := m.machineCaps()
+	levels := map[string]int{
+		"beans_mild":     inv.BeansMildGrams,
+		"beans_espresso": inv.BeansEspressoGrams,
+		"water":          inv.WaterMl,
+		"milk":           inv.MilkMl,
+	}
+	for _, tb := range teaBags {
+		levels["tea_"+tb.Flavor] = tb.Count
+	}
+
+	st := MachineStatus{NeedsService: append([]string{}, caps.partsNeedingService(inv)...)}
+	for _, p := range caps.refillParts() {
+		st.Levels = append(st.Levels, PartLevel{Part: p.key, Label: p.label, Level: levels[p.key],
+			Capacity: p.max, Unit: strings.TrimSpace(p.unit), Percent: percent(levels[p.key], p.max)})
+	}
+	st.Levels = append(st.Levels, PartLevel{Part: partGrounds, Label: "Grounds container", Level: inv.GroundsGrams,
+		Capacity: caps.groundsG, Unit: "g", Percent: percent(inv.GroundsGrams, caps.groundsG)})
+
+	for _, board := range []struct {
+		dst *[]UserTally
+		top func(string, int) ([]userCount, error)
+	}{
+		{&st.TopBaristas, m.topDrinkers},
+		{&st.TopRefillers, m.topRefillers},
+		{&st.TopSlackers, m.topSlackers},
+	} {
+		rows, err := board.top(guildID, statusLeaders)
+		if err != nil {
+			return MachineStatus{}, err
+		}
+		*board.dst = make([]UserTally, 0, len(rows))
+		for _, r := range rows {
+			*board.dst = append(*board.dst, UserTally{UserID: r.UserID, Count: r.Count})
+		}
+	}
+	return st, nil
+}
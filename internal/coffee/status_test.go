@@ -0,0 +1,43 @@
+package coffee
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	m := newTestModule(t)
+	for _, user := range []string{"user1", "user2", "user1"} {
+		if _, err := m.dispense("g1", user, "coffee", false, false); err != nil {
+			t.Fatalf("dispense: %v", err)
+		}
+		m.getDB().Model(&DrinkOrder{}).Where("user_id = ?", user).Update("status", orderStatusPickedUp)
+	}
+	setLevels(m, t, "g1", func(inv *MachineInventory) { inv.MilkMl = 0 })
+
+	st, err := m.Status("g1")
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	milk := st.Levels[slices.IndexFunc(st.Levels, func(p PartLevel) bool { return p.Part == "milk" })]
+	if milk.Level != 0 || milk.Capacity != maxMilkMl || milk.Unit != "ml" || milk.Percent != 0 {
+		t.Errorf("milk = %+v, want empty", milk)
+	}
+	grounds := st.Levels[len(st.Levels)-1]
+	if grounds.Part != partGrounds || grounds.Level == 0 || grounds.Unit != "g" {
+		t.Errorf("last level = %+v, want the used grounds", grounds)
+	}
+	if !slices.Contains(st.NeedsService, "milk") {
+		t.Errorf("NeedsService = %v, want milk", st.NeedsService)
+	}
+	if want := []UserTally{{"user1", 2}, {"user2", 1}}; !slices.Equal(st.TopBaristas, want) {
+		t.Errorf("TopBaristas = %v, want %v", st.TopBaristas, want)
+	}
+	if st.TopRefillers == nil || len(st.TopRefillers) != 0 {
+		t.Errorf("TopRefillers = %#v, want an empty list", st.TopRefillers)
+	}
+	tea := slices.IndexFunc(st.Levels, func(p PartLevel) bool { return p.Part == "tea_"+teaFlavors[0].key })
+	if tea < 0 || st.Levels[tea].Level != seedTeaBagsPerFlavor || st.Levels[tea].Unit != "bags" {
+		t.Errorf("levels = %+v, want the seeded tea bags", st.Levels)
+	}
+}
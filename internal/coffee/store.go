@@ -143,7 +143,7 @@ type SlackerEvent struct {
 func (SlackerEvent) TableName() string { return "coffee_slacker_events" }
 
 // TeaBagInventory tracks tea bag counts per guild and tea variety. Seeded at
-// first use with seedTeaBagsPerFlavor bags; capped at maxTeaBagsPerFlavor.
+// first use with seedTeaBagsPerFlavor bags; capped at the configured capacity.
 // Exactly one row per (guild_id, flavor).
 type TeaBagInventory struct {
 	gorm.Model
@@ -493,12 +493,13 @@ func clearPendingServiceTx(tx *gorm.DB, guildID, part string) error {
 }
 
 // getOrSeedTeaBagTx loads or creates the TeaBagInventory row for the given
-// guild and flavor. New rows start with seedTeaBagsPerFlavor bags. Must be
-// called inside a transaction that holds machineMu.
-func getOrSeedTeaBagTx(tx *gorm.DB, guildID, flavor string) (TeaBagInventory, error) {
+// guild and flavor. New rows start with seedTeaBagsPerFlavor bags, or a full
+// box if the configured capacity is smaller. Must be called inside a
+// transaction that holds machineMu.
+func getOrSeedTeaBagTx(tx *gorm.DB, guildID, flavor string, c capacities) (TeaBagInventory, error) {
 	var tb TeaBagInventory
 	err := tx.Where(TeaBagInventory{GuildID: guildID, Flavor: flavor}).
-		Attrs(TeaBagInventory{Count: seedTeaBagsPerFlavor}).
+		Attrs(TeaBagInventory{Count: min(seedTeaBagsPerFlavor, c.teaBagsPerFlavor)}).
 		FirstOrCreate(&tb).Error
 	return tb, err
 }
@@ -513,7 +514,7 @@ func (m *Module) getTeaBagInventory(guildID string) ([]TeaBagInventory, error) {
 	var rows []TeaBagInventory
 	err := d.Transaction(func(tx *gorm.DB) error {
 		for _, t := range teaFlavors {
-			if _, e := getOrSeedTeaBagTx(tx, guildID, t.key); e != nil {
+			if _, e := getOrSeedTeaBagTx(tx, guildID, t.key, m.machineCaps()); e != nil {
 				return e
 			}
 		}
@@ -530,7 +531,7 @@ type refillTeaBagsOutcome struct {
 	alreadyFull bool
 }
 
-// refillTeaBags tops up tea bags of the given flavor to maxTeaBagsPerFlavor for
+// refillTeaBags tops up tea bags of the given flavor to the configured capacity for
 // the guild and records a RefillEvent for the amount added.
 func (m *Module) refillTeaBags(guildID, userID, flavor string) (refillTeaBagsOutcome, error) {
 	d := m.getDB()
@@ -543,19 +544,20 @@ func (m *Module) refillTeaBags(guildID, userID, flavor string) (refillTeaBagsOut
 	defer m.machineMu.Unlock()
 
 	err := d.Transaction(func(tx *gorm.DB) error {
-		tb, e := getOrSeedTeaBagTx(tx, guildID, flavor)
+		capacity := m.machineCaps().teaBagsPerFlavor
+		tb, e := getOrSeedTeaBagTx(tx, guildID, flavor, m.machineCaps())
 		if e != nil {
 			return e
 		}
 		if e = clearPendingServiceTx(tx, guildID, "tea_"+flavor); e != nil {
 			return e
 		}
-		if tb.Count >= maxTeaBagsPerFlavor {
+		if tb.Count >= capacity {
 			out.alreadyFull = true
 			return nil
 		}
-		added := maxTeaBagsPerFlavor - tb.Count
-		tb.Count = maxTeaBagsPerFlavor
+		added := capacity - tb.Count
+		tb.Count = capacity
 		if e = tx.Save(&tb).Error; e != nil {
 			return e
 		}
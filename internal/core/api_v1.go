@@ -0,0 +1,568 @@
+package gidbig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toksikk/gidbig/internal/coffee"
+	"github.com/toksikk/gidbig/internal/leetoclock"
+)
+
+const (
+	// apiV1Prefix is the path the versioned web API is served under.
+	apiV1Prefix = "/api/v1"
+
+	// maxAPIBody bounds the JSON body of an API request.
+	maxAPIBody = 4096
+
+	// defaultScoreboards and maxScoreboards bound how many games the
+	// leetoclock endpoint returns.
+	defaultScoreboards = 10
+	maxScoreboards     = 100
+)
+
+// coffeeStatus is the part of the coffee module the web API reads.
+type coffeeStatus interface {
+	Status(guildID string) (coffee.MachineStatus, error)
+}
+
+// leetScoreboards is the part of the leetoclock module the web API reads.
+type leetScoreboards interface {
+	Scoreboards(guildID string, limit int) ([]leetoclock.Scoreboard, error)
+}
+
+// apiRoute is an endpoint of /api/v1. The handler and the OpenAPI document
+// are both built from apiV1Routes, so the document cannot drift from what
+// the server answers.
+type apiRoute struct {
+	method string
+	// path is below apiV1Prefix, with path parameters in braces
+	path    string
+	summary string
+	// scope is what a token needs to call the route; public routes, which
+	// answer without a logged-in user, have none
+	scope  string
+	params []apiParam
+	// request is the type of the JSON body, nil when the route takes none
+	request  reflect.Type
+	response reflect.Type
+	// errors maps the statuses of the error responses particular to the
+	// route to what they mean
+	errors map[int]string
+	handle func(w http.ResponseWriter, r *http.Request, userID string)
+}
+
+// apiParam is a path or query parameter of an apiRoute.
+type apiParam struct {
+	name        string
+	in          string
+	description string
+	integer     bool
+}
+
+func apiV1Routes() []apiRoute {
+	guildParam := apiParam{name: "guild_id", in: "path", description: "Discord ID of a server you are a member of."}
+	return []apiRoute{
+		{
+			method:   http.MethodGet,
+			path:     "/collections",
+			summary:  "List the sound collections and their sounds",
+			scope:    scopePlay,
+			response: reflect.TypeFor[apiCollectionList](),
+			handle:   apiListCollections,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/collections/{prefix}",
+			summary:  "Get a sound collection and its sounds",
+			scope:    scopePlay,
+			params:   []apiParam{{name: "prefix", in: "path", description: "Prefix or command of the collection."}},
+			response: reflect.TypeFor[apiCollection](),
+			errors:   map[int]string{http.StatusNotFound: "unknown_collection"},
+			handle:   apiGetCollection,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/play",
+			summary:  "Queue a sound in your voice channel",
+			scope:    scopePlay,
+			request:  reflect.TypeFor[apiPlayRequest](),
+			response: reflect.TypeFor[playSoundResponse](),
+			errors: map[int]string{
+				http.StatusForbidden:           "forbidden, role_denied, channel_restricted",
+				http.StatusNotFound:            "unknown_collection, unknown_sound, unknown_guild",
+				http.StatusConflict:            "not_in_voice",
+				http.StatusUnprocessableEntity: "empty_collection",
+				http.StatusTooManyRequests:     "queue_full, cooldown, daily_cap",
+			},
+			handle: apiPlay,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/queue",
+			summary:  "Show what is playing and queued in your servers",
+			scope:    scopePlay,
+			response: reflect.TypeFor[apiQueue](),
+			handle:   apiGetQueue,
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/guilds/{guild_id}/stats",
+			summary: "Show the soundboard statistics of a server",
+			scope:   scopeStats,
+			params: []apiParam{guildParam, {name: "range", in: "query",
+				description: "One of " + strings.Join(statsRangeKeys(), ", ") + "; week by default."}},
+			response: reflect.TypeFor[soundStats](),
+			errors: map[int]string{
+				http.StatusBadRequest: "bad_request",
+				http.StatusForbidden:  "forbidden",
+			},
+			handle: apiGetStats,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/guilds/{guild_id}/coffee",
+			summary:  "Show the coffee machine of a server",
+			scope:    scopeStats,
+			params:   []apiParam{guildParam},
+			response: reflect.TypeFor[coffee.MachineStatus](),
+			errors: map[int]string{
+				http.StatusForbidden:          "forbidden",
+				http.StatusServiceUnavailable: "module_disabled",
+			},
+			handle: apiGetCoffee,
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/guilds/{guild_id}/leetoclock",
+			summary: "Show the leetoclock scoreboards of a server, newest first",
+			scope:   scopeStats,
+			params: []apiParam{guildParam, {name: "limit", in: "query", integer: true,
+				description: fmt.Sprintf("Number of games, %d by default and at most %d.", defaultScoreboards, maxScoreboards)}},
+			response: reflect.TypeFor[apiScoreboardList](),
+			errors: map[int]string{
+				http.StatusBadRequest:         "bad_request",
+				http.StatusForbidden:          "forbidden",
+				http.StatusServiceUnavailable: "module_disabled",
+			},
+			handle: apiGetLeetoclock,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/openapi.json",
+			summary:  "This OpenAPI document",
+			response: reflect.TypeFor[map[string]any](),
+			handle: func(w http.ResponseWriter, r *http.Request, _ string) {
+				writeJSON(w, http.StatusOK, openAPIDocument(apiV1Routes()))
+			},
+		},
+	}
+}
+
+// apiV1Handler serves /api/v1. Every answer, including unknown paths and
+// methods, has a JSON body.
+func apiV1Handler() http.Handler {
+	mux := http.NewServeMux()
+	allowed := make(map[string][]string)
+	for _, route := range apiV1Routes() {
+		mux.HandleFunc(route.method+" "+apiV1Prefix+route.path, route.serve)
+		allowed[route.path] = append(allowed[route.path], route.method)
+	}
+	// The patterns without a method only match what the routes above do not.
+	for path, methods := range allowed {
+		mux.HandleFunc(apiV1Prefix+path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use "+strings.Join(methods, " or ")+".")
+		})
+	}
+	mux.HandleFunc(apiV1Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "not_found", "No such API endpoint.")
+	})
+	return mux
+}
+
+func (route apiRoute) serve(w http.ResponseWriter, r *http.Request) {
+	if route.scope == "" {
+		route.handle(w, r, "")
+		return
+	}
+	userID, ok := apiUser(w, r, route.scope)
+	if !ok {
+		return
+	}
+	route.handle(w, r, userID)
+}
+
+// decodeJSON reads the single JSON object in the body of r into v. It writes
+// the error response itself when the body is refused.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/json.")
+		return false
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body: "+err.Error())
+		return false
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_json", "The body must contain one JSON object.")
+		return false
+	}
+	return true
+}
+
+// apiCollectionList is the body of GET /collections.
+type apiCollectionList struct {
+	Collections []apiCollection `json:"collections"`
+}
+
+// apiCollection is a sound collection as the web API shows it.
+type apiCollection struct {
+	Prefix      string     `json:"prefix"`
+	DisplayName string     `json:"display_name,omitempty"`
+	Commands    []string   `json:"commands"`
+	Tags        []string   `json:"tags"`
+	Sounds      []apiSound `json:"sounds"`
+}
+
+// apiSound is a sound of an apiCollection.
+type apiSound struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags"`
+	DurationMs  int64    `json:"duration_ms"`
+}
+
+func newAPICollection(c *soundCollection) apiCollection {
+	ac := apiCollection{
+		Prefix:      c.Prefix,
+		DisplayName: c.DisplayName,
+		Commands:    append([]string{}, c.Commands...),
+		Tags:        append([]string{}, c.Tags...),
+		Sounds:      make([]apiSound, 0, len(c.Sounds)),
+	}
+	for _, snd := range c.Sounds {
+		as := apiSound{
+			Name:        snd.Name,
+			DisplayName: snd.DisplayName,
+			Tags:        append([]string{}, snd.Tags...),
+			DurationMs:  snd.meta.Duration.Milliseconds(),
+		}
+		if d := snd.description; d != nil {
+			as.Description = d.Text
+		}
+		ac.Sounds = append(ac.Sounds, as)
+	}
+	return ac
+}
+
+func apiListCollections(w http.ResponseWriter, r *http.Request, userID string) {
+	list := apiCollectionList{Collections: []apiCollection{}}
+	for _, c := range webCollections(userID) {
+		list.Collections = append(list.Collections, newAPICollection(c))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// apiCollectionFor returns the collection named by command if userID may see
+// it in the web UI.
+func apiCollectionFor(userID, command string) *soundCollection {
+	coll := collectionByCommand(command)
+	if coll == nil {
+		return nil
+	}
+	for _, c := range webCollections(userID) {
+		if c == coll {
+			return coll
+		}
+	}
+	return nil
+}
+
+func apiGetCollection(w http.ResponseWriter, r *http.Request, userID string) {
+	coll := apiCollectionFor(userID, r.PathValue("prefix"))
+	if coll == nil {
+		writeJSONError(w, http.StatusNotFound, "unknown_collection", fmt.Sprintf("There is no collection !%s.", strings.TrimPrefix(r.PathValue("prefix"), "!")))
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPICollection(coll))
+}
+
+// apiPlayRequest is the body of POST /play. Without a sound a random one of
+// the collection plays; without a guild the sound plays in the voice channel
+// the user is in.
+type apiPlayRequest struct {
+	Collection string `json:"collection"`
+	Sound      string `json:"sound,omitempty"`
+	GuildID    string `json:"guild_id,omitempty"`
+}
+
+func apiPlay(w http.ResponseWriter, r *http.Request, userID string) {
+	var req apiPlayRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	coll := apiCollectionFor(userID, req.Collection)
+	if coll == nil {
+		writePlayResult(w, enqueueResult{Status: enqueueUnknownCollection, Prefix: strings.TrimPrefix(req.Collection, "!")})
+		return
+	}
+	guildID := req.GuildID
+	if guildID == "" {
+		guild := voiceGuild(userID)
+		if guild == nil {
+			writePlayResult(w, enqueueResult{Status: enqueueNotInVoice, Prefix: coll.Prefix})
+			return
+		}
+		guildID = guild.ID
+	}
+	member, err := lookupMember(guildID, userID)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "You are not a member of this server.")
+		return
+	}
+	guild, err := discord.State.Guild(guildID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "unknown_guild", "The bot is not in this server.")
+		return
+	}
+	slog.Info("API play request", "user", userID, "guild", guildID, "collection", coll.Prefix, "sound", req.Sound)
+	writePlayResult(w, requestPlay(member.User, guild, coll, req.Sound, sourceWeb))
+}
+
+// apiQueue is the body of GET /queue.
+type apiQueue struct {
+	Guilds []guildQueueStatus `json:"guilds"`
+}
+
+func apiGetQueue(w http.ResponseWriter, r *http.Request, userID string) {
+	writeJSON(w, http.StatusOK, apiQueue{Guilds: queueStatuses(userID)})
+}
+
+// apiGuild returns the guild_id path parameter of r if userID is a member of
+// that guild. It writes the error response itself otherwise.
+func apiGuild(w http.ResponseWriter, r *http.Request, userID string) (string, bool) {
+	guildID := r.PathValue("guild_id")
+	if !isGuildMember(guildID, userID) {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "You are not a member of this server.")
+		return "", false
+	}
+	return guildID, true
+}
+
+func apiGetStats(w http.ResponseWriter, r *http.Request, userID string) {
+	rng := findStatsRange(r.URL.Query().Get("range"))
+	if key := r.URL.Query().Get("range"); key != "" && key != rng.Key {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "range must be one of "+strings.Join(statsRangeKeys(), ", ")+".")
+		return
+	}
+	guildID, ok := apiGuild(w, r, userID)
+	if !ok {
+		return
+	}
+	stats, err := loadSoundStats(guildID, rng.Since(time.Now()))
+	if err != nil {
+		slog.Error("API could not load sound stats", "guild", guildID, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Could not load the statistics.")
+		return
+	}
+	// Send empty lists rather than null
+	stats.TopSounds = append([]soundCount{}, stats.TopSounds...)
+	stats.TopUsers = append([]userPlayCount{}, stats.TopUsers...)
+	stats.NeverPlayed = append([]string{}, stats.NeverPlayed...)
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func apiGetCoffee(w http.ResponseWriter, r *http.Request, userID string) {
+	guildID, ok := apiGuild(w, r, userID)
+	if !ok {
+		return
+	}
+	if coffeeMod == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "module_disabled", "The coffee module is disabled.")
+		return
+	}
+	status, err := coffeeMod.Status(guildID)
+	if err != nil {
+		slog.Error("API could not read the coffee machine", "guild", guildID, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Could not read the coffee machine.")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// apiScoreboardList is the body of GET /guilds/{guild_id}/leetoclock.
+type apiScoreboardList struct {
+	Scoreboards []leetoclock.Scoreboard `json:"scoreboards"`
+}
+
+func apiGetLeetoclock(w http.ResponseWriter, r *http.Request, userID string) {
+	limit := defaultScoreboards
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxScoreboards {
+			writeJSONError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("limit must be a number from 1 to %d.", maxScoreboards))
+			return
+		}
+		limit = n
+	}
+	guildID, ok := apiGuild(w, r, userID)
+	if !ok {
+		return
+	}
+	if leetMod == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "module_disabled", "The leetoclock module is disabled.")
+		return
+	}
+	boards, err := leetMod.Scoreboards(guildID, limit)
+	if err != nil {
+		slog.Error("API could not read the leetoclock scoreboards", "guild", guildID, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Could not read the scoreboards.")
+		return
+	}
+	writeJSON(w, http.StatusOK, apiScoreboardList{Scoreboards: boards})
+}
+
+// openAPIDocument describes routes as an OpenAPI 3.1 document, deriving the
+// schemas from the JSON encoding of the request and response types.
+func openAPIDocument(routes []apiRoute) map[string]any {
+	schemas := make(map[string]any)
+	errorContent := jsonContent(jsonSchema(reflect.TypeFor[apiError](), schemas))
+	paths := make(map[string]map[string]any)
+	for _, route := range routes {
+		errs := maps.Clone(route.errors)
+		if errs == nil {
+			errs = make(map[int]string)
+		}
+		op := map[string]any{"summary": route.summary}
+		if route.scope != "" {
+			op["security"] = []map[string][]string{{"session": {}}, {"token": {route.scope}}}
+			errs[http.StatusUnauthorized] = "unauthorized, invalid_token"
+			errs[http.StatusForbidden] = strings.TrimPrefix(errs[http.StatusForbidden]+", insufficient_scope", ", ")
+		}
+		if route.request != nil {
+			op["requestBody"] = map[string]any{"required": true, "content": jsonContent(jsonSchema(route.request, schemas))}
+			errs[http.StatusBadRequest] = strings.TrimPrefix(errs[http.StatusBadRequest]+", invalid_json", ", ")
+			errs[http.StatusUnsupportedMediaType] = "unsupported_media_type"
+		}
+		if len(route.params) > 0 {
+			var params []map[string]any
+			for _, p := range route.params {
+				typ := "string"
+				if p.integer {
+					typ = "integer"
+				}
+				params = append(params, map[string]any{
+					"name":        p.name,
+					"in":          p.in,
+					"required":    p.in == "path",
+					"description": p.description,
+					"schema":      map[string]string{"type": typ},
+				})
+			}
+			op["parameters"] = params
+		}
+		responses := map[string]any{
+			"200": map[string]any{"description": "OK", "content": jsonContent(jsonSchema(route.response, schemas))},
+		}
+		for status, codes := range errs {
+			responses[strconv.Itoa(status)] = map[string]any{"description": codes, "content": errorContent}
+		}
+		op["responses"] = responses
+		if paths[route.path] == nil {
+			paths[route.path] = make(map[string]any)
+		}
+		paths[route.path][strings.ToLower(route.method)] = op
+	}
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info":    map[string]string{"title": "gidbig", "version": currentVersion()},
+		"servers": []map[string]string{{"url": apiV1Prefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"session": map[string]string{"type": "apiKey", "in": "cookie", "name": sessionCookieName},
+				"token":   map[string]string{"type": "http", "scheme": "bearer", "description": "A personal API token from /tokens."},
+			},
+		},
+	}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// jsonSchema returns the schema of the JSON encoding of t. Structs are added
+// to schemas under their schemaName and referenced.
+func jsonSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonSchema(t.Elem(), schemas)
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = nil // claimed before the fields so recursive types end
+			props := make(map[string]any)
+			var required []string
+			for i := range t.NumField() {
+				f := t.Field(i)
+				tag, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+				if !f.IsExported() || tag == "-" {
+					continue
+				}
+				if tag == "" {
+					tag = f.Name
+				}
+				props[tag] = jsonSchema(f.Type, schemas)
+				if !strings.Contains(opts, "omitempty") {
+					required = append(required, tag)
+				}
+			}
+			schema := map[string]any{"type": "object", "properties": props}
+			if len(required) > 0 {
+				schema["required"] = required
+			}
+			schemas[name] = schema
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// schemaName names the schema of a struct after its Go type, without the api
+// prefix of the types private to the web API.
+func schemaName(t reflect.Type) string {
+	name := strings.TrimPrefix(t.Name(), "api")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,251 @@
+package gidbig
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/toksikk/gidbig/internal/cfg"
+	"github.com/toksikk/gidbig/internal/coffee"
+	"github.com/toksikk/gidbig/internal/leetoclock"
+)
+
+// serveAPI sends req to /api/v1 and decodes the JSON answer into v.
+func serveAPI(t *testing.T, req *http.Request, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	apiV1Handler().ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s: Content-Type = %q, want JSON", req.Method, req.URL, ct)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s %s: decode %q: %v", req.Method, req.URL, w.Body, err)
+	}
+	return w
+}
+
+// jsonRequest is an authedRequest with a JSON body.
+func jsonRequest(t *testing.T, method, target, userID, body string) *http.Request {
+	t.Helper()
+	req := authedRequest(t, method, target, userID, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestAPIV1_errors(t *testing.T) {
+	testSoundSession(t, true)
+	useCollections(t)
+	textBody := authedRequest(t, http.MethodPost, "/api/v1/play", "user-1", strings.NewReader(`{"collection":"horn"}`))
+	textBody.Header.Set("Content-Type", "text/plain")
+	cases := []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"unknown path", authedRequest(t, http.MethodGet, "/api/v1/nope", "user-1", nil), http.StatusNotFound, "not_found"},
+		{"wrong method", authedRequest(t, http.MethodGet, "/api/v1/play", "user-1", nil), http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"logged out", httptest.NewRequest(http.MethodGet, "/api/v1/queue", nil), http.StatusUnauthorized, "unauthorized"},
+		{"not JSON", textBody, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"unknown field", jsonRequest(t, http.MethodPost, "/api/v1/play", "user-1", `{"collection":"horn","volume":11}`), http.StatusBadRequest, "invalid_json"},
+		{"two objects", jsonRequest(t, http.MethodPost, "/api/v1/play", "user-1", `{"collection":"horn"}{}`), http.StatusBadRequest, "invalid_json"},
+		{"unknown collection", jsonRequest(t, http.MethodPost, "/api/v1/play", "user-1", `{"collection":"horn"}`), http.StatusNotFound, "unknown_collection"},
+		{"bad limit", authedRequest(t, http.MethodGet, "/api/v1/guilds/guild-1/leetoclock?limit=0", "user-1", nil), http.StatusBadRequest, "bad_request"},
+		{"other guild", authedRequest(t, http.MethodGet, "/api/v1/guilds/guild-2/coffee", "user-1", nil), http.StatusForbidden, "forbidden"},
+		{"module disabled", authedRequest(t, http.MethodGet, "/api/v1/guilds/guild-1/coffee", "user-1", nil), http.StatusServiceUnavailable, "module_disabled"},
+	}
+	for _, tc := range cases {
+		var res apiError
+		w := serveAPI(t, tc.req, &res)
+		if w.Code != tc.status || res.Error != tc.code || res.Message == "" {
+			t.Errorf("%s: got %d %+v, want %d %s", tc.name, w.Code, res, tc.status, tc.code)
+		}
+		if tc.status == http.StatusMethodNotAllowed && w.Header().Get("Allow") != http.MethodPost {
+			t.Errorf("%s: Allow = %q", tc.name, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestAPIV1Collections(t *testing.T) {
+	testSoundSession(t, false)
+	useCollections(t)
+	COLLECTIONS = []*soundCollection{
+		{Prefix: "horn", DisplayName: "Horns", Commands: []string{"!horn", "!h"}, Sounds: []*soundClip{
+			{Name: "one", DisplayName: "One", description: &soundDescription{Text: "The first horn"}},
+			{Name: "two"},
+		}},
+		{Prefix: "theirs", Commands: []string{"!theirs"}, Guilds: []string{"guild-2"}},
+	}
+
+	var list apiCollectionList
+	serveAPI(t, authedRequest(t, http.MethodGet, "/api/v1/collections", "user-1", nil), &list)
+	if len(list.Collections) != 1 {
+		t.Fatalf("collections = %+v, want horn only", list.Collections)
+	}
+	horn := list.Collections[0]
+	if horn.Prefix != "horn" || horn.DisplayName != "Horns" || !slices.Equal(horn.Commands, []string{"!horn", "!h"}) || len(horn.Sounds) != 2 {
+		t.Errorf("collection = %+v", horn)
+	}
+	if want := (apiSound{Name: "one", DisplayName: "One", Description: "The first horn", Tags: []string{}}); !equalAPISound(horn.Sounds[0], want) {
+		t.Errorf("sound = %+v, want %+v", horn.Sounds[0], want)
+	}
+
+	var coll apiCollection
+	if w := serveAPI(t, authedRequest(t, http.MethodGet, "/api/v1/collections/h", "user-1", nil), &coll); w.Code != http.StatusOK || coll.Prefix != "horn" {
+		t.Errorf("GET /collections/h = %d %+v", w.Code, coll)
+	}
+	var res apiError
+	if w := serveAPI(t, authedRequest(t, http.MethodGet, "/api/v1/collections/theirs", "user-1", nil), &res); w.Code != http.StatusNotFound || res.Error != "unknown_collection" {
+		t.Errorf("GET /collections/theirs = %d %+v, want it hidden", w.Code, res)
+	}
+}
+
+func equalAPISound(a, b apiSound) bool {
+	return a.Name == b.Name && a.DisplayName == b.DisplayName && a.Description == b.Description &&
+		slices.Equal(a.Tags, b.Tags) && a.DurationMs == b.DurationMs
+}
+
+func TestAPIV1Play(t *testing.T) {
+	testSoundSession(t, true)
+	useFakeVoice(t, 16)
+	useCollections(t)
+	usePolicy(t, cfg.SoundboardConfig{})
+	COLLECTIONS = []*soundCollection{{Prefix: "horn", Commands: []string{"!horn"}, soundRange: 1,
+		Sounds: []*soundClip{{Name: "one", Weight: 1, buffer: [][]byte{{0x01}}}}}}
+
+	var res playSoundResponse
+	w := serveAPI(t, jsonRequest(t, http.MethodPost, "/api/v1/play", "user-1", `{"collection":"horn","sound":"one"}`), &res)
+	if w.Code != http.StatusOK || res.Status != "queued" || res.Sound != "one" {
+		t.Errorf("play = %d %+v", w.Code, res)
+	}
+
+	var apiErr apiError
+	w = serveAPI(t, jsonRequest(t, http.MethodPost, "/api/v1/play", "user-1", `{"collection":"horn","sound":"two","guild_id":"guild-1"}`), &apiErr)
+	if w.Code != http.StatusNotFound || apiErr.Error != "unknown_sound" {
+		t.Errorf("unknown sound = %d %+v", w.Code, apiErr)
+	}
+	w = serveAPI(t, jsonRequest(t, http.MethodPost, "/api/v1/play", "user-1", `{"collection":"horn","guild_id":"guild-2"}`), &apiErr)
+	if w.Code != http.StatusForbidden || apiErr.Error != "forbidden" {
+		t.Errorf("other guild = %d %+v", w.Code, apiErr)
+	}
+}
+
+func TestAPIV1Queue(t *testing.T) {
+	testSoundSession(t, true)
+	usePlaying(t, &Play{Prefix: "horn", Sound: &soundClip{Name: "one"}, Username: "Alice"})
+
+	var res apiQueue
+	serveAPI(t, authedRequest(t, http.MethodGet, "/api/v1/queue", "user-1", nil), &res)
+	if len(res.Guilds) != 1 || res.Guilds[0].NowPlaying != "one" || res.Guilds[0].Queue == nil {
+		t.Errorf("queue = %+v", res)
+	}
+}
+
+type fakeModules struct {
+	guildID string
+	limit   int
+	err     error
+}
+
+func (f *fakeModules) Status(guildID string) (coffee.MachineStatus, error) {
+	f.guildID = guildID
+	return coffee.MachineStatus{NeedsService: []string{"milk"}}, f.err
+}
+
+func (f *fakeModules) Scoreboards(guildID string, limit int) ([]leetoclock.Scoreboard, error) {
+	f.guildID, f.limit = guildID, limit
+	return []leetoclock.Scoreboard{{ChannelID: "chan-1"}}, f.err
+}
+
+func TestAPIV1Modules(t *testing.T) {
+	testSoundSession(t, false)
+	fake := &fakeModules{}
+	origCoffee, origLeet := coffeeMod, leetMod
+	coffeeMod, leetMod = fake, fake
+	t.Cleanup(func() { coffeeMod, leetMod = origCoffee, origLeet })
+
+	var status coffee.MachineStatus
+	serveAPI(t, authedRequest(t, http.MethodGet, "/api/v1/guilds/guild-1/coffee", "user-1", nil), &status)
+	if fake.guildID != "guild-1" || !slices.Equal(status.NeedsService, []string{"milk"}) {
+		t.Errorf("coffee = %+v for %q", status, fake.guildID)
+	}
+
+	var boards apiScoreboardList
+	serveAPI(t, authedRequest(t, http.MethodGet, "/api/v1/guilds/guild-1/leetoclock", "user-1", nil), &boards)
+	if fake.limit != defaultScoreboards || len(boards.Scoreboards) != 1 || boards.Scoreboards[0].ChannelID != "chan-1" {
+		t.Errorf("leetoclock = %+v with limit %d", boards, fake.limit)
+	}
+	serveAPI(t, authedRequest(t, http.MethodGet, "/api/v1/guilds/guild-1/leetoclock?limit=3", "user-1", nil), &boards)
+	if fake.limit != 3 {
+		t.Errorf("limit = %d, want 3", fake.limit)
+	}
+
+	fake.err = errors.New("database is locked")
+	var res apiError
+	if w := serveAPI(t, authedRequest(t, http.MethodGet, "/api/v1/guilds/guild-1/coffee", "user-1", nil), &res); w.Code != http.StatusInternalServerError || res.Error != "internal_error" || strings.Contains(res.Message, "locked") {
+		t.Errorf("failing module = %d %+v", w.Code, res)
+	}
+}
+
+func TestAPIV1OpenAPI(t *testing.T) {
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Security    []map[string][]string `json:"security"`
+			RequestBody *struct{}             `json:"requestBody"`
+			Responses   map[string]struct {
+				Content map[string]struct {
+					Schema map[string]any `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	w := serveAPI(t, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil), &doc)
+	if w.Code != http.StatusOK || doc.OpenAPI != "3.1.0" {
+		t.Fatalf("GET /openapi.json = %d, version %q", w.Code, doc.OpenAPI)
+	}
+
+	for _, route := range apiV1Routes() {
+		op, ok := doc.Paths[route.path][strings.ToLower(route.method)]
+		if !ok {
+			t.Errorf("%s %s is not documented", route.method, route.path)
+			continue
+		}
+		public := route.scope == ""
+		if _, ok := op.Responses["401"]; ok == public || (len(op.Security) == 0) != public {
+			t.Errorf("%s %s: security %v does not match scope %q", route.method, route.path, op.Security, route.scope)
+		}
+		if (op.RequestBody != nil) != (route.request != nil) {
+			t.Errorf("%s %s: request body documented = %v", route.method, route.path, op.RequestBody != nil)
+		}
+		for status, resp := range op.Responses {
+			ref, _ := resp.Content["application/json"].Schema["$ref"].(string)
+			if name := strings.TrimPrefix(ref, "#/components/schemas/"); ref != "" {
+				if _, ok := doc.Components.Schemas[name]; !ok {
+					t.Errorf("%s %s %s: schema %s is missing", route.method, route.path, status, name)
+				}
+			}
+		}
+	}
+
+	play := doc.Components.Schemas["PlayRequest"]
+	if !slices.Equal(play.Required, []string{"collection"}) || len(play.Properties) != 3 {
+		t.Errorf("PlayRequest = %+v", play)
+	}
+	if got := doc.Components.Schemas["Scoreboard"].Properties["date"]["format"]; got != "date-time" {
+		t.Errorf("Scoreboard.date format = %v", got)
+	}
+	if errSchema := doc.Components.Schemas["Error"]; !slices.Equal(errSchema.Required, []string{"error", "message"}) {
+		t.Errorf("Error = %+v", errSchema)
+	}
+}
@@ -0,0 +1,212 @@
+package gidbig
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// apiTokenPrefix starts every API token so leaked ones are easy to spot.
+	apiTokenPrefix = "gidbig_"
+
+	// maxAPITokens is how many tokens a user may hold at once.
+	maxAPITokens = 10
+
+	// maxAPITokenName bounds the name a token is given.
+	maxAPITokenName = 50
+)
+
+// The scopes a token can be granted. Each route of /api/* needs one.
+const (
+	// scopePlay plays sounds and reads and controls the queue.
+	scopePlay = "play"
+	// scopeStats reads the statistics of the soundboard and the modules.
+	scopeStats = "stats"
+	// scopeAdmin changes sounds, as far as the owner may.
+	scopeAdmin = "admin"
+)
+
+// apiTokenScopes lists the scopes in the order the web UI shows them.
+var apiTokenScopes = []string{scopePlay, scopeStats, scopeAdmin}
+
+// APIToken is a personal token for scripts and other clients without a
+// browser. Only the SHA-256 of the token is stored; revoking soft-deletes it.
+type APIToken struct {
+	gorm.Model
+	UserID string `gorm:"not null;index"`
+	Name   string `gorm:"not null"`
+	// Scopes is the space-separated list of granted scopes.
+	Scopes string `gorm:"not null"`
+	Hash   string `gorm:"not null;uniqueIndex"`
+	// Hint is the end of the token, shown to tell tokens apart.
+	Hint       string `gorm:"not null"`
+	LastUsedAt *time.Time
+}
+
+// TableName returns the database table name.
+func (APIToken) TableName() string { return "api_tokens" }
+
+// hasScope reports whether the token was granted scope.
+func (t *APIToken) hasScope(scope string) bool {
+	return slices.Contains(strings.Fields(t.Scopes), scope)
+}
+
+// errUnknownToken refuses a token that does not exist or was revoked.
+var errUnknownToken = &manageError{http.StatusNotFound, "unknown_token", "There is no such token."}
+
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAPIToken stores a new token of userID and returns it with its secret,
+// which is not kept and cannot be shown again.
+func createAPIToken(userID, name string, scopes []string) (*APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxAPITokenName {
+		return nil, "", &manageError{http.StatusBadRequest, "invalid_name", fmt.Sprintf("Name the token with 1 to %d characters.", maxAPITokenName)}
+	}
+	invalidScope := &manageError{http.StatusBadRequest, "invalid_scope", "Pick at least one of the scopes " + strings.Join(apiTokenScopes, ", ") + "."}
+	var granted []string
+	for _, s := range apiTokenScopes {
+		if slices.Contains(scopes, s) {
+			granted = append(granted, s)
+		}
+	}
+	if len(granted) == 0 {
+		return nil, "", invalidScope
+	}
+	for _, s := range scopes {
+		if !slices.Contains(apiTokenScopes, s) {
+			return nil, "", invalidScope
+		}
+	}
+	d := getSoundDB()
+	if d == nil {
+		return nil, "", errors.New("store not initialized")
+	}
+	var held int64
+	if err := d.Model(&APIToken{}).Where("user_id = ?", userID).Count(&held).Error; err != nil {
+		return nil, "", err
+	}
+	if held >= maxAPITokens {
+		return nil, "", &manageError{http.StatusConflict, "too_many_tokens", fmt.Sprintf("You already have %d tokens, revoke one first.", maxAPITokens)}
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	secret := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	tok := &APIToken{
+		UserID: userID,
+		Name:   name,
+		Scopes: strings.Join(granted, " "),
+		Hash:   hashAPIToken(secret),
+		Hint:   secret[len(secret)-4:],
+	}
+	if err := d.Create(tok).Error; err != nil {
+		return nil, "", err
+	}
+	slog.Info("API token created", "token", tok.ID, "user", userID, "scopes", tok.Scopes)
+	return tok, secret, nil
+}
+
+// listAPITokens returns the tokens of userID, the newest first.
+func listAPITokens(userID string) ([]APIToken, error) {
+	d := getSoundDB()
+	if d == nil {
+		return nil, errors.New("store not initialized")
+	}
+	var tokens []APIToken
+	err := d.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// revokeAPIToken revokes the token id of userID.
+func revokeAPIToken(userID string, id uint) error {
+	d := getSoundDB()
+	if d == nil {
+		return errors.New("store not initialized")
+	}
+	res := d.Where("user_id = ?", userID).Delete(&APIToken{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errUnknownToken
+	}
+	slog.Info("API token revoked", "token", id, "user", userID)
+	return nil
+}
+
+// lookupAPIToken returns the token with secret and notes that it was used.
+func lookupAPIToken(secret string) (*APIToken, error) {
+	d := getSoundDB()
+	if d == nil || !strings.HasPrefix(secret, apiTokenPrefix) {
+		return nil, errUnknownToken
+	}
+	var tok APIToken
+	err := d.Where("hash = ?", hashAPIToken(secret)).First(&tok).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errUnknownToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := d.Model(&tok).Update("last_used_at", now).Error; err != nil {
+		slog.Warn("could not note API token use", "token", tok.ID, "error", err)
+	}
+	return &tok, nil
+}
+
+// apiUser returns the user a request to /api/* acts for: the owner of its
+// bearer token, which must have been granted scope, or else the logged-in
+// user, see sessionUser. It writes the error response itself when the
+// request is refused.
+func apiUser(w http.ResponseWriter, r *http.Request, scope string) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return sessionUser(w, r)
+	}
+
+	scheme, secret, _ := strings.Cut(auth, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gidbig"`)
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Use an Authorization header of the form: Bearer <token>.")
+		return "", false
+	}
+	tok, err := lookupAPIToken(strings.TrimSpace(secret))
+	if errors.Is(err, errUnknownToken) {
+		slog.Warn("API request with an unknown token", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gidbig", error="invalid_token"`)
+		writeJSONError(w, http.StatusUnauthorized, "invalid_token", "The token is unknown or was revoked.")
+		return "", false
+	}
+	if err != nil {
+		slog.Error("could not look up API token", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Could not check the token, try again later.")
+		return "", false
+	}
+	if !tok.hasScope(scope) {
+		slog.Warn("API token lacks scope", "token", tok.ID, "user", tok.UserID, "scope", scope, "method", r.Method, "path", r.URL.Path)
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="gidbig", error="insufficient_scope", scope=%q`, scope))
+		writeJSONError(w, http.StatusForbidden, "insufficient_scope", fmt.Sprintf("The token was not granted the %s scope.", scope))
+		return "", false
+	}
+	slog.Info("API token used", "token", tok.ID, "user", tok.UserID, "method", r.Method, "path", r.URL.Path)
+	return tok.UserID, true
+}
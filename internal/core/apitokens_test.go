@@ -0,0 +1,174 @@
+package gidbig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func bearerRequest(method, target, token string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestAPITokens(t *testing.T) {
+	db := useSoundStore(t)
+	testSoundSession(t, true)
+
+	for _, c := range []struct {
+		name   string
+		scopes []string
+		code   string
+	}{
+		{" ", []string{scopePlay}, "invalid_name"},
+		{strings.Repeat("x", maxAPITokenName+1), []string{scopePlay}, "invalid_name"},
+		{"button", nil, "invalid_scope"},
+		{"button", []string{scopePlay, "root"}, "invalid_scope"},
+	} {
+		var refused *manageError
+		if _, _, err := createAPIToken("user-1", c.name, c.scopes); !errors.As(err, &refused) || refused.code != c.code {
+			t.Errorf("create %q %v = %v, want %s", c.name, c.scopes, err, c.code)
+		}
+	}
+
+	tok, secret, err := createAPIToken("user-1", " button ", []string{scopeAdmin, scopePlay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Name != "button" || tok.Scopes != "play admin" || !strings.HasPrefix(secret, apiTokenPrefix) || !strings.HasSuffix(secret, tok.Hint) {
+		t.Errorf("token = %+v, secret %q", tok, secret)
+	}
+	var stored APIToken
+	if err := db.First(&stored, tok.ID).Error; err != nil || stored.Hash == secret || strings.Contains(stored.Hash, secret) {
+		t.Errorf("stored token = %+v, %v; want only the hash", stored, err)
+	}
+
+	w := httptest.NewRecorder()
+	apiV1Handler().ServeHTTP(w, bearerRequest(http.MethodGet, "/api/v1/queue", secret))
+	if w.Code != http.StatusOK {
+		t.Errorf("queue with a play token = %d %s", w.Code, w.Body)
+	}
+	if err := db.First(&stored, tok.ID).Error; err != nil || stored.LastUsedAt == nil {
+		t.Errorf("last use = %v, %v", stored.LastUsedAt, err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"missing scope", bearerRequest(http.MethodGet, "/api/v1/guilds/guild-1/stats", secret), http.StatusForbidden, "insufficient_scope"},
+		{"unknown token", bearerRequest(http.MethodGet, "/api/v1/queue", apiTokenPrefix+"nope"), http.StatusUnauthorized, "invalid_token"},
+		{"basic auth", func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/queue", nil)
+			req.SetBasicAuth("user-1", secret)
+			return req
+		}(), http.StatusUnauthorized, "unauthorized"},
+	} {
+		var res apiError
+		w := serveAPI(t, c.req, &res)
+		if w.Code != c.status || res.Error != c.code || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: got %d %+v, want %d %s", c.name, w.Code, res, c.status, c.code)
+		}
+	}
+
+	if err := revokeAPIToken("user-2", tok.ID); !errors.Is(err, errUnknownToken) {
+		t.Errorf("revoking someone else's token = %v", err)
+	}
+	if err := revokeAPIToken("user-1", tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lookupAPIToken(secret); !errors.Is(err, errUnknownToken) {
+		t.Errorf("revoked token = %v, want it refused", err)
+	}
+
+	for range maxAPITokens {
+		if _, _, err := createAPIToken("user-1", "many", []string{scopeStats}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var refused *manageError
+	if _, _, err := createAPIToken("user-1", "one more", []string{scopeStats}); !errors.As(err, &refused) || refused.code != "too_many_tokens" {
+		t.Errorf("token over the limit = %v", err)
+	}
+}
+
+func TestHandleAPITokens(t *testing.T) {
+	useSoundStore(t)
+	post := func(handler http.HandlerFunc, userID string, form url.Values) (*httptest.ResponseRecorder, tokenResponse) {
+		w := httptest.NewRecorder()
+		handler(w, authedRequest(t, http.MethodPost, "/api/tokens", userID, strings.NewReader(form.Encode())))
+		var res tokenResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w, res
+	}
+
+	w, res := post(handleAPITokensCreate, "user-1", url.Values{"name": {"deck"}, "scope": {scopePlay, scopeStats}})
+	if w.Code != http.StatusOK || !strings.HasPrefix(res.Token, apiTokenPrefix) || !strings.Contains(res.Message, "not shown again") {
+		t.Fatalf("create = %d %s", w.Code, w.Body)
+	}
+	tokens, err := listAPITokens("user-1")
+	if err != nil || len(tokens) != 1 || tokens[0].Scopes != "play stats" {
+		t.Fatalf("tokens = %+v, %v", tokens, err)
+	}
+
+	// A token cannot mint or revoke tokens, not even with the session.
+	req := authedRequest(t, http.MethodPost, "/api/tokens/create", "user-1", strings.NewReader("name=more&scope=admin"))
+	req.Header.Set("Authorization", "Bearer "+res.Token)
+	w = httptest.NewRecorder()
+	handleAPITokensCreate(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("create with a token = %d %s", w.Code, w.Body)
+	}
+
+	id := url.Values{"id": {"1"}}
+	if w, _ := post(handleAPITokensRevoke, "user-2", id); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `"unknown_token"`) {
+		t.Errorf("revoke by someone else = %d %s", w.Code, w.Body)
+	}
+	if w, _ := post(handleAPITokensRevoke, "user-1", url.Values{"id": {"first"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("revoke without a number = %d %s", w.Code, w.Body)
+	}
+	if w, _ := post(handleAPITokensRevoke, "user-1", id); w.Code != http.StatusOK {
+		t.Errorf("revoke = %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handleAPITokensCreate(w, httptest.NewRequest(http.MethodPost, "/api/tokens/create", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("create while logged out = %d", w.Code)
+	}
+}
+
+func TestBuildTokensPage(t *testing.T) {
+	tmpl := template.Must(template.ParseFiles("../../web/templates/apitokens.html",
+		"../../web/templates/header.html", "../../web/templates/footer.html"))
+	useSoundStore(t)
+	tok, secret, err := createAPIToken("user-1", "deck", []string{scopePlay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := createAPIToken("user-2", "theirs", []string{scopePlay}); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buildTokensPage("user-1")
+	if len(data.Tokens) != 1 || data.Tokens[0].ID != tok.ID || data.Tokens[0].Hint != tok.Hint || data.Tokens[0].LastUsed != "never" {
+		t.Errorf("Tokens = %+v", data.Tokens)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&b, "header", data); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(b.String(), "deck") || !strings.Contains(b.String(), `value="admin"`) || strings.Contains(b.String(), secret) {
+		t.Errorf("page does not list the token as expected:\n%s", b.String())
+	}
+}
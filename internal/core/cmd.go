@@ -3,9 +3,11 @@ package gidbig
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"reflect"
 	"runtime"
 	"strings"
 	"sync"
@@ -37,11 +39,18 @@ var (
 	// mutex for checking if voice connection already exists
 	mutex = &sync.Mutex{}
 
+	// soundWatchInterval is how often the audio folder is checked for changes
+	soundWatchInterval = 30 * time.Second
+
 	// Start time for uptime calculation
 	startTime = time.Now()
 
 	// Eso module instance for web server access
 	esoMod *eso.Module
+
+	// Coffee and leetoclock modules for the web API, nil while disabled
+	coffeeMod coffeeStatus
+	leetMod   leetScoreboards
 )
 
 func onReady(s *discordgo.Session, event *discordgo.Ready) {
@@ -229,7 +238,7 @@ func onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 
 	if m.Content == "!list" {
 		var list string
-		for _, c := range COLLECTIONS {
+		for _, c := range soundCollectionsIn(m.GuildID) {
 			list += "**!" + c.Prefix + "**\n"
 			for _, sounds := range c.Sounds {
 				list += sounds.Name + "\n"
@@ -307,20 +316,117 @@ func setupLogging(config *cfg.Config) {
 	slog.SetDefault(logger)
 }
 
+// CheckConfig loads the config at path the same way StartGidbig does and
+// prints every problem found to w. It returns the process exit code.
+func CheckConfig(path string, w io.Writer) int {
+	if _, err := cfg.Load(path); err != nil {
+		_, _ = fmt.Fprintf(w, "%s is invalid:\n", path)
+		for _, line := range strings.Split(err.Error(), "\n") {
+			_, _ = fmt.Fprintf(w, "  - %s\n", line)
+		}
+		return 1
+	}
+	_, _ = fmt.Fprintf(w, "%s is valid\n", path)
+	return 0
+}
+
+// reloadConfig re-reads the config at path and applies it to b. The returned
+// text summarises the outcome for /admin reload and the log.
+func reloadConfig(b *bot.Bot, path string) string {
+	next, err := cfg.Load(path)
+	if err != nil {
+		return formatReloadError(path, err)
+	}
+	report := b.Reload(next)
+	normalize := currentSoundPolicy().Normalize
+	setSoundPolicy(b.Config().Soundboard)
+	if !reflect.DeepEqual(normalize, b.Config().Soundboard.Normalize) {
+		go func() {
+			res := rescanSounds()
+			slog.Info("sound normalization changed, sounds rescanned", "failed", len(res.Failed))
+			for _, err := range res.Failed {
+				slog.Error("error adding sound to soundCollection", "error", err)
+			}
+		}()
+	}
+	if err := setSpeech(b.Config().TTS); err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("tts: %w", err))
+	}
+	llm.ResolvePersonality(b.Config().LLM.Personality, b.Config().LLM.Preset)
+	return formatReloadReport(report)
+}
+
+func formatReloadError(path string, err error) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s is invalid, keeping the running config:\n", path)
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintf(&sb, "  - %s\n", line)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func formatReloadReport(r bot.ReloadReport) string {
+	if !r.Changed() {
+		return "Config reloaded, nothing changed."
+	}
+	var sb strings.Builder
+	sb.WriteString("Config reloaded.")
+	if len(r.Live) > 0 {
+		sb.WriteString("\nApplied: " + strings.Join(r.Live, ", "))
+	}
+	if len(r.Restart) > 0 {
+		sb.WriteString("\nNeeds a restart, left unchanged: " + strings.Join(r.Restart, ", "))
+	}
+	for _, err := range r.Errors {
+		sb.WriteString("\nFailed: " + err.Error())
+	}
+	return sb.String()
+}
+
+// watchReload reloads the config every time the process receives SIGHUP
+// until ctx is done.
+func watchReload(ctx context.Context, reload func() string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("SIGHUP received, reloading config", "result", reload())
+		}
+	}
+}
+
 // StartGidbig obviously
-func StartGidbig() {
-	conf = cfg.GetConfig()
+func StartGidbig(configPath string) {
+	var err error
+	conf, err = cfg.Load(configPath)
+	if err != nil {
+		slog.Error("Could not load config.", "path", configPath, "error", err)
+		os.Exit(1)
+	}
 	setupLogging(conf)
 	LogVersion()
-	var err error
-
-	// create SoundCollections by scanning the audio folder
-	createCollections()
+	setSoundPolicy(conf.Soundboard)
+	if err := setSpeech(conf.TTS); err != nil {
+		slog.Error("Could not set up text to speech", "error", err)
+	}
 
-	// Preload all the sounds
+	// Create SoundCollections by scanning the audio folder and preload all
+	// the sounds
 	slog.Info("Preloading sounds...")
-	for _, coll := range COLLECTIONS {
-		coll.Load()
+	for _, err := range rescanSounds().Failed {
+		slog.Error("error adding sound to soundCollection", "error", err)
+	}
+
+	dbPath := "gidbig.db"
+	if conf.Database.Path != "" {
+		dbPath = conf.Database.Path
+	}
+	if err := openSoundStore(dbPath); err != nil {
+		slog.Error("Could not open the soundboard store, plays are not recorded", "path", dbPath, "error", err)
 	}
 
 	// Create a discord session
@@ -357,8 +463,7 @@ func StartGidbig() {
 	discord.AddHandler(onConnect)
 	discord.AddHandler(onDisconnect)
 	discord.AddHandler(onResumed)
-	discord.AddHandler(onMessageCreate)
-	discord.AddHandler(onStatusInteractionCreate)
+	discord.AddHandler(onVoiceStateUpdate)
 
 	err = discord.Open()
 	if err != nil {
@@ -381,80 +486,66 @@ func StartGidbig() {
 		return
 	}
 	llm.ResolvePersonality(conf.LLM.Personality, conf.LLM.Preset)
-	coffeeMod := coffee.New()
-	coffeeReady := false
-	if err := coffeeMod.Init(bot.Deps{Session: discord, Config: conf}); err != nil {
-		slog.Error("coffee: init failed", "error", err)
-	} else {
-		coffeeReady = true
-		for _, l := range coffeeMod.Listeners() {
-			discord.AddHandler(l)
+
+	b := bot.New(bot.Deps{
+		Session: discord,
+		Config:  conf,
+		LLM:     llm.GetClient(),
+		Logger:  slog.Default(),
+		OwnerID: conf.Discord.OwnerID,
+		Speaker: voiceSpeaker{},
+	})
+
+	modules := []bot.Module{
+		coffee.New(),
+		eso.New(),
+		gamerstatus.New(),
+		gippity.New(),
+		leetoclock.New(),
+		stoll.New(),
+		wttrin.New(),
+	}
+	for _, m := range modules {
+		if !conf.Modules.Enabled(m.Name()) {
+			slog.Info("module disabled in config", "module", m.Name())
+			continue
 		}
-	}
-	admin.RegisterProvider(coffeeMod)
-	admin.Start(discord, conf.Discord.OwnerID, buildBotStatsMessage)
-	esoMod = eso.New()
-	if err := esoMod.Init(bot.Deps{Session: discord, OwnerID: conf.Discord.OwnerID}); err != nil {
-		slog.Error("eso: init failed", "error", err)
-	} else {
-		for _, l := range esoMod.Listeners() {
-			discord.AddHandler(l)
+		if err := b.RegisterModule(m); err != nil {
+			slog.Error("module init failed", "module", m.Name(), "error", err)
+			continue
 		}
-	}
-	bgCtx, bgCancel := context.WithCancel(context.Background())
-	bgSupervisor := bot.NewSupervisor()
-	if coffeeReady {
-		bgSupervisor.Start(bgCtx, coffeeMod.Background()...)
-	}
-	gamerstatusMod := gamerstatus.New()
-	if err := gamerstatusMod.Init(bot.Deps{Session: discord, OwnerID: conf.Discord.OwnerID}); err != nil {
-		slog.Error("gamerstatus: init failed", "error", err)
-	} else {
-		bgSupervisor.Start(bgCtx, gamerstatusMod.Background()...)
-	}
-	gippity.Start(discord)
-	leetoMod := leetoclock.New()
-	leetoReady := false
-	if err := leetoMod.Init(bot.Deps{Session: discord, Config: conf}); err != nil {
-		slog.Error("leetoclock: init failed", "error", err)
-	} else {
-		leetoReady = true
-		for _, l := range leetoMod.Listeners() {
-			discord.AddHandler(l)
+		switch mod := m.(type) {
+		case *eso.Module:
+			esoMod = mod
+		case *coffee.Module:
+			coffeeMod = mod
+		case *leetoclock.Module:
+			leetMod = mod
 		}
-		bgSupervisor.Start(bgCtx, leetoMod.Background()...)
 	}
-	stollMod := stoll.New()
-	if err := stollMod.Init(bot.Deps{Session: discord, OwnerID: conf.Discord.OwnerID}); err != nil {
-		slog.Error("stoll: init failed", "error", err)
-	} else {
-		for _, l := range stollMod.Listeners() {
-			discord.AddHandler(l)
-		}
+
+	for _, p := range b.AdminProviders() {
+		admin.RegisterProvider(p)
 	}
-	wttrinMod := wttrin.New()
-	if err := wttrinMod.Init(bot.Deps{Session: discord, OwnerID: conf.Discord.OwnerID, LLM: llm.GetClient()}); err != nil {
-		slog.Error("wttrin: init failed", "error", err)
-	} else {
-		for _, l := range wttrinMod.Listeners() {
-			discord.AddHandler(l)
-		}
+	admin.RegisterProvider(soundsAdmin{})
+	b.Router.AddMessageHandler(onMessageCreate)
+	b.AddCommand(&discordgo.ApplicationCommand{Name: "status", Description: "Show bot runtime status (owner only)"}, onStatusInteractionCreate)
+	b.AddCommand(soundCommand, onSoundInteractionCreate)
+	b.AddAutocomplete(soundCommand.Name, onSoundAutocomplete)
+	b.AddCommand(sayCommand, onSayInteractionCreate)
+	b.AddCommand(clipCommand, onClipInteractionCreate)
+	reload := func() string { return reloadConfig(b, configPath) }
+	adminHandler := admin.Start(conf.Discord.OwnerID, buildBotStatsMessage, reload)
+	for _, cmd := range admin.Commands() {
+		b.AddCommand(cmd, adminHandler)
 	}
 
-	cmds := []*discordgo.ApplicationCommand{
-		{Name: "status", Description: "Show bot runtime status (owner only)"},
-	}
-	cmds = append(cmds, admin.Commands()...)
-	cmds = append(cmds, coffeeMod.Commands()...)
-	cmds = append(cmds, esoMod.Commands()...)
-	cmds = append(cmds, gippity.Commands()...)
-	cmds = append(cmds, stollMod.Commands()...)
-	if _, err := discord.ApplicationCommandBulkOverwrite(discord.State.User.ID, "", cmds); err != nil {
+	if _, err := discord.ApplicationCommandBulkOverwrite(discord.State.User.ID, "", b.Commands()); err != nil {
 		slog.Error("Failed to register slash commands", "error", err)
 	}
 
 	// Start Webserver if a valid port is provided and if ClientID and ClientSecret are set
-	if conf.Web.Port != 0 && conf.Web.Port >= 1 && conf.Web.Oauth.ClientID != "" && conf.Web.Oauth.ClientSecret != "" && conf.Web.Oauth.RedirectURI != "" {
+	if conf.WebServerEnabled() {
 		slog.Info("Starting web server", "port", conf.Web.Port)
 		go startWebServer(conf)
 	} else {
@@ -466,37 +557,18 @@ func StartGidbig() {
 	slog.Info("Gidbig is ready. Quit with CTRL-C.")
 	setStartedStatus()
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go watchReload(ctx, reload)
+	go watchSounds(ctx, soundWatchInterval)
+	if err := b.Run(ctx); err != nil {
+		slog.Error("bot stopped with error", "error", err)
+	}
 
 	slog.Info("shutting down")
-
-	bgCancel()
-	bgSupervisor.Wait()
-
-	shutdownDone := make(chan struct{})
-	go func() {
-		defer close(shutdownDone)
-		if err := discord.Close(); err != nil {
-			slog.Error("error closing discord session", "error", err)
-		}
-		gippity.Shutdown()
-		gippity.CloseDB()
-		if leetoReady {
-			if err := leetoMod.Shutdown(); err != nil {
-				slog.Error("leetoclock: shutdown failed", "error", err)
-			}
-		}
-		if err := coffeeMod.Shutdown(); err != nil {
-			slog.Error("coffee: shutdown failed", "error", err)
-		}
-	}()
-
-	select {
-	case <-shutdownDone:
-		slog.Info("shutdown complete")
-	case <-time.After(10 * time.Second):
-		slog.Warn("shutdown timed out after 10s, forcing exit")
+	stopPlayers()
+	if err := closeSoundStore(); err != nil {
+		slog.Error("could not close the soundboard store", "error", err)
 	}
+	b.Shutdown()
 }
@@ -2,11 +2,16 @@ package gidbig
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
 	"runtime/debug"
 	"strings"
 	"testing"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/bot"
+	"github.com/toksikk/gidbig/internal/cfg"
 )
 
 func TestScontains(t *testing.T) {
@@ -132,24 +137,17 @@ func TestBanner_NilWriter(t *testing.T) {
 	Banner(nil)
 }
 
-func TestAddNewSoundCollection(t *testing.T) {
-	originalCollections := COLLECTIONS
-	COLLECTIONS = nil
-	t.Cleanup(func() { COLLECTIONS = originalCollections })
+func TestNewSoundCollection(t *testing.T) {
+	c := newSoundCollection("test")
 
-	addNewSoundCollection("test", "sound1")
-
-	if len(COLLECTIONS) != 1 {
-		t.Fatalf("expected 1 collection, got %d", len(COLLECTIONS))
-	}
-	if COLLECTIONS[0].Prefix != "test" {
-		t.Errorf("Prefix = %q, want %q", COLLECTIONS[0].Prefix, "test")
+	if c.Prefix != "test" {
+		t.Errorf("Prefix = %q, want %q", c.Prefix, "test")
 	}
-	if len(COLLECTIONS[0].Commands) != 1 || COLLECTIONS[0].Commands[0] != "!test" {
-		t.Errorf("Commands = %v, want [!test]", COLLECTIONS[0].Commands)
+	if len(c.Commands) != 1 || c.Commands[0] != "!test" {
+		t.Errorf("Commands = %v, want [!test]", c.Commands)
 	}
-	if len(COLLECTIONS[0].Sounds) != 1 || COLLECTIONS[0].Sounds[0].Name != "sound1" {
-		t.Errorf("Sounds[0].Name = %q, want %q", COLLECTIONS[0].Sounds[0].Name, "sound1")
+	if len(c.Sounds) != 0 {
+		t.Errorf("Sounds = %v, want none", c.Sounds)
 	}
 }
 
@@ -245,3 +243,50 @@ func TestStatusInteractionResponse_NonOwner(t *testing.T) {
 		t.Errorf("Content = %q, want %q", resp.Data.Content, "Access denied.")
 	}
 }
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(valid, []byte("discord:\n  token: tok\ngippity:\n  allowed_guilds: [\"1\"]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalid, []byte("modules:\n  coffee:\n    milk_ml: -1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if code := CheckConfig(valid, &out); code != 0 {
+		t.Fatalf("valid config: exit code %d, output:\n%s", code, out.String())
+	}
+
+	out.Reset()
+	if code := CheckConfig(invalid, &out); code != 1 {
+		t.Fatalf("invalid config: exit code %d, want 1", code)
+	}
+	for _, want := range []string{"  - discord.token", "  - gippity.allowed_guilds", "  - modules.coffee.milk_ml"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output should list %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestFormatReloadReport(t *testing.T) {
+	if got := formatReloadReport(bot.ReloadReport{}); got != "Config reloaded, nothing changed." {
+		t.Errorf("unchanged report = %q", got)
+	}
+
+	got := formatReloadReport(bot.ReloadReport{
+		Diff:   cfg.Diff{Live: []string{"gippity.ignored_users"}, Restart: []string{"discord.token"}},
+		Errors: []error{errors.New("coffee: water_ml too small")},
+	})
+	for _, want := range []string{
+		"Applied: gippity.ignored_users",
+		"Needs a restart, left unchanged: discord.token",
+		"Failed: coffee: water_ml too small",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report should contain %q, got:\n%s", want, got)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package gidbig
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -17,16 +21,193 @@ import (
 const playStartDelay = 250 * time.Millisecond
 
 var (
-	// Map of Guild id's to *Play channels, used for queuing and rate-limiting guilds
-	queues = make(map[string]chan *Play)
+	// maxQueueSize is how many plays may wait per guild
+	maxQueueSize = 6
+)
 
-	// nowPlaying tracks the sound currently being played per guild
-	nowPlaying = make(map[string]*Play)
+// playSource tells where a play was requested.
+type playSource string
 
-	// maxQueueSize Sound encoding settings
-	maxQueueSize = 6
+const (
+	sourceChat  playSource = "chat"
+	sourceWeb   playSource = "web"
+	sourceSlash playSource = "slash"
+
+	// sourceEntrance marks the entrance sound of a user joining voice.
+	sourceEntrance playSource = "entrance"
+
+	// sourceGippity marks a spoken gippity answer.
+	sourceGippity playSource = "gippity"
 )
 
+// enqueueStatus is the outcome of a play request.
+type enqueueStatus int
+
+const (
+	enqueueQueued enqueueStatus = iota
+	enqueueQueueFull
+	enqueueNotInVoice
+	enqueueUnknownCollection
+	enqueueUnknownSound
+	enqueueEmptyCollection
+	enqueueCooldown
+	enqueueDailyCap
+	enqueueRoleDenied
+	enqueueChannelRestricted
+	enqueueSpeechOff
+	enqueueTextTooLong
+	enqueueSpeechFailed
+)
+
+// enqueueResult tells the requester what happened to a play request.
+type enqueueResult struct {
+	Status enqueueStatus
+
+	// Play is the queued play; it is only set when Status is enqueueQueued.
+	Play *Play
+
+	// Position is the number of plays ahead of Play, 0 means it starts right away.
+	Position int
+
+	// Prefix and SoundName echo the request; SoundName is empty for random plays.
+	Prefix    string
+	SoundName string
+
+	// RetryAfter is how long to wait before the next request, set for
+	// cooldowns and the daily cap.
+	RetryAfter time.Duration
+
+	// Limit is the daily cap that was reached, or the longest text that is
+	// spoken.
+	Limit int
+
+	// Channels names the voice channels a restricted collection may play in.
+	Channels []string
+}
+
+// Code is a stable identifier of the status for API clients.
+func (r enqueueResult) Code() string {
+	switch r.Status {
+	case enqueueQueued:
+		return "queued"
+	case enqueueQueueFull:
+		return "queue_full"
+	case enqueueNotInVoice:
+		return "not_in_voice"
+	case enqueueUnknownCollection:
+		return "unknown_collection"
+	case enqueueUnknownSound:
+		return "unknown_sound"
+	case enqueueEmptyCollection:
+		return "empty_collection"
+	case enqueueCooldown:
+		return "cooldown"
+	case enqueueDailyCap:
+		return "daily_cap"
+	case enqueueRoleDenied:
+		return "role_denied"
+	case enqueueChannelRestricted:
+		return "channel_restricted"
+	case enqueueSpeechOff:
+		return "tts_disabled"
+	case enqueueTextTooLong:
+		return "text_too_long"
+	case enqueueSpeechFailed:
+		return "speech_failed"
+	}
+	return "unknown"
+}
+
+// Message describes the result to the user who asked for the play.
+func (r enqueueResult) Message() string {
+	switch r.Status {
+	case enqueueQueued:
+		label := fmt.Sprintf("`!%s %s`", r.Prefix, r.Play.Sound.Name)
+		if !r.Play.Forced {
+			label += " (random)"
+		}
+		if r.Position == 0 {
+			return "Playing " + label + "."
+		}
+		return fmt.Sprintf("Queued %s at position %d.", label, r.Position)
+	case enqueueQueueFull:
+		return fmt.Sprintf("The queue is full (%d sounds), try again in a moment.", maxQueueSize)
+	case enqueueNotInVoice:
+		return "Join a voice channel first."
+	case enqueueUnknownCollection:
+		return fmt.Sprintf("Unknown sound collection `%s`.", r.Prefix)
+	case enqueueUnknownSound:
+		return fmt.Sprintf("Unknown sound `%s` in `!%s`.", r.SoundName, r.Prefix)
+	case enqueueEmptyCollection:
+		return fmt.Sprintf("`!%s` has no sounds to play.", r.Prefix)
+	case enqueueCooldown:
+		return fmt.Sprintf("Slow down, you can play another sound in %s.", formatWait(r.RetryAfter))
+	case enqueueDailyCap:
+		return fmt.Sprintf("This server played its %d sounds for today, try again in %s.", r.Limit, formatWait(r.RetryAfter))
+	case enqueueRoleDenied:
+		return "Your roles do not allow playing sounds on this server."
+	case enqueueChannelRestricted:
+		return fmt.Sprintf("`!%s` can only be played in %s.", r.Prefix, strings.Join(r.Channels, ", "))
+	case enqueueSpeechOff:
+		return "Text to speech is not set up."
+	case enqueueTextTooLong:
+		return fmt.Sprintf("That is too long to say, keep it within %d characters.", r.Limit)
+	case enqueueSpeechFailed:
+		return "Could not render the speech, try again later."
+	}
+	return "Could not play the sound."
+}
+
+// Reaction is the emoji added to a text command that could not be played.
+func (r enqueueResult) Reaction() string {
+	switch r.Status {
+	case enqueueQueued:
+		return "✅"
+	case enqueueQueueFull:
+		return "⏳"
+	case enqueueNotInVoice:
+		return "🔇"
+	case enqueueEmptyCollection:
+		return "📭"
+	case enqueueCooldown:
+		return "🐢"
+	case enqueueDailyCap:
+		return "🛑"
+	case enqueueRoleDenied:
+		return "🚫"
+	case enqueueChannelRestricted:
+		return "📍"
+	case enqueueSpeechOff, enqueueSpeechFailed:
+		return "🤐"
+	case enqueueTextTooLong:
+		return "📜"
+	}
+	return "❓"
+}
+
+// HTTPStatus is the status code /playsound answers with.
+func (r enqueueResult) HTTPStatus() int {
+	switch r.Status {
+	case enqueueQueued:
+		return http.StatusOK
+	case enqueueQueueFull, enqueueCooldown, enqueueDailyCap:
+		return http.StatusTooManyRequests
+	case enqueueNotInVoice:
+		return http.StatusConflict
+	case enqueueEmptyCollection:
+		return http.StatusUnprocessableEntity
+	case enqueueRoleDenied, enqueueChannelRestricted:
+		return http.StatusForbidden
+	case enqueueSpeechOff:
+		return http.StatusServiceUnavailable
+	case enqueueTextTooLong:
+		return http.StatusRequestEntityTooLarge
+	case enqueueSpeechFailed:
+		return http.StatusBadGateway
+	}
+	return http.StatusNotFound
+}
+
 // Random select sound
 func (sc *soundCollection) Random() *soundClip {
 	if len(sc.Sounds) == 0 {
@@ -47,8 +228,23 @@ func (sc *soundCollection) Random() *soundClip {
 	return nil
 }
 
-func findSoundAndCollection(command string, soundname string) (*soundClip, *soundCollection) {
-	for _, c := range COLLECTIONS {
+// findSound returns the sound called name in coll, or nil.
+func findSound(coll *soundCollection, name string) *soundClip {
+	if coll == nil {
+		return nil
+	}
+	for _, s := range coll.Sounds {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// findSoundAndCollection returns the collection answering to command in
+// guildID and its sound called soundname, if any.
+func findSoundAndCollection(guildID, command, soundname string) (*soundClip, *soundCollection) {
+	for _, c := range soundCollectionsIn(guildID) {
 		if scontains(command, c.Commands...) {
 			for _, s := range c.Sounds {
 				if soundname == s.Name {
@@ -61,27 +257,26 @@ func findSoundAndCollection(command string, soundname string) (*soundClip, *soun
 	return nil, nil
 }
 
-// Find sound in collection and play it or do nothing if not found
+// Find sound in collection and play it. Commands that could not be played
+// are kept and get a reaction telling why.
 func findAndPlaySound(s *discordgo.Session, m *discordgo.MessageCreate, parts []string, g *discordgo.Guild) {
-	for _, coll := range COLLECTIONS {
+	for _, coll := range soundCollectionsIn(g.ID) {
 		if scontains(parts[0], coll.Commands...) {
-			go deleteCommandMessage(s, m.ChannelID, m.ID)
-
-			// If they passed a specific sound effect, find and select that (otherwise play nothing)
-			var sound *soundClip
+			// If they passed a specific sound effect, find and select that
+			var name string
 			if len(parts) > 1 {
-				for _, s := range coll.Sounds {
-					if parts[1] == s.Name {
-						sound = s
-					}
-				}
-
-				if sound == nil {
-					return
-				}
+				name = parts[1]
 			}
 
-			go enqueuePlay(m.Author, g, coll, sound)
+			res := requestPlay(m.Author, g, coll, name, sourceChat)
+			if res.Status == enqueueQueued {
+				go deleteCommandMessage(s, m.ChannelID, m.ID)
+				return
+			}
+			slog.Info("sound not played", "user", m.Author.ID, "prefix", coll.Prefix, "soundname", name, "reason", res.Code())
+			if err := s.MessageReactionAdd(m.ChannelID, m.ID, res.Reaction()); err != nil {
+				slog.Error("could not add reaction", "error", err)
+			}
 			return
 		}
 	}
@@ -95,8 +290,10 @@ func findAndPlaySound(s *discordgo.Session, m *discordgo.MessageCreate, parts []
 // here (as PR #110 did) duplicates the cadence and starves the sender's
 // channel between ticks, which is itself a plausible cause of the silent
 // audio reported in #113.
-func (s *soundClip) Play(vc *discordgo.VoiceConnection) {
-	slog.Debug("Play start", "frames", len(s.buffer), "guildID", vc.GuildID, "status", vc.Status)
+//
+// Play returns early once ctx is cancelled, which is how sounds are skipped.
+func (s *soundClip) Play(ctx context.Context, vc voiceConn) error {
+	slog.Debug("Play start", "frames", len(s.buffer))
 
 	if err := vc.Speaking(true); err != nil {
 		slog.Error("error setting speaking to true", "error", err)
@@ -107,17 +304,26 @@ func (s *soundClip) Play(vc *discordgo.VoiceConnection) {
 		}
 	}()
 
+	frames := vc.Frames()
 	for i, buff := range s.buffer {
+		if ctx.Err() != nil {
+			slog.Debug("Play cancelled", "frameIndex", i, "totalFrames", len(s.buffer))
+			return ctx.Err()
+		}
 		select {
-		case vc.OpusSend <- buff:
+		case frames <- buff:
+		case <-ctx.Done():
+			slog.Debug("Play cancelled", "frameIndex", i, "totalFrames", len(s.buffer))
+			return ctx.Err()
 		case <-time.After(time.Second):
 			slog.Error("OpusSend stalled — sender goroutine is not draining frames",
-				"guildID", vc.GuildID, "frameIndex", i, "totalFrames", len(s.buffer), "status", vc.Status)
-			return
+				"frameIndex", i, "totalFrames", len(s.buffer))
+			return errVoiceStalled
 		}
 	}
 
-	slog.Debug("Play done", "frames", len(s.buffer), "guildID", vc.GuildID)
+	slog.Debug("Play done", "frames", len(s.buffer))
+	return nil
 }
 
 // Attempts to find the current users voice channel inside a given guild
@@ -132,12 +338,12 @@ func getCurrentVoiceChannel(user *discordgo.User, guild *discordgo.Guild) *disco
 }
 
 // Prepares a play
-func createPlay(user *discordgo.User, guild *discordgo.Guild, coll *soundCollection, sound *soundClip) *Play {
+func createPlay(user *discordgo.User, guild *discordgo.Guild, coll *soundCollection, sound *soundClip, source playSource) (*Play, enqueueStatus) {
 	// Grab the users voice channel
 	channel := getCurrentVoiceChannel(user, guild)
 	if channel == nil {
 		slog.Warn("Failed to find channel to play sound in", "user", user.ID, "guild", guild.ID)
-		return nil
+		return nil, enqueueNotInVoice
 	}
 
 	// Create the play
@@ -146,7 +352,10 @@ func createPlay(user *discordgo.User, guild *discordgo.Guild, coll *soundCollect
 		ChannelID: channel.ID,
 		UserID:    user.ID,
 		Sound:     sound,
+		Prefix:    coll.Prefix,
+		Username:  user.DisplayName(),
 		Forced:    true,
+		Source:    source,
 	}
 
 	// If we didn't get passed a manual sound, generate a random one
@@ -156,7 +365,7 @@ func createPlay(user *discordgo.User, guild *discordgo.Guild, coll *soundCollect
 	}
 	if play.Sound == nil {
 		slog.Warn("sound collection is empty, nothing to play", "prefix", coll.Prefix)
-		return nil
+		return nil, enqueueEmptyCollection
 	}
 
 	// If the collection is a chained one, set the next sound
@@ -170,130 +379,123 @@ func createPlay(user *discordgo.User, guild *discordgo.Guild, coll *soundCollect
 				ChannelID: play.ChannelID,
 				UserID:    play.UserID,
 				Sound:     nextSound,
+				Prefix:    coll.ChainWith.Prefix,
+				Username:  play.Username,
 				Forced:    play.Forced,
+				Source:    play.Source,
 			}
 		}
 	}
 
-	return play
+	return play, enqueueQueued
 }
 
-// Prepares and enqueues a play into the ratelimit/buffer guild queue
-func enqueuePlay(user *discordgo.User, guild *discordgo.Guild, coll *soundCollection, sound *soundClip) {
-	play := createPlay(user, guild, coll, sound)
-	if play == nil {
-		return
-	}
-	if sound != nil {
-		slog.Info("Playing sound", "username", user.Username, "prefix", coll.Prefix, "soundname", sound.Name, "server", guild.Name, "channel", play.ChannelID)
-	} else {
-		slog.Info("Playing random sound", "username", user.Username, "prefix", coll.Prefix, "soundname", play.Sound.Name, "server", guild.Name, "channel", play.ChannelID)
+// requestPlay looks up the sound called name in coll and enqueues it. An
+// empty name picks a random sound.
+func requestPlay(user *discordgo.User, guild *discordgo.Guild, coll *soundCollection, name string, source playSource) enqueueResult {
+	if !coll.availableIn(guild.ID) {
+		return enqueueResult{Status: enqueueUnknownCollection, Prefix: coll.Prefix}
 	}
-	// Check if we already have a connection to this guild
-	// this should be threadsafe
-	mutex.Lock()
-	_, exists := queues[guild.ID]
-	mutex.Unlock()
-
-	if exists {
-		if len(queues[guild.ID]) < maxQueueSize {
-			mutex.Lock()
-			queues[guild.ID] <- play
-			mutex.Unlock()
-		}
-	} else {
-		mutex.Lock()
-		queues[guild.ID] = make(chan *Play, maxQueueSize)
-		mutex.Unlock()
-		_, _, err := playSound(play, nil, "")
-		if err != nil {
-			slog.Error("could not playSound", "error", err)
+	var sound *soundClip
+	if name != "" {
+		if sound = findSound(coll, name); sound == nil {
+			return enqueueResult{Status: enqueueUnknownSound, Prefix: coll.Prefix, SoundName: name}
 		}
 	}
+	return enqueuePlay(user, guild, coll, sound, source)
 }
 
-// Play a sound
-func playSound(play *Play, vc *discordgo.VoiceConnection, vcChannelID string) (retVC *discordgo.VoiceConnection, retChannelID string, err error) {
-	slog.Info("Playing sound", "play", play)
-
-	ctx := context.Background()
-
-	if vc != nil {
-		if vc.GuildID != play.GuildID {
-			if disconnErr := vc.Disconnect(ctx); disconnErr != nil {
-				slog.Error("could not disconnect voice connection", "error", disconnErr)
-			}
-			vc = nil
-			vcChannelID = ""
-		}
+// Prepares and enqueues a play into the ratelimit/buffer guild queue after
+// checking it against the soundboard config. It returns once the play is
+// queued; playback runs in the background.
+func enqueuePlay(user *discordgo.User, guild *discordgo.Guild, coll *soundCollection, sound *soundClip, source playSource) enqueueResult {
+	res := enqueueResult{Prefix: coll.Prefix}
+	if sound != nil {
+		res.SoundName = sound.Name
 	}
-
-	if vc == nil {
-		vc, err = discord.ChannelVoiceJoin(ctx, play.GuildID, play.ChannelID, false, true)
-		if err != nil {
-			slog.Error("Failed to play sound", "error", err)
-			mutex.Lock()
-			delete(queues, play.GuildID)
-			mutex.Unlock()
-			return nil, "", err
-		}
-		vcChannelID = play.ChannelID
-		time.Sleep(playStartDelay)
+	play, status := createPlay(user, guild, coll, sound, source)
+	if status != enqueueQueued {
+		res.Status = status
+		return res
+	}
+	policy := currentSoundPolicy()
+	if res.Status, res.Channels = checkPlayAccess(policy, play); res.Status != enqueueQueued {
+		return res
 	}
 
-	// If we need to change channels, disconnect and rejoin
-	if vcChannelID != play.ChannelID {
-		if disconnErr := vc.Disconnect(ctx); disconnErr != nil {
-			slog.Error("could not disconnect voice connection", "error", disconnErr)
+	res.Limit = policy.DailyCapIn(guild.ID)
+	res.Status, res.RetryAfter = limiter.admit(play, policy.CooldownIn(guild.ID), res.Limit, func() enqueueStatus {
+		// Hand the play to the guild's player, starting one if there is none
+		mutex.Lock()
+		defer mutex.Unlock()
+		player := players[guild.ID]
+		if player == nil {
+			player = startPlayer(guild.ID)
 		}
-		vc, err = discord.ChannelVoiceJoin(ctx, play.GuildID, play.ChannelID, false, true)
-		if err != nil {
-			slog.Error("could not join voice channel", "error", err)
-			mutex.Lock()
-			delete(queues, play.GuildID)
-			mutex.Unlock()
-			return nil, "", err
+		position, ok := player.enqueue(play)
+		if !ok {
+			return enqueueQueueFull
 		}
-		vcChannelID = play.ChannelID
-		time.Sleep(playStartDelay)
+		res.Position = position
+		return enqueueQueued
+	})
+	if res.Status != enqueueQueued {
+		return res
 	}
 
-	mutex.Lock()
-	nowPlaying[play.GuildID] = play
-	mutex.Unlock()
-
-	// Play the sound
-	play.Sound.Play(vc)
+	if sound != nil {
+		slog.Info("Playing sound", "username", user.Username, "prefix", coll.Prefix, "soundname", sound.Name, "server", guild.Name, "channel", play.ChannelID, "position", res.Position)
+	} else {
+		slog.Info("Playing random sound", "username", user.Username, "prefix", coll.Prefix, "soundname", play.Sound.Name, "server", guild.Name, "channel", play.ChannelID, "position", res.Position)
+	}
+	res.Play = play
+	return res
+}
 
+// skipSound stops the sound currently being played in guildID together with
+// its chained sound and returns it, or nil when nothing is playing.
+func skipSound(guildID string) *Play {
 	mutex.Lock()
-	delete(nowPlaying, play.GuildID)
-	mutex.Unlock()
-
-	// If this is chained, play the chained sound
-	if play.Next != nil {
-		vc, vcChannelID, err = playSound(play.Next, vc, vcChannelID)
-		if err != nil {
-			slog.Error("could not playSound", "error", err)
-		}
+	defer mutex.Unlock()
+	p := players[guildID]
+	if p == nil || p.current == nil {
+		return nil
 	}
+	p.skip()
+	return p.current
+}
 
-	// If there is another song in the queue, recurse and play that
-	if len(queues[play.GuildID]) > 0 {
-		play = <-queues[play.GuildID]
-		vc, vcChannelID, err = playSound(play, vc, vcChannelID)
-		if err != nil {
-			slog.Error("could not playSound", "error", err)
-		}
-		return vc, vcChannelID, nil
+// stopSounds drops every play queued in guildID and skips the current one.
+// It returns the number of plays dropped and the skipped play, if any.
+func stopSounds(guildID string) (cleared int, stopped *Play) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	p := players[guildID]
+	if p == nil {
+		return 0, nil
+	}
+	cleared = len(p.pending)
+	p.pending = nil
+	if cleared > 0 {
+		ev := p.event(eventCleared, nil)
+		ev.Cleared = cleared
+		soundEvents.publish(ev)
 	}
+	if p.current != nil {
+		p.skip()
+		stopped = p.current
+	}
+	return cleared, stopped
+}
 
-	// If the queue is empty, delete it
-	time.Sleep(time.Millisecond * time.Duration(play.Sound.PartDelay))
+// guildQueue returns the play currently being played in guildID, if any, and
+// the plays waiting behind it.
+func guildQueue(guildID string) (current *Play, pending []*Play) {
 	mutex.Lock()
-	delete(queues, play.GuildID)
-	if disconnErr := vc.Disconnect(context.Background()); disconnErr != nil {
-		slog.Error("could not disconnect voice connection", "error", disconnErr)
+	defer mutex.Unlock()
+	p := players[guildID]
+	if p == nil {
+		return nil, nil
 	}
-	mutex.Unlock()
-	return nil, "", nil
+	return p.current, slices.Clone(p.pending)
 }
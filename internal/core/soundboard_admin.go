@@ -0,0 +1,99 @@
+package gidbig
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// soundsAdmin provides the /admin sounds subcommand group.
+type soundsAdmin struct{}
+
+// AdminSubcommandGroup returns the /admin sounds subcommand group definition.
+func (soundsAdmin) AdminSubcommandGroup() *discordgo.ApplicationCommandOption {
+	clipID := []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "id",
+			Description: "Clip number from /admin sounds clips",
+			Required:    true,
+		},
+	}
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+		Name:        "sounds",
+		Description: "Soundboard administration",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "rescan",
+				Description: "Reload the audio folder without restarting",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "loudness",
+				Description: "List the sounds much louder or quieter than the target",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "clips",
+				Description: "List the clips waiting for approval",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "approve",
+				Description: "Add a clip to the soundboard",
+				Options:     clipID,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "reject",
+				Description: "Drop a clip",
+				Options:     clipID,
+			},
+		},
+	}
+}
+
+// HandleAdminSubcommand handles /admin sounds subcommands.
+func (soundsAdmin) HandleAdminSubcommand(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
+	content, ok := soundsAdminReply(sub)
+	if !ok {
+		return
+	}
+	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content}); err != nil {
+		slog.Error("sounds: admin edit response failed", "error", err)
+	}
+}
+
+// soundsAdminReply runs an /admin sounds subcommand and returns the reply. It
+// reports false for unknown subcommands.
+func soundsAdminReply(sub *discordgo.ApplicationCommandInteractionDataOption) (string, bool) {
+	switch sub.Name {
+	case "rescan":
+		return rescanSounds().String(), true
+	case "loudness":
+		return loudnessReport(context.Background()), true
+	case "clips":
+		return pendingClipsReply(), true
+	case "approve", "reject":
+		var id uint
+		for _, o := range sub.Options {
+			if o.Name == "id" && o.IntValue() > 0 {
+				id = uint(o.IntValue())
+			}
+		}
+		decide := approveClip
+		if sub.Name == "reject" {
+			decide = rejectClip
+		}
+		content, err := decide(id)
+		if err != nil {
+			return fmt.Sprintf("Clip #%d: %v.", id, err), true
+		}
+		return content, true
+	}
+	return "", false
+}
@@ -0,0 +1,539 @@
+package gidbig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"gorm.io/gorm"
+)
+
+// clipFrameSamples is how far the RTP timestamp advances per 20 ms frame.
+const clipFrameSamples = 960
+
+// clipMinSeconds is the shortest clip /clip save accepts.
+var clipMinSeconds = 1.0
+
+// ClipConsent records that a user agreed to their voice being kept for /clip
+// in a guild.
+type ClipConsent struct {
+	gorm.Model
+	GuildID string `gorm:"not null;uniqueIndex:idx_soundboard_clip_consent_member"`
+	UserID  string `gorm:"not null;uniqueIndex:idx_soundboard_clip_consent_member"`
+}
+
+// TableName returns the database table name.
+func (ClipConsent) TableName() string { return "soundboard_clip_consents" }
+
+// PendingClip is a clip waiting for the owner to approve it as a sound.
+type PendingClip struct {
+	gorm.Model
+	GuildID     string `gorm:"not null"`
+	RequestedBy string `gorm:"not null"`
+	SpeakerID   string `gorm:"not null"`
+	Collection  string `gorm:"not null"`
+	Sound       string `gorm:"not null"`
+	Duration    time.Duration
+	// Data is the clip as a DCA1 file.
+	Data []byte `gorm:"not null"`
+}
+
+// TableName returns the database table name.
+func (PendingClip) TableName() string { return "soundboard_pending_clips" }
+
+// hasClipConsent reports whether userID agreed to being clipped in guildID.
+func hasClipConsent(guildID, userID string) (bool, error) {
+	d := getSoundDB()
+	if d == nil {
+		return false, errors.New("store not initialized")
+	}
+	var n int64
+	err := d.Model(&ClipConsent{}).Where("guild_id = ? AND user_id = ?", guildID, userID).Count(&n).Error
+	return n > 0, err
+}
+
+// setClipConsent stores whether userID agrees to being clipped in guildID.
+// Withdrawing also drops what was kept of the user.
+func setClipConsent(guildID, userID string, on bool) error {
+	d := getSoundDB()
+	if d == nil {
+		return errors.New("store not initialized")
+	}
+	var err error
+	if on {
+		err = d.Where(ClipConsent{GuildID: guildID, UserID: userID}).FirstOrCreate(&ClipConsent{}).Error
+	} else {
+		err = d.Unscoped().Where("guild_id = ? AND user_id = ?", guildID, userID).Delete(&ClipConsent{}).Error
+	}
+	if err != nil {
+		return err
+	}
+	if rec := guildRecorder(guildID); rec != nil {
+		rec.setConsent(userID, on)
+	}
+	return nil
+}
+
+// clipNow is the clock of the recorders; tests replace it.
+var clipNow = time.Now
+
+// clipPacket is a received Opus packet and when it arrived.
+type clipPacket struct {
+	at        time.Time
+	timestamp uint32
+	opus      []byte
+}
+
+// clipRecorder keeps the last window of audio of every consenting user in
+// the voice channel the bot is connected to in a guild.
+type clipRecorder struct {
+	guildID string
+	window  time.Duration
+
+	mu       sync.Mutex
+	speakers map[uint32]string // user ID by SSRC
+	consent  map[string]bool   // by user ID, filled when a user starts speaking
+	packets  map[string][]clipPacket
+}
+
+var (
+	// recorders holds the recorder of every guild the bot listens in,
+	// guarded by recordersMu.
+	recorders   = make(map[string]*clipRecorder)
+	recordersMu sync.Mutex
+)
+
+func guildRecorder(guildID string) *clipRecorder {
+	recordersMu.Lock()
+	defer recordersMu.Unlock()
+	return recorders[guildID]
+}
+
+func newClipRecorder(guildID string, window time.Duration) *clipRecorder {
+	return &clipRecorder{
+		guildID:  guildID,
+		window:   window,
+		speakers: make(map[uint32]string),
+		consent:  make(map[string]bool),
+		packets:  make(map[string][]clipPacket),
+	}
+}
+
+// startRecorder keeps what consenting users say on vc until the connection
+// dies. Nothing is kept when vc does not receive audio.
+func startRecorder(guildID string, vc *discordgo.VoiceConnection, window time.Duration) *clipRecorder {
+	recv := vc.OpusRecv
+	if recv == nil {
+		return nil
+	}
+	rec := newClipRecorder(guildID, window)
+	recordersMu.Lock()
+	recorders[guildID] = rec
+	recordersMu.Unlock()
+
+	vc.AddHandler(func(_ *discordgo.VoiceConnection, u *discordgo.VoiceSpeakingUpdate) {
+		rec.speaker(uint32(u.SSRC), u.UserID)
+	})
+	go func() {
+		for p := range recv {
+			rec.add(p)
+		}
+		rec.stop()
+	}()
+	return rec
+}
+
+// stop drops everything rec kept and unregisters it.
+func (r *clipRecorder) stop() {
+	recordersMu.Lock()
+	if recorders[r.guildID] == r {
+		delete(recorders, r.guildID)
+	}
+	recordersMu.Unlock()
+	r.mu.Lock()
+	clear(r.packets)
+	r.mu.Unlock()
+}
+
+// speaker maps ssrc to userID and looks up whether the user consented, once
+// per connection.
+func (r *clipRecorder) speaker(ssrc uint32, userID string) {
+	r.mu.Lock()
+	r.speakers[ssrc] = userID
+	_, known := r.consent[userID]
+	r.mu.Unlock()
+	if known {
+		return
+	}
+	ok, err := hasClipConsent(r.guildID, userID)
+	if err != nil {
+		slog.Error("could not look up clip consent", "guild", r.guildID, "user", userID, "error", err)
+	}
+	r.mu.Lock()
+	if _, known := r.consent[userID]; !known {
+		r.consent[userID] = ok
+	}
+	r.mu.Unlock()
+}
+
+// setConsent applies a changed consent of userID right away.
+func (r *clipRecorder) setConsent(userID string, on bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.consent[userID] = on
+	if !on {
+		delete(r.packets, userID)
+	}
+}
+
+// add keeps p if it comes from a consenting user and forgets what fell out
+// of the window.
+func (r *clipRecorder) add(p *discordgo.Packet) {
+	if len(p.Opus) == 0 || len(p.Opus) > maxOpusFrame {
+		return
+	}
+	now := clipNow()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	userID, ok := r.speakers[p.SSRC]
+	if !ok || !r.consent[userID] {
+		return
+	}
+	// The receiver reuses the buffer behind p.Opus.
+	kept := append(r.packets[userID], clipPacket{at: now, timestamp: p.Timestamp, opus: bytes.Clone(p.Opus)})
+	cut := 0
+	for cut < len(kept) && now.Sub(kept[cut].at) > r.window {
+		cut++
+	}
+	r.packets[userID] = kept[cut:]
+}
+
+// clip returns the frames userID said within the last d. Pauses between
+// packets are filled with silence so the clip keeps its timing.
+func (r *clipRecorder) clip(userID string, d time.Duration) [][]byte {
+	d = min(d, r.window)
+	limit := int(d / (20 * time.Millisecond))
+	since := clipNow().Add(-d)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var frames [][]byte
+	var last uint32
+	for _, p := range r.packets[userID] {
+		if p.at.Before(since) {
+			continue
+		}
+		if len(frames) > 0 {
+			if gap := int((p.timestamp-last)/clipFrameSamples) - 1; gap > 0 && gap < limit {
+				for range gap {
+					frames = append(frames, opusSilence)
+				}
+			}
+		}
+		frames = append(frames, p.opus)
+		last = p.timestamp
+	}
+	if len(frames) > limit {
+		frames = frames[len(frames)-limit:]
+	}
+	return frames
+}
+
+// clipCommand lets users agree to being clipped and turn what someone just
+// said into a sound.
+var clipCommand = &discordgo.ApplicationCommand{
+	Name:        "clip",
+	Description: "Turn what someone just said into a sound",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "consent",
+			Description: "Allow or forbid clipping your voice on this server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "set",
+					Description: "on keeps your voice for clips while I am in your channel",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "on", Value: "on"},
+						{Name: "off", Value: "off"},
+					},
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "save",
+			Description: "Save the last seconds someone said as a sound, after approval",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "Who said it",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "collection",
+					Description: "Collection to add the sound to, e.g. quotes",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "name",
+					Description: "Name of the new sound",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "seconds",
+					Description: "How many seconds to keep (all that was kept when omitted)",
+					MinValue:    &clipMinSeconds,
+				},
+			},
+		},
+	},
+}
+
+func onClipInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	content := clipReply(i)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		slog.Error("could not respond to /clip", "error", err)
+	}
+}
+
+// clipReply runs a /clip interaction and returns the reply for the user.
+func clipReply(i *discordgo.InteractionCreate) string {
+	if i.GuildID == "" || i.Member == nil {
+		return "Clips can only be made on a server."
+	}
+	data := i.ApplicationCommandData()
+	sub, opts := soundSubcommand(data)
+	userID := i.Member.User.ID
+	switch sub {
+	case "consent":
+		on := soundOption(i, "set") == "on"
+		if err := setClipConsent(i.GuildID, userID, on); err != nil {
+			slog.Error("could not save clip consent", "guild", i.GuildID, "user", userID, "error", err)
+			return "Could not save your choice, try again later."
+		}
+		if !on {
+			return "Your voice is no longer kept for clips on this server, and what was kept is gone."
+		}
+		reply := "Your voice may now be clipped on this server while I am in your voice channel."
+		if !currentSoundPolicy().ClipsIn(i.GuildID) {
+			reply += " Clips are turned off on this server, so nothing is kept for now."
+		}
+		return reply
+	case "save":
+		var speaker *discordgo.User
+		var seconds int64
+		for _, o := range opts {
+			switch o.Name {
+			case "user":
+				// Discord sends the picked user along, no need to fetch it.
+				speaker = o.UserValue(nil)
+				if data.Resolved != nil && data.Resolved.Users[speaker.ID] != nil {
+					speaker = data.Resolved.Users[speaker.ID]
+				}
+			case "seconds":
+				seconds = o.IntValue()
+			}
+		}
+		return saveClipReply(i.GuildID, userID, speaker, soundOption(i, "collection"), soundOption(i, "name"), time.Duration(seconds)*time.Second)
+	}
+	return "Unknown subcommand."
+}
+
+// saveClipReply keeps the last d of what speaker said as a clip waiting for
+// approval. A zero d keeps everything the recorder has.
+func saveClipReply(guildID, requestedBy string, speaker *discordgo.User, prefix, name string, d time.Duration) string {
+	policy := currentSoundPolicy()
+	if !policy.ClipsIn(guildID) {
+		return "Clips are turned off on this server."
+	}
+	prefix, name = strings.ToLower(strings.TrimSpace(prefix)), strings.ToLower(strings.TrimSpace(name))
+	if err := checkNewSound(prefix, name); err != nil {
+		return err.Error()
+	}
+	if c := collectionByCommand(prefix); c != nil && !c.availableIn(guildID) {
+		return enqueueResult{Status: enqueueUnknownCollection, Prefix: prefix}.Message()
+	}
+	if speaker == nil {
+		return "Pick who said it."
+	}
+	consented, err := hasClipConsent(guildID, speaker.ID)
+	if err != nil {
+		slog.Error("could not look up clip consent", "guild", guildID, "user", speaker.ID, "error", err)
+		return "Could not save the clip, try again later."
+	}
+	if !consented {
+		return fmt.Sprintf("<@%s> has not agreed to being clipped, they can run `/clip consent set:on`.", speaker.ID)
+	}
+	rec := guildRecorder(guildID)
+	if rec == nil {
+		return "I am not in a voice channel right now, so there is nothing to clip."
+	}
+	if d <= 0 {
+		d = rec.window
+	}
+	frames := rec.clip(speaker.ID, d)
+	if len(frames) == 0 {
+		return fmt.Sprintf("I did not hear <@%s> in the last %s.", speaker.ID, formatWait(min(d, rec.window)))
+	}
+	var buf bytes.Buffer
+	if err := writeDCA(&buf, frames, "Clip of "+speaker.Username); err != nil {
+		slog.Error("could not encode clip", "guild", guildID, "error", err)
+		return "Could not save the clip, try again later."
+	}
+	clip := &PendingClip{
+		GuildID:     guildID,
+		RequestedBy: requestedBy,
+		SpeakerID:   speaker.ID,
+		Collection:  prefix,
+		Sound:       name,
+		Duration:    time.Duration(len(frames)) * 20 * time.Millisecond,
+		Data:        buf.Bytes(),
+	}
+	if err := savePendingClip(clip); err != nil {
+		slog.Error("could not save clip", "guild", guildID, "error", err)
+		return "Could not save the clip, try again later."
+	}
+	slog.Info("clip waiting for approval", "id", clip.ID, "guild", guildID, "user", requestedBy, "speaker", speaker.ID, "prefix", prefix, "soundname", name)
+	return fmt.Sprintf("Clip #%d `!%s %s` (%s) is waiting for the owner's approval.", clip.ID, prefix, name, formatWait(clip.Duration))
+}
+
+func savePendingClip(clip *PendingClip) error {
+	d := getSoundDB()
+	if d == nil {
+		return errors.New("store not initialized")
+	}
+	return d.Create(clip).Error
+}
+
+// pendingClips returns the clips waiting for approval, oldest first.
+func pendingClips() ([]PendingClip, error) {
+	d := getSoundDB()
+	if d == nil {
+		return nil, errors.New("store not initialized")
+	}
+	var clips []PendingClip
+	err := d.Omit("data").Order("id").Find(&clips).Error
+	return clips, err
+}
+
+// errClipNotFound is returned for an ID that is not waiting for approval.
+var errClipNotFound = errors.New("no clip is waiting with this number")
+
+// loadPendingClip returns the pending clip id.
+func loadPendingClip(id uint) (*PendingClip, error) {
+	d := getSoundDB()
+	if d == nil {
+		return nil, errors.New("store not initialized")
+	}
+	var clip PendingClip
+	err := d.First(&clip, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errClipNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &clip, nil
+}
+
+func deletePendingClip(id uint) error {
+	d := getSoundDB()
+	if d == nil {
+		return errors.New("store not initialized")
+	}
+	return d.Unscoped().Delete(&PendingClip{}, id).Error
+}
+
+// approveClip writes the pending clip id to audioDir and rescans, which
+// makes it playable right away. A clip starting a new collection limits it to
+// the guild it was recorded in. A clip whose name was taken in the meantime
+// stays pending until it is rejected.
+func approveClip(id uint) (string, error) {
+	clip, err := loadPendingClip(id)
+	if err != nil {
+		return "", err
+	}
+	manageMu.Lock()
+	defer manageMu.Unlock()
+	key := clip.Collection + "_" + clip.Sound
+	if soundExists(clip.Collection, clip.Sound) {
+		return "", fmt.Errorf("`!%s %s` exists by now, reject the clip", clip.Collection, clip.Sound)
+	}
+	if err := os.MkdirAll(audioDir, 0o755); err != nil {
+		return "", err
+	}
+	if collectionByCommand(clip.Collection) == nil {
+		if err := limitCollection(clip.Collection, clip.GuildID); err != nil {
+			return "", err
+		}
+	}
+	path := filepath.Join(audioDir, key+".dca")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(clip.Data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	if err := deletePendingClip(id); err != nil {
+		slog.Error("could not remove approved clip", "id", id, "error", err)
+	}
+	slog.Info("clip approved", "id", id, "guild", clip.GuildID, "prefix", clip.Collection, "soundname", clip.Sound)
+	return fmt.Sprintf("Clip #%d is now `!%s %s`.\n%s", id, clip.Collection, clip.Sound, rescanSounds()), nil
+}
+
+// rejectClip drops the pending clip id.
+func rejectClip(id uint) (string, error) {
+	clip, err := loadPendingClip(id)
+	if err != nil {
+		return "", err
+	}
+	if err := deletePendingClip(id); err != nil {
+		return "", err
+	}
+	slog.Info("clip rejected", "id", id, "guild", clip.GuildID, "prefix", clip.Collection, "soundname", clip.Sound)
+	return fmt.Sprintf("Clip #%d `!%s %s` was dropped.", id, clip.Collection, clip.Sound), nil
+}
+
+// pendingClipsReply lists the clips waiting for approval.
+func pendingClipsReply() string {
+	clips, err := pendingClips()
+	if err != nil {
+		slog.Error("could not list pending clips", "error", err)
+		return "Could not list the clips, try again later."
+	}
+	if len(clips) == 0 {
+		return "No clips are waiting for approval."
+	}
+	var sb strings.Builder
+	sb.WriteString("Clips waiting for approval:")
+	for _, c := range clips {
+		fmt.Fprintf(&sb, "\n#%d `!%s %s` (%s) said by <@%s>, requested by <@%s>", c.ID, c.Collection, c.Sound, formatWait(c.Duration), c.SpeakerID, c.RequestedBy)
+	}
+	return sb.String()
+}
@@ -0,0 +1,217 @@
+package gidbig
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+// useClipClock replaces the recorder clock with a fake one and returns a func
+// advancing it.
+func useClipClock(t *testing.T) func(time.Duration) {
+	t.Helper()
+	orig := clipNow
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.Local)
+	clipNow = func() time.Time { return now }
+	t.Cleanup(func() { clipNow = orig })
+	return func(d time.Duration) { now = now.Add(d) }
+}
+
+// useRecorder registers a recorder for guild-1 as if the bot listened there.
+func useRecorder(t *testing.T, window time.Duration) *clipRecorder {
+	t.Helper()
+	rec := newClipRecorder("guild-1", window)
+	recordersMu.Lock()
+	recorders["guild-1"] = rec
+	recordersMu.Unlock()
+	t.Cleanup(rec.stop)
+	return rec
+}
+
+func voicePacket(ssrc, timestamp uint32, opus ...byte) *discordgo.Packet {
+	return &discordgo.Packet{SSRC: ssrc, Timestamp: timestamp, Opus: opus}
+}
+
+func TestClipRecorder(t *testing.T) {
+	advance := useClipClock(t)
+	rec := newClipRecorder("guild-1", 2*time.Second)
+	rec.speakers[1], rec.consent["user-1"] = "user-1", true
+	rec.speakers[2], rec.consent["user-2"] = "user-2", false
+
+	first := voicePacket(1, 0, 0x01)
+	rec.add(first)
+	first.Opus[0] = 0xff // the receiver reuses its buffer
+	advance(20 * time.Millisecond)
+	rec.add(voicePacket(1, clipFrameSamples, 0x02))
+	rec.add(voicePacket(2, clipFrameSamples, 0x09))
+	rec.add(voicePacket(3, clipFrameSamples, 0x09)) // nobody we know
+	advance(120 * time.Millisecond)
+	rec.add(voicePacket(1, 7*clipFrameSamples, 0x03))
+
+	got := rec.clip("user-1", time.Minute)
+	if len(got) != 8 || got[0][0] != 0x01 || got[1][0] != 0x02 || got[7][0] != 0x03 {
+		t.Fatalf("clip = %v, want both frames, five frames of silence and the last one", got)
+	}
+	for _, f := range got[2:7] {
+		if !bytes.Equal(f, opusSilence) {
+			t.Errorf("gap frame = %x, want silence", f)
+		}
+	}
+	if got := rec.clip("user-2", time.Minute); len(got) != 0 {
+		t.Errorf("clip of a user without consent = %v, want nothing", got)
+	}
+	if got := rec.clip("user-1", 120*time.Millisecond); len(got) != 6 || got[5][0] != 0x03 {
+		t.Errorf("clip of 120ms = %d frames, want the last 6", len(got))
+	}
+
+	advance(3 * time.Second)
+	rec.add(voicePacket(1, 500*clipFrameSamples, 0x04))
+	if got := rec.clip("user-1", time.Minute); len(got) != 1 || got[0][0] != 0x04 {
+		t.Errorf("clip after the window passed = %v, want only the new frame", got)
+	}
+
+	rec.setConsent("user-1", false)
+	rec.add(voicePacket(1, 501*clipFrameSamples, 0x05))
+	if got := rec.clip("user-1", time.Minute); len(got) != 0 {
+		t.Errorf("clip after withdrawing consent = %v, want nothing", got)
+	}
+}
+
+func clipInteraction(sub string, opts ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := soundInteraction("guild-1", sub, opts...)
+	i.Data = discordgo.ApplicationCommandInteractionData{Name: "clip", Options: soundData(sub, opts...).Options}
+	return i
+}
+
+func userOption(name, userID string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: discordgo.ApplicationCommandOptionUser, Value: userID}
+}
+
+func TestClipReply(t *testing.T) {
+	useSoundStore(t)
+	useCollections(t)
+	COLLECTIONS = []*soundCollection{{Prefix: "quotes", Commands: []string{"!quotes"},
+		Sounds: []*soundClip{{Name: "old", Weight: 1}}, soundRange: 1}}
+	advance := useClipClock(t)
+	usePolicy(t, cfg.SoundboardConfig{Clips: true, ClipLength: "30s"})
+
+	save := func(name string, user string) string {
+		return clipReply(clipInteraction("save", userOption("user", user),
+			stringOption("collection", "quotes", false), stringOption("name", name, false)))
+	}
+
+	if got := clipReply(clipInteraction("consent", stringOption("set", "on", false))); !strings.Contains(got, "may now be clipped") {
+		t.Fatalf("consent on = %q", got)
+	}
+	if got := save("hello", "user-1"); !strings.Contains(got, "not in a voice channel") {
+		t.Errorf("save without a recorder = %q", got)
+	}
+
+	rec := useRecorder(t, 30*time.Second)
+	rec.speaker(1, "user-1")
+	rec.speaker(2, "user-2")
+	for n := range uint32(5) {
+		rec.add(voicePacket(1, n*clipFrameSamples, 0x01))
+		rec.add(voicePacket(2, n*clipFrameSamples, 0x02))
+		advance(20 * time.Millisecond)
+	}
+
+	for name, want := range map[string]string{
+		"Hello!": "The name may only use",
+		"old":    "`!quotes old` already exists.",
+	} {
+		if got := save(name, "user-1"); got != want && !strings.HasPrefix(got, want) {
+			t.Errorf("save %q = %q, want %q", name, got, want)
+		}
+	}
+	if got := save("hello", "user-2"); !strings.Contains(got, "<@user-2> has not agreed") {
+		t.Errorf("save of user-2 = %q, want missing consent", got)
+	}
+	if got := save("hello", "user-1"); got != "Clip #1 `!quotes hello` (1s) is waiting for the owner's approval." {
+		t.Errorf("save = %q", got)
+	}
+	clips, err := pendingClips()
+	if err != nil || len(clips) != 1 || clips[0].SpeakerID != "user-1" || clips[0].Duration != 100*time.Millisecond {
+		t.Fatalf("pending clips = %+v, %v", clips, err)
+	}
+
+	if got := clipReply(clipInteraction("consent", stringOption("set", "off", false))); !strings.Contains(got, "no longer kept") {
+		t.Errorf("consent off = %q", got)
+	}
+	if got := save("again", "user-1"); !strings.Contains(got, "has not agreed") {
+		t.Errorf("save after withdrawing = %q", got)
+	}
+	if got := rec.clip("user-1", time.Minute); len(got) != 0 {
+		t.Errorf("kept audio after withdrawing = %d frames, want none", len(got))
+	}
+
+	usePolicy(t, cfg.SoundboardConfig{})
+	if got := save("hello", "user-1"); got != "Clips are turned off on this server." {
+		t.Errorf("save with clips off = %q", got)
+	}
+}
+
+func clipAdmin(sub string, id int) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: sub, Type: discordgo.ApplicationCommandOptionSubCommand,
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{{Name: "id", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(id)}}}
+}
+
+func TestSoundsAdminReply_clips(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useSoundStore(t)
+	useCollections(t)
+
+	list := &discordgo.ApplicationCommandInteractionDataOption{Name: "clips", Type: discordgo.ApplicationCommandOptionSubCommand}
+	if got, _ := soundsAdminReply(list); got != "No clips are waiting for approval." {
+		t.Errorf("empty list = %q", got)
+	}
+	for _, name := range []string{"hello", "bye"} {
+		var data bytes.Buffer
+		if err := writeDCA(&data, [][]byte{{0x01}, {0x02}}, "Clip of someone"); err != nil {
+			t.Fatal(err)
+		}
+		if err := savePendingClip(&PendingClip{GuildID: "guild-1", RequestedBy: "user-1", SpeakerID: "user-2",
+			Collection: "quotes", Sound: name, Duration: 40 * time.Millisecond, Data: data.Bytes()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _ := soundsAdminReply(list)
+	if !strings.Contains(got, "#1 `!quotes hello`") || !strings.Contains(got, "#2 `!quotes bye`") {
+		t.Errorf("list = %q, want both clips", got)
+	}
+
+	got, _ = soundsAdminReply(clipAdmin("approve", 1))
+	if !strings.HasPrefix(got, "Clip #1 is now `!quotes hello`.") || !strings.Contains(got, "Added: quotes_hello") {
+		t.Errorf("approve = %q", got)
+	}
+	if snd, _ := findSoundAndCollection("guild-1", "!quotes", "hello"); snd == nil || len(snd.buffer) != 2 || snd.meta.Title != "Clip of someone" {
+		t.Errorf("approved sound = %+v, want the clip", snd)
+	}
+	// The clip started the collection, which stays in the guild it was
+	// recorded in.
+	if c := collectionIn("guild-2", "quotes"); c != nil {
+		t.Errorf("new collection of a clip = %+v, want it limited to guild-1", c)
+	}
+	if _, err := os.Stat(filepath.Join("audio", "quotes_hello.dca")); err != nil {
+		t.Errorf("approved clip not written: %v", err)
+	}
+	if got, _ := soundsAdminReply(clipAdmin("approve", 1)); got != "Clip #1: no clip is waiting with this number." {
+		t.Errorf("second approve = %q", got)
+	}
+
+	if got, _ := soundsAdminReply(clipAdmin("reject", 2)); got != "Clip #2 `!quotes bye` was dropped." {
+		t.Errorf("reject = %q", got)
+	}
+	if got, _ := soundsAdminReply(list); got != "No clips are waiting for approval." {
+		t.Errorf("list after deciding = %q", got)
+	}
+	if _, ok := soundsAdminReply(&discordgo.ApplicationCommandInteractionDataOption{Name: "nope"}); ok {
+		t.Error("unknown subcommand handled")
+	}
+}
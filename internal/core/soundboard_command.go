@@ -0,0 +1,357 @@
+package gidbig
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxAutocompleteChoices is the most choices Discord accepts in one response.
+const maxAutocompleteChoices = 25
+
+// soundCommand plays and controls soundboard clips without the message
+// content intent.
+var soundCommand = &discordgo.ApplicationCommand{
+	Name:        "sound",
+	Description: "Soundboard",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "play",
+			Description: "Play a soundboard clip in your voice channel",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:         discordgo.ApplicationCommandOptionString,
+					Name:         "collection",
+					Description:  "Sound collection, e.g. airhorn",
+					Required:     true,
+					Autocomplete: true,
+				},
+				{
+					Type:         discordgo.ApplicationCommandOptionString,
+					Name:         "name",
+					Description:  "Sound to play (random when omitted)",
+					Autocomplete: true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "skip",
+			Description: "Skip the sound playing right now",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "stop",
+			Description: "Stop the sound playing right now and clear the queue",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "queue",
+			Description: "Show the sound playing right now and what is queued",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "stats",
+			Description: "Show the most played sounds and who plays them",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "range",
+					Description: "Time range (default: last 7 days)",
+					Choices:     statsRangeChoices(),
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Name:        "entrance",
+			Description: "Your sound for joining a voice channel on this server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set",
+					Description: "Play this sound when you join a voice channel",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "collection",
+							Description:  "Sound collection, e.g. airhorn",
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "name",
+							Description:  "Sound to play",
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "clear",
+					Description: "Stop playing a sound when you join",
+				},
+			},
+		},
+	},
+}
+
+func statsRangeChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(statsRanges))
+	for _, r := range statsRanges {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: r.Label, Value: r.Key})
+	}
+	return choices
+}
+
+// collectionByCommand returns the collection answering to command, which may be
+// given with or without the leading "!".
+func collectionByCommand(command string) *soundCollection {
+	command = "!" + strings.TrimPrefix(strings.TrimSpace(command), "!")
+	for _, c := range soundCollections() {
+		if scontains(command, c.Commands...) {
+			return c
+		}
+	}
+	return nil
+}
+
+// soundSubcommand returns the subcommand of a /sound interaction and its
+// options. Subcommands of a group are named after both, e.g. "entrance set".
+func soundSubcommand(data discordgo.ApplicationCommandInteractionData) (string, []*discordgo.ApplicationCommandInteractionDataOption) {
+	if len(data.Options) == 0 {
+		return "", nil
+	}
+	o := data.Options[0]
+	if o.Type == discordgo.ApplicationCommandOptionSubCommandGroup && len(o.Options) > 0 {
+		return o.Name + " " + o.Options[0].Name, o.Options[0].Options
+	}
+	return o.Name, o.Options
+}
+
+// soundOption returns the string option called name of a /sound subcommand.
+func soundOption(i *discordgo.InteractionCreate, name string) string {
+	_, opts := soundSubcommand(i.ApplicationCommandData())
+	for _, o := range opts {
+		if o.Name == name {
+			return o.StringValue()
+		}
+	}
+	return ""
+}
+
+func onSoundInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	content := soundCommandReply(s, i)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		slog.Error("could not respond to /sound", "error", err)
+	}
+}
+
+// soundCommandReply runs the subcommand of a /sound interaction and returns
+// the reply for the user.
+func soundCommandReply(s *discordgo.Session, i *discordgo.InteractionCreate) string {
+	if i.GuildID == "" || i.Member == nil {
+		return "Sounds can only be played on a server."
+	}
+	switch sub, _ := soundSubcommand(i.ApplicationCommandData()); sub {
+	case "play":
+		return playSoundCommand(s, i)
+	case "skip":
+		skipped := skipSound(i.GuildID)
+		slog.Info("sound skipped", "user", i.Member.User.ID, "guild", i.GuildID, "skipped", skipped != nil)
+		return skipReply(skipped)
+	case "stop":
+		cleared, stopped := stopSounds(i.GuildID)
+		slog.Info("sounds stopped", "user", i.Member.User.ID, "guild", i.GuildID, "cleared", cleared)
+		return stopReply(cleared, stopped)
+	case "queue":
+		return queueReply(guildQueue(i.GuildID))
+	case "stats":
+		r := findStatsRange(soundOption(i, "range"))
+		stats, err := loadSoundStats(i.GuildID, r.Since(time.Now()))
+		if err != nil {
+			slog.Error("could not load sound stats", "guild", i.GuildID, "error", err)
+			return "Could not load the statistics, try again later."
+		}
+		return statsReply(stats, r)
+	case "entrance set", "entrance clear":
+		return entranceCommandReply(i, sub)
+	}
+	return "Unknown subcommand."
+}
+
+// playLabel names the sound of p the way it is requested, e.g. `!horn one`.
+func playLabel(p *Play) string {
+	return fmt.Sprintf("`!%s %s`", p.Prefix, p.Sound.Name)
+}
+
+func skipReply(skipped *Play) string {
+	if skipped == nil {
+		return "Nothing is playing."
+	}
+	return fmt.Sprintf("Skipped %s.", playLabel(skipped))
+}
+
+func stopReply(cleared int, stopped *Play) string {
+	switch {
+	case stopped == nil && cleared == 0:
+		return "Nothing is playing."
+	case stopped == nil:
+		return fmt.Sprintf("Cleared %d queued sounds.", cleared)
+	case cleared == 0:
+		return fmt.Sprintf("Stopped %s.", playLabel(stopped))
+	}
+	return fmt.Sprintf("Stopped %s and cleared %d queued sounds.", playLabel(stopped), cleared)
+}
+
+// queueReply lists the sound playing right now and the queued ones, together
+// with who asked for them.
+func queueReply(current *Play, pending []*Play) string {
+	if current == nil && len(pending) == 0 {
+		return "Nothing is playing."
+	}
+	var b strings.Builder
+	if current != nil {
+		fmt.Fprintf(&b, "Now playing %s, queued by <@%s>.", playLabel(current), current.UserID)
+	} else {
+		b.WriteString("Starting the next sound.")
+	}
+	for n, p := range pending {
+		fmt.Fprintf(&b, "\n%d. %s by <@%s>", n+1, playLabel(p), p.UserID)
+	}
+	return b.String()
+}
+
+// maxNeverPlayed caps the never played sounds listed by /sound stats.
+const maxNeverPlayed = 15
+
+func statsReply(stats *soundStats, r statsRange) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 **Soundboard stats, %s** (%d plays)", r.Label, stats.Total)
+	if len(stats.TopSounds) > 0 {
+		b.WriteString("\n**Top sounds**")
+		for n, c := range stats.TopSounds {
+			fmt.Fprintf(&b, "\n%d. `!%s %s` %d×", n+1, c.Collection, c.Sound, c.Count)
+		}
+	}
+	if len(stats.TopUsers) > 0 {
+		b.WriteString("\n**Top users**")
+		for n, u := range stats.TopUsers {
+			fmt.Fprintf(&b, "\n%d. <@%s> %d×", n+1, u.UserID, u.Count)
+		}
+	}
+	if len(stats.NeverPlayed) > 0 {
+		fmt.Fprintf(&b, "\n**Never played** (%d)\n", len(stats.NeverPlayed))
+		shown := stats.NeverPlayed[:min(len(stats.NeverPlayed), maxNeverPlayed)]
+		b.WriteString("`" + strings.Join(shown, "`, `") + "`")
+		if more := len(stats.NeverPlayed) - len(shown); more > 0 {
+			fmt.Fprintf(&b, " and %d more", more)
+		}
+	}
+	return b.String()
+}
+
+// playSoundCommand queues the sound requested by /sound play and returns the
+// reply for the user.
+func playSoundCommand(s *discordgo.Session, i *discordgo.InteractionCreate) string {
+	collection, name := soundOption(i, "collection"), soundOption(i, "name")
+	coll := collectionIn(i.GuildID, collection)
+	if coll == nil {
+		return enqueueResult{Status: enqueueUnknownCollection, Prefix: collection}.Message()
+	}
+	guild, err := s.State.Guild(i.GuildID)
+	if err != nil {
+		slog.Error("could not look up guild for /sound", "guild", i.GuildID, "error", err)
+		return "Could not find this server, try again later."
+	}
+	return requestPlay(i.Member.User, guild, coll, name, sourceSlash).Message()
+}
+
+func onSoundAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: soundAutocompleteChoices(i.GuildID, i.ApplicationCommandData()),
+		},
+	})
+	if err != nil {
+		slog.Error("could not respond to /sound autocomplete", "error", err)
+	}
+}
+
+// soundAutocompleteChoices suggests collections of guildID or their sounds
+// matching the text typed into the focused option.
+func soundAutocompleteChoices(guildID string, data discordgo.ApplicationCommandInteractionData) []*discordgo.ApplicationCommandOptionChoice {
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	collection := ""
+	_, opts := soundSubcommand(data)
+	for _, o := range opts {
+		if o.Focused {
+			focused = o
+		}
+		if o.Name == "collection" {
+			collection = o.StringValue()
+		}
+	}
+	if focused == nil {
+		return nil
+	}
+	typed := strings.ToLower(strings.TrimPrefix(focused.StringValue(), "!"))
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	add := func(label, value string, keys ...string) {
+		if len(choices) == maxAutocompleteChoices {
+			return
+		}
+		for _, k := range keys {
+			if strings.Contains(strings.ToLower(k), typed) {
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: truncateChoice(label), Value: value})
+				return
+			}
+		}
+	}
+	switch focused.Name {
+	case "collection":
+		for _, c := range soundCollectionsIn(guildID) {
+			label := "!" + c.Prefix
+			if c.DisplayName != "" {
+				label = c.DisplayName + " (!" + c.Prefix + ")"
+			}
+			add(label, c.Prefix, append([]string{c.Prefix, c.DisplayName}, c.Commands...)...)
+		}
+	case "name":
+		coll := collectionIn(guildID, collection)
+		if coll == nil {
+			return choices
+		}
+		for _, snd := range coll.Sounds {
+			label := snd.Name
+			if snd.DisplayName != "" {
+				label = snd.DisplayName + " (" + snd.Name + ")"
+			}
+			add(label, snd.Name, snd.Name, snd.DisplayName)
+		}
+	}
+	return choices
+}
+
+// truncateChoice keeps choice labels within Discord's 100 character limit.
+func truncateChoice(label string) string {
+	if r := []rune(label); len(r) > 100 {
+		return string(r[:99]) + "…"
+	}
+	return label
+}
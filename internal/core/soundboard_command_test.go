@@ -0,0 +1,346 @@
+package gidbig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func stringOption(name, value string, focused bool) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:    name,
+		Type:    discordgo.ApplicationCommandOptionString,
+		Value:   value,
+		Focused: focused,
+	}
+}
+
+// soundData is the data of a /sound interaction running subcommand sub. A
+// sub such as "entrance set" runs set of the entrance group.
+func soundData(sub string, opts ...*discordgo.ApplicationCommandInteractionDataOption) discordgo.ApplicationCommandInteractionData {
+	option := &discordgo.ApplicationCommandInteractionDataOption{Name: sub, Type: discordgo.ApplicationCommandOptionSubCommand, Options: opts}
+	if group, name, ok := strings.Cut(sub, " "); ok {
+		option.Name = name
+		option = &discordgo.ApplicationCommandInteractionDataOption{Name: group, Type: discordgo.ApplicationCommandOptionSubCommandGroup,
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{option}}
+	}
+	return discordgo.ApplicationCommandInteractionData{
+		Name:    "sound",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{option},
+	}
+}
+
+func soundInteraction(guildID, sub string, opts ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			Type:    discordgo.InteractionApplicationCommand,
+			GuildID: guildID,
+			Member:  &discordgo.Member{User: &discordgo.User{ID: "user-1"}},
+			Data:    soundData(sub, opts...),
+		},
+	}
+}
+
+// notFoundTransport answers every Discord API request with 404, so lookups
+// missing from the state fail without touching the network.
+type notFoundTransport struct{}
+
+func (notFoundTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"message":"Unknown Member","code":10007}`)),
+		Request:    r,
+	}, nil
+}
+
+// testSoundSession returns a session whose state knows guild "guild-1" with
+// member user-1, optionally in voice channel "voice-1", and installs it as the
+// global session.
+func testSoundSession(t *testing.T, inVoice bool) *discordgo.Session {
+	t.Helper()
+	s, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Client = &http.Client{Transport: notFoundTransport{}}
+	g := &discordgo.Guild{ID: "guild-1", Name: "Test",
+		Members: []*discordgo.Member{{GuildID: "guild-1", User: &discordgo.User{ID: "user-1"}}}}
+	if inVoice {
+		g.VoiceStates = []*discordgo.VoiceState{{UserID: "user-1", ChannelID: "voice-1", GuildID: "guild-1"}}
+	}
+	if err := s.State.GuildAdd(g); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.State.ChannelAdd(&discordgo.Channel{ID: "voice-1", GuildID: "guild-1", Type: discordgo.ChannelTypeGuildVoice}); err != nil {
+		t.Fatal(err)
+	}
+	orig := discord
+	discord = s
+	t.Cleanup(func() { discord = orig })
+	return s
+}
+
+func TestSoundAutocompleteChoices(t *testing.T) {
+	useCollections(t)
+	horn := &soundCollection{Prefix: "airhorn", DisplayName: "Air Horns", Commands: []string{"!airhorn", "!ah"},
+		Sounds: []*soundClip{{Name: "default", DisplayName: "The Classic"}, {Name: "tiny"}}}
+	COLLECTIONS = []*soundCollection{horn, {Prefix: "cow", Commands: []string{"!cow"}},
+		{Prefix: "ahoy", Commands: []string{"!ahoy"}, Guilds: []string{"guild-2"}}}
+
+	choices := soundAutocompleteChoices("guild-1", soundData("play", stringOption("collection", "!AH", true)))
+	if len(choices) != 1 || choices[0].Value != "airhorn" || choices[0].Name != "Air Horns (!airhorn)" {
+		t.Fatalf("collection choices = %+v, want airhorn via its alias", choices)
+	}
+
+	choices = soundAutocompleteChoices("guild-1", soundData("play",
+		stringOption("collection", "ah", false),
+		stringOption("name", "class", true),
+	))
+	if len(choices) != 1 || choices[0].Value != "default" {
+		t.Fatalf("name choices = %+v, want default via its display name", choices)
+	}
+
+	choices = soundAutocompleteChoices("guild-1", soundData("play",
+		stringOption("collection", "unknown", false),
+		stringOption("name", "", true),
+	))
+	if choices == nil || len(choices) != 0 {
+		t.Fatalf("unknown collection choices = %+v, want an empty list", choices)
+	}
+
+	choices = soundAutocompleteChoices("guild-2", soundData("play", stringOption("collection", "ah", true)))
+	if len(choices) != 2 || choices[1].Value != "ahoy" {
+		t.Fatalf("choices in guild-2 = %+v, want airhorn and ahoy", choices)
+	}
+}
+
+func TestSoundAutocompleteChoices_limit(t *testing.T) {
+	useCollections(t)
+	for i := range 40 {
+		prefix := fmt.Sprintf("c%02d", i)
+		COLLECTIONS = append(COLLECTIONS, &soundCollection{Prefix: prefix, Commands: []string{"!" + prefix}})
+	}
+	choices := soundAutocompleteChoices("guild-1", soundData("play", stringOption("collection", "", true)))
+	if len(choices) != maxAutocompleteChoices {
+		t.Fatalf("got %d choices, want %d", len(choices), maxAutocompleteChoices)
+	}
+}
+
+func TestTruncateChoice(t *testing.T) {
+	if got := truncateChoice(strings.Repeat("ä", 150)); len([]rune(got)) != 100 {
+		t.Errorf("truncated label has %d runes, want 100", len([]rune(got)))
+	}
+	if got := truncateChoice("short"); got != "short" {
+		t.Errorf("truncateChoice(short) = %q", got)
+	}
+}
+
+func TestPlaySoundCommand(t *testing.T) {
+	useCollections(t)
+	COLLECTIONS = []*soundCollection{{Prefix: "horn", Commands: []string{"!horn"},
+		Sounds: []*soundClip{{Name: "one", Weight: 1}}, soundRange: 1},
+		{Prefix: "cow", Commands: []string{"!cow"}, Guilds: []string{"guild-2"},
+			Sounds: []*soundClip{{Name: "moo", Weight: 1}}, soundRange: 1}}
+
+	s := testSoundSession(t, false)
+	cases := []struct {
+		name string
+		i    *discordgo.InteractionCreate
+		want string
+	}{
+		{"direct message", soundInteraction("", "play", stringOption("collection", "horn", false)), "only be played on a server"},
+		{"unknown collection", soundInteraction("guild-1", "play", stringOption("collection", "nope", false)), "Unknown sound collection `nope`"},
+		{"unknown sound", soundInteraction("guild-1", "play", stringOption("collection", "horn", false), stringOption("name", "two", false)), "Unknown sound `two` in `!horn`"},
+		{"collection of another guild", soundInteraction("guild-1", "play", stringOption("collection", "cow", false), stringOption("name", "moo", false)), "Unknown sound collection `cow`"},
+		{"not in voice", soundInteraction("guild-1", "play", stringOption("collection", "!horn", false), stringOption("name", "one", false)), "Join a voice channel first"},
+	}
+	for _, tc := range cases {
+		if got := soundCommandReply(s, tc.i); !strings.Contains(got, tc.want) {
+			t.Errorf("%s: reply = %q, want it to contain %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPlaySoundCommand_queueFull(t *testing.T) {
+	useCollections(t)
+	COLLECTIONS = []*soundCollection{{Prefix: "horn", Commands: []string{"!horn"},
+		Sounds: []*soundClip{{Name: "one", Weight: 1}}, soundRange: 1}}
+	s := testSoundSession(t, true)
+
+	usePlaying(t, nil, make([]*Play, maxQueueSize)...) // no room left
+
+	got := soundCommandReply(s, soundInteraction("guild-1", "play", stringOption("collection", "horn", false)))
+	if !strings.Contains(got, "queue is full") {
+		t.Errorf("reply = %q, want queue full", got)
+	}
+}
+
+func TestEnqueueResult(t *testing.T) {
+	snd := &soundClip{Name: "one"}
+	cases := []struct {
+		res      enqueueResult
+		code     string
+		message  string
+		status   int
+		reaction string
+	}{
+		{enqueueResult{Status: enqueueQueued, Prefix: "horn", Play: &Play{Sound: snd, Forced: true}}, "queued", "Playing `!horn one`.", http.StatusOK, "✅"},
+		{enqueueResult{Status: enqueueQueued, Prefix: "horn", Play: &Play{Sound: snd}, Position: 2}, "queued", "Queued `!horn one` (random) at position 2.", http.StatusOK, "✅"},
+		{enqueueResult{Status: enqueueQueueFull, Prefix: "horn"}, "queue_full", "The queue is full (6 sounds), try again in a moment.", http.StatusTooManyRequests, "⏳"},
+		{enqueueResult{Status: enqueueNotInVoice, Prefix: "horn"}, "not_in_voice", "Join a voice channel first.", http.StatusConflict, "🔇"},
+		{enqueueResult{Status: enqueueUnknownCollection, Prefix: "nope"}, "unknown_collection", "Unknown sound collection `nope`.", http.StatusNotFound, "❓"},
+		{enqueueResult{Status: enqueueUnknownSound, Prefix: "horn", SoundName: "two"}, "unknown_sound", "Unknown sound `two` in `!horn`.", http.StatusNotFound, "❓"},
+		{enqueueResult{Status: enqueueEmptyCollection, Prefix: "horn"}, "empty_collection", "`!horn` has no sounds to play.", http.StatusUnprocessableEntity, "📭"},
+		{enqueueResult{Status: enqueueCooldown, Prefix: "horn", RetryAfter: 12 * time.Second}, "cooldown", "Slow down, you can play another sound in 12s.", http.StatusTooManyRequests, "🐢"},
+		{enqueueResult{Status: enqueueDailyCap, Prefix: "horn", Limit: 50, RetryAfter: 3 * time.Hour}, "daily_cap", "This server played its 50 sounds for today, try again in 3h.", http.StatusTooManyRequests, "🛑"},
+		{enqueueResult{Status: enqueueRoleDenied, Prefix: "horn"}, "role_denied", "Your roles do not allow playing sounds on this server.", http.StatusForbidden, "🚫"},
+		{enqueueResult{Status: enqueueChannelRestricted, Prefix: "nsfw", Channels: []string{"Late Night"}}, "channel_restricted", "`!nsfw` can only be played in Late Night.", http.StatusForbidden, "📍"},
+		{enqueueResult{Status: enqueueSpeechOff, Prefix: "say"}, "tts_disabled", "Text to speech is not set up.", http.StatusServiceUnavailable, "🤐"},
+		{enqueueResult{Status: enqueueTextTooLong, Prefix: "say", Limit: 300}, "text_too_long", "That is too long to say, keep it within 300 characters.", http.StatusRequestEntityTooLarge, "📜"},
+		{enqueueResult{Status: enqueueSpeechFailed, Prefix: "say"}, "speech_failed", "Could not render the speech, try again later.", http.StatusBadGateway, "🤐"},
+	}
+	for _, tc := range cases {
+		if got := tc.res.Code(); got != tc.code {
+			t.Errorf("Code() = %q, want %q", got, tc.code)
+		}
+		if got := tc.res.Message(); got != tc.message {
+			t.Errorf("%s: Message() = %q, want %q", tc.code, got, tc.message)
+		}
+		if got := tc.res.HTTPStatus(); got != tc.status {
+			t.Errorf("%s: HTTPStatus() = %d, want %d", tc.code, got, tc.status)
+		}
+		if got := tc.res.Reaction(); got != tc.reaction {
+			t.Errorf("%s: Reaction() = %q, want %q", tc.code, got, tc.reaction)
+		}
+	}
+}
+
+func TestRequestPlay_positions(t *testing.T) {
+	coll := &soundCollection{Prefix: "horn", Commands: []string{"!horn"},
+		Sounds: []*soundClip{{Name: "one", Weight: 1}}, soundRange: 1}
+	testSoundSession(t, true)
+	guild, _ := discord.State.Guild("guild-1")
+	user := &discordgo.User{ID: "user-1"}
+
+	// A sound is already playing with room for two more behind it
+	usePlaying(t, &Play{}, make([]*Play, maxQueueSize-2)...)
+
+	for want := maxQueueSize - 1; want <= maxQueueSize; want++ {
+		res := requestPlay(user, guild, coll, "one", sourceSlash)
+		if res.Status != enqueueQueued || res.Position != want || !res.Play.Forced || res.Play.Prefix != "horn" {
+			t.Fatalf("play %d = %+v, want queued at position %d", want, res, want)
+		}
+	}
+	if res := requestPlay(user, guild, coll, "", sourceSlash); res.Status != enqueueQueueFull {
+		t.Fatalf("third play = %+v, want queue full", res)
+	}
+	if res := requestPlay(user, guild, coll, "two", sourceSlash); res.Status != enqueueUnknownSound || res.SoundName != "two" {
+		t.Fatalf("unknown sound = %+v", res)
+	}
+}
+
+func TestWritePlayResult(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writePlayResult(rec, enqueueResult{Status: enqueueNotInVoice, Prefix: "horn"})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	var apiErr apiError
+	if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error body: %v", err)
+	}
+	if apiErr.Error != "not_in_voice" || apiErr.Message != "Join a voice channel first." {
+		t.Errorf("body = %+v", apiErr)
+	}
+
+	rec = httptest.NewRecorder()
+	writePlayResult(rec, enqueueResult{Status: enqueueQueued, Prefix: "horn", Position: 3, Play: &Play{Sound: &soundClip{Name: "one"}, Forced: true}})
+	var ok playSoundResponse
+	if err := json.NewDecoder(rec.Body).Decode(&ok); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if rec.Code != http.StatusOK || ok.Status != "queued" || ok.Sound != "one" || ok.Position != 3 {
+		t.Errorf("response = %d %+v", rec.Code, ok)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+// usePlaying installs a player for guild-1 without a worker, with current as
+// the sound playing and pending queued behind it. The returned func reports
+// whether the current play was skipped.
+func usePlaying(t *testing.T, current *Play, pending ...*Play) func() bool {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	mutex.Lock()
+	players["guild-1"] = &guildPlayer{
+		guildID: "guild-1",
+		wake:    make(chan struct{}, 1),
+		pending: pending,
+		current: current,
+		skip:    cancel,
+	}
+	mutex.Unlock()
+	t.Cleanup(func() {
+		cancel()
+		mutex.Lock()
+		delete(players, "guild-1")
+		mutex.Unlock()
+	})
+	return func() bool { return ctx.Err() != nil }
+}
+
+func TestSoundCommandReply_queueControl(t *testing.T) {
+	s := testSoundSession(t, true)
+	one := &Play{Prefix: "horn", Sound: &soundClip{Name: "one"}, UserID: "user-1"}
+	two := &Play{Prefix: "horn", Sound: &soundClip{Name: "two"}, UserID: "user-2"}
+	three := &Play{Prefix: "cow", Sound: &soundClip{Name: "moo"}, UserID: "user-3"}
+
+	if got := soundCommandReply(s, soundInteraction("guild-1", "skip")); got != "Nothing is playing." {
+		t.Errorf("skip while idle = %q", got)
+	}
+	cancelled := usePlaying(t, one, two, three)
+
+	want := "Now playing `!horn one`, queued by <@user-1>.\n1. `!horn two` by <@user-2>\n2. `!cow moo` by <@user-3>"
+	if got := soundCommandReply(s, soundInteraction("guild-1", "queue")); got != want {
+		t.Errorf("queue = %q, want %q", got, want)
+	}
+
+	if got := soundCommandReply(s, soundInteraction("guild-1", "skip")); got != "Skipped `!horn one`." || !cancelled() {
+		t.Errorf("skip = %q, cancelled %v", got, cancelled())
+	}
+	if _, pending := guildQueue("guild-1"); len(pending) != 2 {
+		t.Errorf("skip must keep the queue, %d plays left", len(pending))
+	}
+
+	if got := soundCommandReply(s, soundInteraction("guild-1", "stop")); got != "Stopped `!horn one` and cleared 2 queued sounds." {
+		t.Errorf("stop = %q", got)
+	}
+	if _, pending := guildQueue("guild-1"); len(pending) != 0 {
+		t.Errorf("after stop %d plays are left, want none", len(pending))
+	}
+}
+
+func TestStopReply(t *testing.T) {
+	one := &Play{Prefix: "horn", Sound: &soundClip{Name: "one"}}
+	cases := map[string]string{
+		stopReply(0, nil): "Nothing is playing.",
+		stopReply(3, nil): "Cleared 3 queued sounds.",
+		stopReply(0, one): "Stopped `!horn one`.",
+	}
+	for got, want := range cases {
+		if got != want {
+			t.Errorf("stopReply = %q, want %q", got, want)
+		}
+	}
+}
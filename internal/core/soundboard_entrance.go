@@ -0,0 +1,153 @@
+package gidbig
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+	"gorm.io/gorm"
+)
+
+// EntranceSound is the sound played when a user joins a voice channel of a
+// guild.
+type EntranceSound struct {
+	gorm.Model
+	GuildID    string `gorm:"not null;uniqueIndex:idx_soundboard_entrance_member"`
+	UserID     string `gorm:"not null;uniqueIndex:idx_soundboard_entrance_member"`
+	Collection string `gorm:"not null"`
+	Sound      string `gorm:"not null"`
+}
+
+// TableName returns the database table name.
+func (EntranceSound) TableName() string { return "soundboard_entrances" }
+
+// loadEntrance returns the entrance sound of userID in guildID, or nil when
+// the user has none.
+func loadEntrance(guildID, userID string) (*EntranceSound, error) {
+	d := getSoundDB()
+	if d == nil {
+		return nil, errors.New("store not initialized")
+	}
+	var e EntranceSound
+	err := d.Where("guild_id = ? AND user_id = ?", guildID, userID).First(&e).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// saveEntrance sets the entrance sound of userID in guildID, replacing the
+// previous one.
+func saveEntrance(guildID, userID, collection, sound string) error {
+	d := getSoundDB()
+	if d == nil {
+		return errors.New("store not initialized")
+	}
+	var e EntranceSound
+	return d.Where(EntranceSound{GuildID: guildID, UserID: userID}).
+		Assign(EntranceSound{Collection: collection, Sound: sound}).
+		FirstOrCreate(&e).Error
+}
+
+// deleteEntrance removes the entrance sound of userID in guildID and reports
+// whether there was one.
+func deleteEntrance(guildID, userID string) (bool, error) {
+	d := getSoundDB()
+	if d == nil {
+		return false, errors.New("store not initialized")
+	}
+	// Delete for good so the unique index allows setting a new one later.
+	res := d.Unscoped().Where("guild_id = ? AND user_id = ?", guildID, userID).Delete(&EntranceSound{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// onVoiceStateUpdate plays the entrance sound of users joining a voice
+// channel. Moving between channels and mute or deafen changes do not count
+// as joining.
+func onVoiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	if v.VoiceState == nil || v.ChannelID == "" {
+		return
+	}
+	if v.BeforeUpdate != nil && v.BeforeUpdate.ChannelID != "" {
+		return
+	}
+	if (v.Member != nil && v.Member.User != nil && v.Member.User.Bot) || (s.State.User != nil && v.UserID == s.State.User.ID) {
+		return
+	}
+	playEntrance(v.GuildID, v.UserID)
+}
+
+// playEntrance queues the entrance sound of userID in guildID, unless
+// entrances are off there or the user's last entrance is too recent.
+func playEntrance(guildID, userID string) {
+	policy := currentSoundPolicy()
+	if !policy.EntrancesIn(guildID) || !limiter.admitEntrance(guildID, userID, policy.EntranceCooldownIn(guildID)) {
+		return
+	}
+	e, err := loadEntrance(guildID, userID)
+	if err != nil {
+		slog.Error("could not load entrance sound", "guild", guildID, "user", userID, "error", err)
+		return
+	}
+	if e == nil {
+		return
+	}
+	coll := collectionIn(guildID, e.Collection)
+	sound := findSound(coll, e.Sound)
+	if sound == nil {
+		slog.Warn("entrance sound is no longer available", "guild", guildID, "user", userID, "prefix", e.Collection, "soundname", e.Sound)
+		return
+	}
+	guild, err := discord.State.Guild(guildID)
+	if err != nil {
+		slog.Error("could not look up guild for entrance sound", "guild", guildID, "error", err)
+		return
+	}
+	member, err := lookupMember(guildID, userID)
+	if err != nil {
+		slog.Error("could not look up member for entrance sound", "guild", guildID, "user", userID, "error", err)
+		return
+	}
+	res := enqueuePlay(member.User, guild, coll, sound, sourceEntrance)
+	slog.Info("entrance sound", "guild", guildID, "user", userID, "prefix", coll.Prefix, "soundname", sound.Name, "result", res.Code())
+}
+
+// entranceCommandReply runs /sound entrance set and clear for the user of i.
+func entranceCommandReply(i *discordgo.InteractionCreate, sub string) string {
+	userID := i.Member.User.ID
+	switch sub {
+	case "entrance set":
+		collection, name := soundOption(i, "collection"), soundOption(i, "name")
+		coll := collectionIn(i.GuildID, collection)
+		if coll == nil {
+			return enqueueResult{Status: enqueueUnknownCollection, Prefix: collection}.Message()
+		}
+		if findSound(coll, name) == nil {
+			return enqueueResult{Status: enqueueUnknownSound, Prefix: coll.Prefix, SoundName: name}.Message()
+		}
+		if err := saveEntrance(i.GuildID, userID, coll.Prefix, name); err != nil {
+			slog.Error("could not save entrance sound", "guild", i.GuildID, "user", userID, "error", err)
+			return "Could not save your entrance sound, try again later."
+		}
+		reply := fmt.Sprintf("Your entrance sound is now `!%s %s`.", coll.Prefix, name)
+		if !currentSoundPolicy().EntrancesIn(i.GuildID) {
+			reply += " Entrance sounds are turned off on this server, so it stays quiet for now."
+		}
+		return reply
+	case "entrance clear":
+		removed, err := deleteEntrance(i.GuildID, userID)
+		if err != nil {
+			slog.Error("could not remove entrance sound", "guild", i.GuildID, "user", userID, "error", err)
+			return "Could not remove your entrance sound, try again later."
+		}
+		if !removed {
+			return "You have no entrance sound."
+		}
+		return "Your entrance sound was removed."
+	}
+	return "Unknown subcommand."
+}
@@ -0,0 +1,136 @@
+package gidbig
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+func TestEntranceStore(t *testing.T) {
+	useSoundStore(t)
+	if e, err := loadEntrance("guild-1", "user-1"); err != nil || e != nil {
+		t.Fatalf("loadEntrance before set = %+v, %v; want none", e, err)
+	}
+	if err := saveEntrance("guild-1", "user-1", "horn", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveEntrance("guild-1", "user-1", "cow", "moo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveEntrance("guild-2", "user-1", "horn", "two"); err != nil {
+		t.Fatal(err)
+	}
+	e, err := loadEntrance("guild-1", "user-1")
+	if err != nil || e == nil || e.Collection != "cow" || e.Sound != "moo" {
+		t.Fatalf("loadEntrance = %+v, %v; want the replaced !cow moo", e, err)
+	}
+
+	if removed, err := deleteEntrance("guild-1", "user-1"); err != nil || !removed {
+		t.Fatalf("deleteEntrance = %v, %v", removed, err)
+	}
+	if removed, err := deleteEntrance("guild-1", "user-1"); err != nil || removed {
+		t.Fatalf("second deleteEntrance = %v, %v; want nothing removed", removed, err)
+	}
+	if err := saveEntrance("guild-1", "user-1", "horn", "one"); err != nil {
+		t.Fatalf("set after clear: %v", err)
+	}
+	if e, _ := loadEntrance("guild-2", "user-1"); e == nil || e.Sound != "two" {
+		t.Errorf("entrance of the other guild = %+v, want it kept", e)
+	}
+}
+
+// voiceJoin is the update sent when user-1 joins channelID, coming from
+// beforeChannelID.
+func voiceJoin(channelID, beforeChannelID string) *discordgo.VoiceStateUpdate {
+	v := &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{GuildID: "guild-1", UserID: "user-1", ChannelID: channelID}}
+	if beforeChannelID != "" {
+		v.BeforeUpdate = &discordgo.VoiceState{GuildID: "guild-1", UserID: "user-1", ChannelID: beforeChannelID}
+	}
+	return v
+}
+
+func TestOnVoiceStateUpdate_playsEntrance(t *testing.T) {
+	useSoundStore(t)
+	useCollections(t)
+	COLLECTIONS = []*soundCollection{{Prefix: "horn", Commands: []string{"!horn"},
+		Sounds: []*soundClip{{Name: "one", Weight: 1}}, soundRange: 1}}
+	s := testSoundSession(t, true)
+	usePlaying(t, &Play{})
+	on, off := true, false
+	advance := usePolicy(t, cfg.SoundboardConfig{
+		EntranceCooldown: "10m",
+		Guilds:           map[string]cfg.SoundboardGuild{"guild-1": {Entrances: &on}},
+	})
+	if err := saveEntrance("guild-1", "user-1", "horn", "one"); err != nil {
+		t.Fatal(err)
+	}
+	queued := func() int {
+		_, pending := guildQueue("guild-1")
+		return len(pending)
+	}
+
+	onVoiceStateUpdate(s, voiceJoin("voice-1", ""))
+	_, pending := guildQueue("guild-1")
+	if len(pending) != 1 || pending[0].Source != sourceEntrance || pending[0].Sound.Name != "one" {
+		t.Fatalf("queue after joining = %+v, want the entrance sound", pending)
+	}
+
+	// Reconnecting inside the cooldown and moving channels stay quiet.
+	onVoiceStateUpdate(s, voiceJoin("voice-1", ""))
+	advance(time.Hour)
+	onVoiceStateUpdate(s, voiceJoin("voice-1", "voice-2"))
+	onVoiceStateUpdate(s, voiceJoin("", "voice-1"))
+	if n := queued(); n != 1 {
+		t.Fatalf("queue = %d plays, want only the first entrance", n)
+	}
+	onVoiceStateUpdate(s, voiceJoin("voice-1", ""))
+	if n := queued(); n != 2 {
+		t.Fatalf("queue = %d plays, want a second entrance after the cooldown", n)
+	}
+
+	setSoundPolicy(cfg.SoundboardConfig{Entrances: true,
+		Guilds: map[string]cfg.SoundboardGuild{"guild-1": {Entrances: &off}}})
+	advance(time.Hour)
+	onVoiceStateUpdate(s, voiceJoin("voice-1", ""))
+	if n := queued(); n != 2 {
+		t.Errorf("queue = %d plays, want no entrance while the guild turned them off", n)
+	}
+}
+
+func TestEntranceCommandReply(t *testing.T) {
+	useSoundStore(t)
+	useCollections(t)
+	COLLECTIONS = []*soundCollection{{Prefix: "horn", Commands: []string{"!horn"},
+		Sounds: []*soundClip{{Name: "one", Weight: 1}}, soundRange: 1}}
+	s := testSoundSession(t, false)
+	usePolicy(t, cfg.SoundboardConfig{})
+
+	set := func(collection, name string) string {
+		return soundCommandReply(s, soundInteraction("guild-1", "entrance set",
+			stringOption("collection", collection, false), stringOption("name", name, false)))
+	}
+	choices := soundAutocompleteChoices("guild-1", soundData("entrance set", stringOption("collection", "ho", true)))
+	if len(choices) != 1 || choices[0].Value != "horn" {
+		t.Errorf("collection choices = %+v, want horn", choices)
+	}
+	if got := set("horn", "two"); got != "Unknown sound `two` in `!horn`." {
+		t.Errorf("unknown sound reply = %q", got)
+	}
+	got := set("!horn", "one")
+	if !strings.HasPrefix(got, "Your entrance sound is now `!horn one`.") || !strings.Contains(got, "turned off on this server") {
+		t.Errorf("set reply = %q, want the sound and a note that entrances are off", got)
+	}
+	if e, _ := loadEntrance("guild-1", "user-1"); e == nil || e.Collection != "horn" {
+		t.Errorf("stored entrance = %+v", e)
+	}
+	clearCmd := soundInteraction("guild-1", "entrance clear")
+	if got := soundCommandReply(s, clearCmd); got != "Your entrance sound was removed." {
+		t.Errorf("clear reply = %q", got)
+	}
+	if got := soundCommandReply(s, clearCmd); got != "You have no entrance sound." {
+		t.Errorf("second clear reply = %q", got)
+	}
+}
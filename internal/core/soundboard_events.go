@@ -0,0 +1,239 @@
+package gidbig
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// eventBuffer is how many events a subscriber may fall behind before it
+	// is dropped. The web UI reconnects and starts over from a snapshot.
+	eventBuffer = 64
+
+	// eventKeepAlive is how often an idle event stream sends a comment so
+	// proxies do not close it.
+	eventKeepAlive = 25 * time.Second
+)
+
+// The types of soundEvent.
+const (
+	// eventState is the snapshot of a guild sent when a stream opens.
+	eventState    = "state"
+	eventQueued   = "queued"
+	eventStarted  = "started"
+	eventFinished = "finished"
+	eventSkipped  = "skipped"
+	// eventCleared is sent when /sound stop drops the queue.
+	eventCleared = "cleared"
+	// eventVoice is sent when the voice connection of a guild changes.
+	eventVoice = "voice"
+)
+
+// soundEvent is something that happened in the player of a guild, together
+// with the state of the guild right after it so a client never has to merge
+// events itself.
+type soundEvent struct {
+	Type    string `json:"type"`
+	GuildID string `json:"guild_id"`
+	// Play is the sound the event is about, unset for voice events.
+	Play *eventPlay `json:"play,omitempty"`
+	// Voice is connected, disconnected, failed or stalled for voice events.
+	Voice   string `json:"voice,omitempty"`
+	Cleared int    `json:"cleared,omitempty"`
+
+	// VoiceChannelID is the channel the bot is in, empty when none.
+	VoiceChannelID string      `json:"voice_channel_id,omitempty"`
+	NowPlaying     *eventPlay  `json:"now_playing,omitempty"`
+	Queue          []eventPlay `json:"queue"`
+}
+
+// eventPlay is a play as the event stream shows it. The duration follows
+// from the frame count of the clip; ElapsedMs is only set for the sound
+// playing.
+type eventPlay struct {
+	Prefix     string `json:"prefix"`
+	Sound      string `json:"sound"`
+	QueuedBy   string `json:"queued_by"`
+	Frames     int    `json:"frames"`
+	DurationMs int64  `json:"duration_ms"`
+	ElapsedMs  int64  `json:"elapsed_ms,omitempty"`
+}
+
+func newEventPlay(play *Play) eventPlay {
+	ep := eventPlay{Prefix: play.Prefix, QueuedBy: play.Username}
+	if play.Sound != nil {
+		ep.Sound = play.Sound.Name
+		ep.Frames = len(play.Sound.buffer)
+		ep.DurationMs = (time.Duration(ep.Frames) * 20 * time.Millisecond).Milliseconds()
+	}
+	return ep
+}
+
+// event returns an event of type typ about play with the current state of
+// p. The caller must hold mutex.
+func (p *guildPlayer) event(typ string, play *Play) soundEvent {
+	ev := soundEvent{Type: typ, GuildID: p.guildID, VoiceChannelID: p.voice, Queue: make([]eventPlay, 0, len(p.pending))}
+	if play != nil {
+		ep := newEventPlay(play)
+		ev.Play = &ep
+	}
+	if p.current != nil && !p.started.IsZero() {
+		np := newEventPlay(p.current)
+		np.ElapsedMs = time.Since(p.started).Milliseconds()
+		ev.NowPlaying = &np
+	}
+	for _, q := range p.pending {
+		if q != nil {
+			ev.Queue = append(ev.Queue, newEventPlay(q))
+		}
+	}
+	return ev
+}
+
+// emit publishes an event of type typ about play. The caller must hold mutex.
+func (p *guildPlayer) emit(typ string, play *Play) {
+	soundEvents.publish(p.event(typ, play))
+}
+
+// emitVoice records and publishes a change of the voice connection. It is
+// called by the worker, which must not hold mutex.
+func (p *guildPlayer) emitVoice(state, channelID string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	p.voice = channelID
+	ev := p.event(eventVoice, nil)
+	ev.Voice = state
+	soundEvents.publish(ev)
+}
+
+// eventHub fans the events of every player out to the open event streams.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan soundEvent]struct{}
+}
+
+var soundEvents = &eventHub{subs: make(map[chan soundEvent]struct{})}
+
+// subscribe returns a channel receiving every event published from now on
+// and a function to stop. The channel is closed when the subscriber falls
+// more than eventBuffer events behind.
+func (h *eventHub) subscribe() (<-chan soundEvent, func()) {
+	ch := make(chan soundEvent, eventBuffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish hands ev to every subscriber without blocking.
+func (h *eventHub) publish(ev soundEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			slog.Warn("dropping slow event subscriber", "guild", ev.GuildID, "type", ev.Type)
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribeWithSnapshots subscribes to the events and returns a state event
+// for every guild with a player. Events are only published with mutex held,
+// so the snapshots are exactly the state the first event applies to.
+func subscribeWithSnapshots() ([]soundEvent, <-chan soundEvent, func()) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	events, unsubscribe := soundEvents.subscribe()
+	snapshots := make([]soundEvent, 0, len(players))
+	for _, p := range players {
+		snapshots = append(snapshots, p.event(eventState, nil))
+	}
+	return snapshots, events, unsubscribe
+}
+
+// handleAPIEvents streams the events of the guilds the user is a member of
+// as Server-Sent Events, starting with a snapshot of each of them.
+func handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use GET.")
+		return
+	}
+	userID, ok := apiUser(w, r, scopePlay)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Streaming is not supported.")
+		return
+	}
+	snapshots, events, unsubscribe := subscribeWithSnapshots()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Membership is looked up once per guild and stream.
+	member := make(map[string]bool)
+	send := func(ev soundEvent) bool {
+		allowed, seen := member[ev.GuildID]
+		if !seen {
+			allowed = isGuildMember(ev.GuildID, userID)
+			member[ev.GuildID] = allowed
+		}
+		if !allowed {
+			return true
+		}
+		data, err := json.Marshal(ev)
+		if err != nil {
+			slog.Error("could not encode sound event", "error", err)
+			return true
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	for _, ev := range snapshots {
+		if !send(ev) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok || !send(ev) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
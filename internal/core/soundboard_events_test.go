@@ -0,0 +1,143 @@
+package gidbig
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, events <-chan soundEvent) soundEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return soundEvent{}
+	}
+}
+
+func TestGuildPlayer_events(t *testing.T) {
+	j := useFakeVoice(t, 0)
+	events, unsubscribe := soundEvents.subscribe()
+	defer unsubscribe()
+
+	first := testPlay("voice-a", 0, 1, 1)
+	first.Username = "Alice"
+	enqueueTest(t, first, testPlay("voice-a", 0, 2))
+	nextFrame(t, j.frames)
+	skipSound("guild-p")
+	nextFrame(t, j.frames)
+	waitFor(t, "the idle player to leave", playerGone)
+
+	var got []string
+	for len(got) == 0 || got[len(got)-1] != "voice:disconnected" {
+		ev := nextEvent(t, events)
+		switch ev.Type {
+		case eventStarted:
+			if ev.NowPlaying == nil || *ev.NowPlaying != *ev.Play {
+				t.Errorf("started event = %+v, want the play as now playing", ev)
+			}
+		case eventFinished, eventSkipped:
+			if ev.NowPlaying != nil {
+				t.Errorf("%s event still has %+v playing", ev.Type, ev.NowPlaying)
+			}
+		case eventVoice:
+			got = append(got, ev.Type+":"+ev.Voice)
+			continue
+		}
+		got = append(got, ev.Type+":"+ev.Play.Sound+":"+ev.Play.QueuedBy)
+		if ev.Type == eventQueued && ev.Play.QueuedBy == "Alice" && (ev.Play.Frames != 2 || ev.Play.DurationMs != 40) {
+			t.Errorf("queued event = %+v, want 2 frames lasting 40ms", ev.Play)
+		}
+	}
+	want := []string{
+		"queued:clip:Alice", "queued:clip:",
+		"voice:connected", "started:clip:Alice", "skipped:clip:Alice",
+		"started:clip:", "finished:clip:",
+		"voice:disconnected",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("events =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestEventHub_dropsSlowSubscriber(t *testing.T) {
+	hub := &eventHub{subs: make(map[chan soundEvent]struct{})}
+	events, unsubscribe := hub.subscribe()
+	for range eventBuffer + 1 {
+		hub.publish(soundEvent{Type: eventQueued})
+	}
+	n := 0
+	for range events {
+		n++
+	}
+	if n != eventBuffer || len(hub.subs) != 0 {
+		t.Errorf("received %d events with %d subscribers left, want %d and none", n, len(hub.subs), eventBuffer)
+	}
+	unsubscribe() // after being dropped, this must not close the channel again
+}
+
+func TestHandleAPIEvents(t *testing.T) {
+	testSoundSession(t, false)
+	usePlaying(t, &Play{Prefix: "horn", Sound: &soundClip{Name: "one"}, Username: "Alice"},
+		&Play{Prefix: "cow", Sound: &soundClip{Name: "moo"}, Username: "Bob"})
+	srv := httptest.NewServer(http.HandlerFunc(handleAPIEvents))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range authedRequest(t, http.MethodGet, "/api/events", "user-1", nil).Cookies() {
+		req.AddCookie(c)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("response = %d %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	lines := bufio.NewScanner(res.Body)
+	read := func() soundEvent {
+		t.Helper()
+		for lines.Scan() {
+			if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+				var ev soundEvent
+				if err := json.Unmarshal([]byte(data), &ev); err != nil {
+					t.Fatal(err)
+				}
+				return ev
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return soundEvent{}
+	}
+
+	// usePlaying leaves started zero, as between the parts of a chain.
+	if ev := read(); ev.Type != eventState || ev.GuildID != "guild-1" || len(ev.Queue) != 1 || ev.Queue[0].Sound != "moo" {
+		t.Errorf("snapshot = %+v", ev)
+	}
+	// Events of guilds the user is not a member of are left out.
+	soundEvents.publish(soundEvent{Type: eventQueued, GuildID: "guild-2"})
+	mutex.Lock()
+	players["guild-1"].emit(eventSkipped, &Play{Prefix: "horn", Sound: &soundClip{Name: "one"}})
+	mutex.Unlock()
+	if ev := read(); ev.Type != eventSkipped || ev.GuildID != "guild-1" || ev.Play.Sound != "one" {
+		t.Errorf("event = %+v, want the skip in guild-1", ev)
+	}
+
+	w := httptest.NewRecorder()
+	handleAPIEvents(w, httptest.NewRequest(http.MethodGet, "/api/events", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("logged out = %d, want 401", w.Code)
+	}
+}
@@ -1,60 +1,297 @@
 package gidbig
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
-// COLLECTIONS all collections
-var COLLECTIONS []*soundCollection
+// audioDir holds the {prefix}_{soundname}.dca, .ogg and .opus files and their
+// optional .txt descriptions.
+const audioDir = "audio"
 
-// Create collections
-func createCollections() {
-	files, _ := os.ReadDir("./audio")
+var (
+	// COLLECTIONS all collections. Rescans replace the slice instead of
+	// modifying it; read it through soundCollections.
+	COLLECTIONS []*soundCollection
+
+	// collectionsMu guards COLLECTIONS.
+	collectionsMu sync.RWMutex
+
+	// rescanMu serialises rescans so two of them never load the same files.
+	rescanMu sync.Mutex
+
+	// soundPrefixPattern and soundNamePattern keep new sounds usable as
+	// {prefix}_{soundname} file names and chat commands.
+	soundPrefixPattern = regexp.MustCompile(`^[a-z0-9]{1,32}$`)
+	soundNamePattern   = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+)
+
+// soundCollections returns the current collections. The result is never
+// modified after it is published, so it can be used without holding a lock.
+func soundCollections() []*soundCollection {
+	collectionsMu.RLock()
+	defer collectionsMu.RUnlock()
+	return COLLECTIONS
+}
+
+// availableIn reports whether the collection can be used in guildID.
+func (c *soundCollection) availableIn(guildID string) bool {
+	return len(c.Guilds) == 0 || slices.Contains(c.Guilds, guildID)
+}
+
+// soundCollectionsIn returns the collections that can be used in guildID.
+func soundCollectionsIn(guildID string) []*soundCollection {
+	var colls []*soundCollection
+	for _, c := range soundCollections() {
+		if c.availableIn(guildID) {
+			colls = append(colls, c)
+		}
+	}
+	return colls
+}
+
+// collectionIn returns the collection answering to command in guildID, or nil
+// when there is none or it belongs to other guilds.
+func collectionIn(guildID, command string) *soundCollection {
+	if c := collectionByCommand(command); c != nil && c.availableIn(guildID) {
+		return c
+	}
+	return nil
+}
+
+// rescanResult lists the sounds a rescan changed as "prefix_soundname".
+type rescanResult struct {
+	Added   []string
+	Updated []string
+	Removed []string
+	Failed  []error
+}
+
+func (r rescanResult) String() string {
+	if len(r.Added)+len(r.Updated)+len(r.Removed)+len(r.Failed) == 0 {
+		return "Sounds rescanned, nothing changed."
+	}
+	var sb strings.Builder
+	sb.WriteString("Sounds rescanned.")
+	for _, part := range []struct {
+		label string
+		names []string
+	}{{"Added", r.Added}, {"Updated", r.Updated}, {"Removed", r.Removed}} {
+		if len(part.names) > 0 {
+			fmt.Fprintf(&sb, "\n%s: %s", part.label, strings.Join(part.names, ", "))
+		}
+	}
+	for _, err := range r.Failed {
+		fmt.Fprintf(&sb, "\nFailed: %v", err)
+	}
+	return sb.String()
+}
+
+// rescanSounds rebuilds COLLECTIONS from audioDir. Clips whose sound file is
+// unchanged keep their loaded buffer, new or modified files are loaded, and
+// deleted ones are dropped. Descriptions and manifests are re-read for every
+// clip. A sound that is currently playing holds its own *soundClip and is not
+// affected.
+func rescanSounds() rescanResult {
+	rescanMu.Lock()
+	defer rescanMu.Unlock()
+
+	prev := make(map[string]*soundClip)
+	for _, c := range soundCollections() {
+		for _, snd := range c.Sounds {
+			prev[c.Prefix+"_"+snd.Name] = snd
+		}
+	}
+
+	var (
+		res      rescanResult
+		next     []*soundCollection
+		byPrefix = make(map[string]*soundCollection)
+		seen     = make(map[string]bool)
+	)
+	files, err := os.ReadDir(audioDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		res.Failed = append(res.Failed, err)
+		return res
+	}
 	for _, f := range files {
-		if strings.Contains(f.Name(), ".dca") {
-			soundfile := strings.Split(strings.ReplaceAll(f.Name(), ".dca", ""), "_")
-			containsPrefix := false
-			containsSound := false
+		// Dotfiles are uploads in progress and normalized copies.
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		ext := filepath.Ext(f.Name())
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(f.Name(), ext), "_")
+		if _, known := soundFormats[ext]; f.IsDir() || !known || !ok || name == "" {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			res.Failed = append(res.Failed, err)
+			continue
+		}
+		c, ok := byPrefix[prefix]
+		if !ok {
+			c = newSoundCollection(prefix)
+			byPrefix[prefix] = c
+			next = append(next, c)
+		}
 
-			if len(COLLECTIONS) == 0 {
-				addNewSoundCollection(soundfile[0], soundfile[1])
-			}
-			for _, c := range COLLECTIONS {
-				if c.Prefix == soundfile[0] {
-					containsPrefix = true
-					for _, sound := range c.Sounds {
-						if sound.Name == soundfile[1] {
-							containsSound = true
-						}
-					}
-					if !containsSound {
-						c.Sounds = append(c.Sounds, createSound(soundfile[1], 1, 250))
-					}
-				}
+		key := prefix + "_" + name
+		if seen[key] {
+			res.Failed = append(res.Failed, fmt.Errorf("%s: skipping %s, another file already provides this sound", key, f.Name()))
+			continue
+		}
+		var clip *soundClip
+		if old := prev[key]; old != nil && old.ext == ext && old.modTime.Equal(info.ModTime()) && old.size == info.Size() {
+			cp := *old
+			cp.Weight, cp.PartDelay = defaultWeight, defaultPartDelay
+			cp.DisplayName, cp.Tags, cp.volume = "", nil, 0
+			clip = &cp
+		} else {
+			clip = createSound(name, defaultWeight, defaultPartDelay)
+			clip.ext = ext
+			if err := clip.Load(c); err != nil {
+				res.Failed = append(res.Failed, fmt.Errorf("%s: %w", key, err))
+				seen[key] = true
+				continue
 			}
-			if !containsPrefix {
-				addNewSoundCollection(soundfile[0], soundfile[1])
+			clip.modTime, clip.size = info.ModTime(), info.Size()
+			if old != nil {
+				res.Updated = append(res.Updated, key)
+			} else {
+				res.Added = append(res.Added, key)
 			}
 		}
+		clip.description = nil
+		if text, shortText, ok := readSoundDescription(prefix, name); ok {
+			clip.description = &soundDescription{Text: text, Short: shortText}
+		} else if clip.meta.Title != "" {
+			clip.description = &soundDescription{Text: clip.meta.Title, Short: shortDescription(clip.meta.Title)}
+		}
+		seen[key] = true
+		c.Sounds = append(c.Sounds, clip)
+	}
+	for key := range prev {
+		if !seen[key] {
+			res.Removed = append(res.Removed, key)
+		}
+	}
+	slices.Sort(res.Removed)
+	next = slices.DeleteFunc(next, func(c *soundCollection) bool { return len(c.Sounds) == 0 })
+	res.Failed = append(res.Failed, applyManifests(next)...)
+	res.Failed = append(res.Failed, normalizeSounds(next, currentSoundPolicy().Normalize)...)
+	for _, c := range next {
+		for _, snd := range c.Sounds {
+			c.soundRange += snd.Weight
+		}
+	}
+
+	collectionsMu.Lock()
+	COLLECTIONS = next
+	collectionsMu.Unlock()
+	return res
+}
+
+// watchSounds rescans audioDir whenever its contents change, checking every
+// interval until ctx is done.
+func watchSounds(ctx context.Context, interval time.Duration) {
+	last := audioDirFingerprint()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fp := audioDirFingerprint()
+		if fp == last {
+			continue
+		}
+		last = fp
+		res := rescanSounds()
+		slog.Info("audio directory changed, sounds rescanned",
+			"added", res.Added, "updated", res.Updated, "removed", res.Removed, "failed", len(res.Failed))
+		for _, err := range res.Failed {
+			slog.Error("error adding sound to soundCollection", "error", err)
+		}
+	}
+}
+
+// audioDirFingerprint summarises names, sizes and modification times of the
+// files in audioDir so that changes can be detected without loading them.
+func audioDirFingerprint() string {
+	files, _ := os.ReadDir(audioDir)
+	var sb strings.Builder
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s|%d|%d\n", f.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return sb.String()
+}
+
+// checkNewSound refuses prefix and name for a new sound when they are not
+// usable as a file name and command or the sound already exists.
+func checkNewSound(prefix, name string) error {
+	if !soundPrefixPattern.MatchString(prefix) || prefix == sayCollection.Prefix {
+		return &manageError{http.StatusBadRequest, "invalid_name", "The collection may only use lowercase letters and digits."}
+	}
+	if !soundNamePattern.MatchString(name) {
+		return &manageError{http.StatusBadRequest, "invalid_name", "The name may only use lowercase letters, digits, `-` and `_`."}
+	}
+	if c := collectionByCommand(prefix); c != nil && c.Prefix != prefix {
+		return &manageError{http.StatusConflict, "sound_exists", fmt.Sprintf("`!%s` is an alias of `!%s`, use that collection.", prefix, c.Prefix)}
 	}
+	if soundExists(prefix, name) {
+		return &manageError{http.StatusConflict, "sound_exists", fmt.Sprintf("`!%s %s` already exists.", prefix, name)}
+	}
+	return nil
+}
+
+// soundFile returns the path of the sound file of prefix and name in
+// audioDir, whether it loaded or not.
+func soundFile(prefix, name string) (string, bool) {
+	for _, ext := range slices.Sorted(maps.Keys(soundFormats)) {
+		path := filepath.Join(audioDir, prefix+"_"+name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
 }
 
-func addNewSoundCollection(prefix string, soundname string) {
-	var SC = &soundCollection{
+// soundExists reports whether a sound called name exists in prefix, as a
+// loaded sound or a file.
+func soundExists(prefix, name string) bool {
+	if findSound(collectionByCommand(prefix), name) != nil {
+		return true
+	}
+	_, ok := soundFile(prefix, name)
+	return ok
+}
+
+func newSoundCollection(prefix string) *soundCollection {
+	return &soundCollection{
 		Prefix: prefix,
 		Commands: []string{
 			"!" + prefix,
 		},
-		Sounds: []*soundClip{
-			createSound(soundname, 1, 250),
-		},
 	}
-	COLLECTIONS = append(COLLECTIONS, SC)
 }
 
 // Create a Sound struct
@@ -67,70 +304,41 @@ func createSound(Name string, Weight int, PartDelay int) *soundClip {
 	}
 }
 
-// Load soundcollection
-func (sc *soundCollection) Load() {
-	for _, sound := range sc.Sounds {
-		sc.soundRange += sound.Weight
-		err := sound.Load(sc)
-		if err != nil {
-			slog.Error("error adding sound to soundCollection", "Error", err)
-		}
-	}
-}
-
-// Load attempts to load an encoded sound file from disk
-// DCA files are pre-computed sound files that are easy to send to Discord.
-// If you would like to create your own DCA files, please use:
+// Load attempts to load an encoded sound file from disk.
+// DCA files are pre-computed sound files that are easy to send to Discord,
+// with or without a DCA1 metadata header. If you would like to create your
+// own DCA files, please use:
 // https://github.com/nstafie/dca-rs
 // eg: dca-rs --raw -i <input wav file> > <output file>
+// Ogg Opus files (.ogg, .opus) as written by opusenc or ffmpeg are demuxed
+// directly.
 func (s *soundClip) Load(c *soundCollection) error {
-	path := fmt.Sprintf("audio/%v_%v.dca", c.Prefix, s.Name)
+	ext := s.ext
+	if ext == "" {
+		ext = ".dca"
+	}
+	read, ok := soundFormats[ext]
+	if !ok {
+		return fmt.Errorf("unsupported sound file type %q", ext)
+	}
+	path := fmt.Sprintf("%s/%v_%v%s", audioDir, c.Prefix, s.Name, ext)
 
 	file, err := os.Open(path)
-
 	if err != nil {
-		slog.Error("error opening dca file", "error", err)
+		slog.Error("error opening sound file", "error", err)
 		return err
 	}
 	defer func() { _ = file.Close() }()
 
-	var opuslen int16
-	var minLen, maxLen, totalBytes int
-
-	for {
-		// read opus frame length from dca file
-		err = binary.Read(file, binary.LittleEndian, &opuslen)
-
-		// If this is the end of the file, just return
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			break
-		}
-
-		if err != nil {
-			slog.Error("error reading from dca file", "error", err)
-			return err
-		}
-
-		// A negative or absurdly large frame length means we lost framing —
-		// most often because the file has a DCA1 JSON header that the loader
-		// doesn't strip.  Surface this loudly instead of corrupting the buffer.
-		if opuslen <= 0 || opuslen > 4000 {
-			slog.Error("dca frame length out of range — file is likely DCA1 or corrupted",
-				"path", path, "opuslen", opuslen, "frameIndex", len(s.buffer))
-			return fmt.Errorf("invalid opus frame length %d in %s", opuslen, path)
-		}
-
-		// read encoded pcm from dca file
-		InBuf := make([]byte, opuslen)
-		err = binary.Read(file, binary.LittleEndian, &InBuf)
-
-		// Should not be any end of file errors
-		if err != nil {
-			slog.Error("error reading from dca file", "error", err)
-			return err
-		}
+	frames, meta, err := read(file)
+	if err != nil {
+		slog.Error("error reading sound file", "path", path, "error", err)
+		return fmt.Errorf("%s: %w", path, err)
+	}
 
-		l := int(opuslen)
+	var minLen, maxLen, totalBytes int
+	for _, frame := range frames {
+		l := len(frame)
 		if minLen == 0 || l < minLen {
 			minLen = l
 		}
@@ -138,16 +346,17 @@ func (s *soundClip) Load(c *soundCollection) error {
 			maxLen = l
 		}
 		totalBytes += l
-
-		// append encoded pcm data to the buffer
-		s.buffer = append(s.buffer, InBuf)
 	}
+	s.buffer = append(s.buffer, frames...)
+	s.meta = meta
 
-	slog.Debug("dca loaded",
+	slog.Debug("sound loaded",
 		"path", path,
 		"frames", len(s.buffer),
 		"bytes", totalBytes,
 		"minFrame", minLen,
-		"maxFrame", maxLen)
+		"maxFrame", maxLen,
+		"title", meta.Title,
+		"duration", meta.Duration)
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -120,3 +121,86 @@ func TestSoundCollectionRandom_returnsSound(t *testing.T) {
 		}
 	}
 }
+
+// useCollections resets COLLECTIONS for the test and restores it afterwards.
+func useCollections(t *testing.T) {
+	t.Helper()
+	original := COLLECTIONS
+	COLLECTIONS = nil
+	t.Cleanup(func() { COLLECTIONS = original })
+}
+
+func findClip(t *testing.T, prefix, name string) *soundClip {
+	t.Helper()
+	snd, c := findSoundAndCollection("", "!"+prefix, name)
+	if c == nil || snd == nil {
+		t.Fatalf("sound %s_%s not found", prefix, name)
+	}
+	return snd
+}
+
+func TestRescanSounds(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useCollections(t)
+	writeDCAFile(t, "horn", "one", [][]byte{{0x01}})
+	writeDCAFile(t, "horn", "two", [][]byte{{0x02}})
+	writeDCAFile(t, "cow", "moo_long", [][]byte{{0x03}})
+
+	res := rescanSounds()
+	if len(res.Added) != 3 || len(res.Failed) != 0 {
+		t.Fatalf("first scan = %+v, want 3 added", res)
+	}
+	if got := len(soundCollections()); got != 2 {
+		t.Fatalf("collections = %d, want 2", got)
+	}
+	findClip(t, "cow", "moo_long")
+	playing := findClip(t, "horn", "one")
+
+	if err := os.Remove(filepath.Join("audio", "horn_two.dca")); err != nil {
+		t.Fatal(err)
+	}
+	writeDCAFile(t, "horn", "three", [][]byte{{0x04}})
+	writeAudioDescription(t, "horn", "one", "loud")
+
+	res = rescanSounds()
+	if len(res.Added) != 1 || res.Added[0] != "horn_three" {
+		t.Errorf("Added = %v, want [horn_three]", res.Added)
+	}
+	if len(res.Removed) != 1 || res.Removed[0] != "horn_two" {
+		t.Errorf("Removed = %v, want [horn_two]", res.Removed)
+	}
+	if len(res.Updated) != 0 {
+		t.Errorf("Updated = %v, want none for unchanged files", res.Updated)
+	}
+	if _, c := findSoundAndCollection("", "!horn", "two"); c == nil || c.soundRange != 2 {
+		t.Errorf("horn collection should hold two sounds after the rescan")
+	}
+
+	one := findClip(t, "horn", "one")
+	if one.description == nil || one.description.Text != "loud" {
+		t.Errorf("description = %+v, want refreshed text", one.description)
+	}
+	if playing.description != nil || len(playing.buffer) != 1 {
+		t.Error("rescan must not modify a clip that may still be playing")
+	}
+}
+
+func TestRescanSounds_reportsBrokenFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useCollections(t)
+	writeDCAFile(t, "ok", "clip", [][]byte{{0x01}})
+	if err := os.WriteFile(filepath.Join("audio", "bad_clip.dca"), []byte{0xff, 0xff}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res := rescanSounds()
+	if len(res.Failed) != 1 {
+		t.Fatalf("Failed = %v, want one entry", res.Failed)
+	}
+	if _, c := findSoundAndCollection("", "!bad", "clip"); c != nil {
+		t.Error("a collection without loadable sounds must not be published")
+	}
+	if !strings.Contains(res.String(), "Added: ok_clip") {
+		t.Errorf("String() = %q, want added sound listed", res.String())
+	}
+}
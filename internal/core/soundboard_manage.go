@@ -0,0 +1,498 @@
+package gidbig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// maxDescriptionLength bounds a description edited in the web UI.
+const maxDescriptionLength = 200
+
+// manageMu serialises changes to audioDir made through the web UI.
+var manageMu sync.Mutex
+
+// SoundAudit records a change made to the sounds through the web UI.
+type SoundAudit struct {
+	gorm.Model
+	UserID     string `gorm:"not null;index"`
+	Action     string `gorm:"not null"`
+	Collection string `gorm:"not null"`
+	Sound      string `gorm:"not null"`
+	Detail     string
+}
+
+// TableName returns the database table name.
+func (SoundAudit) TableName() string { return "soundboard_audit" }
+
+// recordAudit stores that userID made a change. Without a store nothing is
+// recorded.
+func recordAudit(userID, action, prefix, name, detail string) {
+	slog.Info("sound changed", "user", userID, "action", action, "prefix", prefix, "soundname", name, "detail", detail)
+	d := getSoundDB()
+	if d == nil {
+		return
+	}
+	err := d.Create(&SoundAudit{UserID: userID, Action: action, Collection: prefix, Sound: name, Detail: detail}).Error
+	if err != nil {
+		slog.Error("could not record sound change", "user", userID, "action", action, "error", err)
+	}
+}
+
+// recentAudit returns the last limit changes, newest first.
+func recentAudit(limit int) ([]SoundAudit, error) {
+	d := getSoundDB()
+	if d == nil {
+		return nil, errors.New("store not initialized")
+	}
+	var entries []SoundAudit
+	err := d.Order("id DESC").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// manageError is a refused change, answered to the web UI with its HTTP
+// status and error code.
+type manageError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *manageError) Error() string { return e.message }
+
+// errNotManager refuses a change to a collection the user may not manage.
+var errNotManager = &manageError{http.StatusForbidden, "forbidden", "You may not manage the sounds of this collection."}
+
+// managerScope tells which collections a user may change.
+type managerScope struct {
+	// all is set for the owner and the users in soundboard.managers.
+	all bool
+	// guilds are the guilds the user administers.
+	guilds []string
+}
+
+// soundManagerScope returns which collections userID may change: every one
+// for the owner and the users listed in soundboard.managers, otherwise those
+// available in the guilds the user administers.
+func soundManagerScope(userID string) managerScope {
+	if userID == "" {
+		return managerScope{}
+	}
+	if userID == conf.Discord.OwnerID || slices.Contains(currentSoundPolicy().Managers, userID) {
+		return managerScope{all: true}
+	}
+	discord.State.RLock()
+	guilds := slices.Clone(discord.State.Guilds)
+	discord.State.RUnlock()
+	var scope managerScope
+	for _, g := range guilds {
+		if isGuildAdmin(g, userID) {
+			scope.guilds = append(scope.guilds, g.ID)
+		}
+	}
+	return scope
+}
+
+// any reports whether the user may change any sounds at all.
+func (s managerScope) any() bool { return s.all || len(s.guilds) > 0 }
+
+// allows reports whether the user may change the sounds of c. A nil c is a
+// collection that does not exist yet. Collections available in every guild
+// are left to the owner and the managers, as they play in guilds the user
+// does not administer.
+func (s managerScope) allows(c *soundCollection) bool {
+	if s.all {
+		return true
+	}
+	if c == nil || len(c.Guilds) == 0 {
+		return false
+	}
+	return slices.ContainsFunc(s.guilds, c.availableIn)
+}
+
+// errGuildRequired refuses a new collection of a user administering several
+// guilds who did not pick one.
+var errGuildRequired = &manageError{http.StatusBadRequest, "guild_required", "Pick the server the new collection is for."}
+
+// newCollectionGuild returns the guild a collection the user creates is
+// limited to. The owner and the managers may create one for every guild by
+// leaving guildID empty; anyone else gets guildID, or the one guild they
+// administer.
+func (s managerScope) newCollectionGuild(guildID string) (string, error) {
+	switch {
+	case s.all:
+		return guildID, nil
+	case guildID == "" && len(s.guilds) == 1:
+		return s.guilds[0], nil
+	case guildID == "" && len(s.guilds) > 1:
+		return "", errGuildRequired
+	case slices.Contains(s.guilds, guildID):
+		return guildID, nil
+	}
+	return "", errNotManager
+}
+
+// canManageSounds reports whether userID may change any sounds.
+func canManageSounds(userID string) bool {
+	return soundManagerScope(userID).any()
+}
+
+// canManageCollection reports whether userID may change the sounds of prefix.
+func canManageCollection(userID, prefix string) bool {
+	return soundManagerScope(userID).allows(collectionByCommand(prefix))
+}
+
+// isGuildAdmin reports whether userID owns g or holds a role that may manage
+// it.
+func isGuildAdmin(g *discordgo.Guild, userID string) bool {
+	if g.OwnerID == userID {
+		return true
+	}
+	member, err := lookupMember(g.ID, userID)
+	if err != nil {
+		return false
+	}
+	for _, r := range g.Roles {
+		if slices.Contains(member.Roles, r.ID) && r.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// existingSound returns the file of the sound name in prefix, refusing sounds
+// that do not exist.
+func existingSound(prefix, name string) (string, error) {
+	// Check the names first so no path outside audioDir is touched.
+	if soundPrefixPattern.MatchString(prefix) && soundNamePattern.MatchString(name) {
+		if path, ok := soundFile(prefix, name); ok {
+			return path, nil
+		}
+	}
+	return "", &manageError{http.StatusNotFound, "unknown_sound", fmt.Sprintf("Unknown sound `%s` in `!%s`.", name, prefix)}
+}
+
+// uploadSound adds the sound file data, named filename by the uploader, as
+// name in prefix after checking its format, size and length. A new prefix
+// starts a collection limited to guildID, see newCollectionGuild.
+func uploadSound(userID, guildID, prefix, name, filename string, data []byte, description string) error {
+	scope := soundManagerScope(userID)
+	c := collectionByCommand(prefix)
+	if c == nil {
+		var err error
+		if guildID, err = scope.newCollectionGuild(guildID); err != nil {
+			return err
+		}
+	} else if !scope.allows(c) {
+		return errNotManager
+	}
+	policy := currentSoundPolicy()
+	ext := strings.ToLower(filepath.Ext(filename))
+	read, ok := soundFormats[ext]
+	if !ok {
+		exts := slices.Sorted(maps.Keys(soundFormats))
+		return &manageError{http.StatusUnsupportedMediaType, "unsupported_format", fmt.Sprintf("Upload a %s file.", strings.Join(exts, ", "))}
+	}
+	if policy.MaxUploadSize > 0 && len(data) > policy.MaxUploadSize {
+		return uploadTooLarge(policy.MaxUploadSize)
+	}
+	frames, meta, err := read(bytes.NewReader(data))
+	if err != nil || len(frames) == 0 {
+		return &manageError{http.StatusUnprocessableEntity, "invalid_file", fmt.Sprintf("The file is no valid %s sound.", ext)}
+	}
+	length := meta.Duration
+	if length == 0 {
+		length = time.Duration(len(frames)) * 20 * time.Millisecond
+	}
+	if limit := policy.UploadLength(); limit > 0 && length > limit {
+		return &manageError{http.StatusRequestEntityTooLarge, "too_long", fmt.Sprintf("The sound is longer than %s.", formatWait(limit))}
+	}
+
+	manageMu.Lock()
+	defer manageMu.Unlock()
+	if err := checkNewSound(prefix, name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(audioDir, 0o755); err != nil {
+		return err
+	}
+	// Limit a new collection before its first sound lands, so a rescan never
+	// offers it to every guild.
+	if c == nil && guildID != "" {
+		if err := limitCollection(prefix, guildID); err != nil {
+			return err
+		}
+	}
+	// Write to a file the rescan ignores first, so it never loads half a
+	// sound, and link it in place, which fails if the name got taken.
+	tmp, err := os.CreateTemp(audioDir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Link(tmp.Name(), filepath.Join(audioDir, prefix+"_"+name+ext)); err != nil {
+		return err
+	}
+	if description = cleanDescription(description); description != "" {
+		if err := writeDescription(prefix, name, description); err != nil {
+			slog.Error("could not write sound description", "prefix", prefix, "soundname", name, "error", err)
+		}
+	}
+	recordAudit(userID, "upload", prefix, name, fmt.Sprintf("%s, %d bytes, %s", ext, len(data), length.Round(time.Millisecond)))
+	rescanSounds()
+	return nil
+}
+
+// uploadTooLarge refuses an upload larger than limit bytes.
+func uploadTooLarge(limit int) error {
+	return &manageError{http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("The file is larger than %d KiB.", limit>>10)}
+}
+
+// cleanDescription keeps the first line of text, as readSoundDescription
+// reads only that, cut to maxDescriptionLength characters.
+func cleanDescription(text string) string {
+	text, _, _ = strings.Cut(strings.TrimSpace(text), "\n")
+	text = strings.TrimSpace(text)
+	if r := []rune(text); len(r) > maxDescriptionLength {
+		text = string(r[:maxDescriptionLength])
+	}
+	return text
+}
+
+func descriptionPath(prefix, name string) string {
+	return filepath.Join(audioDir, prefix+"_"+name+".txt")
+}
+
+func writeDescription(prefix, name, text string) error {
+	return os.WriteFile(descriptionPath(prefix, name), []byte(text+"\n"), 0o644)
+}
+
+// describeSound replaces the description of a sound; an empty text removes
+// it.
+func describeSound(userID, prefix, name, text string) error {
+	if !canManageCollection(userID, prefix) {
+		return errNotManager
+	}
+	manageMu.Lock()
+	defer manageMu.Unlock()
+	if _, err := existingSound(prefix, name); err != nil {
+		return err
+	}
+	text = cleanDescription(text)
+	var err error
+	if text == "" {
+		err = os.Remove(descriptionPath(prefix, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	} else {
+		err = writeDescription(prefix, name, text)
+	}
+	if err != nil {
+		return err
+	}
+	recordAudit(userID, "describe", prefix, name, text)
+	rescanSounds()
+	return nil
+}
+
+// renameSound renames a sound within its collection, moving its file,
+// description, manifest entry and the entrance sounds using it. Normalized
+// copies are dropped and made again under the new name.
+func renameSound(userID, prefix, name, newName string) error {
+	if !canManageCollection(userID, prefix) {
+		return errNotManager
+	}
+	manageMu.Lock()
+	defer manageMu.Unlock()
+	path, err := existingSound(prefix, name)
+	if err != nil {
+		return err
+	}
+	if err := checkNewSound(prefix, newName); err != nil {
+		return err
+	}
+	if err := os.Rename(path, filepath.Join(audioDir, prefix+"_"+newName+filepath.Ext(path))); err != nil {
+		return err
+	}
+	if err := os.Rename(descriptionPath(prefix, name), descriptionPath(prefix, newName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("could not rename sound description", "prefix", prefix, "soundname", name, "error", err)
+	}
+	removeNormalized(prefix, name, "")
+	err = editManifest(prefix, func(sounds *yaml.Node) bool {
+		for i := 0; i+1 < len(sounds.Content); i += 2 {
+			if sounds.Content[i].Value == name {
+				sounds.Content[i].Value = newName
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		slog.Error("could not rename manifest entry", "prefix", prefix, "soundname", name, "error", err)
+	}
+	if d := getSoundDB(); d != nil {
+		err := d.Model(&EntranceSound{}).Where("collection = ? AND sound = ?", prefix, name).Update("sound", newName).Error
+		if err != nil {
+			slog.Error("could not rename entrance sounds", "prefix", prefix, "soundname", name, "error", err)
+		}
+	}
+	recordAudit(userID, "rename", prefix, name, newName)
+	rescanSounds()
+	return nil
+}
+
+// deleteSound removes a sound with its description, manifest entry and
+// normalized copies.
+func deleteSound(userID, prefix, name string) error {
+	if !canManageCollection(userID, prefix) {
+		return errNotManager
+	}
+	manageMu.Lock()
+	defer manageMu.Unlock()
+	path, err := existingSound(prefix, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := os.Remove(descriptionPath(prefix, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("could not remove sound description", "prefix", prefix, "soundname", name, "error", err)
+	}
+	removeNormalized(prefix, name, "")
+	err = editManifest(prefix, func(sounds *yaml.Node) bool {
+		for i := 0; i+1 < len(sounds.Content); i += 2 {
+			if sounds.Content[i].Value == name {
+				sounds.Content = slices.Delete(sounds.Content, i, i+2)
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		slog.Error("could not remove manifest entry", "prefix", prefix, "soundname", name, "error", err)
+	}
+	recordAudit(userID, "delete", prefix, name, filepath.Base(path))
+	rescanSounds()
+	return nil
+}
+
+// weighSound sets the weight of a sound in the manifest of its collection.
+func weighSound(userID, prefix, name string, weight int) error {
+	if weight < 0 {
+		return &manageError{http.StatusBadRequest, "invalid_weight", "The weight must not be negative."}
+	}
+	if !canManageCollection(userID, prefix) {
+		return errNotManager
+	}
+	manageMu.Lock()
+	defer manageMu.Unlock()
+	if _, err := existingSound(prefix, name); err != nil {
+		return err
+	}
+	err := editManifest(prefix, func(sounds *yaml.Node) bool {
+		// Set the node in place to keep a comment next to the old weight.
+		v := mappingValue(mappingValue(sounds, name, true), "weight", true)
+		v.Kind, v.Tag, v.Value, v.Content = yaml.ScalarNode, "!!int", strconv.Itoa(weight), nil
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	recordAudit(userID, "weight", prefix, name, strconv.Itoa(weight))
+	rescanSounds()
+	return nil
+}
+
+// limitCollection makes guildID the only guild in the manifest of prefix.
+func limitCollection(prefix, guildID string) error {
+	return editManifestRoot(prefix, func(root *yaml.Node) bool {
+		v := mappingValue(root, "guilds", true)
+		*v = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: guildID, Style: yaml.DoubleQuotedStyle},
+		}}
+		return true
+	})
+}
+
+// editManifest lets edit change the sounds: mapping of the manifest of prefix
+// and writes the manifest back when edit reports a change. Comments and the
+// other settings are kept; a missing manifest is created.
+func editManifest(prefix string, edit func(sounds *yaml.Node) bool) error {
+	return editManifestRoot(prefix, func(root *yaml.Node) bool {
+		return edit(mappingValue(root, "sounds", true))
+	})
+}
+
+// editManifestRoot is editManifest for the whole top-level mapping.
+func editManifestRoot(prefix string, edit func(root *yaml.Node) bool) error {
+	path, ok := manifestPath(prefix)
+	if !ok {
+		path = filepath.Join(audioDir, prefix+".yaml")
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: the manifest is not a mapping", path)
+	}
+	if !edit(root) {
+		return nil
+	}
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0o644)
+}
+
+// mappingValue returns the value of key in the mapping m. When create is set,
+// a missing or empty value becomes an empty mapping.
+func mappingValue(m *yaml.Node, key string, create bool) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if v := m.Content[i+1]; m.Content[i].Value == key {
+			if create && v.Kind == yaml.ScalarNode && v.Tag == "!!null" {
+				*v = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+			return v
+		}
+	}
+	if !create {
+		return nil
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	return v
+}
@@ -0,0 +1,412 @@
+package gidbig
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/cfg"
+	"gopkg.in/yaml.v3"
+)
+
+// useOwner sets the bot owner to ownerID.
+func useOwner(t *testing.T, ownerID string) {
+	t.Helper()
+	orig := conf
+	conf = &cfg.Config{}
+	conf.Discord.OwnerID = ownerID
+	t.Cleanup(func() { conf = orig })
+}
+
+// dcaData returns a DCA1 sound of n frames.
+func dcaData(t *testing.T, n int) []byte {
+	t.Helper()
+	frames := make([][]byte, n)
+	for i := range frames {
+		frames[i] = []byte{0x01}
+	}
+	var buf bytes.Buffer
+	if err := writeDCA(&buf, frames, "Upload"); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func manageCode(err error) string {
+	var refused *manageError
+	if errors.As(err, &refused) {
+		return refused.code
+	}
+	return ""
+}
+
+func TestCanManageSounds(t *testing.T) {
+	s := testSoundSession(t, false)
+	useOwner(t, "owner")
+	usePolicy(t, cfg.SoundboardConfig{Managers: []string{"manager"}})
+	g, _ := s.State.Guild("guild-1")
+	g.Roles = []*discordgo.Role{
+		{ID: "mods", Permissions: discordgo.PermissionManageGuild},
+		{ID: "fans", Permissions: discordgo.PermissionVoiceConnect},
+	}
+	for _, m := range []*discordgo.Member{
+		{GuildID: "guild-1", User: &discordgo.User{ID: "mod"}, Roles: []string{"fans", "mods"}},
+		{GuildID: "guild-1", User: &discordgo.User{ID: "fan"}, Roles: []string{"fans"}},
+	} {
+		if err := s.State.MemberAdd(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for user, want := range map[string]bool{
+		"owner":   true,
+		"manager": true,
+		"mod":     true,
+		"fan":     false,
+		"user-1":  false,
+		"":        false,
+	} {
+		if got := canManageSounds(user); got != want {
+			t.Errorf("canManageSounds(%q) = %v, want %v", user, got, want)
+		}
+	}
+	g.OwnerID = "user-1"
+	if !canManageSounds("user-1") {
+		t.Error("guild owner may not manage sounds")
+	}
+
+	useCollections(t)
+	COLLECTIONS = []*soundCollection{
+		{Prefix: "horn", Commands: []string{"!horn"}},
+		{Prefix: "ours", Commands: []string{"!ours"}, Guilds: []string{"guild-1"}},
+		{Prefix: "theirs", Commands: []string{"!theirs"}, Guilds: []string{"guild-2"}},
+	}
+	for _, tc := range []struct {
+		user, prefix string
+		want         bool
+	}{
+		{"mod", "horn", false},
+		{"mod", "ours", true},
+		{"mod", "theirs", false},
+		{"mod", "new", false},
+		{"manager", "horn", true},
+		{"manager", "theirs", true},
+		{"fan", "horn", false},
+	} {
+		if got := canManageCollection(tc.user, tc.prefix); got != tc.want {
+			t.Errorf("canManageCollection(%q, %q) = %v, want %v", tc.user, tc.prefix, got, tc.want)
+		}
+	}
+	if err := deleteSound("mod", "theirs", "one"); manageCode(err) != "forbidden" {
+		t.Errorf("delete in another guild's collection = %v, want forbidden", err)
+	}
+}
+
+func TestUploadSound(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useOwner(t, "user-1")
+	useSoundStore(t)
+	useCollections(t)
+	usePolicy(t, cfg.SoundboardConfig{MaxUploadSize: 1 << 10, MaxUploadLength: "1s"})
+	writeDCAFile(t, "quotes", "old", [][]byte{{0x01}})
+	rescanSounds()
+
+	for _, tc := range []struct {
+		prefix, name, file string
+		data               []byte
+		want               string
+	}{
+		{"quotes", "new", "new.mp3", dcaData(t, 2), "unsupported_format"},
+		{"quotes", "new", "new.dca", bytes.Repeat([]byte{0x01}, 2<<10), "file_too_large"},
+		{"quotes", "new", "new.dca", []byte("DCA1garbage"), "invalid_file"},
+		{"quotes", "new", "new.dca", dcaData(t, 60), "too_long"},
+		{"quotes", "old", "old.dca", dcaData(t, 2), "sound_exists"},
+		{"Quotes", "new", "new.dca", dcaData(t, 2), "invalid_name"},
+		{"say", "new", "new.dca", dcaData(t, 2), "invalid_name"},
+	} {
+		if got := manageCode(uploadSound("user-1", "", tc.prefix, tc.name, tc.file, tc.data, "")); got != tc.want {
+			t.Errorf("upload %s_%s from %s = %q, want %q", tc.prefix, tc.name, tc.file, got, tc.want)
+		}
+	}
+
+	if err := uploadSound("user-1", "", "quotes", "new", "Take 2.DCA", dcaData(t, 3), "  Hello there\nsecond line"); err != nil {
+		t.Fatal(err)
+	}
+	if snd := findClip(t, "quotes", "new"); len(snd.buffer) != 3 || snd.description.Text != "Hello there" {
+		t.Errorf("uploaded sound = %d frames, %+v", len(snd.buffer), snd.description)
+	}
+	if files, _ := filepath.Glob("audio/.upload-*"); len(files) != 0 {
+		t.Errorf("left temporary files %v", files)
+	}
+	entries, err := recentAudit(10)
+	if err != nil || len(entries) != 1 || entries[0].Action != "upload" || entries[0].Sound != "new" || entries[0].UserID != "user-1" {
+		t.Errorf("audit = %+v, %v", entries, err)
+	}
+}
+
+func TestUploadSound_guildAdmin(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := testSoundSession(t, false)
+	useOwner(t, "owner")
+	useSoundStore(t)
+	useCollections(t)
+	usePolicy(t, cfg.SoundboardConfig{MaxUploadSize: 1 << 10, MaxUploadLength: "30s"})
+	g, _ := s.State.Guild("guild-1")
+	g.OwnerID = "admin"
+	writeDCAFile(t, "horn", "one", [][]byte{{0x01}})
+	writeDCAFile(t, "ours", "one", [][]byte{{0x01}})
+	if err := os.WriteFile(filepath.Join("audio", "ours.yaml"), []byte("guilds: [\"guild-1\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rescanSounds()
+
+	// The collections every guild shares are not the admin's to change.
+	for name, err := range map[string]error{
+		"upload":   uploadSound("admin", "", "horn", "two", "two.dca", dcaData(t, 2), ""),
+		"describe": describeSound("admin", "horn", "one", "mine now"),
+		"rename":   renameSound("admin", "horn", "one", "uno"),
+		"weight":   weighSound("admin", "horn", "one", 0),
+		"delete":   deleteSound("admin", "horn", "one"),
+	} {
+		if manageCode(err) != "forbidden" {
+			t.Errorf("%s in a global collection = %v, want forbidden", name, err)
+		}
+	}
+	if err := uploadSound("admin", "", "ours", "two", "two.dca", dcaData(t, 2), ""); err != nil {
+		t.Errorf("upload to the guild's collection = %v", err)
+	}
+	if err := uploadSound("admin", "guild-2", "theirs", "one", "one.dca", dcaData(t, 2), ""); manageCode(err) != "forbidden" {
+		t.Errorf("new collection for another guild = %v, want forbidden", err)
+	}
+
+	// A new collection is limited to the guild of the admin.
+	if err := uploadSound("admin", "", "fresh", "one", "one.dca", dcaData(t, 2), ""); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := readManifest(filepath.Join("audio", "fresh.yaml")); err != nil || !slices.Equal(m.Guilds, []string{"guild-1"}) {
+		t.Errorf("manifest of the new collection = %+v, %v", m, err)
+	}
+	if c := collectionByCommand("fresh"); c == nil || c.availableIn("guild-2") {
+		t.Errorf("new collection = %+v, want it limited to guild-1", c)
+	}
+
+	if err := s.State.GuildAdd(&discordgo.Guild{ID: "guild-2", Name: "Other", OwnerID: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploadSound("admin", "", "both", "one", "one.dca", dcaData(t, 2), ""); manageCode(err) != "guild_required" {
+		t.Errorf("new collection without a guild = %v, want guild_required", err)
+	}
+	if err := uploadSound("owner", "", "shared", "one", "one.dca", dcaData(t, 2), ""); err != nil {
+		t.Fatal(err)
+	}
+	if c := collectionByCommand("shared"); c == nil || len(c.Guilds) != 0 {
+		t.Errorf("new collection of the owner = %+v, want it in every guild", c)
+	}
+}
+
+func TestDescribeRenameDeleteSound(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useOwner(t, "user-1")
+	db := useSoundStore(t)
+	useCollections(t)
+	writeDCAFile(t, "quotes", "hello", [][]byte{{0x01}})
+	writeDCAFile(t, "quotes", "other", [][]byte{{0x02}})
+	manifest := "# the quotes\ndisplay_name: Quotes\nsounds:\n  hello:\n    weight: 3 # often\n"
+	if err := os.WriteFile(filepath.Join("audio", "quotes.yaml"), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&EntranceSound{GuildID: "guild-1", UserID: "user-2", Collection: "quotes", Sound: "hello"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	rescanSounds()
+
+	if err := describeSound("user-1", "quotes", "hello", strings.Repeat("a", 300)); err != nil {
+		t.Fatal(err)
+	}
+	if snd := findClip(t, "quotes", "hello"); len(snd.description.Text) != maxDescriptionLength {
+		t.Errorf("description = %d characters, want it cut to %d", len(snd.description.Text), maxDescriptionLength)
+	}
+	if got := manageCode(describeSound("user-1", "quotes", "nope", "x")); got != "unknown_sound" {
+		t.Errorf("describe unknown sound = %q", got)
+	}
+
+	if got := manageCode(renameSound("user-1", "quotes", "hello", "other")); got != "sound_exists" {
+		t.Errorf("rename onto another sound = %q", got)
+	}
+	if err := renameSound("user-1", "quotes", "hello", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	snd := findClip(t, "quotes", "hi")
+	if snd.Weight != 3 || snd.description == nil {
+		t.Errorf("renamed sound = weight %d, description %+v, want both kept", snd.Weight, snd.description)
+	}
+	if _, err := os.Stat(filepath.Join("audio", "quotes_hello.dca")); !os.IsNotExist(err) {
+		t.Errorf("old file still there: %v", err)
+	}
+	var entrance EntranceSound
+	if err := db.First(&entrance, "user_id = ?", "user-2").Error; err != nil || entrance.Sound != "hi" {
+		t.Errorf("entrance sound = %+v, %v, want it renamed", entrance, err)
+	}
+	raw, _ := os.ReadFile(filepath.Join("audio", "quotes.yaml"))
+	if !strings.Contains(string(raw), "# the quotes") || !strings.Contains(string(raw), "hi:") {
+		t.Errorf("manifest = %q, want the entry renamed and comments kept", raw)
+	}
+
+	if err := weighSound("user-1", "quotes", "other", 0); err != nil {
+		t.Fatal(err)
+	}
+	if snd := findClip(t, "quotes", "other"); snd.Weight != 0 {
+		t.Errorf("weight = %d, want 0", snd.Weight)
+	}
+	if got := manageCode(weighSound("user-1", "quotes", "other", -1)); got != "invalid_weight" {
+		t.Errorf("negative weight = %q", got)
+	}
+
+	if err := deleteSound("user-1", "quotes", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if c := collectionByCommand("quotes"); findSound(c, "hi") != nil {
+		t.Error("deleted sound still loaded")
+	}
+	for _, f := range []string{"quotes_hi.dca", "quotes_hi.txt"} {
+		if _, err := os.Stat(filepath.Join("audio", f)); !os.IsNotExist(err) {
+			t.Errorf("%s still there: %v", f, err)
+		}
+	}
+	raw, _ = os.ReadFile(filepath.Join("audio", "quotes.yaml"))
+	if strings.Contains(string(raw), "hi:") || !strings.Contains(string(raw), "other:") {
+		t.Errorf("manifest = %q, want only the entry of other", raw)
+	}
+
+	entries, err := recentAudit(10)
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	if err != nil || strings.Join(actions, " ") != "delete weight rename describe" {
+		t.Errorf("audit = %v, %v, want the changes newest first", actions, err)
+	}
+}
+
+func TestEditManifest_createsManifest(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("audio", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := editManifest("quotes", func(sounds *yaml.Node) bool {
+		entry := mappingValue(sounds, "hello", true)
+		entry.Content = append(entry.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "weight"}, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: "2"})
+		return mappingValue(entry, "weight", false) != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := readManifest(filepath.Join("audio", "quotes.yaml"))
+	if err != nil || m.Sounds["hello"].Weight == nil || *m.Sounds["hello"].Weight != 2 {
+		t.Errorf("manifest = %+v, %v", m, err)
+	}
+}
+
+func TestHandleAPISounds(t *testing.T) {
+	t.Chdir(t.TempDir())
+	testSoundSession(t, false)
+	useSoundStore(t)
+	useCollections(t)
+	useOwner(t, "owner")
+	usePolicy(t, cfg.SoundboardConfig{MaxUploadSize: 1 << 10, MaxUploadLength: "30s"})
+
+	upload := func(userID string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		_ = mw.WriteField("collection", "quotes")
+		_ = mw.WriteField("name", "hello")
+		fw, _ := mw.CreateFormFile("file", "hello.dca")
+		_, _ = fw.Write(data)
+		_ = mw.Close()
+		req := authedRequest(t, http.MethodPost, "/api/sounds/upload", userID, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		handleAPISoundsUpload(w, req)
+		return w
+	}
+	if w := upload("user-1", dcaData(t, 2)); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"forbidden"`) {
+		t.Errorf("upload by a member = %d %s", w.Code, w.Body)
+	}
+	if w := upload("owner", bytes.Repeat([]byte{0x01}, 256<<10)); w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), `"file_too_large"`) {
+		t.Errorf("huge upload = %d %s", w.Code, w.Body)
+	}
+	if w := upload("owner", dcaData(t, 2)); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Added !quotes hello.") {
+		t.Fatalf("upload = %d %s", w.Code, w.Body)
+	}
+
+	post := func(handler http.HandlerFunc, form url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, authedRequest(t, http.MethodPost, "/api/sounds", "owner", strings.NewReader(form.Encode())))
+		return w
+	}
+	if w := post(handleAPISoundsWeight, url.Values{"collection": {"quotes"}, "name": {"hello"}, "weight": {"many"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("weight without a number = %d %s", w.Code, w.Body)
+	}
+	if w := post(handleAPISoundsRename, url.Values{"collection": {"quotes"}, "name": {"hello"}, "new_name": {"hi"}}); w.Code != http.StatusOK {
+		t.Errorf("rename = %d %s", w.Code, w.Body)
+	}
+	if w := post(handleAPISoundsDescribe, url.Values{"collection": {"quotes"}, "name": {"hello"}, "description": {"x"}}); w.Code != http.StatusNotFound {
+		t.Errorf("describe renamed sound = %d %s, want 404", w.Code, w.Body)
+	}
+	if w := post(handleAPISoundsDelete, url.Values{"collection": {"quotes"}, "name": {"hi"}}); w.Code != http.StatusOK {
+		t.Errorf("delete = %d %s", w.Code, w.Body)
+	}
+
+	w := httptest.NewRecorder()
+	handleAPISoundsDelete(w, authedRequest(t, http.MethodGet, "/api/sounds/delete", "owner", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d, want 405", w.Code)
+	}
+}
+
+func TestBuildManagePage(t *testing.T) {
+	useOwner(t, "owner")
+	tmpl := template.Must(template.ParseFiles("../../web/templates/soundmanage.html",
+		"../../web/templates/header.html", "../../web/templates/footer.html"))
+	t.Chdir(t.TempDir())
+	testSoundSession(t, false)
+	useSoundStore(t)
+	useCollections(t)
+	usePolicy(t, cfg.SoundboardConfig{MaxUploadSize: 2 << 20, MaxUploadLength: "30s"})
+	writeDCAFile(t, "quotes", "hello", [][]byte{{0x01}})
+	if err := os.WriteFile(filepath.Join("audio", "quotes_hello.txt"), []byte("Hi there\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rescanSounds()
+	recordAudit("user-1", "upload", "quotes", "hello", ".dca")
+
+	data := buildManagePage("owner")
+	if len(data.Sounds) != 1 || data.Sounds[0] != (manageSound{Prefix: "quotes", Name: "hello", Description: "Hi there", Weight: 1, First: true}) {
+		t.Errorf("Sounds = %+v", data.Sounds)
+	}
+	if data.MaxSize != "2048 KiB" || data.MaxLength != "30s" || data.Formats != ".dca,.ogg,.opus" {
+		t.Errorf("limits = %q, %q, %q", data.MaxSize, data.MaxLength, data.Formats)
+	}
+	if len(data.Audit) != 1 || data.Audit[0].Command != "!quotes hello" || data.Audit[0].User != "user-1" {
+		t.Errorf("Audit = %+v", data.Audit)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&b, "header", data); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(b.String(), `value="Hi there"`) || !strings.Contains(b.String(), `<tr id="quotes">`) {
+		t.Errorf("page is missing the sounds:\n%s", b.String())
+	}
+}
@@ -0,0 +1,237 @@
+package gidbig
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultWeight and defaultPartDelay apply to sounds without a manifest entry.
+	defaultWeight    = 1
+	defaultPartDelay = 250
+)
+
+// soundManifest is the optional audio/<prefix>.yaml describing a collection.
+// Settings at the top level apply to every sound of the collection; entries
+// under sounds override them per sound.
+type soundManifest struct {
+	DisplayName string `yaml:"display_name"`
+	// Aliases are extra commands for the collection, with or without "!".
+	Aliases []string `yaml:"aliases"`
+	Tags    []string `yaml:"tags"`
+	// Guilds limits the collection to these guild IDs; it is available in
+	// every guild when empty.
+	Guilds []string `yaml:"guilds"`
+	// ChainWith names the prefix of a collection whose random sound plays
+	// right after every sound of this one.
+	ChainWith string                        `yaml:"chain_with"`
+	Weight    *int                          `yaml:"weight"`
+	PartDelay *int                          `yaml:"part_delay"`
+	Volume    *float64                      `yaml:"volume"`
+	Sounds    map[string]soundManifestEntry `yaml:"sounds"`
+}
+
+// soundManifestEntry holds the settings of a single sound.
+type soundManifestEntry struct {
+	DisplayName string `yaml:"display_name"`
+	// Weight adjusts how likely the sound is picked at random; 0 means it
+	// only plays when requested by name.
+	Weight *int `yaml:"weight"`
+	// PartDelay is the wait in milliseconds before leaving the voice channel.
+	PartDelay *int `yaml:"part_delay"`
+	// Volume in dB is added to the gain of the loudness normalization.
+	Volume *float64 `yaml:"volume"`
+	Tags   []string `yaml:"tags"`
+}
+
+// maxVolume bounds the volume override of a manifest, in dB either way.
+const maxVolume = 30
+
+// manifestPath returns the manifest file of prefix, preferring .yaml over .yml.
+func manifestPath(prefix string) (string, bool) {
+	for _, ext := range []string{".yaml", ".yml"} {
+		path := filepath.Join(audioDir, prefix+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// readManifest decodes the manifest at path, rejecting unknown keys.
+func readManifest(path string) (*soundManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var m soundManifest
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// applyManifests reads the manifest of every collection in colls and applies
+// it. A manifest that fails to decode is ignored as a whole; invalid entries
+// inside a valid manifest are skipped one by one. Every problem is returned.
+func applyManifests(colls []*soundCollection) []error {
+	byPrefix := make(map[string]*soundCollection, len(colls))
+	owner := make(map[string]string) // command -> prefix
+	for _, c := range colls {
+		byPrefix[c.Prefix] = c
+		for _, cmd := range c.Commands {
+			owner[cmd] = c.Prefix
+		}
+	}
+
+	var errs []error
+	for _, c := range colls {
+		path, ok := manifestPath(c.Prefix)
+		if !ok {
+			continue
+		}
+		m, err := readManifest(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, m.apply(path, c, byPrefix, owner)...)
+	}
+	errs = append(errs, orphanManifests(byPrefix)...)
+	return errs
+}
+
+func (m *soundManifest) apply(path string, c *soundCollection, byPrefix map[string]*soundCollection, owner map[string]string) []error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{path}, args...)...))
+	}
+
+	c.DisplayName = m.DisplayName
+	c.Tags = m.Tags
+	c.Guilds = m.Guilds
+
+	for _, alias := range m.Aliases {
+		cmd := "!" + strings.TrimPrefix(strings.TrimSpace(alias), "!")
+		switch {
+		case cmd == "!" || strings.ContainsAny(cmd, " \t\n"):
+			fail("alias %q must be a single word", alias)
+		case cmd == "!list" || cmd == "!uptime":
+			fail("alias %q is a built-in command", alias)
+		case owner[cmd] != "" && owner[cmd] != c.Prefix:
+			fail("alias %q is already used by collection %q", alias, owner[cmd])
+		case !slices.Contains(c.Commands, cmd):
+			owner[cmd] = c.Prefix
+			c.Commands = append(c.Commands, cmd)
+		}
+	}
+
+	if m.ChainWith != "" {
+		switch next, ok := byPrefix[m.ChainWith]; {
+		case !ok:
+			fail("chain_with refers to unknown collection %q", m.ChainWith)
+		case next == c:
+			fail("chain_with must not refer to the collection itself")
+		default:
+			c.ChainWith = next
+		}
+	}
+
+	weight, partDelay := defaultWeight, defaultPartDelay
+	if m.Weight != nil {
+		if *m.Weight < 0 {
+			fail("weight must not be negative, got %d", *m.Weight)
+		} else {
+			weight = *m.Weight
+		}
+	}
+	if m.PartDelay != nil {
+		if *m.PartDelay < 0 {
+			fail("part_delay must not be negative, got %d", *m.PartDelay)
+		} else {
+			partDelay = *m.PartDelay
+		}
+	}
+	var volume float64
+	if m.Volume != nil {
+		if math.Abs(*m.Volume) > maxVolume {
+			fail("volume must be between -%d and %d dB, got %g", maxVolume, maxVolume, *m.Volume)
+		} else {
+			volume = *m.Volume
+		}
+	}
+	for _, snd := range c.Sounds {
+		snd.Weight, snd.PartDelay, snd.volume = weight, partDelay, volume
+	}
+
+	names := make([]string, 0, len(m.Sounds))
+	for name := range m.Sounds {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		e := m.Sounds[name]
+		i := slices.IndexFunc(c.Sounds, func(s *soundClip) bool { return s.Name == name })
+		if i < 0 {
+			fail("sounds.%s: no sound file %s_%s in %s", name, c.Prefix, name, audioDir)
+			continue
+		}
+		snd := c.Sounds[i]
+		snd.DisplayName = e.DisplayName
+		snd.Tags = e.Tags
+		if e.Weight != nil {
+			if *e.Weight < 0 {
+				fail("sounds.%s.weight must not be negative, got %d", name, *e.Weight)
+			} else {
+				snd.Weight = *e.Weight
+			}
+		}
+		if e.PartDelay != nil {
+			if *e.PartDelay < 0 {
+				fail("sounds.%s.part_delay must not be negative, got %d", name, *e.PartDelay)
+			} else {
+				snd.PartDelay = *e.PartDelay
+			}
+		}
+		if e.Volume != nil {
+			if math.Abs(*e.Volume) > maxVolume {
+				fail("sounds.%s.volume must be between -%d and %d dB, got %g", name, maxVolume, maxVolume, *e.Volume)
+			} else {
+				snd.volume = *e.Volume
+			}
+		}
+	}
+	return errs
+}
+
+// orphanManifests reports manifests whose prefix has no sound files.
+func orphanManifests(byPrefix map[string]*soundCollection) []error {
+	files, err := os.ReadDir(audioDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return []error{err}
+	}
+	var errs []error
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		if prefix := strings.TrimSuffix(f.Name(), ext); byPrefix[prefix] == nil {
+			errs = append(errs, fmt.Errorf("%s: no sound files with prefix %q", filepath.Join(audioDir, f.Name()), prefix))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,181 @@
+package gidbig
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, prefix, content string) {
+	t.Helper()
+	if err := os.MkdirAll("audio", 0o755); err != nil {
+		t.Fatalf("mkdir audio: %v", err)
+	}
+	path := filepath.Join("audio", prefix+".yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func findCollection(t *testing.T, prefix string) *soundCollection {
+	t.Helper()
+	for _, c := range soundCollections() {
+		if c.Prefix == prefix {
+			return c
+		}
+	}
+	t.Fatalf("collection %q not found", prefix)
+	return nil
+}
+
+func TestRescanSounds_appliesManifest(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useCollections(t)
+	writeDCAFile(t, "horn", "one", [][]byte{{0x01}})
+	writeDCAFile(t, "horn", "two", [][]byte{{0x02}})
+	writeDCAFile(t, "anotha", "one", [][]byte{{0x03}})
+	writeManifest(t, "horn", `
+display_name: Air Horns
+aliases: [ah, "!horns"]
+tags: [loud]
+chain_with: anotha
+part_delay: 100
+sounds:
+  one:
+    display_name: The Classic
+    weight: 5
+    tags: [classic]
+  two:
+    weight: 0
+    part_delay: 900
+`)
+
+	if res := rescanSounds(); len(res.Failed) != 0 {
+		t.Fatalf("unexpected failures: %v", res.Failed)
+	}
+	horn := findCollection(t, "horn")
+	if horn.DisplayName != "Air Horns" || !slices.Equal(horn.Tags, []string{"loud"}) {
+		t.Errorf("collection = %q %v, want display name and tags", horn.DisplayName, horn.Tags)
+	}
+	if want := []string{"!horn", "!ah", "!horns"}; !slices.Equal(horn.Commands, want) {
+		t.Errorf("Commands = %v, want %v", horn.Commands, want)
+	}
+	if horn.ChainWith != findCollection(t, "anotha") {
+		t.Error("ChainWith not resolved to the anotha collection")
+	}
+	if horn.soundRange != 5 {
+		t.Errorf("soundRange = %d, want 5", horn.soundRange)
+	}
+	if snd, c := findSoundAndCollection("", "!ah", "one"); c != horn || snd.DisplayName != "The Classic" || snd.PartDelay != 100 {
+		t.Errorf("alias lookup = %+v, want sound one with manifest settings", snd)
+	}
+	two := findClip(t, "horn", "two")
+	if two.Weight != 0 || two.PartDelay != 900 {
+		t.Errorf("two = weight %d delay %d, want 0 and 900", two.Weight, two.PartDelay)
+	}
+	for range 20 {
+		if got := horn.Random(); got == nil || got.Name != "one" {
+			t.Fatalf("Random() = %v, a weight of 0 must never be picked", got)
+		}
+	}
+	if anotha := findClip(t, "anotha", "one"); anotha.Weight != defaultWeight || anotha.PartDelay != defaultPartDelay {
+		t.Errorf("sound without manifest = weight %d delay %d, want defaults", anotha.Weight, anotha.PartDelay)
+	}
+
+	// Dropping the manifest resets reused clips to the defaults.
+	if err := os.Remove(filepath.Join("audio", "horn.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	rescanSounds()
+	one := findClip(t, "horn", "one")
+	if one.DisplayName != "" || one.Weight != defaultWeight || findCollection(t, "horn").ChainWith != nil {
+		t.Errorf("manifest settings survived its removal: %+v", one)
+	}
+}
+
+func TestRescanSounds_manifestErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useCollections(t)
+	writeDCAFile(t, "horn", "one", [][]byte{{0x01}})
+	writeDCAFile(t, "cow", "moo", [][]byte{{0x02}})
+	writeDCAFile(t, "bad", "one", [][]byte{{0x03}})
+	writeManifest(t, "horn", `
+aliases: [cow, "two words", list, ok]
+chain_with: nope
+weight: -1
+sounds:
+  missing: {weight: 2}
+  one: {part_delay: -5}
+`)
+	writeManifest(t, "bad", "weigth: 3\n")
+	writeManifest(t, "ghost", "display_name: Nobody\n")
+
+	res := rescanSounds()
+	var msgs []string
+	for _, err := range res.Failed {
+		msgs = append(msgs, err.Error())
+	}
+	got := strings.Join(msgs, "\n")
+	for _, want := range []string{
+		`alias "cow" is already used by collection "cow"`,
+		`alias "two words" must be a single word`,
+		`alias "list" is a built-in command`,
+		`chain_with refers to unknown collection "nope"`,
+		`weight must not be negative, got -1`,
+		`sounds.missing: no sound file horn_missing`,
+		`sounds.one.part_delay must not be negative`,
+		`audio/bad.yaml: yaml: unmarshal errors`,
+		`audio/ghost.yaml: no sound files with prefix "ghost"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("errors should mention %q, got:\n%s", want, got)
+		}
+	}
+
+	horn := findCollection(t, "horn")
+	if want := []string{"!horn", "!ok"}; !slices.Equal(horn.Commands, want) {
+		t.Errorf("Commands = %v, want only the valid alias added", horn.Commands)
+	}
+	if one := findClip(t, "horn", "one"); one.Weight != defaultWeight || one.PartDelay != defaultPartDelay {
+		t.Errorf("invalid values should keep the defaults, got weight %d delay %d", one.Weight, one.PartDelay)
+	}
+	if findCollection(t, "bad").soundRange != defaultWeight {
+		t.Error("a manifest that fails to decode must leave its collection on defaults")
+	}
+}
+
+func TestRescanSounds_guildScopedCollection(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useCollections(t)
+	writeDCAFile(t, "horn", "one", [][]byte{{0x01}})
+	writeDCAFile(t, "inside", "joke", [][]byte{{0x02}})
+	writeManifest(t, "inside", "guilds: [\"guild-2\", \"guild-3\"]\n")
+
+	if res := rescanSounds(); len(res.Failed) != 0 {
+		t.Fatalf("unexpected failures: %v", res.Failed)
+	}
+	for guildID, want := range map[string][]string{
+		"guild-1": {"horn"},
+		"guild-2": {"horn", "inside"},
+		"":        {"horn"},
+	} {
+		var got []string
+		for _, c := range soundCollectionsIn(guildID) {
+			got = append(got, c.Prefix)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("collections in %q = %v, want %v", guildID, got, want)
+		}
+	}
+	if _, c := findSoundAndCollection("guild-1", "!inside", "joke"); c != nil {
+		t.Error("collection of guild-2 found in guild-1")
+	}
+	if snd, c := findSoundAndCollection("guild-3", "!inside", "joke"); c == nil || snd == nil {
+		t.Error("collection not found in its own guild")
+	}
+	if collectionIn("guild-1", "inside") != nil || collectionIn("guild-2", "!inside") == nil {
+		t.Error("collectionIn does not follow the guilds of the manifest")
+	}
+}
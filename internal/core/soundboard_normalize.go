@@ -0,0 +1,314 @@
+package gidbig
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+const (
+	// maxNormalizedOutput bounds what the normalize command may write to stdout.
+	maxNormalizedOutput = 64 << 20
+
+	// normKeyLength is the number of hex digits of a normalization key in the
+	// name of a cached file.
+	normKeyLength = 12
+
+	// maxLoudnessOutliers caps the sounds listed by the loudness report.
+	maxLoudnessOutliers = 15
+)
+
+// normalizeKey identifies the normalization of snd under n: it changes with
+// the sound file, the volume override and the settings that shape the output.
+func normalizeKey(snd *soundClip, n cfg.SoundboardNormalize) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%d|%d|%d|%g|%q",
+		snd.ext, snd.size, snd.modTime.UnixNano(), n.Target, snd.volume, n.Command))
+	return hex.EncodeToString(sum[:])[:normKeyLength]
+}
+
+// normalizedPath returns the file the normalized sound is cached in. It is a
+// dotfile next to the sound file so rescans skip it.
+func normalizedPath(prefix, name, key string) string {
+	return filepath.Join(audioDir, fmt.Sprintf(".%s_%s.%s.ogg", prefix, name, key))
+}
+
+// removeNormalized deletes the cached normalizations of a sound except the
+// one for keep.
+func removeNormalized(prefix, name, keep string) {
+	stem := fmt.Sprintf(".%s_%s.", prefix, name)
+	matches, _ := filepath.Glob(filepath.Join(audioDir, stem+"*.ogg"))
+	for _, path := range matches {
+		key := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), stem), ".ogg")
+		if len(key) != normKeyLength || key == keep {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			slog.Warn("failed to remove normalized sound", "path", path, "error", err)
+		}
+	}
+}
+
+// normalizeSounds brings the sounds of colls to the loudness configured in n,
+// running the command for every sound whose normalization is not cached yet.
+// A sound that fails keeps the frames it had. With normalization switched
+// off, sounds that were normalized are loaded from their file again.
+func normalizeSounds(colls []*soundCollection, n cfg.SoundboardNormalize) []error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		sem  = make(chan struct{}, runtime.NumCPU())
+	)
+	for _, c := range colls {
+		for _, snd := range c.Sounds {
+			key := ""
+			if n.Enabled() {
+				key = normalizeKey(snd, n)
+			}
+			if snd.normKey == key {
+				continue
+			}
+			wg.Go(func() {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				var err error
+				if key == "" {
+					err = restoreSound(c, snd)
+				} else {
+					err = normalizeSound(c, snd, key, n)
+				}
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s_%s: %w", c.Prefix, snd.Name, err))
+					mu.Unlock()
+				}
+			})
+		}
+	}
+	wg.Wait()
+	return errs
+}
+
+// restoreSound loads the sound file of snd again, dropping its normalization.
+func restoreSound(c *soundCollection, snd *soundClip) error {
+	src := &soundClip{Name: snd.Name, ext: snd.ext}
+	if err := src.Load(c); err != nil {
+		return err
+	}
+	snd.buffer, snd.meta, snd.normKey = src.buffer, src.meta, ""
+	removeNormalized(c.Prefix, snd.Name, "")
+	return nil
+}
+
+// normalizeSound replaces the frames of snd with its normalization for key,
+// read from the cache or made by running the command over the sound file.
+func normalizeSound(c *soundCollection, snd *soundClip, key string, n cfg.SoundboardNormalize) error {
+	path := normalizedPath(c.Prefix, snd.Name, key)
+	frames, err := readNormalized(path)
+	if err != nil {
+		src := &soundClip{Name: snd.Name, ext: snd.ext, volume: snd.volume}
+		if err := src.Load(c); err != nil {
+			return err
+		}
+		frames, err = runNormalize(c.Prefix, src, n)
+		if err != nil {
+			return err
+		}
+		if err := writeNormalized(path, frames, src.meta.Title); err != nil {
+			slog.Warn("failed to cache normalized sound", "path", path, "error", err)
+		}
+		slog.Info("sound normalized", "sound", c.Prefix+"_"+snd.Name, "frames", len(frames), "trimmed", len(src.buffer)-len(frames))
+	}
+	removeNormalized(c.Prefix, snd.Name, key)
+	snd.buffer, snd.normKey = frames, key
+	snd.meta.Duration = time.Duration(len(frames)) * 20 * time.Millisecond
+	return nil
+}
+
+// readNormalized reads a cached normalization.
+func readNormalized(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	frames, _, err := readOggOpus(f)
+	if err == nil && len(frames) == 0 {
+		err = errors.New("no frames")
+	}
+	return frames, err
+}
+
+// writeNormalized caches frames at path, replacing the file in one step so a
+// crash never leaves half a file behind.
+func writeNormalized(path string, frames [][]byte, title string) error {
+	tmp, err := os.CreateTemp(audioDir, ".normalize-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if err := writeOggOpus(tmp, frames, title); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runNormalize runs the normalize command over the frames of snd and returns
+// the result with its leading and trailing silence trimmed.
+func runNormalize(prefix string, snd *soundClip, n cfg.SoundboardNormalize) ([][]byte, error) {
+	var in bytes.Buffer
+	if err := writeOggOpus(&in, snd.buffer, snd.meta.Title); err != nil {
+		return nil, err
+	}
+	env := []string{
+		"GIDBIG_SOUND=" + prefix + "_" + snd.Name,
+		"GIDBIG_TARGET_LUFS=" + strconv.Itoa(n.Target),
+		"GIDBIG_GAIN_DB=" + strconv.FormatFloat(snd.volume, 'f', -1, 64),
+	}
+	out, err := runCommand(context.Background(), n.Command, &in, env, n.RunTimeout(), maxNormalizedOutput)
+	if err != nil {
+		return nil, err
+	}
+	frames, _, err := readOggOpus(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("reading the output of %s: %w", n.Command[0], err)
+	}
+	frames = trimSilence(frames)
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("%s returned nothing but silence", n.Command[0])
+	}
+	return frames, nil
+}
+
+// trimSilence drops the silent frames at both ends of frames. Encoders emit
+// silence as packets no longer than opusSilence.
+func trimSilence(frames [][]byte) [][]byte {
+	silent := func(f []byte) bool { return len(f) <= len(opusSilence) }
+	for len(frames) > 0 && silent(frames[0]) {
+		frames = frames[1:]
+	}
+	for len(frames) > 0 && silent(frames[len(frames)-1]) {
+		frames = frames[:len(frames)-1]
+	}
+	return frames
+}
+
+var (
+	// loudnessMu guards loudnessCache.
+	loudnessMu sync.Mutex
+	// loudnessCache holds the measured loudness by loudnessCacheKey so the
+	// report only measures sounds that changed.
+	loudnessCache = make(map[string]float64)
+)
+
+// loudnessCacheKey identifies what a measurement of snd depends on.
+func loudnessCacheKey(prefix string, snd *soundClip, measure []string) string {
+	return fmt.Sprintf("%s_%s|%s|%d|%d|%q", prefix, snd.Name, snd.normKey, snd.size, snd.modTime.UnixNano(), measure)
+}
+
+// measureLoudness runs the measure command over the frames of snd and
+// returns the integrated loudness it printed.
+func measureLoudness(ctx context.Context, prefix string, snd *soundClip, n cfg.SoundboardNormalize) (float64, error) {
+	var in bytes.Buffer
+	if err := writeOggOpus(&in, snd.buffer, snd.meta.Title); err != nil {
+		return 0, err
+	}
+	env := []string{"GIDBIG_SOUND=" + prefix + "_" + snd.Name}
+	out, err := runCommand(ctx, n.Measure, &in, env, n.RunTimeout(), 4096)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%s printed nothing", n.Measure[0])
+	}
+	lufs, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+	if err != nil || math.IsNaN(lufs) || math.IsInf(lufs, 0) {
+		return 0, fmt.Errorf("%s printed %q instead of the loudness in LUFS", n.Measure[0], fields[len(fields)-1])
+	}
+	return lufs, nil
+}
+
+// loudnessOutlier is a sound the loudness report lists.
+type loudnessOutlier struct {
+	command string
+	lufs    float64
+}
+
+// loudnessReport measures every sound and lists those further than the
+// tolerance off the target, the worst first.
+func loudnessReport(ctx context.Context) string {
+	n := currentSoundPolicy().Normalize
+	if len(n.Measure) == 0 {
+		return "Set `soundboard.normalize.measure` to measure the loudness of the sounds."
+	}
+
+	loudnessMu.Lock()
+	defer loudnessMu.Unlock()
+	measured := make(map[string]float64)
+	var (
+		outliers []loudnessOutlier
+		total    int
+		failed   int
+	)
+	for _, c := range soundCollections() {
+		for _, snd := range c.Sounds {
+			key := loudnessCacheKey(c.Prefix, snd, n.Measure)
+			lufs, ok := loudnessCache[key]
+			if !ok {
+				var err error
+				if lufs, err = measureLoudness(ctx, c.Prefix, snd, n); err != nil {
+					slog.Error("failed to measure loudness", "sound", c.Prefix+"_"+snd.Name, "error", err)
+					failed++
+					continue
+				}
+			}
+			measured[key] = lufs
+			total++
+			if math.Abs(lufs-float64(n.Target)) > float64(n.Tolerance) {
+				outliers = append(outliers, loudnessOutlier{fmt.Sprintf("!%s %s", c.Prefix, snd.Name), lufs})
+			}
+		}
+	}
+	loudnessCache = measured
+
+	var sb strings.Builder
+	if len(outliers) == 0 {
+		fmt.Fprintf(&sb, "All %d sounds are within %d LU of %d LUFS.", total, n.Tolerance, n.Target)
+	} else {
+		slices.SortStableFunc(outliers, func(a, b loudnessOutlier) int {
+			return cmp.Compare(math.Abs(b.lufs-float64(n.Target)), math.Abs(a.lufs-float64(n.Target)))
+		})
+		fmt.Fprintf(&sb, "**%d of %d sounds** are more than %d LU off %d LUFS:", len(outliers), total, n.Tolerance, n.Target)
+		for _, o := range outliers[:min(len(outliers), maxLoudnessOutliers)] {
+			fmt.Fprintf(&sb, "\n`%s` %.1f LUFS (%+.1f)", o.command, o.lufs, o.lufs-float64(n.Target))
+		}
+		if more := len(outliers) - maxLoudnessOutliers; more > 0 {
+			fmt.Fprintf(&sb, "\nand %d more", more)
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(&sb, "\nCould not measure %d of the sounds, see the log.", failed)
+	}
+	return sb.String()
+}
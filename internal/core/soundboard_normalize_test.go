@@ -0,0 +1,163 @@
+package gidbig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+func normalizedFiles(t *testing.T) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join("audio", ".horn_one.*.ogg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func countRuns(t *testing.T) int {
+	t.Helper()
+	raw, err := os.ReadFile("runs")
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.Count(string(raw), "\n")
+}
+
+func TestRescanSounds_normalize(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useCollections(t)
+	writeDCAFile(t, "horn", "one", [][]byte{opusSilence, {0x01, 0x02, 0x03, 0x04}, {0x05, 0x06, 0x07, 0x08, 0x09}, opusSilence})
+	writeManifest(t, "horn", "sounds:\n  one:\n    volume: 3\n")
+	normalize := cfg.SoundboardNormalize{
+		// Passes the sound through unchanged once the environment checks out.
+		Command: []string{"sh", "-c", `test "$GIDBIG_SOUND" = horn_one && test "$GIDBIG_TARGET_LUFS" = -16 && test "$GIDBIG_GAIN_DB" = 3 && echo run >> runs && cat`},
+		Target:  -16,
+		Timeout: "10s",
+	}
+	usePolicy(t, cfg.SoundboardConfig{Normalize: normalize})
+
+	if res := rescanSounds(); len(res.Added) != 1 || len(res.Failed) != 0 {
+		t.Fatalf("rescan = %+v, want 1 added", res)
+	}
+	snd := findClip(t, "horn", "one")
+	if len(snd.buffer) != 2 || snd.normKey == "" {
+		t.Errorf("got %d frames with key %q, want the 2 frames between the silence normalized", len(snd.buffer), snd.normKey)
+	}
+	if files := normalizedFiles(t); len(files) != 1 {
+		t.Fatalf("cached files = %v, want one", files)
+	}
+
+	// Unchanged sounds are neither normalized again nor picked up as sounds.
+	if res := rescanSounds(); len(res.Added)+len(res.Updated)+len(res.Failed) != 0 {
+		t.Errorf("second rescan = %+v, want no changes", res)
+	}
+	collectionsMu.Lock()
+	COLLECTIONS = nil
+	collectionsMu.Unlock()
+	if res := rescanSounds(); len(res.Failed) != 0 || len(findClip(t, "horn", "one").buffer) != 2 {
+		t.Errorf("rescan after a restart = %+v, want the cached normalization", res)
+	}
+	if n := countRuns(t); n != 1 {
+		t.Errorf("command ran %d times, want once", n)
+	}
+
+	// A changed volume needs a new run, which fails here and keeps the frames.
+	writeManifest(t, "horn", "sounds:\n  one:\n    volume: -2\n")
+	if res := rescanSounds(); len(res.Failed) != 1 || len(findClip(t, "horn", "one").buffer) != 2 {
+		t.Errorf("rescan = %+v, want the failed run reported", res)
+	}
+
+	usePolicy(t, cfg.SoundboardConfig{})
+	if res := rescanSounds(); len(res.Failed) != 0 {
+		t.Fatalf("rescan = %+v, want no failures", res)
+	}
+	if snd := findClip(t, "horn", "one"); len(snd.buffer) != 4 || snd.normKey != "" {
+		t.Errorf("got %d frames with key %q, want the sound file again", len(snd.buffer), snd.normKey)
+	}
+	if files := normalizedFiles(t); len(files) != 0 {
+		t.Errorf("cached files = %v, want them removed", files)
+	}
+}
+
+func TestRescanSounds_invalidVolume(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useCollections(t)
+	writeDCAFile(t, "horn", "one", [][]byte{{0x01}})
+	writeManifest(t, "horn", "volume: -40\nsounds:\n  one:\n    volume: 31\n")
+
+	res := rescanSounds()
+	if len(res.Failed) != 2 {
+		t.Fatalf("rescan = %+v, want both volumes refused", res)
+	}
+	if !strings.Contains(res.Failed[0].Error(), "volume must be between -30 and 30 dB") {
+		t.Errorf("error = %v", res.Failed[0])
+	}
+	if snd := findClip(t, "horn", "one"); snd.volume != 0 {
+		t.Errorf("volume = %g, want 0", snd.volume)
+	}
+}
+
+func TestTrimSilence(t *testing.T) {
+	sound := []byte{0x01, 0x02, 0x03, 0x04}
+	for _, c := range []struct {
+		frames [][]byte
+		want   int
+	}{
+		{[][]byte{opusSilence, sound, opusSilence, sound, opusSilence, opusSilence}, 3},
+		{[][]byte{sound}, 1},
+		{[][]byte{opusSilence, opusSilence}, 0},
+		{nil, 0},
+	} {
+		if got := trimSilence(c.frames); len(got) != c.want {
+			t.Errorf("trimSilence(%v) kept %d frames, want %d", c.frames, len(got), c.want)
+		}
+	}
+}
+
+func TestLoudnessReport(t *testing.T) {
+	useCollections(t)
+	t.Cleanup(func() { loudnessCache = make(map[string]float64) })
+	frames := [][]byte{{0x01, 0x02, 0x03, 0x04}}
+	COLLECTIONS = []*soundCollection{{Prefix: "horn", Sounds: []*soundClip{
+		{Name: "loud", buffer: frames},
+		{Name: "fine", buffer: frames},
+		{Name: "quiet", buffer: frames},
+		{Name: "broken", buffer: frames},
+	}}}
+
+	usePolicy(t, cfg.SoundboardConfig{})
+	if got := loudnessReport(context.Background()); !strings.Contains(got, "soundboard.normalize.measure") {
+		t.Errorf("report without measure command = %q", got)
+	}
+
+	usePolicy(t, cfg.SoundboardConfig{Normalize: cfg.SoundboardNormalize{
+		Measure: []string{"sh", "-c", `cat >/dev/null; case $GIDBIG_SOUND in
+			horn_loud) echo "Integrated: -8.5" ;;
+			horn_quiet) echo -20.25 ;;
+			horn_broken) echo n/a ;;
+			*) echo -16.4 ;;
+			esac`},
+		Target:    -16,
+		Tolerance: 2,
+	}})
+	got := loudnessReport(context.Background())
+	for _, want := range []string{
+		"**2 of 3 sounds** are more than 2 LU off -16 LUFS:\n`!horn loud` -8.5 LUFS (+7.5)\n`!horn quiet` -20.2 LUFS (-4.2)",
+		"Could not measure 1 of the sounds",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report should contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "fine") {
+		t.Errorf("report lists a sound within the tolerance:\n%s", got)
+	}
+	if len(loudnessCache) != 3 {
+		t.Errorf("cached %d measurements, want 3", len(loudnessCache))
+	}
+}
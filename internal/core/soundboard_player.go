@@ -0,0 +1,311 @@
+package gidbig
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// voiceJoinAttempts is how often a player tries to join a voice channel
+	// before dropping the play.
+	voiceJoinAttempts = 2
+	voiceRetryDelay   = 500 * time.Millisecond
+
+	// voiceLeaveTimeout bounds how long leaving a voice channel may take.
+	voiceLeaveTimeout = 5 * time.Second
+)
+
+// errVoiceStalled is returned by soundClip.Play when the voice connection stops
+// taking frames.
+var errVoiceStalled = errors.New("voice connection stalled")
+
+var (
+	// players holds the running player of every guild, guarded by mutex.
+	players = make(map[string]*guildPlayer)
+
+	// playersWG waits for every player to leave its voice channel at shutdown.
+	playersWG sync.WaitGroup
+)
+
+// voiceConn is the voice connection a guildPlayer plays into.
+type voiceConn interface {
+	// ChannelID is the voice channel the bot is currently in.
+	ChannelID() string
+	// Closed reports whether the connection can no longer be used.
+	Closed() bool
+	Speaking(bool) error
+	// Frames takes the Opus frames to send.
+	Frames() chan<- []byte
+	Disconnect(ctx context.Context) error
+}
+
+// joinVoice connects to a voice channel. Tests replace it with a fake. The
+// bot only listens where soundboard.clips is on.
+var joinVoice = func(ctx context.Context, guildID, channelID string) (voiceConn, error) {
+	policy := currentSoundPolicy()
+	listen := policy.ClipsIn(guildID)
+	vc, err := discord.ChannelVoiceJoin(ctx, guildID, channelID, false, !listen)
+	if err != nil {
+		return nil, err
+	}
+	v := discordVoice{vc: vc, channelID: channelID}
+	if listen {
+		v.rec = startRecorder(guildID, vc, policy.ClipWindow())
+	}
+	time.Sleep(playStartDelay)
+	return v, nil
+}
+
+// discordVoice adapts a discordgo voice connection to voiceConn.
+type discordVoice struct {
+	vc        *discordgo.VoiceConnection
+	channelID string
+	// rec keeps audio for /clip; nil while the bot does not listen.
+	rec *clipRecorder
+}
+
+// ChannelID follows the bot's voice state, so a moderator moving the bot to
+// another channel is noticed.
+func (v discordVoice) ChannelID() string {
+	if discord != nil && discord.State != nil && discord.State.User != nil {
+		if vs, err := discord.State.VoiceState(v.vc.GuildID, discord.State.User.ID); err == nil {
+			return vs.ChannelID
+		}
+	}
+	return v.channelID
+}
+
+func (v discordVoice) Closed() bool {
+	select {
+	case <-v.vc.Dead:
+		return true
+	default:
+		return false
+	}
+}
+
+func (v discordVoice) Speaking(b bool) error { return v.vc.Speaking(b) }
+
+func (v discordVoice) Frames() chan<- []byte { return v.vc.OpusSend }
+
+// Disconnect leaves the channel and forgets what was kept for /clip.
+func (v discordVoice) Disconnect(ctx context.Context) error {
+	if v.rec != nil {
+		v.rec.stop()
+	}
+	return v.vc.Disconnect(ctx)
+}
+
+// guildPlayer plays the queued sounds of one guild. Its worker goroutine owns
+// the voice connection, joins the channel of each play, and leaves once the
+// queue stays empty for the part delay of the last sound.
+type guildPlayer struct {
+	guildID string
+	wake    chan struct{}
+
+	// ctx ends the worker at shutdown.
+	ctx  context.Context
+	stop context.CancelFunc
+
+	// Guarded by mutex.
+	pending []*Play
+	current *Play
+	skip    context.CancelFunc
+	// started is when the current sound began, zero between sounds.
+	started time.Time
+	// voice is the channel the worker is connected to, for the events.
+	voice string
+
+	// Owned by the worker.
+	vc        voiceConn
+	partDelay time.Duration
+}
+
+// startPlayer creates the player of guildID and starts its worker. The caller
+// must hold mutex.
+func startPlayer(guildID string) *guildPlayer {
+	ctx, stop := context.WithCancel(context.Background())
+	p := &guildPlayer{
+		guildID: guildID,
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		stop:    stop,
+	}
+	players[guildID] = p
+	playersWG.Add(1)
+	go p.run()
+	return p
+}
+
+// stopPlayers ends every player and waits until they left their voice channels.
+func stopPlayers() {
+	mutex.Lock()
+	for _, p := range players {
+		p.stop()
+	}
+	mutex.Unlock()
+	playersWG.Wait()
+}
+
+// enqueue adds play to the queue and returns how many plays are ahead of it.
+// It reports false when the queue is full. The caller must hold mutex.
+func (p *guildPlayer) enqueue(play *Play) (int, bool) {
+	if len(p.pending) >= maxQueueSize {
+		return 0, false
+	}
+	position := len(p.pending)
+	if p.current != nil {
+		position++
+	}
+	p.pending = append(p.pending, play)
+	p.emit(eventQueued, play)
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return position, true
+}
+
+func (p *guildPlayer) run() {
+	defer playersWG.Done()
+	defer p.stop()
+	for {
+		if play, ctx := p.next(); play != nil {
+			p.play(ctx, play)
+			p.done()
+			continue
+		}
+		select {
+		case <-p.wake:
+			continue
+		case <-p.ctx.Done():
+		case <-time.After(p.partDelay):
+		}
+		// Leave before giving up the guild so a new player never joins while
+		// this one is still disconnecting.
+		p.leave()
+		if p.retire() {
+			return
+		}
+	}
+}
+
+// next takes the first queued play and makes it the current one.
+func (p *guildPlayer) next() (*Play, context.Context) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(p.pending) == 0 || p.ctx.Err() != nil {
+		return nil, nil
+	}
+	play := p.pending[0]
+	p.pending = p.pending[1:]
+	ctx, skip := context.WithCancel(p.ctx)
+	p.current, p.skip = play, skip
+	return play, ctx
+}
+
+func (p *guildPlayer) done() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	p.skip()
+	p.current, p.skip = nil, nil
+}
+
+// retire removes the player unless a play arrived in the meantime, in which
+// case it reports false and the player keeps going.
+func (p *guildPlayer) retire() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(p.pending) > 0 && p.ctx.Err() == nil {
+		return false
+	}
+	if players[p.guildID] == p {
+		delete(players, p.guildID)
+	}
+	return true
+}
+
+// play plays a sound and then its chained sounds until ctx is cancelled.
+func (p *guildPlayer) play(ctx context.Context, play *Play) {
+	slog.Info("Playing sound", "play", play)
+	for part := play; part != nil && ctx.Err() == nil; part = part.Next {
+		if err := p.connect(ctx, part.ChannelID); err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to play sound", "guild", p.guildID, "channel", part.ChannelID, "error", err)
+			}
+			return
+		}
+		mutex.Lock()
+		p.current, p.started = part, time.Now()
+		p.emit(eventStarted, part)
+		mutex.Unlock()
+		recordPlay(part)
+
+		err := part.Sound.Play(ctx, p.vc)
+		p.partDelay = time.Duration(part.Sound.PartDelay) * time.Millisecond
+		mutex.Lock()
+		p.started = time.Time{}
+		if ctx.Err() != nil {
+			p.emit(eventSkipped, part)
+		} else {
+			p.emit(eventFinished, part)
+		}
+		mutex.Unlock()
+		if errors.Is(err, errVoiceStalled) {
+			slog.Error("voice connection stalled, reconnecting for the next sound", "guild", p.guildID, "channel", part.ChannelID)
+			p.emitVoice("stalled", part.ChannelID)
+			p.leave()
+			return
+		}
+	}
+}
+
+// connect makes sure the player is in channelID, rejoining when the
+// connection died or the bot sits in another channel.
+func (p *guildPlayer) connect(ctx context.Context, channelID string) error {
+	if p.vc != nil && (p.vc.Closed() || p.vc.ChannelID() != channelID) {
+		p.leave()
+	}
+	if p.vc != nil {
+		return nil
+	}
+	var err error
+	for attempt := 1; attempt <= voiceJoinAttempts; attempt++ {
+		var vc voiceConn
+		if vc, err = joinVoice(ctx, p.guildID, channelID); err == nil {
+			p.vc = vc
+			p.emitVoice("connected", channelID)
+			return nil
+		}
+		slog.Warn("could not join voice channel", "guild", p.guildID, "channel", channelID, "attempt", attempt, "error", err)
+		if attempt == voiceJoinAttempts {
+			p.emitVoice("failed", "")
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(voiceRetryDelay):
+		}
+	}
+	return err
+}
+
+// leave disconnects from the voice channel, if connected.
+func (p *guildPlayer) leave() {
+	if p.vc == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), voiceLeaveTimeout)
+	defer cancel()
+	if err := p.vc.Disconnect(ctx); err != nil {
+		slog.Error("could not disconnect voice connection", "guild", p.guildID, "error", err)
+	}
+	p.vc = nil
+	p.emitVoice("disconnected", "")
+}
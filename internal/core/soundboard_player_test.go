@@ -0,0 +1,225 @@
+package gidbig
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVoice is a voice connection that hands every frame to the test.
+type fakeVoice struct {
+	channelID string
+	frames    chan []byte
+
+	mu           sync.Mutex
+	closed       bool
+	disconnected bool
+}
+
+func (v *fakeVoice) ChannelID() string { return v.channelID }
+
+func (v *fakeVoice) Closed() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.closed
+}
+
+func (v *fakeVoice) Speaking(bool) error { return nil }
+
+func (v *fakeVoice) Frames() chan<- []byte { return v.frames }
+
+func (v *fakeVoice) Disconnect(context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.disconnected = true
+	return nil
+}
+
+// fakeJoiner replaces joinVoice. Every connection shares the frames channel so
+// the test sees the frames of all plays in order.
+type fakeJoiner struct {
+	frames chan []byte
+
+	mu    sync.Mutex
+	fail  int // joins left to fail
+	joins []string
+	conns []*fakeVoice
+}
+
+func (j *fakeJoiner) join(_ context.Context, _, channelID string) (voiceConn, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.joins = append(j.joins, channelID)
+	if j.fail > 0 {
+		j.fail--
+		return nil, errors.New("join failed")
+	}
+	v := &fakeVoice{channelID: channelID, frames: j.frames}
+	j.conns = append(j.conns, v)
+	return v, nil
+}
+
+func (j *fakeJoiner) joined() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return slices.Clone(j.joins)
+}
+
+func useFakeVoice(t *testing.T, frameBuffer int) *fakeJoiner {
+	t.Helper()
+	j := &fakeJoiner{frames: make(chan []byte, frameBuffer)}
+	orig := joinVoice
+	joinVoice = j.join
+	t.Cleanup(func() {
+		stopPlayers()
+		joinVoice = orig
+	})
+	return j
+}
+
+func testPlay(channelID string, partDelay int, frames ...byte) *Play {
+	clip := &soundClip{Name: "clip", PartDelay: partDelay}
+	for _, f := range frames {
+		clip.buffer = append(clip.buffer, []byte{f})
+	}
+	return &Play{GuildID: "guild-p", ChannelID: channelID, Prefix: "test", Sound: clip}
+}
+
+func enqueueTest(t *testing.T, plays ...*Play) {
+	t.Helper()
+	mutex.Lock()
+	defer mutex.Unlock()
+	p := players["guild-p"]
+	if p == nil {
+		p = startPlayer("guild-p")
+	}
+	for _, play := range plays {
+		if _, ok := p.enqueue(play); !ok {
+			t.Fatal("queue full")
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func playerGone() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return players["guild-p"] == nil
+}
+
+func nextFrame(t *testing.T, frames <-chan []byte) byte {
+	t.Helper()
+	select {
+	case f := <-frames:
+		return f[0]
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a frame")
+		return 0
+	}
+}
+
+func TestGuildPlayer_playsQueueInOrderAndLeaves(t *testing.T) {
+	db := useSoundStore(t)
+	j := useFakeVoice(t, 16)
+	chained := testPlay("voice-a", 0, 2)
+	chained.Next = testPlay("voice-a", 0, 3)
+	enqueueTest(t, testPlay("voice-a", 0, 1), chained)
+
+	waitFor(t, "the idle player to leave", playerGone)
+	var got []byte
+	for len(j.frames) > 0 {
+		got = append(got, (<-j.frames)[0])
+	}
+	if want := []byte{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("frames = %v, want %v", got, want)
+	}
+	if joins := j.joined(); len(joins) != 1 || !j.conns[0].disconnected {
+		t.Errorf("joins = %v, disconnected %v; want one join that is left again", joins, j.conns[0].disconnected)
+	}
+	var recorded int64
+	if err := db.Model(&SoundPlay{}).Where("guild_id = ?", "guild-p").Count(&recorded).Error; err != nil || recorded != 3 {
+		t.Errorf("recorded %d plays (%v), want 3 including the chained one", recorded, err)
+	}
+}
+
+func TestGuildPlayer_rejoinsAfterMovesAndDeadConnections(t *testing.T) {
+	j := useFakeVoice(t, 0)
+
+	// The long part delay keeps the player connected between plays.
+	enqueueTest(t, testPlay("voice-a", 1000, 1))
+	nextFrame(t, j.frames)
+	j.conns[0].mu.Lock()
+	j.conns[0].closed = true
+	j.conns[0].mu.Unlock()
+
+	enqueueTest(t, testPlay("voice-a", 1000, 2))
+	nextFrame(t, j.frames)
+	enqueueTest(t, testPlay("voice-b", 1000, 3))
+	nextFrame(t, j.frames)
+
+	if joins := j.joined(); !slices.Equal(joins, []string{"voice-a", "voice-a", "voice-b"}) {
+		t.Errorf("joins = %v, want a rejoin after the dead connection and after the move", joins)
+	}
+	stopPlayers()
+	for i, c := range j.conns {
+		if !c.disconnected {
+			t.Errorf("connection %d was not disconnected", i)
+		}
+	}
+	if !playerGone() {
+		t.Error("player still registered after shutdown")
+	}
+}
+
+func TestGuildPlayer_dropsPlayWhenJoinFails(t *testing.T) {
+	j := useFakeVoice(t, 16)
+	j.fail = voiceJoinAttempts
+	enqueueTest(t, testPlay("voice-a", 0, 1), testPlay("voice-a", 0, 2))
+
+	waitFor(t, "the idle player to leave", playerGone)
+	if got := nextFrame(t, j.frames); got != 2 || len(j.frames) != 0 {
+		t.Errorf("frame = %d, want only the frame of the second play", got)
+	}
+	if joins := j.joined(); len(joins) != voiceJoinAttempts+1 {
+		t.Errorf("joins = %v, want %d failed attempts and one success", joins, voiceJoinAttempts)
+	}
+}
+
+func TestGuildPlayer_skipCancelsMidStream(t *testing.T) {
+	j := useFakeVoice(t, 0)
+	first := testPlay("voice-a", 0, 1, 1, 1)
+	first.Next = testPlay("voice-a", 0, 9)
+	enqueueTest(t, first, testPlay("voice-a", 0, 2))
+
+	if got := nextFrame(t, j.frames); got != 1 {
+		t.Fatalf("first frame = %d", got)
+	}
+	if current, pending := guildQueue("guild-p"); current != first || len(pending) != 1 {
+		t.Fatalf("queue = %v %v, want the first play with one pending", current, pending)
+	}
+	if skipped := skipSound("guild-p"); skipped != first {
+		t.Fatalf("skipped %v, want the first play", skipped)
+	}
+	// At most the frame already waiting on the channel gets through.
+	got := nextFrame(t, j.frames)
+	if got == 1 {
+		got = nextFrame(t, j.frames)
+	}
+	if got != 2 {
+		t.Errorf("frame after skip = %d, want the next queued play and not the chained one", got)
+	}
+	waitFor(t, "the idle player to leave", playerGone)
+}
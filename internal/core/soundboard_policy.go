@@ -0,0 +1,226 @@
+package gidbig
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+// soundPolicy holds the soundboard limits of the running config. It is
+// replaced on every config reload.
+var soundPolicy atomic.Pointer[cfg.SoundboardConfig]
+
+func setSoundPolicy(c cfg.SoundboardConfig) {
+	soundPolicy.Store(&c)
+}
+
+func currentSoundPolicy() cfg.SoundboardConfig {
+	if p := soundPolicy.Load(); p != nil {
+		return *p
+	}
+	return cfg.SoundboardConfig{}
+}
+
+// policyNow is the clock of the limiter; tests replace it.
+var policyNow = time.Now
+
+// limiter enforces the cooldowns and daily caps of every guild.
+var limiter = newSoundLimiter()
+
+type limiterKey struct {
+	guildID string
+	userID  string
+}
+
+// soundLimiter tracks when users may play again and how many sounds each
+// guild played today.
+type soundLimiter struct {
+	mu sync.Mutex
+
+	// until holds the end of the cooldown of each user.
+	until map[limiterKey]time.Time
+
+	// entranceUntil holds when each user's entrance sound may play again.
+	entranceUntil map[limiterKey]time.Time
+
+	// day is the start of the day plays counts. A guild is missing from plays
+	// until its count was loaded from the store.
+	day   time.Time
+	plays map[string]int
+}
+
+func newSoundLimiter() *soundLimiter {
+	return &soundLimiter{
+		until:         make(map[limiterKey]time.Time),
+		entranceUntil: make(map[limiterKey]time.Time),
+		plays:         make(map[string]int),
+	}
+}
+
+// admit checks the cooldown of the requesting user and the daily cap of the
+// guild before running enqueue. A play that gets queued starts a new
+// cooldown and counts towards the cap, chained sounds included. For refused
+// plays it also returns how long to wait.
+func (l *soundLimiter) admit(play *Play, cooldown time.Duration, dailyCap int, enqueue func() enqueueStatus) (enqueueStatus, time.Duration) {
+	now := policyNow()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(now)
+
+	if status, wait := l.refusal(play, dailyCap, now); status != enqueueQueued {
+		return status, wait
+	}
+
+	key := limiterKey{play.GuildID, play.UserID}
+	status := enqueue()
+	if status != enqueueQueued {
+		return status, 0
+	}
+	if cooldown > 0 {
+		l.until[key] = now.Add(cooldown)
+	}
+	if n, ok := l.plays[play.GuildID]; ok {
+		for part := play; part != nil; part = part.Next {
+			n++
+		}
+		l.plays[play.GuildID] = n
+	}
+	return status, 0
+}
+
+// check reports whether admit would let play through right now, without
+// taking it, and how long to wait when not.
+func (l *soundLimiter) check(play *Play, dailyCap int) (enqueueStatus, time.Duration) {
+	now := policyNow()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(now)
+	return l.refusal(play, dailyCap, now)
+}
+
+// refusal applies the cooldown of the requesting user and the daily cap of
+// the guild at now. l.mu must be held.
+func (l *soundLimiter) refusal(play *Play, dailyCap int, now time.Time) (enqueueStatus, time.Duration) {
+	if wait := l.until[limiterKey{play.GuildID, play.UserID}].Sub(now); wait > 0 {
+		return enqueueCooldown, wait
+	}
+	if dailyCap > 0 && l.playedToday(play.GuildID) >= dailyCap {
+		return enqueueDailyCap, l.day.AddDate(0, 0, 1).Sub(now)
+	}
+	return enqueueQueued, 0
+}
+
+// rollover starts a new day of counts once midnight passed and forgets
+// cooldowns that ran out.
+func (l *soundLimiter) rollover(now time.Time) {
+	y, m, d := now.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	if day.Equal(l.day) {
+		return
+	}
+	l.day = day
+	clear(l.plays)
+	for _, m := range []map[limiterKey]time.Time{l.until, l.entranceUntil} {
+		for key, until := range m {
+			if !until.After(now) {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+// admitEntrance reports whether the entrance sound of userID may play in
+// guildID and, if so, keeps it quiet for cooldown. Every join inside the
+// cooldown is ignored, which covers flapping connections.
+func (l *soundLimiter) admitEntrance(guildID, userID string, cooldown time.Duration) bool {
+	now := policyNow()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(now)
+
+	key := limiterKey{guildID, userID}
+	if l.entranceUntil[key].After(now) {
+		return false
+	}
+	if cooldown > 0 {
+		l.entranceUntil[key] = now.Add(cooldown)
+	}
+	return true
+}
+
+// playedToday returns how many sounds guildID played today, counting the
+// recorded plays the first time the guild is asked for.
+func (l *soundLimiter) playedToday(guildID string) int {
+	if n, ok := l.plays[guildID]; ok {
+		return n
+	}
+	n, err := countPlaysSince(guildID, l.day)
+	if err != nil {
+		slog.Error("could not count today's sound plays", "guild", guildID, "error", err)
+	}
+	l.plays[guildID] = n
+	return n
+}
+
+// checkPlayAccess applies the role rules of the guild and the channel
+// restrictions of every collection in the chain of play. When a collection
+// is restricted it also returns the names of the channels it may play in.
+func checkPlayAccess(policy cfg.SoundboardConfig, play *Play) (enqueueStatus, []string) {
+	if policy.HasRoleRules(play.GuildID) {
+		member, err := lookupMember(play.GuildID, play.UserID)
+		if err != nil {
+			slog.Warn("could not look up roles, refusing the play", "guild", play.GuildID, "user", play.UserID, "error", err)
+			return enqueueRoleDenied, nil
+		}
+		if !policy.RolesAllowed(play.GuildID, member.Roles) {
+			return enqueueRoleDenied, nil
+		}
+	}
+	for part := play; part != nil; part = part.Next {
+		channels := policy.ChannelsFor(part.Prefix)
+		if len(channels) > 0 && !slices.Contains(channels, part.ChannelID) {
+			return enqueueChannelRestricted, channelNames(channels)
+		}
+	}
+	return enqueueQueued, nil
+}
+
+// channelNames returns the names of the given channels, falling back to the
+// ID of channels missing from the state.
+func channelNames(ids []string) []string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if c, err := discord.State.Channel(id); err == nil && c.Name != "" {
+			names = append(names, c.Name)
+			continue
+		}
+		names = append(names, id)
+	}
+	return names
+}
+
+// formatWait renders a wait time in whole seconds, or whole minutes once it
+// reaches an hour, dropping zero units: "12s", "2m", "1m30s", "5h", "5h3m".
+func formatWait(d time.Duration) string {
+	d = max(d.Round(time.Second), time.Second)
+	if d >= time.Hour {
+		d = d.Round(time.Minute)
+	}
+	h, m, sec := int(d/time.Hour), int(d/time.Minute)%60, int(d/time.Second)%60
+	var sb strings.Builder
+	for _, u := range []struct {
+		n    int
+		unit string
+	}{{h, "h"}, {m, "m"}, {sec, "s"}} {
+		if u.n > 0 {
+			fmt.Fprintf(&sb, "%d%s", u.n, u.unit)
+		}
+	}
+	return sb.String()
+}
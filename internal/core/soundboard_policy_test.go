@@ -0,0 +1,161 @@
+package gidbig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+// usePolicy installs c as the soundboard config with a fresh limiter whose
+// clock the returned func advances.
+func usePolicy(t *testing.T, c cfg.SoundboardConfig) func(time.Duration) {
+	t.Helper()
+	origLimiter, origNow := limiter, policyNow
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.Local)
+	limiter = newSoundLimiter()
+	policyNow = func() time.Time { return now }
+	setSoundPolicy(c)
+	t.Cleanup(func() {
+		limiter, policyNow = origLimiter, origNow
+		setSoundPolicy(cfg.SoundboardConfig{})
+	})
+	return func(d time.Duration) { now = now.Add(d) }
+}
+
+func policyRequest(t *testing.T, coll *soundCollection) enqueueResult {
+	t.Helper()
+	guild, err := discord.State.Guild("guild-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return requestPlay(&discordgo.User{ID: "user-1"}, guild, coll, "one", sourceChat)
+}
+
+var policyCollection = &soundCollection{Prefix: "horn", Commands: []string{"!horn"},
+	Sounds: []*soundClip{{Name: "one", Weight: 1}}, soundRange: 1}
+
+func TestEnqueuePlay_cooldown(t *testing.T) {
+	testSoundSession(t, true)
+	usePlaying(t, &Play{})
+	advance := usePolicy(t, cfg.SoundboardConfig{
+		Cooldown: "1m",
+		Guilds:   map[string]cfg.SoundboardGuild{"guild-1": {Cooldown: "10s"}},
+	})
+
+	if res := policyRequest(t, policyCollection); res.Status != enqueueQueued {
+		t.Fatalf("first play = %s, want queued", res.Code())
+	}
+	advance(4 * time.Second)
+	res := policyRequest(t, policyCollection)
+	if res.Status != enqueueCooldown || res.RetryAfter != 6*time.Second {
+		t.Fatalf("second play = %s after %v, want a cooldown of 6s", res.Code(), res.RetryAfter)
+	}
+	advance(6 * time.Second)
+	if res := policyRequest(t, policyCollection); res.Status != enqueueQueued {
+		t.Fatalf("play after the cooldown = %s, want queued", res.Code())
+	}
+}
+
+func TestEnqueuePlay_dailyCap(t *testing.T) {
+	db := useSoundStore(t)
+	testSoundSession(t, true)
+	usePlaying(t, &Play{})
+	advance := usePolicy(t, cfg.SoundboardConfig{DailyCap: 3})
+	today := policyNow()
+	addPlays(t, db, "guild-1", "user-2", "horn", "one", today.Add(-time.Hour), 2)
+	addPlays(t, db, "guild-1", "user-2", "horn", "one", today.Add(-24*time.Hour), 5)
+
+	if res := policyRequest(t, policyCollection); res.Status != enqueueQueued {
+		t.Fatalf("third play of the day = %s, want queued", res.Code())
+	}
+	res := policyRequest(t, policyCollection)
+	if res.Status != enqueueDailyCap || res.Limit != 3 || res.RetryAfter != 12*time.Hour {
+		t.Fatalf("fourth play = %s, limit %d, retry after %v; want the cap of 3 until midnight", res.Code(), res.Limit, res.RetryAfter)
+	}
+	advance(12 * time.Hour)
+	if res := policyRequest(t, policyCollection); res.Status != enqueueQueued {
+		t.Fatalf("play on the next day = %s, want queued", res.Code())
+	}
+}
+
+func TestEnqueuePlay_roles(t *testing.T) {
+	s := testSoundSession(t, true)
+	usePlaying(t, &Play{})
+	usePolicy(t, cfg.SoundboardConfig{Guilds: map[string]cfg.SoundboardGuild{
+		"guild-1": {AllowedRoles: []string{"dj"}, DeniedRoles: []string{"muted"}},
+	}})
+	setRoles := func(roles ...string) {
+		if err := s.State.MemberAdd(&discordgo.Member{GuildID: "guild-1", User: &discordgo.User{ID: "user-1"}, Roles: roles}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if res := policyRequest(t, policyCollection); res.Status != enqueueRoleDenied {
+		t.Errorf("play without roles = %s, want role_denied", res.Code())
+	}
+	setRoles("dj", "muted")
+	if res := policyRequest(t, policyCollection); res.Status != enqueueRoleDenied {
+		t.Errorf("play of a muted DJ = %s, want role_denied", res.Code())
+	}
+	setRoles("dj")
+	if res := policyRequest(t, policyCollection); res.Status != enqueueQueued {
+		t.Errorf("play of a DJ = %s, want queued", res.Code())
+	}
+}
+
+func TestEnqueuePlay_channelRestriction(t *testing.T) {
+	s := testSoundSession(t, true)
+	usePlaying(t, &Play{})
+	if err := s.State.ChannelAdd(&discordgo.Channel{ID: "voice-2", GuildID: "guild-1", Name: "Late Night", Type: discordgo.ChannelTypeGuildVoice}); err != nil {
+		t.Fatal(err)
+	}
+	usePolicy(t, cfg.SoundboardConfig{Collections: map[string]cfg.SoundboardCollection{
+		"nsfw": {Channels: []string{"voice-2", "voice-3"}},
+	}})
+	nsfw := &soundCollection{Prefix: "nsfw", Sounds: []*soundClip{{Name: "one", Weight: 1}}, soundRange: 1}
+
+	res := policyRequest(t, nsfw)
+	if res.Status != enqueueChannelRestricted || !slices.Equal(res.Channels, []string{"Late Night", "voice-3"}) {
+		t.Fatalf("restricted play = %s in %v, want channel_restricted naming the channels", res.Code(), res.Channels)
+	}
+	if got, want := res.Message(), "`!nsfw` can only be played in Late Night, voice-3."; got != want {
+		t.Errorf("Message() = %q, want %q", got, want)
+	}
+
+	// A restricted collection chained behind an open one is refused too.
+	horn := &soundCollection{Prefix: "horn", Sounds: []*soundClip{{Name: "one", Weight: 1}}, soundRange: 1, ChainWith: nsfw}
+	if res := policyRequest(t, horn); res.Status != enqueueChannelRestricted {
+		t.Errorf("chained play = %s, want channel_restricted", res.Code())
+	}
+	if res := policyRequest(t, policyCollection); res.Status != enqueueQueued {
+		t.Errorf("unrestricted play = %s, want queued", res.Code())
+	}
+}
+
+func TestWritePlayResult_retryAfter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writePlayResult(rec, enqueueResult{Status: enqueueCooldown, Prefix: "horn", RetryAfter: 2500 * time.Millisecond})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3" {
+		t.Errorf("response = %d with Retry-After %q, want 429 and 3", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestFormatWait(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		200 * time.Millisecond:          "1s",
+		12 * time.Second:                "12s",
+		90 * time.Second:                "1m30s",
+		2 * time.Minute:                 "2m",
+		3 * time.Hour:                   "3h",
+		5*time.Hour + 3*time.Minute + 5: "5h3m",
+	} {
+		if got := formatWait(d); got != want {
+			t.Errorf("formatWait(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package gidbig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// sayTimeout bounds rendering and queueing a spoken phrase.
+const sayTimeout = 30 * time.Second
+
+// sayCollection is the collection spoken phrases are queued under, so
+// soundboard.collections can restrict "say" like any other prefix.
+var sayCollection = &soundCollection{Prefix: "say", DisplayName: "Text to speech"}
+
+// sayCommand speaks text in the voice channel of the user.
+var sayCommand = &discordgo.ApplicationCommand{
+	Name:        "say",
+	Description: "Speak a text in your voice channel",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "text",
+			Description: "What to say",
+			Required:    true,
+		},
+	},
+}
+
+// speakText renders text and queues it in the voice channel of user through
+// the same path as every other sound.
+func speakText(ctx context.Context, user *discordgo.User, guild *discordgo.Guild, text string, source playSource) enqueueResult {
+	res := enqueueResult{Prefix: sayCollection.Prefix}
+	engine := speech.Load()
+	if engine == nil {
+		res.Status = enqueueSpeechOff
+		return res
+	}
+	// Rendering runs the speech engine, so first refuse what would not be
+	// queued anyway: users outside voice, denied by the policy or waiting
+	// for their cooldown or the daily cap.
+	channel := getCurrentVoiceChannel(user, guild)
+	if channel == nil {
+		res.Status = enqueueNotInVoice
+		return res
+	}
+	policy := currentSoundPolicy()
+	probe := &Play{GuildID: guild.ID, ChannelID: channel.ID, UserID: user.ID, Prefix: sayCollection.Prefix}
+	if res.Status, res.Channels = checkPlayAccess(policy, probe); res.Status != enqueueQueued {
+		return res
+	}
+	dailyCap := policy.DailyCapIn(guild.ID)
+	if res.Status, res.RetryAfter = limiter.check(probe, dailyCap); res.Status != enqueueQueued {
+		res.Limit = dailyCap
+		return res
+	}
+	clip, err := engine.render(ctx, text)
+	if errors.Is(err, errSpeechTooLong) {
+		res.Status, res.Limit = enqueueTextTooLong, engine.conf.MaxLength
+		return res
+	}
+	if err != nil {
+		slog.Error("could not render speech", "guild", guild.ID, "user", user.ID, "error", err)
+		res.Status = enqueueSpeechFailed
+		return res
+	}
+	return enqueuePlay(user, guild, sayCollection, clip, source)
+}
+
+func onSayInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Rendering may take longer than Discord waits for an answer.
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		slog.Error("could not respond to /say", "error", err)
+		return
+	}
+	content := sayReply(s, i)
+	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content}); err != nil {
+		slog.Error("could not edit /say response", "error", err)
+	}
+}
+
+// sayReply speaks the text of a /say interaction and returns the reply for
+// the user.
+func sayReply(s *discordgo.Session, i *discordgo.InteractionCreate) string {
+	if i.GuildID == "" || i.Member == nil {
+		return "Sounds can only be played on a server."
+	}
+	var text string
+	for _, o := range i.ApplicationCommandData().Options {
+		if o.Name == "text" {
+			text = o.StringValue()
+		}
+	}
+	guild, err := s.State.Guild(i.GuildID)
+	if err != nil {
+		slog.Error("could not look up guild for /say", "guild", i.GuildID, "error", err)
+		return "Could not find this server, try again later."
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sayTimeout)
+	defer cancel()
+	return speakText(ctx, i.Member.User, guild, text, sourceSlash).Message()
+}
+
+// voiceSpeaker lets modules speak through the soundboard queue.
+type voiceSpeaker struct{}
+
+// Speak queues text in the voice channel userID is in on guildID. It fails
+// with the reason when the text is not queued, e.g. because the user is not
+// in a voice channel.
+func (voiceSpeaker) Speak(ctx context.Context, guildID, userID, text string) error {
+	guild, err := discord.State.Guild(guildID)
+	if err != nil {
+		return fmt.Errorf("looking up guild: %w", err)
+	}
+	member, err := lookupMember(guildID, userID)
+	if err != nil {
+		return fmt.Errorf("looking up member: %w", err)
+	}
+	if res := speakText(ctx, member.User, guild, text, sourceGippity); res.Status != enqueueQueued {
+		return fmt.Errorf("%s: %s", res.Code(), plainMessage(res.Message()))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package gidbig
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+func sayInteraction(text string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			Type:    discordgo.InteractionApplicationCommand,
+			GuildID: "guild-1",
+			Member:  &discordgo.Member{User: &discordgo.User{ID: "user-1"}},
+			Data: discordgo.ApplicationCommandInteractionData{Name: "say",
+				Options: []*discordgo.ApplicationCommandInteractionDataOption{stringOption("text", text, false)}},
+		},
+	}
+}
+
+func TestSayReply(t *testing.T) {
+	s := testSoundSession(t, true)
+	usePlaying(t, &Play{})
+	usePolicy(t, cfg.SoundboardConfig{})
+
+	useSpeech(t, cfg.TTSConfig{})
+	if got := sayReply(s, sayInteraction("hello")); got != "Text to speech is not set up." {
+		t.Errorf("reply without a backend = %q", got)
+	}
+
+	useSpeech(t, cfg.TTSConfig{Backend: "silence", MaxLength: 20, CacheSize: 4})
+	got := sayReply(s, sayInteraction("hello there"))
+	if !strings.Contains(got, "`!say hello there`") {
+		t.Errorf("reply = %q, want the phrase queued", got)
+	}
+	_, pending := guildQueue("guild-1")
+	if len(pending) != 1 || pending[0].Prefix != "say" || pending[0].Source != sourceSlash || len(pending[0].Sound.buffer) != 11 {
+		t.Fatalf("queue = %+v, want the spoken phrase", pending)
+	}
+
+	if got := sayReply(s, sayInteraction(strings.Repeat("a", 21))); !strings.Contains(got, "within 20 characters") {
+		t.Errorf("reply for a long text = %q", got)
+	}
+}
+
+func TestSayReply_restrictedCollection(t *testing.T) {
+	s := testSoundSession(t, true)
+	usePlaying(t, &Play{})
+	usePolicy(t, cfg.SoundboardConfig{Collections: map[string]cfg.SoundboardCollection{"say": {Channels: []string{"voice-2"}}}})
+	useSpeech(t, cfg.TTSConfig{Backend: "silence"})
+
+	if got := sayReply(s, sayInteraction("hello")); !strings.Contains(got, "can only be played in") {
+		t.Errorf("reply = %q, want the channel restriction of say", got)
+	}
+}
+
+func TestSayReply_refusedBeforeRendering(t *testing.T) {
+	s := testSoundSession(t, true)
+	usePlaying(t, &Play{})
+	advance := usePolicy(t, cfg.SoundboardConfig{Cooldown: "1m", DailyCap: 2,
+		Collections: map[string]cfg.SoundboardCollection{"say": {Channels: []string{"voice-1"}}}})
+	synth := &countingSynthesizer{}
+	orig := speech.Load()
+	speech.Store(&speechEngine{conf: cfg.TTSConfig{Backend: "silence"}, synth: synth})
+	t.Cleanup(func() { speech.Store(orig) })
+
+	if got := sayReply(s, sayInteraction("first")); !strings.Contains(got, "`!say first`") {
+		t.Fatalf("reply = %q, want the phrase queued", got)
+	}
+	if got := sayReply(s, sayInteraction("too soon")); !strings.Contains(got, "Slow down") {
+		t.Errorf("reply in the cooldown = %q", got)
+	}
+	advance(time.Minute)
+	if got := sayReply(s, sayInteraction("second")); !strings.Contains(got, "`!say second`") {
+		t.Fatalf("reply = %q, want the phrase queued", got)
+	}
+	advance(time.Minute)
+	if got := sayReply(s, sayInteraction("over the cap")); !strings.Contains(got, "played its 2 sounds") {
+		t.Errorf("reply over the daily cap = %q", got)
+	}
+	setSoundPolicy(cfg.SoundboardConfig{Collections: map[string]cfg.SoundboardCollection{"say": {Channels: []string{"voice-2"}}}})
+	if got := sayReply(s, sayInteraction("elsewhere")); !strings.Contains(got, "can only be played in") {
+		t.Errorf("reply in a restricted channel = %q", got)
+	}
+
+	if len(synth.calls) != 2 || synth.calls[0] != "first" || synth.calls[1] != "second" {
+		t.Errorf("rendered %q, want only the phrases that were queued", synth.calls)
+	}
+}
+
+func TestVoiceSpeaker(t *testing.T) {
+	testSoundSession(t, false)
+	usePlaying(t, &Play{})
+	usePolicy(t, cfg.SoundboardConfig{})
+	useSpeech(t, cfg.TTSConfig{Backend: "silence"})
+
+	err := voiceSpeaker{}.Speak(context.Background(), "guild-1", "user-1", "hello")
+	if err == nil || !strings.Contains(err.Error(), "not_in_voice") {
+		t.Errorf("Speak outside voice: err = %v, want not_in_voice", err)
+	}
+
+	testSoundSession(t, true)
+	if err := (voiceSpeaker{}).Speak(context.Background(), "guild-1", "user-1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	_, pending := guildQueue("guild-1")
+	if len(pending) != 1 || pending[0].Source != sourceGippity {
+		t.Errorf("queue = %+v, want the phrase from gippity", pending)
+	}
+}
@@ -0,0 +1,220 @@
+package gidbig
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// soundStatsTop is how many sounds and users the statistics rank.
+const soundStatsTop = 10
+
+// SoundPlay records a single sound played by the soundboard. Chained sounds
+// are recorded as plays of their own.
+type SoundPlay struct {
+	gorm.Model
+	GuildID    string     `gorm:"not null;index:idx_soundboard_play_guild_time"`
+	ChannelID  string     `gorm:"not null"`
+	UserID     string     `gorm:"not null;index"`
+	Collection string     `gorm:"not null"`
+	Sound      string     `gorm:"not null"`
+	Forced     bool       `gorm:"not null"`
+	Source     playSource `gorm:"not null"`
+	PlayedAt   time.Time  `gorm:"not null;index:idx_soundboard_play_guild_time"`
+}
+
+// TableName returns the database table name.
+func (SoundPlay) TableName() string { return "soundboard_plays" }
+
+var (
+	soundDBMu sync.RWMutex
+	soundDB   *gorm.DB
+)
+
+func getSoundDB() *gorm.DB {
+	soundDBMu.RLock()
+	defer soundDBMu.RUnlock()
+	return soundDB
+}
+
+func openSoundStore(path string) error {
+	soundDBMu.Lock()
+	defer soundDBMu.Unlock()
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&SoundPlay{}, &EntranceSound{}, &ClipConsent{}, &PendingClip{}, &SoundAudit{}, &APIToken{}, &WebSession{}); err != nil {
+		return err
+	}
+	soundDB = db
+	return nil
+}
+
+func closeSoundStore() error {
+	soundDBMu.Lock()
+	defer soundDBMu.Unlock()
+	if soundDB == nil {
+		return nil
+	}
+	sqlDB, err := soundDB.DB()
+	if err != nil {
+		return err
+	}
+	soundDB = nil
+	return sqlDB.Close()
+}
+
+// recordPlay stores that play started. Without a store nothing is recorded.
+func recordPlay(play *Play) {
+	d := getSoundDB()
+	if d == nil {
+		return
+	}
+	err := d.Create(&SoundPlay{
+		GuildID:    play.GuildID,
+		ChannelID:  play.ChannelID,
+		UserID:     play.UserID,
+		Collection: play.Prefix,
+		Sound:      play.Sound.Name,
+		Forced:     play.Forced,
+		Source:     play.Source,
+		PlayedAt:   time.Now(),
+	}).Error
+	if err != nil {
+		slog.Error("could not record sound play", "guild", play.GuildID, "prefix", play.Prefix, "soundname", play.Sound.Name, "error", err)
+	}
+}
+
+// soundCount is how often a sound was played.
+type soundCount struct {
+	Collection string `json:"collection"`
+	Sound      string `json:"sound"`
+	Count      int    `json:"count"`
+}
+
+// userPlayCount is how many sounds a user played.
+type userPlayCount struct {
+	UserID string `json:"user_id"`
+	Count  int    `json:"count"`
+}
+
+// soundStats summarises the plays of one guild.
+type soundStats struct {
+	Total     int             `json:"total"`
+	TopSounds []soundCount    `json:"top_sounds"`
+	TopUsers  []userPlayCount `json:"top_users"`
+
+	// NeverPlayed lists the loaded sounds without a play, as "!prefix name".
+	NeverPlayed []string `json:"never_played"`
+}
+
+// loadSoundStats gathers the statistics of guildID since the given time; a
+// zero since covers every recorded play.
+func loadSoundStats(guildID string, since time.Time) (*soundStats, error) {
+	d := getSoundDB()
+	if d == nil {
+		return nil, errors.New("store not initialized")
+	}
+	plays := func() *gorm.DB {
+		q := d.Model(&SoundPlay{}).Where("guild_id = ?", guildID)
+		if !since.IsZero() {
+			q = q.Where("played_at >= ?", since)
+		}
+		return q
+	}
+
+	var counts []soundCount
+	err := plays().
+		Select("collection, sound, count(*) as count").
+		Group("collection, sound").
+		Order("count DESC, collection ASC, sound ASC").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	stats := &soundStats{}
+	played := make(map[[2]string]bool, len(counts))
+	for _, c := range counts {
+		stats.Total += c.Count
+		played[[2]string{c.Collection, c.Sound}] = true
+	}
+	stats.TopSounds = counts[:min(len(counts), soundStatsTop)]
+
+	err = plays().
+		Select("user_id, count(*) as count").
+		Group("user_id").
+		Order("count DESC, user_id ASC").
+		Limit(soundStatsTop).
+		Scan(&stats.TopUsers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range soundCollectionsIn(guildID) {
+		for _, snd := range c.Sounds {
+			if !played[[2]string{c.Prefix, snd.Name}] {
+				stats.NeverPlayed = append(stats.NeverPlayed, "!"+c.Prefix+" "+snd.Name)
+			}
+		}
+	}
+	return stats, nil
+}
+
+// statsRange is a time range offered for the statistics.
+type statsRange struct {
+	Key   string
+	Label string
+	// Window is how far back the range reaches, 0 means all time.
+	Window time.Duration
+}
+
+var statsRanges = []statsRange{
+	{Key: "day", Label: "last 24 hours", Window: 24 * time.Hour},
+	{Key: "week", Label: "last 7 days", Window: 7 * 24 * time.Hour},
+	{Key: "month", Label: "last 30 days", Window: 30 * 24 * time.Hour},
+	{Key: "all", Label: "all time"},
+}
+
+// statsRangeKeys returns the keys of statsRanges.
+func statsRangeKeys() []string {
+	keys := make([]string, 0, len(statsRanges))
+	for _, r := range statsRanges {
+		keys = append(keys, r.Key)
+	}
+	return keys
+}
+
+// findStatsRange returns the range called key, defaulting to the last week.
+func findStatsRange(key string) statsRange {
+	for _, r := range statsRanges {
+		if r.Key == key {
+			return r
+		}
+	}
+	return statsRanges[1]
+}
+
+// Since returns the start of the range relative to now.
+func (r statsRange) Since(now time.Time) time.Time {
+	if r.Window == 0 {
+		return time.Time{}
+	}
+	return now.Add(-r.Window)
+}
+
+// countPlaysSince returns how many sounds guildID played since the given time.
+// Without a store there is nothing to count.
+func countPlaysSince(guildID string, since time.Time) (int, error) {
+	d := getSoundDB()
+	if d == nil {
+		return 0, nil
+	}
+	var n int64
+	err := d.Model(&SoundPlay{}).Where("guild_id = ? AND played_at >= ?", guildID, since).Count(&n).Error
+	return int(n), err
+}
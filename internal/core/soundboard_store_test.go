@@ -0,0 +1,163 @@
+package gidbig
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// useSoundStore installs an isolated in-memory store as the soundboard store.
+func useSoundStore(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open in-memory store: %v", err)
+	}
+	if err := db.AutoMigrate(&SoundPlay{}, &EntranceSound{}, &ClipConsent{}, &PendingClip{}, &SoundAudit{}, &APIToken{}, &WebSession{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	soundDBMu.Lock()
+	soundDB = db
+	soundDBMu.Unlock()
+	t.Cleanup(func() {
+		if err := closeSoundStore(); err != nil {
+			t.Logf("warning: failed to close test DB: %v", err)
+		}
+	})
+	return db
+}
+
+func addPlays(t *testing.T, db *gorm.DB, guildID, userID, collection, sound string, at time.Time, n int) {
+	t.Helper()
+	for range n {
+		p := SoundPlay{GuildID: guildID, ChannelID: "voice-1", UserID: userID, Collection: collection, Sound: sound, Source: sourceChat, PlayedAt: at}
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("insert play: %v", err)
+		}
+	}
+}
+
+func TestLoadSoundStats(t *testing.T) {
+	db := useSoundStore(t)
+	useCollections(t)
+	COLLECTIONS = []*soundCollection{
+		{Prefix: "horn", Sounds: []*soundClip{{Name: "one"}, {Name: "two"}, {Name: "three"}}},
+		{Prefix: "cow", Sounds: []*soundClip{{Name: "moo"}}},
+	}
+	now := time.Now()
+	addPlays(t, db, "guild-1", "alice", "horn", "one", now.Add(-time.Hour), 3)
+	addPlays(t, db, "guild-1", "bob", "cow", "moo", now.Add(-time.Hour), 1)
+	addPlays(t, db, "guild-1", "bob", "horn", "two", now.Add(-10*24*time.Hour), 5)
+	addPlays(t, db, "guild-2", "carol", "horn", "three", now.Add(-time.Hour), 7)
+
+	week, err := loadSoundStats("guild-1", findStatsRange("week").Since(now))
+	if err != nil {
+		t.Fatalf("loadSoundStats: %v", err)
+	}
+	if week.Total != 4 {
+		t.Errorf("Total = %d, want 4", week.Total)
+	}
+	if want := []soundCount{{"horn", "one", 3}, {"cow", "moo", 1}}; !slices.Equal(week.TopSounds, want) {
+		t.Errorf("TopSounds = %v, want %v", week.TopSounds, want)
+	}
+	if want := []userPlayCount{{"alice", 3}, {"bob", 1}}; !slices.Equal(week.TopUsers, want) {
+		t.Errorf("TopUsers = %v, want %v", week.TopUsers, want)
+	}
+	if want := []string{"!horn two", "!horn three"}; !slices.Equal(week.NeverPlayed, want) {
+		t.Errorf("NeverPlayed = %v, want %v", week.NeverPlayed, want)
+	}
+
+	all, err := loadSoundStats("guild-1", findStatsRange("all").Since(now))
+	if err != nil {
+		t.Fatalf("loadSoundStats: %v", err)
+	}
+	if all.Total != 9 || all.TopUsers[0] != (userPlayCount{"bob", 6}) {
+		t.Errorf("all time = %d plays, top user %v; want 9 and bob", all.Total, all.TopUsers[0])
+	}
+	if want := []string{"!horn three"}; !slices.Equal(all.NeverPlayed, want) {
+		t.Errorf("NeverPlayed = %v, want %v; plays of other guilds must not count", all.NeverPlayed, want)
+	}
+}
+
+func TestRecordPlay(t *testing.T) {
+	db := useSoundStore(t)
+	recordPlay(&Play{GuildID: "guild-1", ChannelID: "voice-1", UserID: "user-1", Prefix: "horn",
+		Sound: &soundClip{Name: "one"}, Forced: true, Source: sourceWeb})
+
+	var got SoundPlay
+	if err := db.First(&got).Error; err != nil {
+		t.Fatalf("read play: %v", err)
+	}
+	if got.Collection != "horn" || got.Sound != "one" || !got.Forced || got.Source != sourceWeb || got.PlayedAt.IsZero() {
+		t.Errorf("recorded %+v", got)
+	}
+}
+
+func TestStatsReply(t *testing.T) {
+	stats := &soundStats{
+		Total:       4,
+		TopSounds:   []soundCount{{"horn", "one", 3}},
+		TopUsers:    []userPlayCount{{"user-1", 4}},
+		NeverPlayed: make([]string, maxNeverPlayed+2),
+	}
+	for n := range stats.NeverPlayed {
+		stats.NeverPlayed[n] = fmt.Sprintf("!horn s%d", n)
+	}
+	got := statsReply(stats, findStatsRange("day"))
+	for _, want := range []string{
+		"**Soundboard stats, last 24 hours** (4 plays)",
+		"1. `!horn one` 3×",
+		"1. <@user-1> 4×",
+		"**Never played** (17)",
+		"`!horn s14` and 2 more",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("reply should contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "s15") {
+		t.Errorf("reply lists more than %d never played sounds", maxNeverPlayed)
+	}
+}
+
+func TestBuildStatsPage(t *testing.T) {
+	db := useSoundStore(t)
+	useCollections(t)
+	s := testSoundSession(t, false)
+	if err := s.State.GuildAdd(&discordgo.Guild{ID: "guild-0", Name: "Elsewhere"}); err != nil {
+		t.Fatal(err)
+	}
+	addPlays(t, db, "guild-1", "user-1", "horn", "one", time.Now(), 2)
+
+	// guild-0 is not shared with user-1 and falls back to guild-1.
+	data := buildStatsPage("user-1", "guild-0", "day")
+	if len(data.Guilds) != 1 || !data.Guilds[0].Selected || data.Guilds[0].Value != "guild-1" {
+		t.Fatalf("Guilds = %+v, want only guild-1 selected", data.Guilds)
+	}
+	if data.Stats == nil || data.Stats.Total != 2 || data.RangeLabel != "last 24 hours" {
+		t.Fatalf("stats = %+v, range %q", data.Stats, data.RangeLabel)
+	}
+	if len(data.TopUsers) != 1 || data.TopUsers[0].Name != "user-1" {
+		t.Errorf("TopUsers = %+v", data.TopUsers)
+	}
+
+	tmpl := template.Must(template.ParseFiles("../../web/templates/soundstats.html",
+		"../../web/templates/header.html", "../../web/templates/footer.html"))
+	var b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&b, "header", data); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(b.String(), "!horn one") || !strings.Contains(b.String(), `<option value="day" selected>`) {
+		t.Errorf("page is missing the stats:\n%s", b.String())
+	}
+}
@@ -1,6 +1,7 @@
 package gidbig
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -25,7 +26,7 @@ func TestSoundClipPlay_deliversAllFrames(t *testing.T) {
 	s := &soundClip{buffer: frames}
 	vc := newTestVoiceConnection(len(frames) + 4)
 
-	s.Play(vc)
+	s.Play(context.Background(), discordVoice{vc: vc})
 
 	if got := len(vc.OpusSend); got != len(frames) {
 		t.Fatalf("OpusSend has %d frames, want %d", got, len(frames))
@@ -53,7 +54,7 @@ func TestSoundClipPlay_doesNotSelfPace(t *testing.T) {
 	vc := newTestVoiceConnection(n + 4)
 
 	start := time.Now()
-	s.Play(vc)
+	s.Play(context.Background(), discordVoice{vc: vc})
 	elapsed := time.Since(start)
 
 	// One frame interval is 20 ms.  If Play self-paces, n frames take >= n*20 ms.
@@ -71,7 +72,7 @@ func TestSoundClipPlay_emptyBuffer(t *testing.T) {
 	vc := newTestVoiceConnection(4)
 
 	start := time.Now()
-	s.Play(vc)
+	s.Play(context.Background(), discordVoice{vc: vc})
 	elapsed := time.Since(start)
 
 	if len(vc.OpusSend) != 0 {
@@ -81,3 +82,37 @@ func TestSoundClipPlay_emptyBuffer(t *testing.T) {
 		t.Errorf("empty Play took %v; expected near-instant", elapsed)
 	}
 }
+
+// TestSoundClipPlay_stopsWhenCancelled verifies that a cancelled context stops
+// the clip before the remaining frames are sent.
+func TestSoundClipPlay_stopsWhenCancelled(t *testing.T) {
+	frames := [][]byte{{0x01}, {0x02}, {0x03}, {0x04}}
+	s := &soundClip{buffer: frames}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	vc := newTestVoiceConnection(len(frames))
+	s.Play(ctx, discordVoice{vc: vc})
+	if got := len(vc.OpusSend); got != 0 {
+		t.Errorf("cancelled before start: OpusSend has %d frames, want 0", got)
+	}
+
+	// Cancel mid-stream while Play waits for room in OpusSend.
+	ctx, cancel = context.WithCancel(context.Background())
+	vc = newTestVoiceConnection(1)
+	done := make(chan struct{})
+	go func() {
+		s.Play(ctx, discordVoice{vc: vc})
+		close(done)
+	}()
+	<-vc.OpusSend
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Play did not return after cancel")
+	}
+	if got := len(vc.OpusSend); got > 1 {
+		t.Errorf("OpusSend has %d frames after cancel, want at most 1", got)
+	}
+}
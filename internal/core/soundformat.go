@@ -0,0 +1,374 @@
+package gidbig
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// dca1Magic starts a DCA1 file; it is followed by an int32 JSON length,
+	// the JSON metadata and the same frames as DCA0.
+	dca1Magic = "DCA1"
+
+	// maxDCAMetadata bounds the JSON header so a corrupt length can't make
+	// the loader allocate gigabytes.
+	maxDCAMetadata = 1 << 20
+
+	// maxOpusFrame is the largest Opus packet we accept.
+	maxOpusFrame = 4000
+
+	// opusSampleRate is the rate Ogg Opus granule positions are counted in.
+	opusSampleRate = 48000
+)
+
+// soundFormats maps the file extensions the loader understands to their reader.
+var soundFormats = map[string]func(io.Reader) ([][]byte, soundMetadata, error){
+	".dca":  readDCA,
+	".ogg":  readOggOpus,
+	".opus": readOggOpus,
+}
+
+// soundMetadata is what a sound file tells about itself.
+type soundMetadata struct {
+	Title    string
+	Duration time.Duration
+}
+
+// dcaHeader is the part of the DCA1 JSON metadata the loader uses.
+type dcaHeader struct {
+	Opus struct {
+		SampleRate int `json:"sample_rate"`
+		FrameSize  int `json:"frame_size"`
+	} `json:"opus"`
+	Info struct {
+		Title string `json:"title"`
+	} `json:"info"`
+}
+
+// readDCA reads a DCA0 or DCA1 file into Opus frames. DCA0 has no header;
+// every frame is an int16 little-endian length followed by the packet.
+func readDCA(r io.Reader) ([][]byte, soundMetadata, error) {
+	br := bufio.NewReader(r)
+	var meta soundMetadata
+	sampleRate, frameSize := opusSampleRate, 960
+
+	if magic, _ := br.Peek(len(dca1Magic)); string(magic) == dca1Magic {
+		_, _ = br.Discard(len(dca1Magic))
+		var n int32
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return nil, meta, fmt.Errorf("reading DCA1 metadata length: %w", err)
+		}
+		if n < 0 || n > maxDCAMetadata {
+			return nil, meta, fmt.Errorf("invalid DCA1 metadata length %d", n)
+		}
+		raw := make([]byte, n)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return nil, meta, fmt.Errorf("reading DCA1 metadata: %w", err)
+		}
+		var h dcaHeader
+		if err := json.Unmarshal(raw, &h); err != nil {
+			return nil, meta, fmt.Errorf("decoding DCA1 metadata: %w", err)
+		}
+		meta.Title = strings.TrimSpace(h.Info.Title)
+		if h.Opus.SampleRate > 0 {
+			sampleRate = h.Opus.SampleRate
+		}
+		if h.Opus.FrameSize > 0 {
+			frameSize = h.Opus.FrameSize
+		}
+	}
+
+	var frames [][]byte
+	var opuslen int16
+	for {
+		// read opus frame length from dca file
+		err := binary.Read(br, binary.LittleEndian, &opuslen)
+
+		// If this is the end of the file, just return
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, meta, err
+		}
+
+		// A negative or absurdly large frame length means we lost framing.
+		// Surface this loudly instead of corrupting the buffer.
+		if opuslen <= 0 || opuslen > maxOpusFrame {
+			return nil, meta, fmt.Errorf("invalid opus frame length %d at frame %d", opuslen, len(frames))
+		}
+
+		// read encoded pcm from dca file
+		frame := make([]byte, opuslen)
+		if _, err := io.ReadFull(br, frame); err != nil {
+			return nil, meta, fmt.Errorf("reading frame %d: %w", len(frames), err)
+		}
+		frames = append(frames, frame)
+	}
+
+	meta.Duration = time.Duration(len(frames)*frameSize) * time.Second / time.Duration(sampleRate)
+	return frames, meta, nil
+}
+
+// writeDCA writes frames as a DCA1 file titled title, which readDCA and the
+// dca tools read back.
+func writeDCA(w io.Writer, frames [][]byte, title string) error {
+	var h dcaHeader
+	h.Opus.SampleRate, h.Opus.FrameSize = opusSampleRate, 960
+	h.Info.Title = title
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(dca1Magic)
+	_ = binary.Write(bw, binary.LittleEndian, int32(len(raw)))
+	bw.Write(raw)
+	for i, frame := range frames {
+		if len(frame) == 0 || len(frame) > maxOpusFrame {
+			return fmt.Errorf("invalid opus frame length %d at frame %d", len(frame), i)
+		}
+		_ = binary.Write(bw, binary.LittleEndian, int16(len(frame)))
+		bw.Write(frame)
+	}
+	return bw.Flush()
+}
+
+// readOggOpus demuxes the first logical stream of an Ogg Opus file into its
+// Opus packets. Pages of other streams are skipped and CRCs are not checked.
+func readOggOpus(r io.Reader) ([][]byte, soundMetadata, error) {
+	br := bufio.NewReader(r)
+	var (
+		meta     soundMetadata
+		packets  [][]byte
+		partial  []byte
+		serial   uint32
+		started  bool
+		granule  int64
+		header   = make([]byte, 27)
+		segments = make([]byte, 255)
+	)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, meta, fmt.Errorf("reading Ogg page: %w", err)
+		}
+		if string(header[:4]) != "OggS" {
+			return nil, meta, errors.New("missing Ogg capture pattern")
+		}
+		pageSerial := binary.LittleEndian.Uint32(header[14:18])
+		lacing := segments[:header[26]]
+		if _, err := io.ReadFull(br, lacing); err != nil {
+			return nil, meta, fmt.Errorf("reading Ogg segment table: %w", err)
+		}
+		size := 0
+		for _, l := range lacing {
+			size += int(l)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, meta, fmt.Errorf("reading Ogg page data: %w", err)
+		}
+
+		if !started {
+			serial, started = pageSerial, true
+		}
+		if pageSerial != serial {
+			continue
+		}
+		// A page without the continuation flag starts a fresh packet.
+		if header[5]&0x01 == 0 {
+			partial = nil
+		}
+		off := 0
+		for _, l := range lacing {
+			partial = append(partial, data[off:off+int(l)]...)
+			off += int(l)
+			if l < 255 {
+				packets = append(packets, partial)
+				partial = nil
+			}
+		}
+		if g := int64(binary.LittleEndian.Uint64(header[6:14])); g != -1 {
+			granule = g
+		}
+	}
+
+	if len(packets) < 2 || !bytes.HasPrefix(packets[0], []byte("OpusHead")) {
+		return nil, meta, errors.New("not an Ogg Opus stream")
+	}
+	var preSkip int64
+	if head := packets[0]; len(head) >= 12 {
+		preSkip = int64(binary.LittleEndian.Uint16(head[10:12]))
+	}
+	if bytes.HasPrefix(packets[1], []byte("OpusTags")) {
+		meta.Title = opusTag(packets[1][len("OpusTags"):], "TITLE")
+	}
+
+	frames := make([][]byte, 0, len(packets)-2)
+	for i, p := range packets[2:] {
+		if len(p) == 0 {
+			continue
+		}
+		if len(p) > maxOpusFrame {
+			return nil, meta, fmt.Errorf("invalid opus frame length %d at frame %d", len(p), i)
+		}
+		frames = append(frames, p)
+	}
+	if samples := granule - preSkip; samples > 0 {
+		meta.Duration = time.Duration(samples) * time.Second / opusSampleRate
+	}
+	return frames, meta, nil
+}
+
+// opusTag returns the value of the first KEY=value comment in an OpusTags
+// body (vendor string followed by the comment list) whose key matches.
+func opusTag(b []byte, key string) string {
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+		v := b[4 : 4+n]
+		b = b[4+n:]
+		return v, true
+	}
+	if _, ok := next(); !ok { // vendor
+		return ""
+	}
+	if len(b) < 4 {
+		return ""
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for range count {
+		c, ok := next()
+		if !ok {
+			return ""
+		}
+		k, v, found := strings.Cut(string(c), "=")
+		if found && strings.EqualFold(k, key) {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// oggSerial is the stream serial writeOggOpus uses; a file holds one stream
+// so any value will do.
+const oggSerial = 0x67626467
+
+// writeOggOpus writes frames as an Ogg Opus file titled title, which
+// readOggOpus and regular Opus tools read back. Every frame is taken to be
+// 20 ms long, as Discord sends them.
+func writeOggOpus(w io.Writer, frames [][]byte, title string) error {
+	head := []byte("OpusHead")
+	head = append(head, 1, 2) // version, channels
+	head = binary.LittleEndian.AppendUint16(head, 0)
+	head = binary.LittleEndian.AppendUint32(head, opusSampleRate)
+	head = binary.LittleEndian.AppendUint16(head, 0) // output gain
+	head = append(head, 0)                           // channel mapping family
+
+	tags := []byte("OpusTags")
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len("gidbig")))
+	tags = append(tags, "gidbig"...)
+	if title == "" {
+		tags = binary.LittleEndian.AppendUint32(tags, 0)
+	} else {
+		comment := "TITLE=" + title
+		tags = binary.LittleEndian.AppendUint32(tags, 1)
+		tags = binary.LittleEndian.AppendUint32(tags, uint32(len(comment)))
+		tags = append(tags, comment...)
+	}
+
+	bw := bufio.NewWriter(w)
+	var seq uint32
+	page := func(flags byte, granule int64, packets [][]byte) {
+		var lacing, body []byte
+		for _, p := range packets {
+			for n := len(p); ; n -= 255 {
+				if n < 255 {
+					lacing = append(lacing, byte(n))
+					break
+				}
+				lacing = append(lacing, 255)
+			}
+			body = append(body, p...)
+		}
+		b := []byte("OggS")
+		b = append(b, 0, flags)
+		b = binary.LittleEndian.AppendUint64(b, uint64(granule))
+		b = binary.LittleEndian.AppendUint32(b, oggSerial)
+		b = binary.LittleEndian.AppendUint32(b, seq)
+		b = binary.LittleEndian.AppendUint32(b, 0) // CRC, filled in below
+		b = append(b, byte(len(lacing)))
+		b = append(b, lacing...)
+		b = append(b, body...)
+		binary.LittleEndian.PutUint32(b[22:26], oggCRC(b))
+		bw.Write(b)
+		seq++
+	}
+	page(0x02, 0, [][]byte{head})
+	page(0, 0, [][]byte{tags})
+
+	// Packets are never split across pages; a page holds up to 255 lacing
+	// values, and a packet of at most maxOpusFrame bytes needs 16.
+	var (
+		pending [][]byte
+		laces   int
+		granule int64
+	)
+	for i, frame := range frames {
+		if len(frame) == 0 || len(frame) > maxOpusFrame {
+			return fmt.Errorf("invalid opus frame length %d at frame %d", len(frame), i)
+		}
+		n := len(frame)/255 + 1
+		if laces+n > 255 {
+			page(0, granule, pending)
+			pending, laces = nil, 0
+		}
+		pending = append(pending, frame)
+		laces += n
+		granule += opusSampleRate / 50
+	}
+	page(0x04, granule, pending)
+	return bw.Flush()
+}
+
+// oggCRCTable holds the CRC-32 Ogg uses: polynomial 0x04c11db7, unreflected,
+// starting from zero.
+var oggCRCTable = func() (t [256]uint32) {
+	for i := range t {
+		r := uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+// oggCRC returns the checksum of an Ogg page whose checksum field is zero.
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
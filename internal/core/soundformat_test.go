@@ -0,0 +1,288 @@
+package gidbig
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dca1Bytes(t *testing.T, metadata string, frames [][]byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	b.WriteString(dca1Magic)
+	_ = binary.Write(&b, binary.LittleEndian, int32(len(metadata)))
+	b.WriteString(metadata)
+	for _, frame := range frames {
+		_ = binary.Write(&b, binary.LittleEndian, int16(len(frame)))
+		b.Write(frame)
+	}
+	return b.Bytes()
+}
+
+// oggPage encodes one Ogg page with the given payload and segment table.
+// The CRC is left zero because the demuxer does not check it.
+func oggPage(headerType byte, granule int64, serial uint32, payload []byte, lacing []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("OggS")
+	b.WriteByte(0)
+	b.WriteByte(headerType)
+	_ = binary.Write(&b, binary.LittleEndian, granule)
+	_ = binary.Write(&b, binary.LittleEndian, serial)
+	_ = binary.Write(&b, binary.LittleEndian, uint32(0)) // sequence
+	_ = binary.Write(&b, binary.LittleEndian, uint32(0)) // crc
+	b.WriteByte(byte(len(lacing)))
+	b.Write(lacing)
+	b.Write(payload)
+	return b.Bytes()
+}
+
+// lacingFor returns the segment table for a complete packet of length n.
+func lacingFor(n int) []byte {
+	var l []byte
+	for ; n >= 255; n -= 255 {
+		l = append(l, 255)
+	}
+	return append(l, byte(n))
+}
+
+func opusHead(preSkip uint16) []byte {
+	h := []byte("OpusHead")
+	h = append(h, 1, 2)
+	h = binary.LittleEndian.AppendUint16(h, preSkip)
+	h = binary.LittleEndian.AppendUint32(h, opusSampleRate)
+	return append(h, 0, 0, 0)
+}
+
+func opusTags(comments ...string) []byte {
+	t := []byte("OpusTags")
+	t = binary.LittleEndian.AppendUint32(t, 4)
+	t = append(t, "test"...)
+	t = binary.LittleEndian.AppendUint32(t, uint32(len(comments)))
+	for _, c := range comments {
+		t = binary.LittleEndian.AppendUint32(t, uint32(len(c)))
+		t = append(t, c...)
+	}
+	return t
+}
+
+func oggOpusBytes() []byte {
+	const serial = 7
+	head, tags := opusHead(312), opusTags("ARTIST=someone", "title=Big Horn")
+	long := bytes.Repeat([]byte{0xab}, 300)
+	spanning := bytes.Repeat([]byte{0xcd}, 510)
+
+	var b bytes.Buffer
+	b.Write(oggPage(0x02, 0, serial, head, lacingFor(len(head))))
+	b.Write(oggPage(0x00, 0, serial, tags, lacingFor(len(tags))))
+	// A page of another logical stream is ignored.
+	b.Write(oggPage(0x02, 0, serial+1, []byte{0x99}, []byte{1}))
+	// Two packets, the first longer than one segment.
+	b.Write(oggPage(0x00, 960, serial, append(append([]byte{}, long...), 0x01), append(lacingFor(len(long)), 1)))
+	// One packet split across two pages.
+	b.Write(oggPage(0x00, -1, serial, spanning[:255], []byte{255}))
+	b.Write(oggPage(0x05, 312+48000, serial, spanning[255:], lacingFor(255)))
+	return b.Bytes()
+}
+
+func TestReadDCA_DCA1Header(t *testing.T) {
+	meta := `{"dca":{"version":1},"opus":{"sample_rate":48000,"frame_size":960},"info":{"title":" Airhorn "}}`
+	frames := [][]byte{{0x01, 0x02}, {0x03}}
+
+	got, m, err := readDCA(bytes.NewReader(dca1Bytes(t, meta, frames)))
+	if err != nil {
+		t.Fatalf("readDCA: %v", err)
+	}
+	if len(got) != 2 || !bytes.Equal(got[0], frames[0]) || !bytes.Equal(got[1], frames[1]) {
+		t.Errorf("frames = %v, want %v", got, frames)
+	}
+	if m.Title != "Airhorn" {
+		t.Errorf("Title = %q, want Airhorn", m.Title)
+	}
+	if m.Duration != 40*time.Millisecond {
+		t.Errorf("Duration = %v, want 40ms", m.Duration)
+	}
+}
+
+func TestReadDCA_errors(t *testing.T) {
+	cases := map[string][]byte{
+		"bad metadata":    dca1Bytes(t, "{", nil),
+		"huge metadata":   append([]byte(dca1Magic), 0xff, 0xff, 0xff, 0x7f),
+		"negative length": {0xff, 0xff},
+		"truncated frame": {0x04, 0x00, 0x01},
+	}
+	for name, data := range cases {
+		if _, _, err := readDCA(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestWriteDCA(t *testing.T) {
+	frames := [][]byte{{0x01, 0x02}, opusSilence, bytes.Repeat([]byte{0xab}, 300)}
+	var buf bytes.Buffer
+	if err := writeDCA(&buf, frames, "Clip of someone"); err != nil {
+		t.Fatal(err)
+	}
+	got, meta, err := readDCA(&buf)
+	if err != nil {
+		t.Fatalf("readDCA: %v", err)
+	}
+	if len(got) != len(frames) || !bytes.Equal(got[2], frames[2]) {
+		t.Errorf("frames = %v, want %v", got, frames)
+	}
+	if meta.Title != "Clip of someone" || meta.Duration != 60*time.Millisecond {
+		t.Errorf("meta = %+v, want the title and 60ms", meta)
+	}
+	if err := writeDCA(io.Discard, [][]byte{nil}, ""); err == nil {
+		t.Error("expected an error for an empty frame")
+	}
+}
+
+func TestReadOggOpus(t *testing.T) {
+	frames, meta, err := readOggOpus(bytes.NewReader(oggOpusBytes()))
+	if err != nil {
+		t.Fatalf("readOggOpus: %v", err)
+	}
+	wantLens := []int{300, 1, 510}
+	if len(frames) != len(wantLens) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(wantLens))
+	}
+	for i, want := range wantLens {
+		if len(frames[i]) != want {
+			t.Errorf("frame %d len = %d, want %d", i, len(frames[i]), want)
+		}
+	}
+	if meta.Title != "Big Horn" {
+		t.Errorf("Title = %q, want %q", meta.Title, "Big Horn")
+	}
+	if meta.Duration != time.Second {
+		t.Errorf("Duration = %v, want 1s", meta.Duration)
+	}
+}
+
+func TestWriteOggOpus(t *testing.T) {
+	// Enough frames to need more than one audio page.
+	frames := make([][]byte, 300)
+	for i := range frames {
+		frames[i] = bytes.Repeat([]byte{byte(i)}, 1+i%300)
+	}
+	var buf bytes.Buffer
+	if err := writeOggOpus(&buf, frames, "Big Horn"); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+	got, meta, err := readOggOpus(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("readOggOpus: %v", err)
+	}
+	if len(got) != len(frames) {
+		t.Fatalf("got %d frames, want %d", len(got), len(frames))
+	}
+	for i := range frames {
+		if !bytes.Equal(got[i], frames[i]) {
+			t.Fatalf("frame %d differs", i)
+		}
+	}
+	if meta.Title != "Big Horn" || meta.Duration != 6*time.Second {
+		t.Errorf("meta = %+v, want the title and 6s", meta)
+	}
+
+	pages := 0
+	for len(raw) > 0 {
+		n := 27 + int(raw[26])
+		for _, l := range raw[27:n] {
+			n += int(l)
+		}
+		page := bytes.Clone(raw[:n])
+		want := binary.LittleEndian.Uint32(page[22:26])
+		binary.LittleEndian.PutUint32(page[22:26], 0)
+		if got := oggCRC(page); got != want {
+			t.Errorf("page %d CRC = %08x, computed %08x", pages, want, got)
+		}
+		raw = raw[n:]
+		pages++
+	}
+	if pages < 4 {
+		t.Errorf("wrote %d pages, want the frames split over more than one", pages)
+	}
+	if err := writeOggOpus(io.Discard, [][]byte{nil}, ""); err == nil {
+		t.Error("expected an error for an empty frame")
+	}
+}
+
+func TestOggCRC(t *testing.T) {
+	if got := oggCRC([]byte("123456789")); got != 0x89a1897f {
+		t.Errorf("oggCRC = %08x, want 89a1897f", got)
+	}
+}
+
+func TestReadOggOpus_errors(t *testing.T) {
+	vorbis := oggPage(0x02, 0, 1, []byte("\x01vorbis"), []byte{7})
+	cases := map[string][]byte{
+		"not ogg":    []byte("RIFF...."),
+		"not opus":   append(vorbis, vorbis...),
+		"truncated":  oggOpusBytes()[:40],
+		"empty file": nil,
+	}
+	for name, data := range cases {
+		if _, _, err := readOggOpus(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRescanSounds_formatsAndMetadata(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useCollections(t)
+	writeDCAFile(t, "horn", "plain", [][]byte{{0x01}})
+	meta := `{"info":{"title":"A rather long title from the encoder"}}`
+	if err := os.WriteFile(filepath.Join("audio", "horn_dca1.dca"), dca1Bytes(t, meta, [][]byte{{0x02}}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("audio", "horn_ogg.opus"), oggOpusBytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeAudioDescription(t, "horn", "ogg", "from txt")
+
+	res := rescanSounds()
+	if len(res.Added) != 3 || len(res.Failed) != 0 {
+		t.Fatalf("rescan = %+v, want 3 added", res)
+	}
+
+	if d := findClip(t, "horn", "plain").description; d != nil {
+		t.Errorf("plain DCA0 description = %+v, want none", d)
+	}
+	d := findClip(t, "horn", "dca1").description
+	if d == nil || d.Text != "A rather long title from the encoder" || !strings.HasSuffix(d.Short, "...") {
+		t.Errorf("DCA1 description = %+v, want title from metadata", d)
+	}
+	ogg := findClip(t, "horn", "ogg")
+	if ogg.description == nil || ogg.description.Text != "from txt" {
+		t.Errorf("ogg description = %+v, want .txt to win over metadata", ogg.description)
+	}
+	if len(ogg.buffer) != 3 {
+		t.Errorf("ogg frames = %d, want 3", len(ogg.buffer))
+	}
+}
+
+func TestRescanSounds_duplicateSoundName(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useCollections(t)
+	writeDCAFile(t, "horn", "one", [][]byte{{0x01}})
+	if err := os.WriteFile(filepath.Join("audio", "horn_one.ogg"), oggOpusBytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res := rescanSounds()
+	if len(res.Added) != 1 || len(res.Failed) != 1 {
+		t.Fatalf("rescan = %+v, want 1 added and 1 failed", res)
+	}
+	if got := findClip(t, "horn", "one"); len(got.buffer) != 1 {
+		t.Errorf("expected the .dca file to win, got %d frames", len(got.buffer))
+	}
+}
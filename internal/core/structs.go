@@ -1,18 +1,127 @@
 package gidbig
 
+import "time"
+
 type templateData struct {
 	Prefixes  []string
 	Username  string
 	AvatarURL string
+	// Manage shows the link to the sound management page
+	Manage bool
+	// CSRFToken goes with every request of the page that changes something
+	CSRFToken string
+	// Nonce lets the inline scripts of the page run under the CSP
+	Nonce string
+	// ServerSessions shows the link to the session page
+	ServerSessions bool
+}
+
+// statsPageData feeds the soundboard statistics page
+type statsPageData struct {
+	templateData
+	Guilds     []statsOption
+	Ranges     []statsOption
+	RangeLabel string
+	Stats      *soundStats
+	TopUsers   []statsUser
+	Error      string
+}
+
+// statsOption is an entry of a select box on the statistics page
+type statsOption struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// statsUser is a top user on the statistics page
+type statsUser struct {
+	Name  string
+	Count int
+}
+
+// managePageData feeds the sound management page
+type managePageData struct {
+	templateData
+	// Guilds are the guilds a new collection may be limited to
+	Guilds    []statsOption
+	Sounds    []manageSound
+	Audit     []manageAudit
+	Formats   string
+	MaxSize   string
+	MaxLength string
+	Error     string
+}
+
+// manageSound is a sound listed on the management page
+type manageSound struct {
+	Prefix      string
+	Name        string
+	Description string
+	Weight      int
+	// First marks the first sound of its collection
+	First bool
+}
+
+// manageAudit is a change listed on the management page
+type manageAudit struct {
+	When    string
+	User    string
+	Action  string
+	Command string
+	Detail  string
+}
+
+// tokensPageData feeds the API token page
+type tokensPageData struct {
+	templateData
+	Tokens []tokenItem
+	Scopes []string
+	Error  string
+}
+
+// tokenItem is a token listed on the API token page
+type tokenItem struct {
+	ID       uint
+	Name     string
+	Scopes   string
+	Hint     string
+	Created  string
+	LastUsed string
+}
+
+// sessionsPageData feeds the session page
+type sessionsPageData struct {
+	templateData
+	Sessions []sessionItem
+	// Owner lists All, the sessions of every user
+	Owner bool
+	All   []sessionItem
+	Error string
+}
+
+// sessionItem is a session listed on the session page
+type sessionItem struct {
+	ID        string
+	User      string
+	Address   string
+	UserAgent string
+	Created   string
+	LastSeen  string
+	// Current marks the session of the page itself
+	Current bool
 }
 
 // soundItem is used to represent a sound of our COLLECTIONS for html generation
 type soundItem struct {
-	Itemprefix    string
-	Itemcommand   string
-	Itemsoundname string
-	Itemtext      string
-	Itemshorttext string
+	Itemprefix      string
+	Itemcollection  string
+	Itemcommand     string
+	Itemsoundname   string
+	Itemdisplayname string
+	Itemtext        string
+	Itemshorttext   string
+	Itemtags        string
 }
 
 // Play represents an individual use of the !airhorn command
@@ -22,17 +131,30 @@ type Play struct {
 	UserID    string
 	Sound     *soundClip
 
+	// Prefix of the collection Sound belongs to
+	Prefix string
+
+	// Username is the display name of the user who queued the play
+	Username string
+
 	// The next play to occur after this, only used for chaining sounds like anotha
 	Next *Play
 
 	// If true, this was a forced play using a specific airhorn sound name
 	Forced bool
+
+	// Source tells where the play was requested
+	Source playSource
 }
 
 // soundCollection of sound clips
 type soundCollection struct {
-	Prefix     string
-	Commands   []string
+	Prefix      string
+	DisplayName string
+	Commands    []string
+	Tags        []string
+	// Guilds limits the collection to these guild IDs, empty means every guild
+	Guilds     []string
 	Sounds     []*soundClip
 	ChainWith  *soundCollection
 	soundRange int
@@ -42,6 +164,11 @@ type soundCollection struct {
 type soundClip struct {
 	Name string
 
+	// DisplayName replaces Name in the Web UI when set
+	DisplayName string
+
+	Tags []string
+
 	// Weight adjust how likely it is this song will play, higher = more likely
 	Weight int
 
@@ -50,4 +177,32 @@ type soundClip struct {
 
 	// Buffer to store encoded PCM packets
 	buffer [][]byte
+
+	// ext is the extension of the sound file, empty means .dca
+	ext string
+
+	// meta is read from the sound file itself (DCA1 header or OpusTags)
+	meta soundMetadata
+
+	// description comes from the optional .txt file next to the sound file,
+	// falling back to the title in meta
+	description *soundDescription
+
+	// modTime and size of the sound file when it was loaded, used by rescans
+	// to skip unchanged files
+	modTime time.Time
+	size    int64
+
+	// volume in dB is the manifest's adjustment of the normalization gain
+	volume float64
+
+	// normKey identifies the normalization buffer went through, empty when
+	// buffer holds the sound file as loaded
+	normKey string
+}
+
+// soundDescription is the Web UI text of a sound clip
+type soundDescription struct {
+	Text  string
+	Short string
 }
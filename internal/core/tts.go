@@ -0,0 +1,238 @@
+package gidbig
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+const (
+	// maxSpeechOutput bounds what a speech command may write to stdout.
+	maxSpeechOutput = 16 << 20
+
+	// maxSpeechFrames caps a rendered phrase at two minutes of 20 ms frames.
+	maxSpeechFrames = 2 * 60 * 50
+)
+
+// opusSilence is the Opus packet of a 20 ms silence frame.
+var opusSilence = []byte{0xF8, 0xFF, 0xFE}
+
+// Synthesizer turns text into Opus frames ready for the voice connection.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string) ([][]byte, error)
+}
+
+// commandSynthesizer runs an offline speech engine for every phrase. The text
+// is written to its stdin and Ogg Opus is read back from its stdout.
+type commandSynthesizer struct {
+	argv    []string
+	timeout time.Duration
+}
+
+func (c commandSynthesizer) Synthesize(ctx context.Context, text string) ([][]byte, error) {
+	out, err := runCommand(ctx, c.argv, strings.NewReader(text), nil, c.timeout, maxSpeechOutput)
+	if err != nil {
+		return nil, err
+	}
+	frames, _, err := readOggOpus(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("reading the output of %s: %w", c.argv[0], err)
+	}
+	return frames, nil
+}
+
+// runCommand runs argv with stdin and the extra environment variables env
+// and returns what it wrote to stdout, failing when that exceeds limit bytes
+// or the run takes longer than timeout. stderr ends up in the error. A
+// command writing more than limit is killed right away.
+func runCommand(ctx context.Context, argv []string, stdin io.Reader, env []string, timeout time.Duration, limit int) ([]byte, error) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	// Children of a killed shell may hold its output open; do not wait for
+	// them.
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = stdin
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %s: %w", argv[0], err)
+	}
+	out, readErr := io.ReadAll(io.LimitReader(stdout, int64(limit)+1))
+	if len(out) > limit {
+		cancel()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("%s wrote more than %d bytes", argv[0], limit)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", argv[0], err, strings.TrimSpace(stderr.String()))
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return out, nil
+}
+
+// silenceSynthesizer renders one silent frame per character, which keeps the
+// voice pipeline busy for a realistic time without a speech engine.
+type silenceSynthesizer struct{}
+
+func (silenceSynthesizer) Synthesize(_ context.Context, text string) ([][]byte, error) {
+	frames := make([][]byte, len([]rune(text)))
+	for i := range frames {
+		frames[i] = opusSilence
+	}
+	return frames, nil
+}
+
+// cachedSynthesizer keeps the most recently rendered phrases so repeated
+// phrases do not run the engine again.
+type cachedSynthesizer struct {
+	next Synthesizer
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // of *cachedPhrase, most recent first
+	phrases map[string]*list.Element
+}
+
+type cachedPhrase struct {
+	text   string
+	frames [][]byte
+}
+
+func newCachedSynthesizer(next Synthesizer, size int) *cachedSynthesizer {
+	return &cachedSynthesizer{
+		next:    next,
+		size:    size,
+		order:   list.New(),
+		phrases: make(map[string]*list.Element),
+	}
+}
+
+func (c *cachedSynthesizer) Synthesize(ctx context.Context, text string) ([][]byte, error) {
+	c.mu.Lock()
+	if e, ok := c.phrases[text]; ok {
+		c.order.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*cachedPhrase).frames, nil
+	}
+	c.mu.Unlock()
+
+	frames, err := c.next.Synthesize(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.phrases[text]; !ok && c.size > 0 {
+		c.phrases[text] = c.order.PushFront(&cachedPhrase{text: text, frames: frames})
+		for c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.phrases, oldest.Value.(*cachedPhrase).text)
+		}
+	}
+	return frames, nil
+}
+
+// speechEngine is the synthesizer built from the tts config together with
+// that config.
+type speechEngine struct {
+	conf  cfg.TTSConfig
+	synth Synthesizer
+}
+
+// speech holds the engine of the running config; it is nil while text to
+// speech is off.
+var speech atomic.Pointer[speechEngine]
+
+// newSynthesizer builds the backend selected by c, wrapped in its cache.
+func newSynthesizer(c cfg.TTSConfig) (Synthesizer, error) {
+	var synth Synthesizer
+	switch c.Backend {
+	case "command":
+		synth = commandSynthesizer{argv: c.Command, timeout: c.RunTimeout()}
+	case "silence":
+		synth = silenceSynthesizer{}
+	default:
+		return nil, fmt.Errorf("unknown tts backend %q", c.Backend)
+	}
+	return newCachedSynthesizer(synth, c.CacheSize), nil
+}
+
+// setSpeech applies the tts config. The engine and its cache are only
+// rebuilt when the config changed.
+func setSpeech(c cfg.TTSConfig) error {
+	if !c.Enabled() {
+		speech.Store(nil)
+		return nil
+	}
+	if cur := speech.Load(); cur != nil && reflect.DeepEqual(cur.conf, c) {
+		return nil
+	}
+	synth, err := newSynthesizer(c)
+	if err != nil {
+		return err
+	}
+	speech.Store(&speechEngine{conf: c, synth: synth})
+	return nil
+}
+
+// errSpeechTooLong is returned for text longer than tts.max_length.
+var errSpeechTooLong = errors.New("text too long")
+
+// render turns text into a sound clip named after it.
+func (e *speechEngine) render(ctx context.Context, text string) (*soundClip, error) {
+	text = strings.Join(strings.Fields(text), " ")
+	if limit := e.conf.MaxLength; limit > 0 && len([]rune(text)) > limit {
+		return nil, errSpeechTooLong
+	}
+	frames, err := e.synth.Synthesize(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("the speech engine rendered nothing")
+	}
+	if len(frames) > maxSpeechFrames {
+		return nil, fmt.Errorf("the rendered speech is longer than %d frames", maxSpeechFrames)
+	}
+	return &soundClip{Name: speechLabel(text), buffer: frames}, nil
+}
+
+// maxSpeechLabel is how many characters of the text name a spoken clip.
+const maxSpeechLabel = 40
+
+// speechLabel shortens text to name the clip in queues and statistics.
+func speechLabel(text string) string {
+	if r := []rune(text); len(r) > maxSpeechLabel {
+		return string(r[:maxSpeechLabel-1]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,174 @@
+package gidbig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/toksikk/gidbig/internal/cfg"
+)
+
+// countingSynthesizer renders one silent frame per phrase and counts the
+// phrases it was asked for.
+type countingSynthesizer struct {
+	calls []string
+	err   error
+}
+
+func (c *countingSynthesizer) Synthesize(_ context.Context, text string) ([][]byte, error) {
+	c.calls = append(c.calls, text)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return [][]byte{opusSilence}, nil
+}
+
+// useSpeech installs the engine built from c for the test.
+func useSpeech(t *testing.T, c cfg.TTSConfig) {
+	t.Helper()
+	orig := speech.Load()
+	speech.Store(nil)
+	if err := setSpeech(c); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { speech.Store(orig) })
+}
+
+func TestSilenceSynthesizer(t *testing.T) {
+	frames, err := silenceSynthesizer{}.Synthesize(context.Background(), "hallö")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 5 {
+		t.Fatalf("got %d frames, want one per character", len(frames))
+	}
+	for i, f := range frames {
+		if string(f) != string(opusSilence) {
+			t.Errorf("frame %d = %x, want silence", i, f)
+		}
+	}
+}
+
+func TestCachedSynthesizer(t *testing.T) {
+	next := &countingSynthesizer{}
+	c := newCachedSynthesizer(next, 2)
+	ctx := context.Background()
+	for _, text := range []string{"one", "two", "one", "three", "one", "two"} {
+		if _, err := c.Synthesize(ctx, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "two" is evicted by "three" because "one" was used more recently.
+	want := []string{"one", "two", "three", "two"}
+	if strings.Join(next.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("rendered %v, want %v", next.calls, want)
+	}
+
+	next.err = errors.New("engine down")
+	if _, err := c.Synthesize(ctx, "four"); err == nil {
+		t.Fatal("expected the engine error")
+	}
+	next.err = nil
+	if _, err := c.Synthesize(ctx, "four"); err != nil {
+		t.Fatal(err)
+	}
+	if got := next.calls[len(next.calls)-1]; got != "four" || len(next.calls) != 6 {
+		t.Errorf("calls = %v, want failed phrases rendered again", next.calls)
+	}
+}
+
+func TestCommandSynthesizer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "speech.opus")
+	if err := os.WriteFile(path, oggOpusBytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	frames, err := commandSynthesizer{argv: []string{"sh", "-c", `cat >/dev/null; cat "$0"`, path}}.Synthesize(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Errorf("got %d frames, want the 3 of the file", len(frames))
+	}
+
+	_, err = commandSynthesizer{argv: []string{"sh", "-c", "echo no voice >&2; exit 3"}}.Synthesize(context.Background(), "hello")
+	if err == nil || !strings.Contains(err.Error(), "no voice") {
+		t.Errorf("failing command: err = %v, want stderr included", err)
+	}
+	_, err = commandSynthesizer{argv: []string{"echo", "not opus"}}.Synthesize(context.Background(), "hello")
+	if err == nil {
+		t.Error("expected an error for output that is not Ogg Opus")
+	}
+}
+
+func TestRunCommand_outputLimit(t *testing.T) {
+	for _, argv := range [][]string{{"yes"}, {"sh", "-c", "yes; echo unreachable"}} {
+		start := time.Now()
+		_, err := runCommand(context.Background(), argv, nil, nil, 20*time.Second, 1<<10)
+		if err == nil || !strings.Contains(err.Error(), "wrote more than 1024 bytes") {
+			t.Errorf("%v: err = %v, want the output limit", argv, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%v: took %s, want the command killed at the limit", argv, elapsed)
+		}
+	}
+}
+
+func TestSetSpeech(t *testing.T) {
+	useSpeech(t, cfg.TTSConfig{})
+	if speech.Load() != nil {
+		t.Fatal("engine set without a backend")
+	}
+
+	c := cfg.TTSConfig{Backend: "silence", MaxLength: 10, CacheSize: 4}
+	if err := setSpeech(c); err != nil {
+		t.Fatal(err)
+	}
+	first := speech.Load()
+	if first == nil {
+		t.Fatal("no engine for the silence backend")
+	}
+	if err := setSpeech(c); err != nil || speech.Load() != first {
+		t.Error("unchanged config rebuilt the engine and dropped its cache")
+	}
+	c.MaxLength = 20
+	if err := setSpeech(c); err != nil || speech.Load() == first {
+		t.Error("changed config kept the old engine")
+	}
+	if err := setSpeech(cfg.TTSConfig{Backend: "robot"}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+	if err := setSpeech(cfg.TTSConfig{}); err != nil || speech.Load() != nil {
+		t.Error("empty backend did not turn speech off")
+	}
+}
+
+func TestSpeechEngineRender(t *testing.T) {
+	e := &speechEngine{conf: cfg.TTSConfig{MaxLength: 50}, synth: silenceSynthesizer{}}
+	clip, err := e.render(context.Background(), "  hello \n  there  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.Name != "hello there" || len(clip.buffer) != len("hello there") {
+		t.Errorf("clip = %q with %d frames, want the normalized text", clip.Name, len(clip.buffer))
+	}
+	if _, err := e.render(context.Background(), strings.Repeat("a", 51)); !errors.Is(err, errSpeechTooLong) {
+		t.Errorf("render of 51 characters: err = %v, want too long", err)
+	}
+	if _, err := e.render(context.Background(), "   "); err == nil {
+		t.Error("expected an error for nothing rendered")
+	}
+
+	e.conf.MaxLength = 0
+	long := strings.Repeat("a", 60)
+	clip, err = e.render(context.Background(), long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := []rune(clip.Name); len(r) != maxSpeechLabel || r[len(r)-1] != '…' {
+		t.Errorf("label = %q, want it shortened to %d characters", clip.Name, maxSpeechLabel)
+	}
+}
@@ -0,0 +1,270 @@
+package gidbig
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// csrfHeader carries the CSRF token of the session on requests made by
+	// the scripts of the web UI.
+	csrfHeader = "X-CSRF-Token"
+
+	// csrfField carries the CSRF token in plain HTML forms.
+	csrfField = "csrf_token"
+)
+
+// nonceKey is the request context key of the CSP nonce.
+type nonceKey struct{}
+
+func randomToken(size int) string {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms.
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// csrfToken returns the CSRF token of session, giving sessions from before
+// tokens were issued one.
+func csrfToken(w http.ResponseWriter, session *sessionData) string {
+	if session.CSRFToken == "" {
+		session.CSRFToken = randomToken(32)
+		if err := store.Save(w, session); err != nil {
+			slog.Error("unable to Save", "error", err)
+		}
+	}
+	return session.CSRFToken
+}
+
+// validCSRF reports whether r carries the CSRF token of session in the
+// X-CSRF-Token header or, for url-encoded forms, the csrf_token field.
+func validCSRF(r *http.Request, session *sessionData) bool {
+	if session.CSRFToken == "" {
+		return false
+	}
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		// Only url-encoded forms are parsed here; uploads set their own
+		// size limit before reading the body.
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+			token = r.PostFormValue(csrfField)
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) == 1
+}
+
+// safeMethod reports whether requests with method change nothing.
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// sessionUser returns the logged-in user of a request made with the session
+// cookie. A request that changes something must carry the CSRF token of the
+// session. It writes the error response itself when the request is refused.
+func sessionUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	session := store.Get(r)
+	if session.DiscordUserID == "" {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Not logged in.")
+		return "", false
+	}
+	if !safeMethod(r.Method) && !validCSRF(r, session) {
+		slog.Warn("request without a valid CSRF token", "method", r.Method, "path", r.URL.Path, "user", session.DiscordUserID)
+		writeJSONError(w, http.StatusForbidden, "csrf_failed", "The request did not carry a valid CSRF token, reload the page.")
+		return "", false
+	}
+	return session.DiscordUserID, true
+}
+
+// rateBucket is the token bucket of one client.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter allows each key perMinute requests a minute, which may come
+// in a burst.
+type rateLimiter struct {
+	perMinute int
+
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	swept   time.Time
+}
+
+// newRateLimiter returns a limiter of perMinute requests a minute, nil when
+// perMinute turns it off. A nil limiter allows everything.
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{perMinute: perMinute, buckets: make(map[string]*rateBucket)}
+}
+
+// allow takes a request of key at now and returns how long to wait when key
+// has none left.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// A bucket refills within a minute, so one idle that long can go.
+	if now.Sub(l.swept) >= time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	full := float64(l.perMinute)
+	perSecond := full / 60
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &rateBucket{tokens: full, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(full, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// webLimits are the rate limits of the web server.
+type webLimits struct {
+	ip      *rateLimiter
+	session *rateLimiter
+}
+
+// clientAddress returns the anonymized address of the client of r, the key
+// of its per-address limit.
+func clientAddress(r *http.Request) string {
+	ip, _, _, err := parseIPPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	anonIP, err := ipAnonymizer.IPString(ip.String())
+	if err != nil {
+		return ip.String()
+	}
+	return anonIP
+}
+
+// clientSession returns the key of the per-session limit of r: its bearer
+// token or else its logged-in user, empty when it has neither.
+func clientSession(r *http.Request) string {
+	if scheme, secret, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return "token:" + hashAPIToken(strings.TrimSpace(secret))
+	}
+	if userID := store.Get(r).DiscordUserID; userID != "" {
+		return "user:" + userID
+	}
+	return ""
+}
+
+// limit refuses requests over the rate limits with 429. Static files and the
+// health check are not limited.
+func (l webLimits) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/static/") || r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+		addr := clientAddress(r)
+		if ok, wait := l.ip.allow(addr, now); !ok {
+			slog.Warn("WebUI rate limit reached", "limit", "ip", "Requesting IP", addr, "path", r.URL.Path)
+			tooManyRequests(w, r, wait)
+			return
+		}
+		if key := clientSession(r); key != "" {
+			if ok, wait := l.session.allow(key, now); !ok {
+				slog.Warn("WebUI rate limit reached", "limit", "session", "Requesting IP", addr, "path", r.URL.Path)
+				tooManyRequests(w, r, wait)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	message := fmt.Sprintf("Too many requests, try again in %s.", formatWait(time.Duration(seconds)*time.Second))
+	if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/playsound" {
+		writeJSONError(w, http.StatusTooManyRequests, "rate_limited", message)
+		return
+	}
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// contentSecurityPolicy allows the stylesheets, fonts and scripts the pages
+// load from their CDNs, and inline scripts only with nonce.
+func contentSecurityPolicy(nonce string) string {
+	return strings.Join([]string{
+		"default-src 'self'",
+		"script-src 'self' 'nonce-" + nonce + "' https://cdn.jsdelivr.net",
+		"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net https://fonts.googleapis.com",
+		"font-src 'self' https://fonts.gstatic.com",
+		"img-src 'self' data: https://cdn.discordapp.com",
+		"connect-src 'self'",
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}, "; ")
+}
+
+// securityHeaders sets the Content-Security-Policy and the other security
+// headers on every response. The CSP nonce of a request is in its context
+// for the templates, see cspNonce. hsts is set when the site is served over
+// HTTPS.
+func securityHeaders(next http.Handler, hsts bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := randomToken(16)
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy(nonce))
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "same-origin")
+		h.Set("Cross-Origin-Opener-Policy", "same-origin")
+		h.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
+		if hsts {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce)))
+	})
+}
+
+// cspNonce returns the nonce inline scripts of the page answering r need.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceKey{}).(string)
+	return nonce
+}
+
+// securePage fills in what the scripts and forms of a page for the
+// logged-in session need, and whether its sessions can be managed.
+func securePage(td *templateData, w http.ResponseWriter, r *http.Request, session *sessionData) {
+	td.Nonce = cspNonce(r)
+	td.CSRFToken = csrfToken(w, session)
+	_, td.ServerSessions = serverSessions()
+}
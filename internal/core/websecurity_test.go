@@ -0,0 +1,268 @@
+package gidbig
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if ok, _ := newRateLimiter(-1).allow("a", time.Now()); !ok {
+		t.Error("a limit turned off refused a request")
+	}
+
+	l := newRateLimiter(2)
+	now := time.Now()
+	for range 2 {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatal("request within the limit refused")
+		}
+	}
+	if ok, wait := l.allow("a", now); ok || wait != 30*time.Second {
+		t.Errorf("third request = %v, wait %v; want refused for 30s", ok, wait)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("another key shares the bucket")
+	}
+	if ok, _ := l.allow("a", now.Add(30*time.Second)); !ok {
+		t.Error("request after the wait refused")
+	}
+
+	l.allow("c", now.Add(2*time.Minute))
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets left, want the idle ones swept", len(l.buckets))
+	}
+}
+
+// testWebServer serves the routes of the web server behind its security
+// headers and limits.
+func testWebServer(t *testing.T, limits webLimits) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(securityHeaders(limits.limit(newWebMux()), true))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// send makes a request to srv, logged in as userID unless it is empty, and
+// does not follow redirects.
+func send(t *testing.T, srv *httptest.Server, req *http.Request, userID string) *http.Response {
+	t.Helper()
+	u, err := url.Parse(srv.URL + req.URL.RequestURI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.URL, req.Host, req.RequestURI = u, u.Host, ""
+	if userID != "" {
+		authed := authedRequest(t, req.Method, "/", userID, nil)
+		for _, c := range authed.Cookies() {
+			req.AddCookie(c)
+		}
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = res.Body.Close() })
+	return res
+}
+
+func errorCode(t *testing.T, res *http.Response) string {
+	t.Helper()
+	var body apiError
+	_ = json.NewDecoder(res.Body).Decode(&body)
+	return body.Error
+}
+
+func form(method, target string, values url.Values) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestWebServer_securityHeaders(t *testing.T) {
+	srv := testWebServer(t, webLimits{})
+	first := send(t, srv, httptest.NewRequest(http.MethodGet, "/health", nil), "")
+	second := send(t, srv, httptest.NewRequest(http.MethodGet, "/health", nil), "")
+
+	csp := first.Header.Get("Content-Security-Policy")
+	if !strings.Contains(csp, "script-src 'self' 'nonce-") || !strings.Contains(csp, "frame-ancestors 'none'") {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+	if csp == second.Header.Get("Content-Security-Policy") {
+		t.Error("two responses share a nonce")
+	}
+	for name, want := range map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "same-origin",
+		"Strict-Transport-Security": "max-age=31536000",
+	} {
+		if got := first.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWebServer_csrf(t *testing.T) {
+	db := useSoundStore(t)
+	testSoundSession(t, true)
+	srv := testWebServer(t, webLimits{})
+	withToken := func(req *http.Request, token string) *http.Request {
+		req.Header.Set(csrfHeader, token)
+		return req
+	}
+	play := url.Values{"command": {"!nope"}}
+
+	for _, c := range []struct {
+		name   string
+		req    *http.Request
+		userID string
+		status int
+		code   string
+	}{
+		{"play without a token", form(http.MethodPost, "/playsound", play), "user-1", http.StatusForbidden, "csrf_failed"},
+		{"play with a wrong token", withToken(form(http.MethodPost, "/playsound", play), "guess"), "user-1", http.StatusForbidden, "csrf_failed"},
+		{"play with the token", withToken(form(http.MethodPost, "/playsound", play), testCSRFToken), "user-1", http.StatusNotFound, "unknown_collection"},
+		{"play with the form field", form(http.MethodPost, "/playsound", url.Values{"command": {"!nope"}, csrfField: {testCSRFToken}}), "user-1", http.StatusNotFound, "unknown_collection"},
+		{"play by GET", httptest.NewRequest(http.MethodGet, "/playsound?command=!nope", nil), "user-1", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"skip without a token", form(http.MethodPost, "/api/queue/skip", url.Values{"guild_id": {"guild-1"}}), "user-1", http.StatusForbidden, "csrf_failed"},
+		{"skip with the token", withToken(form(http.MethodPost, "/api/queue/skip", url.Values{"guild_id": {"guild-1"}}), testCSRFToken), "user-1", http.StatusOK, ""},
+		{"sound change without a token", form(http.MethodPost, "/api/sounds/delete", nil), "user-1", http.StatusForbidden, "csrf_failed"},
+		{"API play without a token", httptest.NewRequest(http.MethodPost, "/api/v1/play", strings.NewReader(`{"collection":"nope"}`)), "user-1", http.StatusForbidden, "csrf_failed"},
+		{"token creation without a token", form(http.MethodPost, "/api/tokens/create", url.Values{"name": {"x"}, "scope": {scopeAdmin}}), "user-1", http.StatusForbidden, "csrf_failed"},
+		{"queue read without a token", httptest.NewRequest(http.MethodGet, "/api/queue", nil), "user-1", http.StatusOK, ""},
+	} {
+		res := send(t, srv, c.req, c.userID)
+		if code := errorCode(t, res); res.StatusCode != c.status || code != c.code {
+			t.Errorf("%s: got %d %q, want %d %q", c.name, res.StatusCode, code, c.status, c.code)
+		}
+	}
+
+	// Bearer tokens are not sent by browsers on their own and need no CSRF
+	// token.
+	_, secret, err := createAPIToken("user-1", "deck", []string{scopePlay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := form(http.MethodPost, "/api/queue/skip", url.Values{"guild_id": {"guild-1"}})
+	req.Header.Set("Authorization", "Bearer "+secret)
+	if res := send(t, srv, req, ""); res.StatusCode != http.StatusOK {
+		t.Errorf("skip with a bearer token = %d", res.StatusCode)
+	}
+	var tokens int64
+	if err := db.Model(&APIToken{}).Count(&tokens).Error; err != nil || tokens != 1 {
+		t.Errorf("%d tokens, %v; want the forged creation refused", tokens, err)
+	}
+}
+
+func TestWebServer_logout(t *testing.T) {
+	srv := testWebServer(t, webLimits{})
+	if res := send(t, srv, httptest.NewRequest(http.MethodGet, "/logout", nil), "user-1"); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("logout by GET = %d", res.StatusCode)
+	}
+	if res := send(t, srv, form(http.MethodPost, "/logout", nil), "user-1"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("logout without a token = %d", res.StatusCode)
+	}
+	res := send(t, srv, form(http.MethodPost, "/logout", url.Values{csrfField: {testCSRFToken}}), "user-1")
+	cleared := false
+	for _, c := range res.Cookies() {
+		cleared = cleared || c.Name == sessionCookieName && c.MaxAge < 0
+	}
+	if res.StatusCode != http.StatusFound || !cleared {
+		t.Errorf("logout = %d, session cleared %v", res.StatusCode, cleared)
+	}
+}
+
+func TestWebServer_esoNeedsLogin(t *testing.T) {
+	previous := esoMod
+	esoMod = nil
+	t.Cleanup(func() { esoMod = previous })
+	srv := testWebServer(t, webLimits{})
+
+	if res := send(t, srv, httptest.NewRequest(http.MethodGet, "/api/eso", nil), ""); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous = %d, want 401", res.StatusCode)
+	}
+	if res := send(t, srv, httptest.NewRequest(http.MethodPost, "/api/eso", nil), "user-1"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("POST without a CSRF token = %d, want 403", res.StatusCode)
+	}
+	// Past the login the module answers, here that it is not running.
+	if res := send(t, srv, httptest.NewRequest(http.MethodGet, "/api/eso", nil), "user-1"); res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("logged in = %d, want 503", res.StatusCode)
+	}
+}
+
+func TestWebServer_rateLimits(t *testing.T) {
+	srv := testWebServer(t, webLimits{ip: newRateLimiter(3)})
+	for range 3 {
+		send(t, srv, httptest.NewRequest(http.MethodGet, "/api/queue", nil), "")
+	}
+	res := send(t, srv, httptest.NewRequest(http.MethodGet, "/api/queue", nil), "")
+	if code := errorCode(t, res); res.StatusCode != http.StatusTooManyRequests || code != "rate_limited" || res.Header.Get("Retry-After") != "20" {
+		t.Errorf("request over the limit = %d %q, Retry-After %q", res.StatusCode, code, res.Header.Get("Retry-After"))
+	}
+	if res.Header.Get("Content-Security-Policy") == "" {
+		t.Error("refusal without security headers")
+	}
+	if res := send(t, srv, httptest.NewRequest(http.MethodGet, "/stats", nil), ""); res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Content-Type") == "application/json" {
+		t.Errorf("page over the limit = %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	if res := send(t, srv, httptest.NewRequest(http.MethodGet, "/health", nil), ""); res.StatusCode != http.StatusOK {
+		t.Errorf("health check = %d, want it unlimited", res.StatusCode)
+	}
+
+	testSoundSession(t, false)
+	srv = testWebServer(t, webLimits{session: newRateLimiter(1)})
+	send(t, srv, httptest.NewRequest(http.MethodGet, "/api/queue", nil), "user-1")
+	if res := send(t, srv, httptest.NewRequest(http.MethodGet, "/api/queue", nil), "user-1"); res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second request of user-1 = %d, want 429", res.StatusCode)
+	}
+	if res := send(t, srv, httptest.NewRequest(http.MethodGet, "/api/queue", nil), "user-2"); res.StatusCode != http.StatusOK {
+		t.Errorf("first request of user-2 = %d, want 200", res.StatusCode)
+	}
+}
+
+func TestSecurePage(t *testing.T) {
+	tmpl := template.Must(template.ParseFiles("../../web/templates/internal.html",
+		"../../web/templates/header.html", "../../web/templates/footer.html"))
+	store = newSessionStore("test-secret")
+	w := httptest.NewRecorder()
+	var served *http.Request
+	securityHeaders(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { served = r }), false).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// A session from before CSRF tokens gets one.
+	session := &sessionData{DiscordUserID: "user-1", DiscordUsername: "Alice"}
+	td := templateData{Username: session.DiscordUsername}
+	securePage(&td, w, served, session)
+	if td.CSRFToken == "" || td.CSRFToken != session.CSRFToken || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("CSRF token %q not saved to the session", td.CSRFToken)
+	}
+	if !strings.Contains(w.Header().Get("Content-Security-Policy"), "'nonce-"+td.Nonce+"'") {
+		t.Errorf("nonce %q is not the one of the CSP", td.Nonce)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&b, "header", td); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	page := b.String()
+	for _, want := range []string{
+		`<meta name="csrf-token" content="` + td.CSRFToken + `">`,
+		`<script nonce="` + td.Nonce + `">`,
+		`name="csrf_token" value="` + td.CSRFToken + `"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %s", want)
+		}
+	}
+	if strings.Contains(page, "onclick=") {
+		t.Error("page has an inline event handler the CSP blocks")
+	}
+}
@@ -14,11 +14,16 @@ import (
 	"html/template"
 	"io"
 	"log/slog"
+	"maps"
+	"math"
 	"mime"
 	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
@@ -40,18 +45,34 @@ type sessionData struct {
 	DiscordUsername  string `json:"discordUsername,omitempty"`
 	DiscordAvatarURL string `json:"discordAvatarURL,omitempty"`
 	AccessToken      string `json:"accessToken,omitempty"`
+	CSRFToken        string `json:"csrfToken,omitempty"`
+
+	// id is the key of a session kept in the database, empty in cookies.
+	id string
+}
+
+// sessionStore keeps the login sessions of the web UI.
+type sessionStore interface {
+	// Get returns the session of r, an empty one when it has none.
+	Get(r *http.Request) *sessionData
+	// Save stores data and sets the cookie naming it.
+	Save(w http.ResponseWriter, data *sessionData) error
+	// Clear ends the session data and removes its cookie.
+	Clear(w http.ResponseWriter, data *sessionData)
 }
 
-type sessionStore struct {
+// cookieStore keeps the whole session encrypted in the cookie. It cannot
+// end a session before the browser drops the cookie.
+type cookieStore struct {
 	secret []byte
 }
 
-func newSessionStore(secret string) *sessionStore {
+func newSessionStore(secret string) *cookieStore {
 	key := sha256.Sum256([]byte(secret))
-	return &sessionStore{secret: key[:]}
+	return &cookieStore{secret: key[:]}
 }
 
-func (s *sessionStore) Get(r *http.Request) *sessionData {
+func (s *cookieStore) Get(r *http.Request) *sessionData {
 	cookie, err := r.Cookie(sessionCookieName)
 	if err != nil || cookie.Value == "" {
 		return &sessionData{}
@@ -63,7 +84,7 @@ func (s *sessionStore) Get(r *http.Request) *sessionData {
 	return data
 }
 
-func (s *sessionStore) Save(w http.ResponseWriter, data *sessionData) error {
+func (s *cookieStore) Save(w http.ResponseWriter, data *sessionData) error {
 	encoded, err := s.encrypt(data)
 	if err != nil {
 		return err
@@ -78,7 +99,11 @@ func (s *sessionStore) Save(w http.ResponseWriter, data *sessionData) error {
 	return nil
 }
 
-func (s *sessionStore) Clear(w http.ResponseWriter) {
+func (s *cookieStore) Clear(w http.ResponseWriter, _ *sessionData) {
+	clearSessionCookie(w)
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     sessionCookieName,
 		Value:    "",
@@ -89,7 +114,7 @@ func (s *sessionStore) Clear(w http.ResponseWriter) {
 	})
 }
 
-func (s *sessionStore) encrypt(data *sessionData) (string, error) {
+func (s *cookieStore) encrypt(data *sessionData) (string, error) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return "", err
@@ -110,7 +135,7 @@ func (s *sessionStore) encrypt(data *sessionData) (string, error) {
 	return base64.URLEncoding.EncodeToString(ciphertext), nil
 }
 
-func (s *sessionStore) decrypt(cookieValue string) (*sessionData, error) {
+func (s *cookieStore) decrypt(cookieValue string) (*sessionData, error) {
 	ciphertext, err := base64.URLEncoding.DecodeString(cookieValue)
 	if err != nil {
 		return nil, err
@@ -155,7 +180,7 @@ var (
 	}
 	tmpls = map[string]*template.Template{}
 
-	store *sessionStore
+	store sessionStore
 
 	ipAnonymizer = ipanonymizer.NewWithMask(
 		net.CIDRMask(16, 32),
@@ -167,6 +192,10 @@ var (
 func startWebServer(config *cfg.Config) {
 	tmpls["home.html"] = template.Must(template.ParseFiles(templateDir+"home.html", header, footer))
 	tmpls["internal.html"] = template.Must(template.ParseFiles(templateDir+"internal.html", header, footer))
+	tmpls["soundstats.html"] = template.Must(template.ParseFiles(templateDir+"soundstats.html", header, footer))
+	tmpls["soundmanage.html"] = template.Must(template.ParseFiles(templateDir+"soundmanage.html", header, footer))
+	tmpls["apitokens.html"] = template.Must(template.ParseFiles(templateDir+"apitokens.html", header, footer))
+	tmpls["sessions.html"] = template.Must(template.ParseFiles(templateDir+"sessions.html", header, footer))
 	tmpls["item.html"] = template.Must(template.ParseFiles(templateDir + "item.html"))
 	tmpls["itemrowstart.html"] = template.Must(template.ParseFiles(templateDir + "itemrowstart.html"))
 	tmpls["itemrowend.html"] = template.Must(template.ParseFiles(templateDir + "itemrowend.html"))
@@ -174,31 +203,66 @@ func startWebServer(config *cfg.Config) {
 	tmpls["collwrapend.html"] = template.Must(template.ParseFiles(templateDir + "collwrapend.html"))
 
 	store = newSessionStore(config.Web.SessionSecret)
+	if sessions := config.Web.Sessions; sessions.ServerSide() {
+		if getSoundDB() != nil {
+			store = &dbSessionStore{idle: sessions.Idle(), absolute: sessions.Absolute()}
+		} else {
+			slog.Error("No database for web.sessions.store sqlite, keeping sessions in cookies")
+		}
+	}
 
 	discordOauthConfig.ClientID = config.Web.Oauth.ClientID
 	discordOauthConfig.ClientSecret = config.Web.Oauth.ClientSecret
 	discordOauthConfig.RedirectURL = config.Web.Oauth.RedirectURI + "/discordCallback"
 
+	limits := webLimits{
+		ip:      newRateLimiter(config.Web.RateLimit.IP),
+		session: newRateLimiter(config.Web.RateLimit.Session),
+	}
+	hsts := strings.HasPrefix(config.Web.Oauth.RedirectURI, "https://")
+	handler := securityHeaders(limits.limit(newWebMux()), hsts)
+
+	err := http.ListenAndServe(":"+strconv.Itoa(config.Web.Port), handler)
+	if err != nil {
+		slog.Error("could not start webserver", "error", err)
+		os.Exit(1)
+	}
+}
+
+// newWebMux routes the pages and endpoints of the web server.
+func newWebMux() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", handleMain)
 	mux.HandleFunc("/logout", handleLogout)
 	mux.HandleFunc("/discordLogin", handleDiscordLogin)
 	mux.HandleFunc("/discordCallback", handleDiscordCallback)
 	mux.HandleFunc("/playsound", handlePlaySound)
+	mux.HandleFunc("/stats", handleStats)
+	mux.HandleFunc("/sounds", handleSoundManage)
+	mux.HandleFunc("/tokens", handleTokens)
+	mux.HandleFunc("/api/tokens/create", handleAPITokensCreate)
+	mux.HandleFunc("/api/tokens/revoke", handleAPITokensRevoke)
+	mux.HandleFunc("/sessions", handleSessions)
+	mux.HandleFunc("/api/sessions/revoke", handleAPISessionsRevoke)
+	mux.HandleFunc("/api/sessions/revoke-all", handleAPISessionsRevokeAll)
+	mux.HandleFunc("/api/sounds/upload", handleAPISoundsUpload)
+	mux.HandleFunc("/api/sounds/describe", handleAPISoundsDescribe)
+	mux.HandleFunc("/api/sounds/rename", handleAPISoundsRename)
+	mux.HandleFunc("/api/sounds/delete", handleAPISoundsDelete)
+	mux.HandleFunc("/api/sounds/weight", handleAPISoundsWeight)
 	mux.HandleFunc("/api/queue", handleAPIQueue)
+	mux.HandleFunc("/api/queue/skip", handleAPIQueueSkip)
+	mux.HandleFunc("/api/queue/stop", handleAPIQueueStop)
+	mux.HandleFunc("/api/events", handleAPIEvents)
 	mux.HandleFunc("/api/eso", handleAPIEso)
+	mux.Handle("/api/v1/", apiV1Handler())
 	mux.HandleFunc("/health", handleHealth)
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
-
-	err := http.ListenAndServe(":"+strconv.Itoa(config.Web.Port), mux)
-	if err != nil {
-		slog.Error("could not start webserver", "error", err)
-		os.Exit(1)
-	}
+	return mux
 }
 
 func readSoundDescription(prefix, name string) (text, shortText string, ok bool) {
-	file, err := os.Open(fmt.Sprintf("audio/%v_%v.txt", prefix, name))
+	file, err := os.Open(fmt.Sprintf("%s/%v_%v.txt", audioDir, prefix, name))
 	if err != nil {
 		return "", "", false
 	}
@@ -206,29 +270,58 @@ func readSoundDescription(prefix, name string) (text, shortText string, ok bool)
 	scanner := bufio.NewScanner(file)
 	scanner.Scan()
 	text = scanner.Text()
-	shortText = text
+	return text, shortDescription(text), true
+}
+
+// shortDescription cuts text to the length shown on a sound button.
+func shortDescription(text string) string {
 	if len(text) > 20 {
-		shortText = text[0:20] + "..."
+		return text[0:20] + "..."
 	}
-	return text, shortText, true
+	return text
 }
 
 func handlePlaySound(w http.ResponseWriter, r *http.Request) {
 	slog.Info("WebUI /playsound Request", "Requesting IP", r.RemoteAddr)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use POST.")
+		return
+	}
 	err := r.ParseForm()
 	if err != nil {
 		slog.Error("could not ParseForm", "error", err)
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "Could not read the request.")
 		return
 	}
-	sound, soundCollection := findSoundAndCollection(r.FormValue("command"), r.FormValue("soundname"))
-	session := store.Get(r)
-	userID := session.DiscordUserID
-	if userID == "" {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	command := r.FormValue("command")
+	soundCollection := collectionByCommand(command)
+	if soundCollection == nil {
+		writePlayResult(w, enqueueResult{Status: enqueueUnknownCollection, Prefix: strings.TrimPrefix(command, "!")})
 		return
 	}
+	user, err := discord.User(userID)
+	if err != nil {
+		slog.Error("WebUI could not look up Discord user", "user", userID, "error", err)
+		writeJSONError(w, http.StatusBadGateway, "discord_unavailable", "Could not reach Discord, try again later.")
+		return
+	}
+	guild := voiceGuild(userID)
+	if guild == nil {
+		writePlayResult(w, enqueueResult{Status: enqueueNotInVoice, Prefix: soundCollection.Prefix})
+		return
+	}
+	writePlayResult(w, requestPlay(user, guild, soundCollection, r.FormValue("soundname"), sourceWeb))
+}
+
+// voiceGuild returns the guild userID is in a voice channel of, nil when the
+// user is in none.
+func voiceGuild(userID string) *discordgo.Guild {
 	var guild *discordgo.Guild
-	user, _ := discord.User(userID)
 	for _, g := range discord.State.Guilds {
 		for _, vs := range g.VoiceStates {
 			if vs.UserID == userID {
@@ -236,54 +329,222 @@ func handlePlaySound(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-	if user != nil && guild != nil && soundCollection != nil {
-		if sound != nil {
-			go enqueuePlay(user, guild, soundCollection, sound)
-		} else {
-			go enqueuePlay(user, guild, soundCollection, soundCollection.Random())
-		}
-		http.Error(w, http.StatusText(200), 200)
-	} else {
-		http.Error(w, http.StatusText(500), 500)
+	return guild
+}
+
+// playSoundResponse is the JSON body /playsound answers with.
+type playSoundResponse struct {
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	Sound    string `json:"sound,omitempty"`
+	Position int    `json:"position"`
+}
+
+// plainMessage drops the markdown from a message written for Discord.
+func plainMessage(message string) string {
+	return strings.ReplaceAll(message, "`", "")
+}
+
+func writePlayResult(w http.ResponseWriter, res enqueueResult) {
+	message := plainMessage(res.Message())
+	if res.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+	}
+	if res.Status != enqueueQueued {
+		writeJSONError(w, res.HTTPStatus(), res.Code(), message)
+		return
+	}
+	writeJSON(w, http.StatusOK, playSoundResponse{
+		Status:   res.Code(),
+		Message:  message,
+		Sound:    res.Play.Sound.Name,
+		Position: res.Position,
+	})
+}
+
+// apiError is the JSON body of every error answered by the web API.
+type apiError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError{Error: code, Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("could not encode JSON response", "error", err)
 	}
 }
 
 type guildQueueStatus struct {
-	GuildID     string `json:"guild_id"`
-	NowPlaying  string `json:"now_playing,omitempty"`
-	QueueLength int    `json:"queue_length"`
+	GuildID      string        `json:"guild_id"`
+	NowPlaying   string        `json:"now_playing,omitempty"`
+	NowPlayingBy string        `json:"now_playing_by,omitempty"`
+	QueueLength  int           `json:"queue_length"`
+	Queue        []queuedSound `json:"queue"`
+}
+
+// queuedSound is a play waiting in a guild queue.
+type queuedSound struct {
+	Prefix   string `json:"prefix"`
+	Sound    string `json:"sound"`
+	QueuedBy string `json:"queued_by"`
 }
 
 func handleAPIQueue(w http.ResponseWriter, r *http.Request) {
-	session := store.Get(r)
-	if session.DiscordUserID == "" {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	userID, ok := apiUser(w, r, scopePlay)
+	if !ok {
 		return
 	}
 
-	var guilds []guildQueueStatus
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"guilds": queueStatuses(userID)})
+}
+
+// queueStatuses returns the queues of the guilds with a player that userID is
+// a member of.
+func queueStatuses(userID string) []guildQueueStatus {
 	mutex.Lock()
-	for guildID, ch := range queues {
+	guildIDs := slices.Sorted(maps.Keys(players))
+	mutex.Unlock()
+
+	guilds := []guildQueueStatus{}
+	for _, guildID := range guildIDs {
+		// Only show who queued what to members of the guild
+		if !isGuildMember(guildID, userID) {
+			continue
+		}
+		current, pending := guildQueue(guildID)
 		gs := guildQueueStatus{
 			GuildID:     guildID,
-			QueueLength: len(ch),
+			QueueLength: len(pending),
+			Queue:       make([]queuedSound, 0, len(pending)),
 		}
-		if np, ok := nowPlaying[guildID]; ok && np != nil && np.Sound != nil {
-			gs.NowPlaying = np.Sound.Name
+		if current != nil && current.Sound != nil {
+			gs.NowPlaying = current.Sound.Name
+			gs.NowPlayingBy = current.Username
+		}
+		for _, p := range pending {
+			gs.Queue = append(gs.Queue, queuedSound{Prefix: p.Prefix, Sound: p.Sound.Name, QueuedBy: p.Username})
 		}
 		guilds = append(guilds, gs)
 	}
-	mutex.Unlock()
+	return guilds
+}
 
-	if guilds == nil {
-		guilds = []guildQueueStatus{}
+// webCollections returns the collections shown to userID in the web UI: those
+// available in every guild and those of the guilds the user shares with the
+// bot.
+func webCollections(userID string) []*soundCollection {
+	discord.State.RLock()
+	guilds := slices.Clone(discord.State.Guilds)
+	discord.State.RUnlock()
+	var shared []string
+	for _, g := range guilds {
+		if isGuildMember(g.ID, userID) {
+			shared = append(shared, g.ID)
+		}
 	}
+	var colls []*soundCollection
+	for _, c := range soundCollections() {
+		if len(c.Guilds) == 0 || slices.ContainsFunc(shared, c.availableIn) {
+			colls = append(colls, c)
+		}
+	}
+	return colls
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{"guilds": guilds})
+// isGuildMember reports whether userID is a member of guildID.
+func isGuildMember(guildID, userID string) bool {
+	_, err := lookupMember(guildID, userID)
+	return err == nil
+}
+
+// lookupMember returns the member userID of guildID, asking Discord when the
+// member is not in the state cache.
+func lookupMember(guildID, userID string) (*discordgo.Member, error) {
+	if m, err := discord.State.Member(guildID, userID); err == nil {
+		return m, nil
+	}
+	m, err := discord.GuildMember(guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+	m.GuildID = guildID
+	if err := discord.State.MemberAdd(m); err != nil {
+		slog.Debug("could not cache guild member", "guild", guildID, "user", userID, "error", err)
+	}
+	return m, nil
+}
+
+// queueControlResponse is the JSON body /api/queue/skip and /api/queue/stop
+// answer with.
+type queueControlResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Cleared int    `json:"cleared"`
+}
+
+// queueControlGuild checks a skip or stop request and returns the guild it
+// applies to. It writes the error response itself when the request is refused.
+func queueControlGuild(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use POST.")
+		return "", false
+	}
+	userID, ok := apiUser(w, r, scopePlay)
+	if !ok {
+		return "", false
+	}
+	guildID := r.FormValue("guild_id")
+	if guildID == "" {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "guild_id is required.")
+		return "", false
+	}
+	if !isGuildMember(guildID, userID) {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "You are not a member of this server.")
+		return "", false
+	}
+	slog.Info("WebUI queue control", "path", r.URL.Path, "user", userID, "guild", guildID)
+	return guildID, true
+}
+
+func handleAPIQueueSkip(w http.ResponseWriter, r *http.Request) {
+	guildID, ok := queueControlGuild(w, r)
+	if !ok {
+		return
+	}
+	skipped := skipSound(guildID)
+	res := queueControlResponse{Status: "skipped", Message: plainMessage(skipReply(skipped))}
+	if skipped == nil {
+		res.Status = "idle"
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func handleAPIQueueStop(w http.ResponseWriter, r *http.Request) {
+	guildID, ok := queueControlGuild(w, r)
+	if !ok {
+		return
+	}
+	cleared, stopped := stopSounds(guildID)
+	res := queueControlResponse{Status: "stopped", Message: plainMessage(stopReply(cleared, stopped)), Cleared: cleared}
+	if stopped == nil && cleared == 0 {
+		res.Status = "idle"
+	}
+	writeJSON(w, http.StatusOK, res)
 }
 
 func handleAPIEso(w http.ResponseWriter, r *http.Request) {
+	// Every request costs an LLM call.
+	if _, ok := apiUser(w, r, scopePlay); !ok {
+		return
+	}
 	if esoMod == nil {
 		handleAPIEsoWithGenerator(w, r, nil)
 		return
@@ -360,27 +621,36 @@ func handleMain(w http.ResponseWriter, r *http.Request) {
 
 		var prefixes []string
 		var si []soundItem
-		for _, sc := range COLLECTIONS {
+		for _, sc := range webCollections(session.DiscordUserID) {
+			collection := sc.Prefix
+			if sc.DisplayName != "" {
+				collection = sc.DisplayName
+			}
 			newSoundItemRandom := soundItem{
-				Itemprefix:    sc.Prefix,
-				Itemcommand:   "!" + sc.Prefix,
-				Itemsoundname: "",
-				Itemtext:      "random",
-				Itemshorttext: "random",
+				Itemprefix:     sc.Prefix,
+				Itemcollection: collection,
+				Itemcommand:    "!" + sc.Prefix,
+				Itemsoundname:  "",
+				Itemtext:       "random",
+				Itemshorttext:  "random",
+				Itemtags:       strings.Join(sc.Tags, " "),
 			}
 			prefixes = append(prefixes, sc.Prefix)
 			si = append(si, newSoundItemRandom)
 			for _, snd := range sc.Sounds {
 				newSoundItem := soundItem{
-					Itemprefix:    sc.Prefix,
-					Itemcommand:   "!" + sc.Prefix,
-					Itemsoundname: snd.Name,
-					Itemtext:      "!" + sc.Prefix + " " + snd.Name,
-					Itemshorttext: "!" + sc.Prefix + " " + snd.Name,
+					Itemprefix:      sc.Prefix,
+					Itemcollection:  collection,
+					Itemcommand:     "!" + sc.Prefix,
+					Itemsoundname:   snd.Name,
+					Itemdisplayname: snd.DisplayName,
+					Itemtext:        "!" + sc.Prefix + " " + snd.Name,
+					Itemshorttext:   "!" + sc.Prefix + " " + snd.Name,
+					Itemtags:        strings.Join(slices.Concat(sc.Tags, snd.Tags), " "),
 				}
-				if text, shortText, ok := readSoundDescription(sc.Prefix, snd.Name); ok {
-					newSoundItem.Itemtext = text
-					newSoundItem.Itemshorttext = shortText
+				if d := snd.description; d != nil {
+					newSoundItem.Itemtext = d.Text
+					newSoundItem.Itemshorttext = d.Short
 				}
 				si = append(si, newSoundItem)
 			}
@@ -390,7 +660,9 @@ func handleMain(w http.ResponseWriter, r *http.Request) {
 			Prefixes:  prefixes,
 			Username:  username,
 			AvatarURL: avatarURL,
+			Manage:    canManageSounds(session.DiscordUserID),
 		}
+		securePage(&td, w, r, session)
 
 		err := tmpls["internal.html"].ExecuteTemplate(w, "header", td)
 		if err != nil {
@@ -480,9 +752,523 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	logWebRequests(r)
+	session := store.Get(r)
+	if session.DiscordUserID == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	data := buildStatsPage(session.DiscordUserID, r.FormValue("guild"), r.FormValue("range"))
+	data.Username = session.DiscordUsername
+	data.AvatarURL = session.DiscordAvatarURL
+	data.Manage = canManageSounds(session.DiscordUserID)
+	securePage(&data.templateData, w, r, session)
+
+	if err := tmpls["soundstats.html"].ExecuteTemplate(w, "header", data); err != nil {
+		slog.Error("failed to execute template", "template", "soundstats.html/header", "error", err)
+		return
+	}
+	if err := tmpls["soundstats.html"].ExecuteTemplate(w, "footer", nil); err != nil {
+		slog.Error("failed to execute template", "template", "soundstats.html/footer", "error", err)
+	}
+}
+
+// buildStatsPage collects the statistics of guildID for userID, falling back
+// to the first guild the user shares with the bot.
+func buildStatsPage(userID, guildID, rangeKey string) statsPageData {
+	rng := findStatsRange(rangeKey)
+	data := statsPageData{RangeLabel: rng.Label}
+	for _, sr := range statsRanges {
+		data.Ranges = append(data.Ranges, statsOption{Value: sr.Key, Label: sr.Label, Selected: sr.Key == rng.Key})
+	}
+
+	discord.State.RLock()
+	guilds := slices.Clone(discord.State.Guilds)
+	discord.State.RUnlock()
+	slices.SortFunc(guilds, func(a, b *discordgo.Guild) int { return strings.Compare(a.Name, b.Name) })
+	for _, g := range guilds {
+		if isGuildMember(g.ID, userID) {
+			data.Guilds = append(data.Guilds, statsOption{Value: g.ID, Label: g.Name, Selected: g.ID == guildID})
+		}
+	}
+	if len(data.Guilds) == 0 {
+		return data
+	}
+	if !slices.ContainsFunc(data.Guilds, func(o statsOption) bool { return o.Selected }) {
+		data.Guilds[0].Selected = true
+		guildID = data.Guilds[0].Value
+	}
+
+	stats, err := loadSoundStats(guildID, rng.Since(time.Now()))
+	if err != nil {
+		slog.Error("could not load sound stats", "guild", guildID, "error", err)
+		data.Error = "Could not load the statistics, try again later."
+		return data
+	}
+	data.Stats = stats
+	for _, u := range stats.TopUsers {
+		data.TopUsers = append(data.TopUsers, statsUser{Name: memberName(guildID, u.UserID), Count: u.Count})
+	}
+	return data
+}
+
+// memberName returns how userID is shown in guildID, or the ID when the
+// member is not known.
+func memberName(guildID, userID string) string {
+	m, err := discord.State.Member(guildID, userID)
+	if err != nil || m.User == nil {
+		return userID
+	}
+	if m.Nick != "" {
+		return m.Nick
+	}
+	if name := m.User.DisplayName(); name != "" {
+		return name
+	}
+	return userID
+}
+
+// manageAuditShown is how many recent changes the management page lists.
+const manageAuditShown = 25
+
+// manageFormOverhead is the room left for the other form fields of an upload
+// on top of soundboard.max_upload_size.
+const manageFormOverhead = 64 << 10
+
+func handleSoundManage(w http.ResponseWriter, r *http.Request) {
+	logWebRequests(r)
+	session := store.Get(r)
+	if session.DiscordUserID == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	if !canManageSounds(session.DiscordUserID) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	data := buildManagePage(session.DiscordUserID)
+	data.Username = session.DiscordUsername
+	data.AvatarURL = session.DiscordAvatarURL
+	data.Manage = true
+	securePage(&data.templateData, w, r, session)
+
+	if err := tmpls["soundmanage.html"].ExecuteTemplate(w, "header", data); err != nil {
+		slog.Error("failed to execute template", "template", "soundmanage.html/header", "error", err)
+		return
+	}
+	if err := tmpls["soundmanage.html"].ExecuteTemplate(w, "footer", nil); err != nil {
+		slog.Error("failed to execute template", "template", "soundmanage.html/footer", "error", err)
+	}
+}
+
+// buildManagePage lists the sounds userID may change, the guilds a new
+// collection may be for, the upload limits and the recent changes to them.
+func buildManagePage(userID string) managePageData {
+	scope := soundManagerScope(userID)
+	policy := currentSoundPolicy()
+	data := managePageData{Formats: strings.Join(slices.Sorted(maps.Keys(soundFormats)), ",")}
+	if scope.all {
+		data.Guilds = append(data.Guilds, statsOption{Value: "", Label: "Every server", Selected: true})
+	}
+	discord.State.RLock()
+	guilds := slices.Clone(discord.State.Guilds)
+	discord.State.RUnlock()
+	for _, g := range guilds {
+		if scope.all || slices.Contains(scope.guilds, g.ID) {
+			data.Guilds = append(data.Guilds, statsOption{Value: g.ID, Label: g.Name})
+		}
+	}
+	if policy.MaxUploadSize > 0 {
+		data.MaxSize = fmt.Sprintf("%d KiB", policy.MaxUploadSize>>10)
+	}
+	if limit := policy.UploadLength(); limit > 0 {
+		data.MaxLength = formatWait(limit)
+	}
+	for _, sc := range soundCollections() {
+		if !scope.allows(sc) {
+			continue
+		}
+		data.Prefixes = append(data.Prefixes, sc.Prefix)
+		for n, snd := range sc.Sounds {
+			text, _, _ := readSoundDescription(sc.Prefix, snd.Name)
+			data.Sounds = append(data.Sounds, manageSound{Prefix: sc.Prefix, Name: snd.Name, Description: text, Weight: snd.Weight, First: n == 0})
+		}
+	}
+
+	entries, err := recentAudit(manageAuditShown)
+	if err != nil {
+		slog.Error("could not load sound changes", "error", err)
+		data.Error = "Could not load the recent changes."
+		return data
+	}
+	for _, e := range entries {
+		if !scope.allows(collectionByCommand(e.Collection)) {
+			continue
+		}
+		data.Audit = append(data.Audit, manageAudit{
+			When:    e.CreatedAt.Format("2006-01-02 15:04"),
+			User:    userName(e.UserID),
+			Action:  e.Action,
+			Command: "!" + e.Collection + " " + e.Sound,
+			Detail:  e.Detail,
+		})
+	}
+	return data
+}
+
+// userName returns how userID is shown in the first guild that knows the
+// user, or the ID.
+func userName(userID string) string {
+	discord.State.RLock()
+	guilds := slices.Clone(discord.State.Guilds)
+	discord.State.RUnlock()
+	for _, g := range guilds {
+		if name := memberName(g.ID, userID); name != userID {
+			return name
+		}
+	}
+	return userID
+}
+
+// manageResponse is the JSON body the /api/sounds endpoints answer with.
+type manageResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// soundManager checks a request changing sounds and returns the user making
+// it. It writes the error response itself when the request is refused.
+func soundManager(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use POST.")
+		return "", false
+	}
+	userID, ok := apiUser(w, r, scopeAdmin)
+	if !ok {
+		return "", false
+	}
+	if !canManageSounds(userID) {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "You may not manage sounds.")
+		return "", false
+	}
+	slog.Info("WebUI sound change", "path", r.URL.Path, "user", userID)
+	return userID, true
+}
+
+func writeManageResult(w http.ResponseWriter, err error, message string) {
+	var refused *manageError
+	switch {
+	case errors.As(err, &refused):
+		writeJSONError(w, refused.status, refused.code, plainMessage(refused.message))
+	case err != nil:
+		slog.Error("could not change sound", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Could not change the sound, try again later.")
+	default:
+		writeJSON(w, http.StatusOK, manageResponse{Status: "ok", Message: plainMessage(message)})
+	}
+}
+
+func handleAPISoundsUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := soundManager(w, r)
+	if !ok {
+		return
+	}
+	limit := currentSoundPolicy().MaxUploadSize
+	if limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(limit)+manageFormOverhead)
+	}
+	file, header, err := r.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeManageResult(w, uploadTooLarge(limit), "")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "file is required.")
+		return
+	}
+	defer func() { _ = file.Close() }()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "Could not read the file.")
+		return
+	}
+	prefix, name := r.FormValue("collection"), r.FormValue("name")
+	err = uploadSound(userID, r.FormValue("guild_id"), prefix, name, header.Filename, data, r.FormValue("description"))
+	writeManageResult(w, err, fmt.Sprintf("Added `!%s %s`.", prefix, name))
+}
+
+func handleAPISoundsDescribe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := soundManager(w, r)
+	if !ok {
+		return
+	}
+	prefix, name := r.FormValue("collection"), r.FormValue("name")
+	err := describeSound(userID, prefix, name, r.FormValue("description"))
+	writeManageResult(w, err, fmt.Sprintf("Updated the description of `!%s %s`.", prefix, name))
+}
+
+func handleAPISoundsRename(w http.ResponseWriter, r *http.Request) {
+	userID, ok := soundManager(w, r)
+	if !ok {
+		return
+	}
+	prefix, name, newName := r.FormValue("collection"), r.FormValue("name"), r.FormValue("new_name")
+	err := renameSound(userID, prefix, name, newName)
+	writeManageResult(w, err, fmt.Sprintf("Renamed `!%s %s` to `!%s %s`.", prefix, name, prefix, newName))
+}
+
+func handleAPISoundsDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := soundManager(w, r)
+	if !ok {
+		return
+	}
+	prefix, name := r.FormValue("collection"), r.FormValue("name")
+	err := deleteSound(userID, prefix, name)
+	writeManageResult(w, err, fmt.Sprintf("Deleted `!%s %s`.", prefix, name))
+}
+
+func handleAPISoundsWeight(w http.ResponseWriter, r *http.Request) {
+	userID, ok := soundManager(w, r)
+	if !ok {
+		return
+	}
+	weight, err := strconv.Atoi(r.FormValue("weight"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_weight", "The weight must be a whole number.")
+		return
+	}
+	prefix, name := r.FormValue("collection"), r.FormValue("name")
+	err = weighSound(userID, prefix, name, weight)
+	writeManageResult(w, err, fmt.Sprintf("`!%s %s` now has weight %d.", prefix, name, weight))
+}
+
+func handleTokens(w http.ResponseWriter, r *http.Request) {
+	logWebRequests(r)
+	session := store.Get(r)
+	if session.DiscordUserID == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	data := buildTokensPage(session.DiscordUserID)
+	data.Username = session.DiscordUsername
+	data.AvatarURL = session.DiscordAvatarURL
+	data.Manage = canManageSounds(session.DiscordUserID)
+	securePage(&data.templateData, w, r, session)
+
+	if err := tmpls["apitokens.html"].ExecuteTemplate(w, "header", data); err != nil {
+		slog.Error("failed to execute template", "template", "apitokens.html/header", "error", err)
+		return
+	}
+	if err := tmpls["apitokens.html"].ExecuteTemplate(w, "footer", nil); err != nil {
+		slog.Error("failed to execute template", "template", "apitokens.html/footer", "error", err)
+	}
+}
+
+// buildTokensPage lists the API tokens of userID.
+func buildTokensPage(userID string) tokensPageData {
+	data := tokensPageData{Scopes: apiTokenScopes}
+	tokens, err := listAPITokens(userID)
+	if err != nil {
+		slog.Error("could not load API tokens", "user", userID, "error", err)
+		data.Error = "Could not load your tokens."
+		return data
+	}
+	for _, t := range tokens {
+		item := tokenItem{ID: t.ID, Name: t.Name, Scopes: t.Scopes, Hint: t.Hint,
+			Created: t.CreatedAt.Format("2006-01-02 15:04"), LastUsed: "never"}
+		if t.LastUsedAt != nil {
+			item.LastUsed = t.LastUsedAt.Format("2006-01-02 15:04")
+		}
+		data.Tokens = append(data.Tokens, item)
+	}
+	return data
+}
+
+// tokenResponse is the JSON body /api/tokens/create and /api/tokens/revoke
+// answer with. Token is only set when a token was created.
+type tokenResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Token   string `json:"token,omitempty"`
+}
+
+// webUIUser checks a request managing tokens or sessions and returns the
+// logged-in user making it. Tokens cannot be used to manage either. It
+// writes the error response itself when the request is refused.
+func webUIUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use POST.")
+		return "", false
+	}
+	if r.Header.Get("Authorization") != "" {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "Tokens and sessions can only be managed from the web UI.")
+		return "", false
+	}
+	return sessionUser(w, r)
+}
+
+func writeTokenResult(w http.ResponseWriter, err error, res tokenResponse) {
+	var refused *manageError
+	switch {
+	case errors.As(err, &refused):
+		writeJSONError(w, refused.status, refused.code, refused.message)
+	case err != nil:
+		slog.Error("could not change API token", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Could not change the token, try again later.")
+	default:
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func handleAPITokensCreate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := webUIUser(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "Could not read the request.")
+		return
+	}
+	tok, secret, err := createAPIToken(userID, r.FormValue("name"), r.Form["scope"])
+	res := tokenResponse{Status: "ok", Token: secret}
+	if tok != nil {
+		res.Message = fmt.Sprintf("Created the token %s. Copy it now, it is not shown again.", tok.Name)
+	}
+	writeTokenResult(w, err, res)
+}
+
+func handleAPITokensRevoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := webUIUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(r.FormValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "id must be the number of a token.")
+		return
+	}
+	writeTokenResult(w, revokeAPIToken(userID, uint(id)), tokenResponse{Status: "ok", Message: "Revoked the token."})
+}
+
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	logWebRequests(r)
+	session := store.Get(r)
+	if session.DiscordUserID == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	data := buildSessionsPage(session.DiscordUserID, session.id)
+	data.Username = session.DiscordUsername
+	data.AvatarURL = session.DiscordAvatarURL
+	data.Manage = canManageSounds(session.DiscordUserID)
+	securePage(&data.templateData, w, r, session)
+
+	if err := tmpls["sessions.html"].ExecuteTemplate(w, "header", data); err != nil {
+		slog.Error("failed to execute template", "template", "sessions.html/header", "error", err)
+		return
+	}
+	if err := tmpls["sessions.html"].ExecuteTemplate(w, "footer", nil); err != nil {
+		slog.Error("failed to execute template", "template", "sessions.html/footer", "error", err)
+	}
+}
+
+// buildSessionsPage lists the active sessions of userID, marking currentID,
+// and for the owner those of every user.
+func buildSessionsPage(userID, currentID string) sessionsPageData {
+	var data sessionsPageData
+	item := func(s WebSession) sessionItem {
+		return sessionItem{ID: s.ID, User: userName(s.UserID), Address: s.Address, UserAgent: s.UserAgent,
+			Created: s.CreatedAt.Format("2006-01-02 15:04"), LastSeen: s.LastSeenAt.Format("2006-01-02 15:04"), Current: s.ID == currentID}
+	}
+	sessions, err := listWebSessions(userID)
+	var refused *manageError
+	if errors.As(err, &refused) {
+		data.Error = refused.message
+		return data
+	}
+	if err != nil {
+		slog.Error("could not load sessions", "user", userID, "error", err)
+		data.Error = "Could not load your sessions."
+		return data
+	}
+	for _, s := range sessions {
+		data.Sessions = append(data.Sessions, item(s))
+	}
+	if userID != conf.Discord.OwnerID {
+		return data
+	}
+	data.Owner = true
+	all, err := listWebSessions("")
+	if err != nil {
+		slog.Error("could not load sessions", "error", err)
+		data.Error = "Could not load the sessions of all users."
+		return data
+	}
+	for _, s := range all {
+		data.All = append(data.All, item(s))
+	}
+	return data
+}
+
+func writeSessionResult(w http.ResponseWriter, err error, message string) {
+	var refused *manageError
+	switch {
+	case errors.As(err, &refused):
+		writeJSONError(w, refused.status, refused.code, refused.message)
+	case err != nil:
+		slog.Error("could not revoke session", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Could not sign out the session, try again later.")
+	default:
+		writeJSON(w, http.StatusOK, manageResponse{Status: "ok", Message: message})
+	}
+}
+
+func handleAPISessionsRevoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := webUIUser(w, r)
+	if !ok {
+		return
+	}
+	id := r.FormValue("id")
+	if id == "" {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "id is required.")
+		return
+	}
+	_, err := revokeWebSessions(userID, id)
+	if err == nil && id == store.Get(r).id {
+		clearSessionCookie(w)
+	}
+	writeSessionResult(w, err, "Signed out the session.")
+}
+
+func handleAPISessionsRevokeAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := webUIUser(w, r)
+	if !ok {
+		return
+	}
+	n, err := revokeWebSessions(userID, "")
+	if err == nil {
+		clearSessionCookie(w)
+	}
+	writeSessionResult(w, err, fmt.Sprintf("Signed out of %d sessions.", n))
+}
+
 func handleLogout(w http.ResponseWriter, r *http.Request) {
 	slog.Info("WebUI /logout Request", "Requesting IP", r.RemoteAddr)
-	store.Clear(w)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	session := store.Get(r)
+	if !validCSRF(r, session) {
+		http.Error(w, "invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	store.Clear(w, session)
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
@@ -552,6 +1338,7 @@ func handleDiscordCallback(w http.ResponseWriter, r *http.Request) {
 	session.DiscordUsername = user.Username
 	session.DiscordAvatarURL = avatarURL
 	session.AccessToken = token.AccessToken
+	session.CSRFToken = randomToken(32)
 	err = store.Save(w, session)
 	if err != nil {
 		slog.Error("unable to Save", "error", err)
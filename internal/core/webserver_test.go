@@ -5,13 +5,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/bwmarrin/discordgo"
 )
 
 type stubEsoGenerator struct {
@@ -246,7 +250,7 @@ func TestHandleAPIEso_moduleUnavailable(t *testing.T) {
 	esoMod = nil
 	t.Cleanup(func() { esoMod = previousEsoMod })
 
-	req := httptest.NewRequest(http.MethodPost, "/api/eso", nil)
+	req := authedRequest(t, http.MethodPost, "/api/eso", "user-1", nil)
 	w := httptest.NewRecorder()
 
 	handleAPIEso(w, req)
@@ -374,3 +378,124 @@ func TestHandleHealth(t *testing.T) {
 		t.Errorf("body = %q, want %q", w.Body.String(), `{"status":"ok"}`)
 	}
 }
+
+// testCSRFToken is the CSRF token of the sessions authedRequest makes.
+const testCSRFToken = "test-csrf"
+
+// authedRequest returns a request carrying the session of a logged-in userID
+// and its CSRF token.
+func authedRequest(t *testing.T, method, target, userID string, body io.Reader) *http.Request {
+	t.Helper()
+	store = newSessionStore("test-secret")
+	setRec := httptest.NewRecorder()
+	if err := store.Save(setRec, &sessionData{DiscordUserID: userID, CSRFToken: testCSRFToken}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set(csrfHeader, testCSRFToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, c := range setRec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestHandleAPIQueue_listsQueuedSounds(t *testing.T) {
+	testSoundSession(t, true)
+	usePlaying(t,
+		&Play{Prefix: "horn", Sound: &soundClip{Name: "one"}, Username: "Alice"},
+		&Play{Prefix: "cow", Sound: &soundClip{Name: "moo"}, Username: "Bob"})
+
+	w := httptest.NewRecorder()
+	handleAPIQueue(w, authedRequest(t, http.MethodGet, "/api/queue", "user-1", nil))
+
+	var result struct {
+		Guilds []guildQueueStatus `json:"guilds"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Guilds) != 1 {
+		t.Fatalf("guilds = %+v, want guild-1", result.Guilds)
+	}
+	g := result.Guilds[0]
+	if g.NowPlaying != "one" || g.NowPlayingBy != "Alice" || g.QueueLength != 1 {
+		t.Errorf("guild = %+v", g)
+	}
+	if want := (queuedSound{Prefix: "cow", Sound: "moo", QueuedBy: "Bob"}); len(g.Queue) != 1 || g.Queue[0] != want {
+		t.Errorf("queue = %+v, want %+v", g.Queue, want)
+	}
+}
+
+func TestHandleAPIQueueStop(t *testing.T) {
+	testSoundSession(t, true)
+	cancelled := usePlaying(t, &Play{Prefix: "horn", Sound: &soundClip{Name: "one"}},
+		&Play{Prefix: "horn", Sound: &soundClip{Name: "two"}})
+
+	w := httptest.NewRecorder()
+	handleAPIQueueStop(w, authedRequest(t, http.MethodPost, "/api/queue/stop", "user-1", strings.NewReader("guild_id=guild-1")))
+
+	var res queueControlResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if w.Code != http.StatusOK || res.Status != "stopped" || res.Cleared != 1 || res.Message != "Stopped !horn one and cleared 1 queued sounds." {
+		t.Errorf("response = %d %+v", w.Code, res)
+	}
+	if !cancelled() {
+		t.Error("stop did not cancel the sound playing")
+	}
+
+	w = httptest.NewRecorder()
+	handleAPIQueueSkip(w, authedRequest(t, http.MethodPost, "/api/queue/skip", "user-1", strings.NewReader("guild_id=guild-1")))
+	res = queueControlResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	// The test player has no worker to finish the play, so it is skipped again.
+	if res.Status != "skipped" {
+		t.Errorf("skip response = %+v", res)
+	}
+}
+
+func TestHandleAPIQueueSkip_rejectsBadRequests(t *testing.T) {
+	cases := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"get", authedRequest(t, http.MethodGet, "/api/queue/skip", "user-1", nil), http.StatusMethodNotAllowed},
+		{"logged out", httptest.NewRequest(http.MethodPost, "/api/queue/skip", nil), http.StatusUnauthorized},
+		{"no guild", authedRequest(t, http.MethodPost, "/api/queue/skip", "user-1", strings.NewReader("")), http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		handleAPIQueueSkip(w, tc.req)
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
+
+func TestWebCollections(t *testing.T) {
+	s := testSoundSession(t, false)
+	if err := s.State.GuildAdd(&discordgo.Guild{ID: "guild-2"}); err != nil {
+		t.Fatal(err)
+	}
+	useCollections(t)
+	COLLECTIONS = []*soundCollection{
+		{Prefix: "horn"},
+		{Prefix: "ours", Guilds: []string{"guild-1"}},
+		{Prefix: "theirs", Guilds: []string{"guild-2"}},
+	}
+
+	var got []string
+	for _, c := range webCollections("user-1") {
+		got = append(got, c.Prefix)
+	}
+	if want := []string{"horn", "ours"}; !slices.Equal(got, want) {
+		t.Errorf("collections = %v, want %v", got, want)
+	}
+}
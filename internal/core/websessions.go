@@ -0,0 +1,208 @@
+package gidbig
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval is how often the last use of a database session is
+// written, at most.
+const sessionTouchInterval = time.Minute
+
+// maxUserAgent bounds the user agent kept with a session.
+const maxUserAgent = 200
+
+// WebSession is a login session of the web UI kept in the database. The
+// cookie holds a random ID; only its SHA-256 is stored.
+type WebSession struct {
+	ID     string `gorm:"primaryKey"`
+	UserID string `gorm:"index"`
+	// Data is the sessionData as JSON.
+	Data string `gorm:"not null"`
+	// Address and UserAgent are where the session was last used from, the
+	// address anonymized.
+	Address    string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time `gorm:"index"`
+}
+
+// TableName returns the database table name.
+func (WebSession) TableName() string { return "web_sessions" }
+
+// dbSessionStore keeps sessions in the database so they can time out and be
+// revoked.
+type dbSessionStore struct {
+	// idle ends a session unused this long, absolute one this long after it
+	// started.
+	idle     time.Duration
+	absolute time.Duration
+}
+
+// expired reports whether s has timed out at now.
+func (st *dbSessionStore) expired(s *WebSession, now time.Time) bool {
+	return now.Sub(s.CreatedAt) >= st.absolute || now.Sub(s.LastSeenAt) >= st.idle
+}
+
+func (st *dbSessionStore) Get(r *http.Request) *sessionData {
+	cookie, err := r.Cookie(sessionCookieName)
+	d := getSoundDB()
+	if err != nil || cookie.Value == "" || d == nil {
+		return &sessionData{}
+	}
+	id := hashAPIToken(cookie.Value)
+	var s WebSession
+	if err := d.Where("id = ?", id).First(&s).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("could not load session", "error", err)
+		}
+		return &sessionData{}
+	}
+	now := time.Now()
+	if st.expired(&s, now) {
+		d.Delete(&WebSession{}, "id = ?", id)
+		return &sessionData{}
+	}
+	var data sessionData
+	if err := json.Unmarshal([]byte(s.Data), &data); err != nil {
+		slog.Error("could not decode session", "error", err)
+		return &sessionData{}
+	}
+	data.id = id
+
+	if now.Sub(s.LastSeenAt) >= sessionTouchInterval || s.Address == "" {
+		agent := r.UserAgent()
+		if len(agent) > maxUserAgent {
+			agent = agent[:maxUserAgent]
+		}
+		err := d.Model(&s).Updates(map[string]any{"last_seen_at": now, "address": clientAddress(r), "user_agent": agent}).Error
+		if err != nil {
+			slog.Warn("could not note session use", "error", err)
+		}
+	}
+	return &data
+}
+
+// Save updates the session of data. It starts a new one, with a new ID in
+// the cookie, when data has none yet or its user changed by logging in.
+func (st *dbSessionStore) Save(w http.ResponseWriter, data *sessionData) error {
+	d := getSoundDB()
+	if d == nil {
+		return errors.New("store not initialized")
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if data.id != "" {
+		res := d.Model(&WebSession{}).Where("id = ? AND user_id = ?", data.id, data.DiscordUserID).Update("data", string(raw))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			return nil
+		}
+		// The user changed; the old ID must not carry the new login.
+		if err := d.Delete(&WebSession{}, "id = ?", data.id).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if err := d.Where("created_at <= ? OR last_seen_at <= ?", now.Add(-st.absolute), now.Add(-st.idle)).Delete(&WebSession{}).Error; err != nil {
+		slog.Warn("could not delete expired sessions", "error", err)
+	}
+	secret := randomToken(32)
+	s := &WebSession{ID: hashAPIToken(secret), UserID: data.DiscordUserID, Data: string(raw), CreatedAt: now, LastSeenAt: now}
+	if err := d.Create(s).Error; err != nil {
+		return err
+	}
+	data.id = s.ID
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    secret,
+		Path:     "/",
+		MaxAge:   int(st.absolute.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (st *dbSessionStore) Clear(w http.ResponseWriter, data *sessionData) {
+	if d := getSoundDB(); d != nil && data.id != "" {
+		if err := d.Delete(&WebSession{}, "id = ?", data.id).Error; err != nil {
+			slog.Error("could not delete session", "error", err)
+		}
+	}
+	clearSessionCookie(w)
+}
+
+// errNoServerSessions refuses listing and revoking sessions kept in cookies.
+var errNoServerSessions = &manageError{http.StatusConflict, "sessions_unavailable", "Sessions are kept in cookies here; set web.sessions.store to sqlite to list and revoke them."}
+
+// errUnknownSession refuses a session that does not exist or ended.
+var errUnknownSession = &manageError{http.StatusNotFound, "unknown_session", "There is no such session."}
+
+// serverSessions returns the database store when sessions are kept there.
+func serverSessions() (*dbSessionStore, bool) {
+	st, ok := store.(*dbSessionStore)
+	return st, ok
+}
+
+// listWebSessions returns the active sessions of userID, or of every logged
+// in user when userID is empty, the most recently used first.
+func listWebSessions(userID string) ([]WebSession, error) {
+	st, ok := serverSessions()
+	if !ok {
+		return nil, errNoServerSessions
+	}
+	d := getSoundDB()
+	if d == nil {
+		return nil, errors.New("store not initialized")
+	}
+	now := time.Now()
+	q := d.Where("user_id <> '' AND created_at > ? AND last_seen_at > ?", now.Add(-st.absolute), now.Add(-st.idle))
+	if userID != "" {
+		q = q.Where("user_id = ?", userID)
+	}
+	var sessions []WebSession
+	err := q.Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// revokeWebSessions ends the session id of userID, or every session of
+// userID when id is empty, and returns how many ended. The owner may end
+// the sessions of anyone.
+func revokeWebSessions(userID, id string) (int64, error) {
+	if _, ok := serverSessions(); !ok {
+		return 0, errNoServerSessions
+	}
+	d := getSoundDB()
+	if d == nil {
+		return 0, errors.New("store not initialized")
+	}
+	q := d.Where("user_id <> ''")
+	switch {
+	case id == "":
+		q = q.Where("user_id = ?", userID)
+	case userID != conf.Discord.OwnerID:
+		q = q.Where("id = ? AND user_id = ?", id, userID)
+	default:
+		q = q.Where("id = ?", id)
+	}
+	res := q.Delete(&WebSession{})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if id != "" && res.RowsAffected == 0 {
+		return 0, errUnknownSession
+	}
+	slog.Info("web sessions revoked", "user", userID, "session", id, "count", res.RowsAffected)
+	return res.RowsAffected, nil
+}
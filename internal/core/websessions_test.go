@@ -0,0 +1,198 @@
+package gidbig
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// useDBSessions keeps sessions in an isolated database for the test.
+func useDBSessions(t *testing.T) (*gorm.DB, *dbSessionStore) {
+	t.Helper()
+	db := useSoundStore(t)
+	orig := store
+	st := &dbSessionStore{idle: time.Hour, absolute: 24 * time.Hour}
+	store = st
+	t.Cleanup(func() { store = orig })
+	return db, st
+}
+
+// login saves a session of userID and returns its cookie.
+func login(t *testing.T, userID string) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := store.Save(w, &sessionData{DiscordUserID: userID, CSRFToken: testCSRFToken}); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()[0]
+}
+
+func withCookie(req *http.Request, c *http.Cookie) *http.Request {
+	req.AddCookie(c)
+	return req
+}
+
+func TestDBSessionStore(t *testing.T) {
+	db, st := useDBSessions(t)
+
+	w := httptest.NewRecorder()
+	anonymous := &sessionData{State: "state"}
+	if err := st.Save(w, anonymous); err != nil {
+		t.Fatal(err)
+	}
+	cookie := w.Result().Cookies()[0]
+	var row WebSession
+	if err := db.First(&row).Error; err != nil || row.ID == cookie.Value || strings.Contains(row.Data, cookie.Value) {
+		t.Fatalf("stored session = %+v, %v; want only the hash of the cookie", row, err)
+	}
+	if cookie.MaxAge != int((24 * time.Hour).Seconds()) {
+		t.Errorf("cookie MaxAge = %d, want the absolute timeout", cookie.MaxAge)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "test-browser")
+	got := st.Get(withCookie(req, cookie))
+	if got.State != "state" || got.id != row.ID {
+		t.Fatalf("Get = %+v", got)
+	}
+	if err := db.First(&row).Error; err != nil || row.Address == "" || row.UserAgent != "test-browser" {
+		t.Errorf("last use = %q %q, %v", row.Address, row.UserAgent, err)
+	}
+
+	// Logging in starts a new session; the old cookie is worthless.
+	got.DiscordUserID = "user-1"
+	w = httptest.NewRecorder()
+	if err := st.Save(w, got); err != nil {
+		t.Fatal(err)
+	}
+	loggedIn := w.Result().Cookies()[0]
+	if loggedIn.Value == cookie.Value || st.Get(withCookie(httptest.NewRequest(http.MethodGet, "/", nil), cookie)).State != "" {
+		t.Error("the session ID did not change on login")
+	}
+	if st.Get(withCookie(httptest.NewRequest(http.MethodGet, "/", nil), loggedIn)).DiscordUserID != "user-1" {
+		t.Error("logged-in session not found")
+	}
+
+	// Updating a session keeps its ID.
+	got.DiscordUsername = "Alice"
+	w = httptest.NewRecorder()
+	if err := st.Save(w, got); err != nil || len(w.Result().Cookies()) != 0 {
+		t.Errorf("update = %v, cookies %v", err, w.Result().Cookies())
+	}
+
+	for _, c := range []struct {
+		column string
+		age    time.Duration
+	}{{"last_seen_at", time.Hour}, {"created_at", 24 * time.Hour}} {
+		cookie := login(t, "user-2")
+		if err := db.Model(&WebSession{}).Where("user_id = ?", "user-2").Update(c.column, time.Now().Add(-c.age)).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got := st.Get(withCookie(httptest.NewRequest(http.MethodGet, "/", nil), cookie)); got.DiscordUserID != "" {
+			t.Errorf("session past %s timeout = %+v, want it ended", c.column, got)
+		}
+	}
+
+	session := st.Get(withCookie(httptest.NewRequest(http.MethodGet, "/", nil), loggedIn))
+	w = httptest.NewRecorder()
+	st.Clear(w, session)
+	var left int64
+	if db.Model(&WebSession{}).Count(&left); left != 0 || w.Result().Cookies()[0].MaxAge >= 0 {
+		t.Errorf("after Clear %d sessions left, cookie %+v", left, w.Result().Cookies()[0])
+	}
+}
+
+func TestHandleAPISessions(t *testing.T) {
+	db, _ := useDBSessions(t)
+	useOwner(t, "owner")
+	testSoundSession(t, false)
+	first, second, other := login(t, "user-1"), login(t, "user-1"), login(t, "user-2")
+	post := func(handler http.HandlerFunc, c *http.Cookie, form url.Values) (*httptest.ResponseRecorder, apiError) {
+		req := httptest.NewRequest(http.MethodPost, "/api/sessions", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, testCSRFToken)
+		w := httptest.NewRecorder()
+		handler(w, withCookie(req, c))
+		var res apiError
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w, res
+	}
+	sessions, err := listWebSessions("user-1")
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("sessions of user-1 = %+v, %v", sessions, err)
+	}
+
+	if w, res := post(handleAPISessionsRevoke, other, url.Values{"id": {sessions[0].ID}}); w.Code != http.StatusNotFound || res.Error != "unknown_session" {
+		t.Errorf("revoking someone else's session = %d %+v", w.Code, res)
+	}
+	if w, _ := post(handleAPISessionsRevokeAll, first, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "2 sessions") {
+		t.Errorf("sign out everywhere = %d %s", w.Code, w.Body)
+	}
+	for _, c := range []*http.Cookie{first, second} {
+		if store.Get(withCookie(httptest.NewRequest(http.MethodGet, "/", nil), c)).DiscordUserID != "" {
+			t.Error("a session survived signing out everywhere")
+		}
+	}
+	var left WebSession
+	if err := db.First(&left).Error; err != nil || left.UserID != "user-2" {
+		t.Errorf("left = %+v, %v; want the session of user-2", left, err)
+	}
+
+	owner := login(t, "owner")
+	if w, _ := post(handleAPISessionsRevoke, owner, url.Values{"id": {left.ID}}); w.Code != http.StatusOK {
+		t.Errorf("owner revoking a session = %d %s", w.Code, w.Body)
+	}
+	if store.Get(withCookie(httptest.NewRequest(http.MethodGet, "/", nil), other)).DiscordUserID != "" {
+		t.Error("the revoked session still works")
+	}
+
+	store = newSessionStore("test-secret")
+	if w, res := post(handleAPISessionsRevokeAll, login(t, "user-1"), nil); w.Code != http.StatusConflict || res.Error != "sessions_unavailable" {
+		t.Errorf("with cookie sessions = %d %+v", w.Code, res)
+	}
+}
+
+func TestBuildSessionsPage(t *testing.T) {
+	tmpl := template.Must(template.ParseFiles("../../web/templates/sessions.html",
+		"../../web/templates/header.html", "../../web/templates/footer.html"))
+	useDBSessions(t)
+	useOwner(t, "owner")
+	testSoundSession(t, false)
+	login(t, "user-1")
+	login(t, "owner")
+	current := store.Get(withCookie(httptest.NewRequest(http.MethodGet, "/", nil), login(t, "owner")))
+
+	data := buildSessionsPage("user-1", "")
+	if len(data.Sessions) != 1 || data.Owner || data.All != nil {
+		t.Errorf("page of user-1 = %+v", data)
+	}
+	data = buildSessionsPage("owner", current.id)
+	if len(data.Sessions) != 2 || !data.Owner || len(data.All) != 3 || !data.Sessions[0].Current {
+		t.Errorf("page of the owner = %+v", data)
+	}
+	data.Username = "owner"
+	data.ServerSessions = true
+
+	var b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&b, "header", data); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for _, want := range []string{"this browser", "All active sessions", `href="/sessions"`, "/api/sessions/revoke-all"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+
+	store = newSessionStore("test-secret")
+	if data := buildSessionsPage("user-1", ""); !strings.Contains(data.Error, "web.sessions.store") {
+		t.Errorf("cookie sessions page error = %q", data.Error)
+	}
+}
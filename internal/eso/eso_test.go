@@ -87,10 +87,19 @@ func TestModule_Shutdown_NoError(t *testing.T) {
 	}
 }
 
-func TestModule_Listeners_Count(t *testing.T) {
-	listeners := New().Listeners()
-	if len(listeners) != 1 {
-		t.Fatalf("expected 1 listener, got %d", len(listeners))
+func TestModule_Listeners_Empty(t *testing.T) {
+	if listeners := New().Listeners(); len(listeners) != 0 {
+		t.Fatalf("expected no listeners, got %d", len(listeners))
+	}
+}
+
+func TestModule_CommandHandlers_CoverCommands(t *testing.T) {
+	m := New()
+	handlers := m.CommandHandlers()
+	for _, cmd := range m.Commands() {
+		if handlers[cmd.Name] == nil {
+			t.Errorf("no handler for command %q", cmd.Name)
+		}
 	}
 }
 
@@ -2,32 +2,37 @@ package gippity
 
 import (
 	"testing"
+
+	"github.com/bwmarrin/discordgo"
 )
 
 func TestAdminGetUserPrivacy_Default(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if !AdminGetUserPrivacy("unknown-user") {
+	if !m.adminGetUserPrivacy("unknown-user") {
 		t.Error("expected default privacy=true for unknown user")
 	}
 }
 
 func TestAdminGetUserPrivacy_ExplicitOff(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if err := setUserPrivacy("user1", false); err != nil {
+	if err := m.setUserPrivacy("user1", false); err != nil {
 		t.Fatalf("setUserPrivacy: %v", err)
 	}
 
-	if AdminGetUserPrivacy("user1") {
+	if m.adminGetUserPrivacy("user1") {
 		t.Error("expected privacy=false after explicit opt-out")
 	}
 }
 
 func TestAdminGetAllUserPrivacy_Empty(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	settings, err := AdminGetAllUserPrivacy()
+	settings, err := m.adminGetAllUserPrivacy()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -37,16 +42,17 @@ func TestAdminGetAllUserPrivacy_Empty(t *testing.T) {
 }
 
 func TestAdminGetAllUserPrivacy_Multiple(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if err := setUserPrivacy("user-a", true); err != nil {
+	if err := m.setUserPrivacy("user-a", true); err != nil {
 		t.Fatalf("setUserPrivacy user-a: %v", err)
 	}
-	if err := setUserPrivacy("user-b", false); err != nil {
+	if err := m.setUserPrivacy("user-b", false); err != nil {
 		t.Fatalf("setUserPrivacy user-b: %v", err)
 	}
 
-	settings, err := AdminGetAllUserPrivacy()
+	settings, err := m.adminGetAllUserPrivacy()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -62,32 +68,35 @@ func TestAdminGetAllUserPrivacy_Multiple(t *testing.T) {
 }
 
 func TestAdminHasConversationHistory_NoHistory(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if AdminHasConversationHistory("unknown-user") {
+	if m.adminHasConversationHistory("unknown-user") {
 		t.Error("expected false for user with no history")
 	}
 }
 
 func TestAdminHasConversationHistory_WithHistory(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if _, err := database.Exec(
+	if _, err := m.db.Exec(
 		`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		"user1", "chan1", 1000, "hello", "msg1", "guild1", 0,
 	); err != nil {
 		t.Fatalf("insert: %v", err)
 	}
 
-	if !AdminHasConversationHistory("user1") {
+	if !m.adminHasConversationHistory("user1") {
 		t.Error("expected true for user with history")
 	}
 }
 
 func TestAdminGetUsersWithHistory_Empty(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	users, err := AdminGetUsersWithHistory()
+	users, err := m.adminGetUsersWithHistory()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -97,10 +106,11 @@ func TestAdminGetUsersWithHistory_Empty(t *testing.T) {
 }
 
 func TestAdminGetUsersWithHistory_Multiple(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
 	for i, uid := range []string{"user-a", "user-b", "user-a"} {
-		if _, err := database.Exec(
+		if _, err := m.db.Exec(
 			`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 			uid, "chan1", int64(1000+i), "msg", "msg"+string(rune('0'+i)), "guild1", 0,
 		); err != nil {
@@ -108,7 +118,7 @@ func TestAdminGetUsersWithHistory_Multiple(t *testing.T) {
 		}
 	}
 
-	users, err := AdminGetUsersWithHistory()
+	users, err := m.adminGetUsersWithHistory()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -116,3 +126,59 @@ func TestAdminGetUsersWithHistory_Multiple(t *testing.T) {
 		t.Fatalf("expected 2 distinct users, got %d: %v", len(users), users)
 	}
 }
+
+func TestAdminSubcommandGroup_Subcommands(t *testing.T) {
+	t.Parallel()
+
+	group := New().AdminSubcommandGroup()
+	if group.Name != "gippity" {
+		t.Fatalf("Name = %q, want gippity", group.Name)
+	}
+	subNames := make(map[string]bool)
+	for _, o := range group.Options {
+		subNames[o.Name] = true
+	}
+	for _, want := range []string{"privacy", "history"} {
+		if !subNames[want] {
+			t.Errorf("missing gippity subcommand %q", want)
+		}
+	}
+}
+
+func TestAdminOptUserID_Present(t *testing.T) {
+	t.Parallel()
+
+	opts := []*discordgo.ApplicationCommandInteractionDataOption{
+		{
+			Name:  "user",
+			Type:  discordgo.ApplicationCommandOptionUser,
+			Value: "target-user",
+		},
+	}
+	if got := adminOptUserID(nil, opts); got != "target-user" {
+		t.Errorf("adminOptUserID = %q, want %q", got, "target-user")
+	}
+}
+
+func TestAdminOptUserID_Absent(t *testing.T) {
+	t.Parallel()
+
+	if got := adminOptUserID(nil, nil); got != "" {
+		t.Errorf("adminOptUserID = %q, want empty string", got)
+	}
+}
+
+func TestAdminQueries_AfterShutdown(t *testing.T) {
+	t.Parallel()
+	m := newTestModule(t)
+	if err := m.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if !m.adminGetUserPrivacy("user1") {
+		t.Error("expected default privacy=true once the database is closed")
+	}
+	if _, err := m.adminGetAllUserPrivacy(); err == nil {
+		t.Error("expected error once the database is closed")
+	}
+}
@@ -1,13 +1,17 @@
 package gippity
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"context"
-
 	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/bot"
 	"github.com/toksikk/gidbig/internal/cfg"
 	"github.com/toksikk/gidbig/internal/llm"
 	"github.com/toksikk/gidbig/internal/util"
@@ -15,60 +19,145 @@ import (
 	openai "github.com/openai/openai-go/v3"
 )
 
-var discordSession *discordgo.Session
+const (
+	userMessageLimit = 30
 
-var generateAnswerFunc = generateAnswer
+	// nameCacheResetInterval bounds how long resolved user, channel and guild names are reused.
+	nameCacheResetInterval = 12 * time.Hour
 
-var chatCompletionFunc = func(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
-	return llm.GetClient().Chat.Completions.New(ctx, params)
-}
+	// speakTimeout bounds reading an answer out in voice.
+	speakTimeout = 30 * time.Second
+)
 
-var channelTypingFunc = func(s *discordgo.Session, channelID string) {
-	s.ChannelTyping(channelID) //nolint:errcheck
-}
+// Module implements bot.Module and bot.AdminProvider for the gippity chat plugin.
+type Module struct {
+	session *discordgo.Session
+
+	// DB state
+	dbMu    sync.RWMutex
+	db      *sql.DB
+	dbPath  string
+	writeMu sync.Mutex
 
-var (
+	// accessMu guards the allow and ignore lists, which a config reload may swap.
+	accessMu        sync.RWMutex
 	allowedGuildIDs map[string]bool
 	ignoredUserIDs  map[string]bool
-)
 
-var userMessageCount map[string]int
+	// limitMu guards the per-user mention rate limit.
+	limitMu                   sync.Mutex
+	userMessageCount          map[string]int
+	userMessageCountLastReset map[string]time.Time
+
+	namesMu       sync.Mutex
+	idToNameCache map[string]string
+
+	// speaker reads answers out in voice while speakAnswers is set by tts.gippity,
+	// cut to speakLimit characters from tts.max_length.
+	speaker      bot.Speaker
+	speakAnswers atomic.Bool
+	speakLimit   atomic.Int64
+
+	// Test hooks
+	nowFunc                func() time.Time
+	generateAnswer         func(*discordgo.MessageCreate, []string) (string, error)
+	chatCompletion         func(context.Context, openai.ChatCompletionNewParams) (*openai.ChatCompletion, error)
+	visionCompletion       func(context.Context, openai.ChatCompletionNewParams) (*openai.ChatCompletion, error)
+	describeImages         func([]string) (string, error)
+	channelTyping          func(*discordgo.Session, string)
+	fetchReferencedMessage func(*discordgo.Session, *discordgo.MessageReference) (*discordgo.Message, error)
+	channelMessage         func(*discordgo.Session, string, string) (*discordgo.Message, error)
+}
 
-const userMessageLimit = 30
+// New returns a Module with production-default hook implementations.
+func New() *Module {
+	m := &Module{
+		dbPath:                    chatHistoryDBFilename,
+		allowedGuildIDs:           make(map[string]bool),
+		ignoredUserIDs:            make(map[string]bool),
+		userMessageCount:          make(map[string]int),
+		userMessageCountLastReset: make(map[string]time.Time),
+		idToNameCache:             make(map[string]string),
+		nowFunc:                   time.Now,
+	}
+	m.generateAnswer = m.generateAnswerImpl
+	m.chatCompletion = llmCompletion
+	m.visionCompletion = llmCompletion
+	m.describeImages = m.describeImagesImpl
+	m.channelTyping = channelTypingImpl
+	m.fetchReferencedMessage = m.fetchReferencedMessageImpl
+	m.channelMessage = channelMessageImpl
+	return m
+}
 
-var userMessageCountLastReset map[string]time.Time
+func llmCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	return llm.GetClient().Chat.Completions.New(ctx, params)
+}
+
+func channelTypingImpl(s *discordgo.Session, channelID string) {
+	s.ChannelTyping(channelID) //nolint:errcheck
+}
 
-// Start the plugin
-func Start(discord *discordgo.Session) {
-	initDB()
+// Name returns the module's identifier.
+func (m *Module) Name() string { return "gippity" }
 
-	go idToNameCacheResetLoop()
+// Init opens the chat history database and reads the guild and user filters from Deps.Config.
+func (m *Module) Init(d bot.Deps) error {
+	m.session = d.Session
+	m.speaker = d.Speaker
+	if d.Config != nil {
+		m.applyAccessLists(d.Config)
+		m.applySpeech(d.Config)
+	}
+	if err := m.openDB(m.dbPath); err != nil {
+		return fmt.Errorf("gippity: open database: %w", err)
+	}
+	slog.Info("gippity: initialized")
+	return nil
+}
 
-	userMessageCount = make(map[string]int, 0)
-	userMessageCountLastReset = make(map[string]time.Time, 0)
+// Reconfigure swaps in the allowed guilds and ignored users from c and
+// whether answers are spoken.
+func (m *Module) Reconfigure(c *cfg.Config) error {
+	m.applyAccessLists(c)
+	m.applySpeech(c)
+	slog.Info("gippity: reconfigured", "allowed_guilds", len(c.Gippity.AllowedGuilds), "ignored_users", len(c.Gippity.IgnoredUsers))
+	return nil
+}
 
-	config := cfg.GetConfig()
-	allowedGuildIDs = make(map[string]bool)
-	ignoredUserIDs = make(map[string]bool)
+func (m *Module) applySpeech(c *cfg.Config) {
+	m.speakAnswers.Store(c.TTS.Gippity)
+	m.speakLimit.Store(int64(c.TTS.MaxLength))
+}
 
-	for _, id := range config.Gippity.AllowedGuilds {
-		allowedGuildIDs[id] = true
+func (m *Module) applyAccessLists(c *cfg.Config) {
+	allowed := make(map[string]bool, len(c.Gippity.AllowedGuilds))
+	for _, id := range c.Gippity.AllowedGuilds {
+		allowed[id] = true
 	}
-	for _, id := range config.Gippity.IgnoredUsers {
-		ignoredUserIDs[id] = true
+	ignored := make(map[string]bool, len(c.Gippity.IgnoredUsers))
+	for _, id := range c.Gippity.IgnoredUsers {
+		ignored[id] = true
 	}
+	m.accessMu.Lock()
+	m.allowedGuildIDs, m.ignoredUserIDs = allowed, ignored
+	m.accessMu.Unlock()
+}
 
-	discordSession = discord
-
-	discord.AddHandler(onMessageCreate)
-	discord.AddHandler(onMessageUpdate)
-	discord.AddHandler(onGippityInteractionCreate)
+func (m *Module) guildAllowed(guildID string) bool {
+	m.accessMu.RLock()
+	defer m.accessMu.RUnlock()
+	return m.allowedGuildIDs[guildID]
+}
 
-	slog.Info("gippity function registered")
+func (m *Module) userIgnored(userID string) bool {
+	m.accessMu.RLock()
+	defer m.accessMu.RUnlock()
+	return m.ignoredUserIDs[userID]
 }
 
 // Commands returns the slash command definitions for this plugin.
-func Commands() []*discordgo.ApplicationCommand {
+func (m *Module) Commands() []*discordgo.ApplicationCommand {
 	return []*discordgo.ApplicationCommand{
 		{
 			Name:        "gippity",
@@ -96,58 +185,87 @@ func Commands() []*discordgo.ApplicationCommand {
 	}
 }
 
-// Shutdown cleans up gippity resources.
-func Shutdown() {
+// CommandHandlers returns the slash command handlers keyed by command name.
+func (m *Module) CommandHandlers() map[string]bot.HandlerFunc {
+	return map[string]bot.HandlerFunc{"gippity": m.onInteractionCreate}
 }
 
-func idToNameCacheResetLoop() {
+// Listeners returns the Discord event listeners for this module.
+func (m *Module) Listeners() []bot.EventListener {
+	return []bot.EventListener{m.onMessageCreate, m.onMessageUpdate}
+}
+
+// Components returns no message-component handlers for this module.
+func (m *Module) Components() []bot.ComponentHandler { return nil }
+
+// Background returns the periodic name-cache reset.
+func (m *Module) Background() []bot.BackgroundTask {
+	return []bot.BackgroundTask{{Name: "gippity/name-cache-reset", Run: m.runNameCacheReset}}
+}
+
+// Shutdown closes the chat history database.
+func (m *Module) Shutdown() error {
+	return m.closeDB()
+}
+
+func (m *Module) runNameCacheReset(ctx context.Context) {
+	ticker := time.NewTicker(nameCacheResetInterval)
+	defer ticker.Stop()
 	for {
-		time.Sleep(12 * time.Hour)
-		idToNameCache = make(map[string]string)
+		select {
+		case <-ticker.C:
+			m.resetNameCache()
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-func isLimitedUser(m *discordgo.MessageCreate) bool {
-	if _, exists := userMessageCount[m.Author.ID]; !exists {
-		userMessageCountLastReset[m.Author.ID] = time.Now()
-		userMessageCount[m.Author.ID] = 0
+func (m *Module) isLimitedUser(mc *discordgo.MessageCreate) bool {
+	m.limitMu.Lock()
+	defer m.limitMu.Unlock()
+
+	now := m.nowFunc()
+	if _, exists := m.userMessageCount[mc.Author.ID]; !exists {
+		m.userMessageCountLastReset[mc.Author.ID] = now
+		m.userMessageCount[mc.Author.ID] = 0
 		return false
 	}
 
-	if _, exists := userMessageCountLastReset[m.Author.ID]; !exists {
-		userMessageCountLastReset[m.Author.ID] = time.Now()
+	if _, exists := m.userMessageCountLastReset[mc.Author.ID]; !exists {
+		m.userMessageCountLastReset[mc.Author.ID] = now
 	}
 
-	if int(time.Since(userMessageCountLastReset[m.Author.ID]).Hours()) >= 1 {
-		userMessageCountLastReset[m.Author.ID] = time.Now()
-		userMessageCount[m.Author.ID] = 0
+	if int(now.Sub(m.userMessageCountLastReset[mc.Author.ID]).Hours()) >= 1 {
+		m.userMessageCountLastReset[mc.Author.ID] = now
+		m.userMessageCount[mc.Author.ID] = 0
 		return false
 	}
 
-	userMessageCount[m.Author.ID]++
+	m.userMessageCount[mc.Author.ID]++
 
-	return userMessageCount[m.Author.ID] >= userMessageLimit
+	return m.userMessageCount[mc.Author.ID] >= userMessageLimit
 }
 
-func limited(m *discordgo.MessageCreate) bool {
-	if m.Author.ID == discordSession.State.User.ID {
+func (m *Module) limited(mc *discordgo.MessageCreate) bool {
+	if mc.Author.ID == m.session.State.User.ID {
 		return true
 	}
 
-	if ignoredUserIDs[m.Author.ID] {
-		slog.Info("ignoring message from ignored user", "user", m.Author.ID)
+	if m.userIgnored(mc.Author.ID) {
+		slog.Info("ignoring message from ignored user", "user", mc.Author.ID)
 		return true
 	}
 
-	if !allowedGuildIDs[m.GuildID] {
-		slog.Info("not using ai generated message in this guild", "guild", m.GuildID)
+	if !m.guildAllowed(mc.GuildID) {
+		slog.Info("not using ai generated message in this guild", "guild", mc.GuildID)
 		return true
 	}
 
-	if isMentioned(m) {
-		if isLimitedUser(m) {
-			slog.Info("not answering because of user limitation", "userMessageCount", userMessageCount[m.Author.ID], "userMessageLimit", userMessageLimit, "userMessageCountLastReset", userMessageCountLastReset[m.Author.ID])
-			_, err := discordSession.ChannelMessageSend(m.ChannelID, "Du hast heute schon genug Nachrichten geschrieben. Komm wann anders wieder.")
+	if m.isMentioned(mc) {
+		if m.isLimitedUser(mc) {
+			slog.Info("not answering because of user limitation", "user", mc.Author.ID, "userMessageLimit", userMessageLimit)
+			_, err := m.session.ChannelMessageSend(mc.ChannelID, "Du hast heute schon genug Nachrichten geschrieben. Komm wann anders wieder.")
 			if err != nil {
 				slog.Info("Error while sending message", "error", err)
 			}
@@ -159,46 +277,46 @@ func limited(m *discordgo.MessageCreate) bool {
 	return true
 }
 
-func onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
-	slog.Debug("Message received", "message", m.Content)
+func (m *Module) onMessageCreate(s *discordgo.Session, mc *discordgo.MessageCreate) {
+	slog.Debug("Message received", "message", mc.Content)
 	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
-		if m.ChannelID != "954388765877612575" { // for debugging / developing
-			slog.Debug("Ignoring message", "channel", m.ChannelID)
+		if mc.ChannelID != "954388765877612575" { // for debugging / developing
+			slog.Debug("Ignoring message", "channel", mc.ChannelID)
 			return
 		}
 	}
-	addMessageToDatabase(m, isMentioned(m))
+	m.addMessageToDatabase(mc, m.isMentioned(mc))
 
-	imageURLs := extractImageURLs(m.Attachments)
+	imageURLs := extractImageURLs(mc.Attachments)
 	if len(imageURLs) > 0 {
 		slog.Debug("Describing image attachments", "count", len(imageURLs))
-		description, err := describeImagesFunc(imageURLs)
+		description, err := m.describeImages(imageURLs)
 		if err != nil {
 			slog.Error("Could not describe images", "error", err)
 		} else {
-			addAttachmentsToDatabase(m.ID, imageURLs, description)
+			m.addAttachmentsToDatabase(mc.ID, imageURLs, description)
 		}
 	}
 
-	if limited(m) {
+	if m.limited(mc) {
 		return
 	}
 
 	var generatedAnswer string
 	var err error
 
-	if len(imageURLs) > 0 && m.Content != "" {
+	if len(imageURLs) > 0 && mc.Content != "" {
 		slog.Debug("Message has image attachments and content")
-		generatedAnswer, err = generateAnswerFunc(m, imageURLs)
+		generatedAnswer, err = m.generateAnswer(mc, imageURLs)
 		if err != nil {
 			slog.Error("Could not generate answer")
 			return
 		}
 	}
 
-	if len(m.Attachments) == 0 && m.Content != "" {
+	if len(mc.Attachments) == 0 && mc.Content != "" {
 		slog.Debug("Message has content but no attachments")
-		generatedAnswer, err = generateAnswerFunc(m, nil)
+		generatedAnswer, err = m.generateAnswer(mc, nil)
 		if err != nil {
 			slog.Error("Could not generate answer")
 			return
@@ -207,35 +325,83 @@ func onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 	slog.Debug("Generated answer", "answer", generatedAnswer)
 
 	if generatedAnswer != "" {
-		_, err = s.ChannelMessageSend(m.ChannelID, generatedAnswer)
+		_, err = s.ChannelMessageSend(mc.ChannelID, generatedAnswer)
 
 		if err != nil {
 			slog.Info("Error while sending message", "error", err)
 		}
+		m.speak(mc, generatedAnswer)
+	}
+}
+
+// speak reads answer out in the voice channel of the author of mc when
+// tts.gippity is on, cut to tts.max_length. Authors outside voice simply get
+// no spoken answer.
+func (m *Module) speak(mc *discordgo.MessageCreate, answer string) {
+	if m.speaker == nil || !m.speakAnswers.Load() || mc.GuildID == "" || mc.Author == nil {
+		return
+	}
+	answer, cut := shortenForSpeech(answer, int(m.speakLimit.Load()))
+	if answer == "" {
+		return
+	}
+	if cut {
+		slog.Info("gippity: spoken answer cut to tts.max_length", "guild", mc.GuildID, "user", mc.Author.ID, "max_length", m.speakLimit.Load())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), speakTimeout)
+	defer cancel()
+	if err := m.speaker.Speak(ctx, mc.GuildID, mc.Author.ID, answer); err != nil {
+		slog.Debug("gippity: answer not spoken", "guild", mc.GuildID, "user", mc.Author.ID, "error", err)
+	}
+}
+
+// shortenForSpeech collapses the whitespace of answer and cuts it to at most
+// limit characters, at the end of a sentence when one ends in the second
+// half, otherwise at the end of a word. It reports whether it cut anything.
+// A limit of 0 or less keeps the whole answer.
+func shortenForSpeech(answer string, limit int) (string, bool) {
+	answer = strings.Join(strings.Fields(answer), " ")
+	r := []rune(answer)
+	if limit <= 0 || len(r) <= limit {
+		return answer, false
+	}
+	head := string(r[:limit])
+	if i := strings.LastIndexAny(head, ".!?"); i >= len(head)/2 {
+		return head[:i+1], true
+	}
+	if next := r[limit]; next != ' ' {
+		if i := strings.LastIndexByte(head, ' '); i > 0 {
+			head = head[:i]
+		}
 	}
+	return strings.TrimRight(head, " "), true
 }
 
-func onMessageUpdate(_ *discordgo.Session, m *discordgo.MessageUpdate) {
-	if m.Message == nil || m.Author == nil || m.Author.Bot {
+func (m *Module) onMessageUpdate(_ *discordgo.Session, mu *discordgo.MessageUpdate) {
+	if mu.Message == nil || mu.Author == nil || mu.Author.Bot {
+		return
+	}
+	if mu.EditedTimestamp == nil || mu.Content == "" {
 		return
 	}
-	if m.EditedTimestamp == nil || m.Content == "" {
+	if !m.guildAllowed(mu.GuildID) {
 		return
 	}
-	if !allowedGuildIDs[m.GuildID] {
+	if m.getUserPrivacy(mu.Author.ID) {
 		return
 	}
-	if getUserPrivacy(m.Author.ID) {
+	db := m.getDB()
+	if db == nil {
 		return
 	}
 	var count int
-	if err := database.QueryRow(`SELECT COUNT(*) FROM chat_history WHERE message_id = ?`, m.ID).Scan(&count); err != nil || count == 0 {
+	if err := db.QueryRow(`SELECT COUNT(*) FROM chat_history WHERE message_id = ?`, mu.ID).Scan(&count); err != nil || count == 0 {
 		return
 	}
-	addMessageEditToDatabase(m.ID, m.Content, m.EditedTimestamp.Unix())
+	m.addMessageEditToDatabase(mu.ID, mu.Content, mu.EditedTimestamp.Unix())
 }
 
-func onGippityInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (m *Module) onInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	if i.Type != discordgo.InteractionApplicationCommand {
 		return
 	}
@@ -270,7 +436,7 @@ func onGippityInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCr
 		slog.Error("gippity: failed to defer privacy interaction", "error", err)
 		return
 	}
-	if err := setUserPrivacy(userID, enabled); err != nil {
+	if err := m.setUserPrivacy(userID, enabled); err != nil {
 		slog.Error("gippity: failed to set user privacy", "error", err, "userID", userID)
 		msg := "Fehler beim Speichern deiner Datenschutzeinstellung."
 		_, _ = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &msg})
@@ -286,10 +452,10 @@ func onGippityInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCr
 	_, _ = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &msg})
 }
 
-func isMentioned(m *discordgo.MessageCreate) bool {
-	botUserID := discordSession.State.User.ID
+func (m *Module) isMentioned(mc *discordgo.MessageCreate) bool {
+	botUserID := m.session.State.User.ID
 
-	for _, user := range m.Mentions {
+	for _, user := range mc.Mentions {
 		if user.ID == botUserID {
 			return true
 		}
@@ -298,18 +464,18 @@ func isMentioned(m *discordgo.MessageCreate) bool {
 	return false
 }
 
-func generateAnswer(m *discordgo.MessageCreate, imageURLs []string) (string, error) {
-	channelTypingFunc(discordSession, m.ChannelID)
+func (m *Module) generateAnswerImpl(mc *discordgo.MessageCreate, imageURLs []string) (string, error) {
+	m.channelTyping(m.session, mc.ChannelID)
 
-	chatHistory, err := getLastNMessagesFromDatabase(m.ChannelID, 10)
+	chatHistory, err := m.getLastNMessagesFromDatabase(mc.ChannelID, 10)
 	if err != nil {
 		slog.Error("Error while getting chat history", "error", err)
 		chatHistory = []LLMChatMessage{}
 	}
 
-	systemMessageBase := `Discord-Chatbot, Name ` + util.GetBotDisplayName(m, discordSession) + `.
-Channel ` + util.GetChannelName(discordSession, m.ChannelID) + `, Server ` + util.GetGuildName(discordSession, m.GuildID) + `. Mehrere Benutzer gleichzeitig.
-Im Channel: ` + util.GetAllMembersOfChannelAsString(discordSession, m.ChannelID) + `.
+	systemMessageBase := `Discord-Chatbot, Name ` + util.GetBotDisplayName(mc, m.session) + `.
+Channel ` + util.GetChannelName(m.session, mc.ChannelID) + `, Server ` + util.GetGuildName(m.session, mc.GuildID) + `. Mehrere Benutzer gleichzeitig.
+Im Channel: ` + util.GetAllMembersOfChannelAsString(m.session, mc.ChannelID) + `.
 ---
 Nachrichten kommen so: [Zeitstempel] [Benutzername]: [Nachricht]
 ---
@@ -326,14 +492,14 @@ Manche Namen sind Pseudonyme (Benutzer 1, 2, …) für anonyme Teilnehmer. Echte
 	messages := []openai.ChatCompletionMessageParamUnion{}
 	messages = append(messages, openai.SystemMessage(systemMessage))
 
-	if m.MessageReference != nil {
-		refMsg, refErr := fetchReferencedMessageFunc(discordSession, m.MessageReference)
+	if mc.MessageReference != nil {
+		refMsg, refErr := m.fetchReferencedMessage(m.session, mc.MessageReference)
 		if refErr != nil {
 			slog.Warn("gippity: could not fetch referenced message", "error", refErr)
 		} else if refMsg != nil {
 			content := refMsg.Content
 			isBot := refMsg.Author != nil && refMsg.Author.Bot
-			if !isBot && refMsg.Author != nil && getUserPrivacy(refMsg.Author.ID) {
+			if !isBot && refMsg.Author != nil && m.getUserPrivacy(refMsg.Author.ID) {
 				content = "[message content hidden -- user opted out]"
 			}
 			authorName := ""
@@ -350,13 +516,13 @@ Manche Namen sind Pseudonyme (Benutzer 1, 2, …) für anonyme Teilnehmer. Echte
 	privacyCache := make(map[string]bool)
 
 	for _, message := range chatHistory {
-		if message.UserID == discordSession.State.User.ID {
+		if message.UserID == m.session.State.User.ID {
 			messages = append(messages, openai.ChatCompletionMessageParamUnion(openai.AssistantMessage(message.Message)))
 			continue
 		}
 
 		if _, cached := privacyCache[message.UserID]; !cached {
-			privacyCache[message.UserID] = getUserPrivacy(message.UserID)
+			privacyCache[message.UserID] = m.getUserPrivacy(message.UserID)
 		}
 		if !message.IsBotMention && privacyCache[message.UserID] {
 			pseudo, ok := pseudonymMap[message.UserID]
@@ -374,7 +540,7 @@ Manche Namen sind Pseudonyme (Benutzer 1, 2, …) für anonyme Teilnehmer. Echte
 			continue
 		}
 
-		replaceAllUserIDsWithUsernamesInMessage(&message)
+		m.replaceAllUserIDsWithUsernamesInMessage(&message)
 		removeSpoilerTagContent(&message)
 		messages = append(messages, openai.ChatCompletionMessageParamUnion(openai.UserMessage(convertLLMChatMessageToLLMCompatibleFlowingText(message))))
 	}
@@ -397,10 +563,10 @@ Manche Namen sind Pseudonyme (Benutzer 1, 2, …) für anonyme Teilnehmer. Echte
 		})
 	}
 
-	if m.Content == "" {
-		sanitizedString := convertDiscordMessageToLLMCompatibleFlowingText(m)
+	if mc.Content == "" {
+		sanitizedString := m.convertDiscordMessageToLLMCompatibleFlowingText(mc)
 		sanitizedString = removeSpoilerTagContentInStringMessage(sanitizedString)
-		sanitizedString = replaceAllUserIDsWithUsernamesInStringMessage(sanitizedString, m.GuildID)
+		sanitizedString = m.replaceAllUserIDsWithUsernamesInStringMessage(sanitizedString, mc.GuildID)
 		// TODO: this could potentially break if we chose to no include user ids in message later
 		messages = append(messages, openai.ChatCompletionMessageParamUnion(openai.UserMessage(sanitizedString)))
 	}
@@ -411,7 +577,7 @@ Manche Namen sind Pseudonyme (Benutzer 1, 2, …) für anonyme Teilnehmer. Echte
 		}
 	}
 
-	chatCompletion, err := chatCompletionFunc(context.Background(), openai.ChatCompletionNewParams{
+	chatCompletion, err := m.chatCompletion(context.Background(), openai.ChatCompletionNewParams{
 		Messages:  messages,
 		Model:     llm.Model(),
 		N:         openai.Int(1),
@@ -60,14 +60,14 @@ func extractImageURLs(attachments []*discordgo.MessageAttachment) []string {
 	return urls
 }
 
-func convertDiscordMessageToLLMCompatibleFlowingText(m *discordgo.MessageCreate) string {
-	if idToNameCache[m.Author.ID] == "" {
-		idToNameCache[m.Author.ID] = util.GetUsernameInGuild(discordSession, m)
-	}
+func (m *Module) convertDiscordMessageToLLMCompatibleFlowingText(mc *discordgo.MessageCreate) string {
+	username := m.cachedName(mc.Author.ID, func() string {
+		return util.GetUsernameInGuild(m.session, mc)
+	})
 	llmChatMessage := LLMChatMessage{
-		Message:         m.Content,
-		Username:        idToNameCache[m.Author.ID],
-		TimestampString: m.Timestamp.Format("2006-01-02 15:04:05"),
+		Message:         mc.Content,
+		Username:        username,
+		TimestampString: mc.Timestamp.Format("2006-01-02 15:04:05"),
 	}
 	return convertLLMChatMessageToLLMCompatibleFlowingText(llmChatMessage)
 }
@@ -85,7 +85,7 @@ func removeSpoilerTagContentInStringMessage(message string) string {
 	return llmChatMessage.Message
 }
 
-func replaceAllUserIDsWithUsernamesInMessage(message *LLMChatMessage) {
+func (m *Module) replaceAllUserIDsWithUsernamesInMessage(message *LLMChatMessage) {
 	regexp := regexp.MustCompile(`<@!?(\d+)>`)
 	matches := regexp.FindAllStringSubmatch(message.Message, -1)
 	idToName := make(map[string]string)
@@ -95,7 +95,7 @@ func replaceAllUserIDsWithUsernamesInMessage(message *LLMChatMessage) {
 		userID := match[1]    // The captured user ID, e.g., "266646297707020289"
 
 		if idToName[userID] == "" {
-			username := util.GetUsernameForUserIDInGuild(discordSession, userID, message.GuildID)
+			username := util.GetUsernameForUserIDInGuild(m.session, userID, message.GuildID)
 			if username == "" {
 				username = "Unbekannter Benutzer"
 			}
@@ -129,16 +129,12 @@ func decodeModifier(fallback string, modifiers []string) string {
 	return string(decodedString)
 }
 
-// fetchReferencedMessageFunc is the var used in tests to mock fetchReferencedMessage.
-var fetchReferencedMessageFunc = fetchReferencedMessage
-
-// channelMessageFunc is the var used in tests to mock the Discord API fallback.
-var channelMessageFunc = func(s *discordgo.Session, channelID, messageID string) (*discordgo.Message, error) {
+func channelMessageImpl(s *discordgo.Session, channelID, messageID string) (*discordgo.Message, error) {
 	return s.ChannelMessage(channelID, messageID)
 }
 
-func fetchReferencedMessage(s *discordgo.Session, ref *discordgo.MessageReference) (*discordgo.Message, error) {
-	dbMsg, err := getMessageFromDatabase(ref.MessageID)
+func (m *Module) fetchReferencedMessageImpl(s *discordgo.Session, ref *discordgo.MessageReference) (*discordgo.Message, error) {
+	dbMsg, err := m.getMessageFromDatabase(ref.MessageID)
 	if err != nil {
 		slog.Warn("gippity: DB lookup for referenced message failed", "messageID", ref.MessageID, "error", err)
 	}
@@ -152,14 +148,14 @@ func fetchReferencedMessage(s *discordgo.Session, ref *discordgo.MessageReferenc
 		}, nil
 	}
 
-	return channelMessageFunc(s, ref.ChannelID, ref.MessageID)
+	return m.channelMessage(s, ref.ChannelID, ref.MessageID)
 }
 
-func replaceAllUserIDsWithUsernamesInStringMessage(message string, guildid string) string {
+func (m *Module) replaceAllUserIDsWithUsernamesInStringMessage(message string, guildid string) string {
 	llmChatMessage := LLMChatMessage{
 		Message: message,
 		GuildID: guildid,
 	}
-	replaceAllUserIDsWithUsernamesInMessage(&llmChatMessage)
+	m.replaceAllUserIDsWithUsernamesInMessage(&llmChatMessage)
 	return llmChatMessage.Message
 }
@@ -8,6 +8,7 @@ import (
 )
 
 func TestEnrichSystemMessage_returnsInputUnchanged(t *testing.T) {
+	t.Parallel()
 	cases := []string{
 		"",
 		"hello world",
@@ -23,6 +24,7 @@ func TestEnrichSystemMessage_returnsInputUnchanged(t *testing.T) {
 }
 
 func TestDecodeModifier(t *testing.T) {
+	t.Parallel()
 	got := decodeModifier("fallback", []string{"c3Bvb2t5"})
 	if got != "spooky" {
 		t.Fatalf("decodeModifier() = %q, want spooky", got)
@@ -35,6 +37,7 @@ func TestDecodeModifier(t *testing.T) {
 }
 
 func TestRemoveSpoilerTagContent(t *testing.T) {
+	t.Parallel()
 	cases := []struct {
 		input string
 		want  string
@@ -55,6 +58,7 @@ func TestRemoveSpoilerTagContent(t *testing.T) {
 }
 
 func TestRemoveSpoilerTagContentInStringMessage(t *testing.T) {
+	t.Parallel()
 	got := removeSpoilerTagContentInStringMessage("tell me ||the answer||")
 	if got != "tell me ||Spoiler||" {
 		t.Errorf("unexpected result: %q", got)
@@ -62,14 +66,17 @@ func TestRemoveSpoilerTagContentInStringMessage(t *testing.T) {
 }
 
 func TestReplaceAllUserIDsWithUsernamesInStringMessage_NoMentions(t *testing.T) {
+	t.Parallel()
+	m := newTestModule(t)
 	input := "Hello world"
-	got := replaceAllUserIDsWithUsernamesInStringMessage(input, "guild123")
+	got := m.replaceAllUserIDsWithUsernamesInStringMessage(input, "guild123")
 	if got != input {
-		t.Errorf("replaceAllUserIDsWithUsernamesInStringMessage(%q) = %q, want unchanged", input, got)
+		t.Errorf("m.replaceAllUserIDsWithUsernamesInStringMessage(%q) = %q, want unchanged", input, got)
 	}
 }
 
 func TestConvertLLMChatMessageToLLMCompatibleFlowingText(t *testing.T) {
+	t.Parallel()
 	msg := LLMChatMessage{
 		TimestampString: "2026-05-01 12:00:00",
 		Username:        "Alice",
@@ -88,12 +95,13 @@ func TestConvertLLMChatMessageToLLMCompatibleFlowingText(t *testing.T) {
 }
 
 func TestFetchReferencedMessage_FoundInDB(t *testing.T) {
-	setupGippityTest(t)
-	idToNameCache["user-2"] = "Bob"
-	idToNameCache["channel-1"] = "general"
-	idToNameCache["allowed-guild"] = "Test Guild"
+	t.Parallel()
+	m := newTestModule(t)
+	m.idToNameCache["user-2"] = "Bob"
+	m.idToNameCache["channel-1"] = "general"
+	m.idToNameCache["allowed-guild"] = "Test Guild"
 
-	if _, err := database.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		"user-2", "channel-1", 1000, "the referenced content", "ref-db-msg", "allowed-guild", 0); err != nil {
 		t.Fatalf("insert: %v", err)
 	}
@@ -103,7 +111,7 @@ func TestFetchReferencedMessage_FoundInDB(t *testing.T) {
 		ChannelID: "channel-1",
 		GuildID:   "allowed-guild",
 	}
-	msg, err := fetchReferencedMessage(discordSession, ref)
+	msg, err := m.fetchReferencedMessageImpl(m.session, ref)
 	if err != nil {
 		t.Fatalf("fetchReferencedMessage: %v", err)
 	}
@@ -120,12 +128,11 @@ func TestFetchReferencedMessage_FoundInDB(t *testing.T) {
 }
 
 func TestFetchReferencedMessage_NotInDB_FallsBackToAPI(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
 	apiCalled := false
-	prevCMF := channelMessageFunc
-	t.Cleanup(func() { channelMessageFunc = prevCMF })
-	channelMessageFunc = func(_ *discordgo.Session, _, msgID string) (*discordgo.Message, error) {
+	m.channelMessage = func(_ *discordgo.Session, _, msgID string) (*discordgo.Message, error) {
 		apiCalled = true
 		return &discordgo.Message{
 			ID:      msgID,
@@ -140,7 +147,7 @@ func TestFetchReferencedMessage_NotInDB_FallsBackToAPI(t *testing.T) {
 		GuildID:   "allowed-guild",
 	}
 	// "api-msg-id" is not in the DB — fetchReferencedMessage must fall back to channelMessageFunc.
-	msg, err := fetchReferencedMessage(discordSession, ref)
+	msg, err := m.fetchReferencedMessageImpl(m.session, ref)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -153,6 +160,7 @@ func TestFetchReferencedMessage_NotInDB_FallsBackToAPI(t *testing.T) {
 }
 
 func TestConvertLLMChatMessageToLLMCompatibleFlowingText_WithImageDescriptions(t *testing.T) {
+	t.Parallel()
 	msg := LLMChatMessage{
 		TimestampString:   "2026-05-01 12:00:00",
 		Username:          "Alice",
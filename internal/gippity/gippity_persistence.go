@@ -2,9 +2,10 @@ package gippity
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log/slog"
 	"strings"
-	"sync"
 
 	"github.com/bwmarrin/discordgo"
 	// sqlite3 driver
@@ -40,60 +41,77 @@ type LLMChatMessage struct {
 
 const chatHistoryDBFilename = "gippity.db"
 
-var database *sql.DB
-var dbMu sync.Mutex
-var idToNameCache = make(map[string]string)
+var errDBClosed = errors.New("gippity: database closed")
 
-func initDB() {
-	var err error
-	database, err = sql.Open("sqlite3", chatHistoryDBFilename+"?_journal=WAL&_busy_timeout=5000")
+// openDB opens the chat history database at path and ensures the schema exists.
+func (m *Module) openDB(path string) error {
+	db, err := sql.Open("sqlite3", path+"?_journal=WAL&_busy_timeout=5000")
 	if err != nil {
-		slog.Error("Error while opening database", "error", err)
-		return
+		return err
+	}
+	if err := migrateDB(db); err != nil {
+		_ = db.Close()
+		return err
 	}
+	m.dbMu.Lock()
+	m.db = db
+	m.dbMu.Unlock()
+	return nil
+}
 
-	_, err = database.Exec(`CREATE TABLE IF NOT EXISTS chat_history (user_id text, channel_id text, timestamp integer, message text, message_id text, guild_id text)`)
-	if err != nil {
-		slog.Error("Error while creating chat_history table", "error", err)
+func migrateDB(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS chat_history (user_id text, channel_id text, timestamp integer, message text, message_id text, guild_id text)`); err != nil {
+		return fmt.Errorf("create chat_history table: %w", err)
 	}
 
 	// idempotent: ignore error if column already exists
-	_, _ = database.Exec(`ALTER TABLE chat_history ADD COLUMN is_bot_mention INTEGER DEFAULT 0`)
+	_, _ = db.Exec(`ALTER TABLE chat_history ADD COLUMN is_bot_mention INTEGER DEFAULT 0`)
 
-	_, err = database.Exec(`CREATE TABLE IF NOT EXISTS user_privacy (user_id TEXT PRIMARY KEY, privacy_enabled INTEGER NOT NULL DEFAULT 1)`)
-	if err != nil {
-		slog.Error("Error while creating user_privacy table", "error", err)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS user_privacy (user_id TEXT PRIMARY KEY, privacy_enabled INTEGER NOT NULL DEFAULT 1)`); err != nil {
+		return fmt.Errorf("create user_privacy table: %w", err)
 	}
 
-	_, err = database.Exec(`CREATE TABLE IF NOT EXISTS chat_attachments (id INTEGER PRIMARY KEY AUTOINCREMENT, message_id TEXT, attachment_url TEXT, image_description TEXT)`)
-	if err != nil {
-		slog.Error("Error while creating chat_attachments table", "error", err)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS chat_attachments (id INTEGER PRIMARY KEY AUTOINCREMENT, message_id TEXT, attachment_url TEXT, image_description TEXT)`); err != nil {
+		return fmt.Errorf("create chat_attachments table: %w", err)
 	}
 	// idempotent: add columns missing from pre-existing migration-created tables
-	_, _ = database.Exec(`ALTER TABLE chat_attachments ADD COLUMN message_id TEXT`)
-	_, _ = database.Exec(`ALTER TABLE chat_attachments ADD COLUMN image_description TEXT`)
+	_, _ = db.Exec(`ALTER TABLE chat_attachments ADD COLUMN message_id TEXT`)
+	_, _ = db.Exec(`ALTER TABLE chat_attachments ADD COLUMN image_description TEXT`)
 
-	_, err = database.Exec(`CREATE TABLE IF NOT EXISTS chat_history_edits (id INTEGER PRIMARY KEY AUTOINCREMENT, original_message_id TEXT, edited_content TEXT, version INTEGER, edited_at INTEGER)`)
-	if err != nil {
-		slog.Error("Error while creating chat_history_edits table", "error", err)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS chat_history_edits (id INTEGER PRIMARY KEY AUTOINCREMENT, original_message_id TEXT, edited_content TEXT, version INTEGER, edited_at INTEGER)`); err != nil {
+		return fmt.Errorf("create chat_history_edits table: %w", err)
 	}
-	_, err = database.Exec(`CREATE INDEX IF NOT EXISTS idx_chat_history_edits_original ON chat_history_edits(original_message_id, version)`)
-	if err != nil {
-		slog.Error("Error while creating index on chat_history_edits", "error", err)
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_chat_history_edits_original ON chat_history_edits(original_message_id, version)`); err != nil {
+		return fmt.Errorf("create chat_history_edits index: %w", err)
 	}
+	return nil
 }
 
-// CloseDB closes the gippity chat history database.
-func CloseDB() {
-	if database != nil {
-		if err := database.Close(); err != nil {
-			slog.Error("error closing gippity database", "error", err)
-		}
+// getDB returns the open database handle, or nil once the module has shut down.
+func (m *Module) getDB() *sql.DB {
+	m.dbMu.RLock()
+	defer m.dbMu.RUnlock()
+	return m.db
+}
+
+// closeDB closes the chat history database.
+func (m *Module) closeDB() error {
+	m.dbMu.Lock()
+	defer m.dbMu.Unlock()
+	if m.db == nil {
+		return nil
 	}
+	err := m.db.Close()
+	m.db = nil
+	return err
 }
 
-func addMessageToDatabase(m *discordgo.MessageCreate, isBotMention bool) {
-	stmt, err := database.Prepare("INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)")
+func (m *Module) addMessageToDatabase(mc *discordgo.MessageCreate, isBotMention bool) {
+	db := m.getDB()
+	if db == nil {
+		return
+	}
+	stmt, err := db.Prepare("INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		slog.Error("Error while preparing statement", "error", err)
 		return
@@ -104,21 +122,25 @@ func addMessageToDatabase(m *discordgo.MessageCreate, isBotMention bool) {
 	if isBotMention {
 		botMentionInt = 1
 	}
-	_, err = stmt.Exec(m.Author.ID, m.ChannelID, util.GetTimestampOfMessage(m.ID).Unix(), m.Content, m.ID, m.GuildID, botMentionInt)
+	_, err = stmt.Exec(mc.Author.ID, mc.ChannelID, util.GetTimestampOfMessage(mc.ID).Unix(), mc.Content, mc.ID, mc.GuildID, botMentionInt)
 	if err != nil {
 		slog.Error("Error while inserting message into database", "error", err)
 	}
 }
 
-func addMessageEditToDatabase(messageID, content string, editedAt int64) {
-	dbMu.Lock()
-	defer dbMu.Unlock()
+func (m *Module) addMessageEditToDatabase(messageID, content string, editedAt int64) {
+	db := m.getDB()
+	if db == nil {
+		return
+	}
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
 	var maxVersion int
-	if err := database.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM chat_history_edits WHERE original_message_id = ?`, messageID).Scan(&maxVersion); err != nil {
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM chat_history_edits WHERE original_message_id = ?`, messageID).Scan(&maxVersion); err != nil {
 		slog.Error("Error while querying max edit version", "error", err)
 		return
 	}
-	_, err := database.Exec(
+	_, err := db.Exec(
 		`INSERT INTO chat_history_edits (original_message_id, edited_content, version, edited_at) VALUES (?, ?, ?, ?)`,
 		messageID, content, maxVersion+1, editedAt,
 	)
@@ -127,10 +149,14 @@ func addMessageEditToDatabase(messageID, content string, editedAt int64) {
 	}
 }
 
-func addAttachmentsToDatabase(messageID string, urls []string, description string) {
-	dbMu.Lock()
-	defer dbMu.Unlock()
-	_, err := database.Exec(
+func (m *Module) addAttachmentsToDatabase(messageID string, urls []string, description string) {
+	db := m.getDB()
+	if db == nil {
+		return
+	}
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	_, err := db.Exec(
 		"INSERT INTO chat_attachments (message_id, attachment_url, image_description) VALUES (?, ?, ?)",
 		messageID, strings.Join(urls, ","), description,
 	)
@@ -139,8 +165,12 @@ func addAttachmentsToDatabase(messageID string, urls []string, description strin
 	}
 }
 
-func getLastNMessagesFromDatabase(channelID string, n int) ([]LLMChatMessage, error) {
-	stmt, err := database.Prepare(`
+func (m *Module) getLastNMessagesFromDatabase(channelID string, n int) ([]LLMChatMessage, error) {
+	db := m.getDB()
+	if db == nil {
+		return nil, errDBClosed
+	}
+	stmt, err := db.Prepare(`
 	SELECT ch.user_id, ch.channel_id, ch.timestamp,
 	       COALESCE((SELECT edited_content FROM chat_history_edits WHERE original_message_id = ch.message_id ORDER BY version DESC LIMIT 1), ch.message) as message,
 	       ch.message_id, ch.guild_id,
@@ -193,19 +223,7 @@ func getLastNMessagesFromDatabase(channelID string, n int) ([]LLMChatMessage, er
 			message.ImageDescriptions = append(message.ImageDescriptions, *imageDescConcat)
 		}
 
-		if idToNameCache[message.UserID] == "" {
-			idToNameCache[message.UserID] = util.GetUsernameForUserIDInGuild(discordSession, message.UserID, message.GuildID)
-		}
-		if idToNameCache[message.ChannelID] == "" {
-			idToNameCache[message.ChannelID] = util.GetChannelName(discordSession, message.ChannelID)
-		}
-		if idToNameCache[message.GuildID] == "" {
-			idToNameCache[message.GuildID] = util.GetGuildName(discordSession, message.GuildID)
-		}
-
-		message.Username = idToNameCache[message.UserID]
-		message.ChannelName = idToNameCache[message.ChannelID]
-		message.GuildName = idToNameCache[message.GuildID]
+		m.resolveNames(&message)
 		message.TimestampString = util.GetTimestampOfMessage(message.MessageID).Format("2006-01-02 15:04:05")
 
 		llmMessages = append(llmMessages, message)
@@ -214,8 +232,12 @@ func getLastNMessagesFromDatabase(channelID string, n int) ([]LLMChatMessage, er
 	return llmMessages, nil
 }
 
-func getMessageFromDatabase(messageID string) (*LLMChatMessage, error) {
-	stmt, err := database.Prepare(`
+func (m *Module) getMessageFromDatabase(messageID string) (*LLMChatMessage, error) {
+	db := m.getDB()
+	if db == nil {
+		return nil, errDBClosed
+	}
+	stmt, err := db.Prepare(`
 	SELECT ch.user_id, ch.channel_id, ch.timestamp,
 	       COALESCE((SELECT edited_content FROM chat_history_edits WHERE original_message_id = ch.message_id ORDER BY version DESC LIMIT 1), ch.message) as message,
 	       ch.message_id, ch.guild_id,
@@ -255,27 +277,19 @@ func getMessageFromDatabase(messageID string) (*LLMChatMessage, error) {
 		message.ImageDescriptions = strings.Split(*imageDescConcat, "||")
 	}
 
-	if idToNameCache[message.UserID] == "" {
-		idToNameCache[message.UserID] = util.GetUsernameForUserIDInGuild(discordSession, message.UserID, message.GuildID)
-	}
-	if idToNameCache[message.ChannelID] == "" {
-		idToNameCache[message.ChannelID] = util.GetChannelName(discordSession, message.ChannelID)
-	}
-	if idToNameCache[message.GuildID] == "" {
-		idToNameCache[message.GuildID] = util.GetGuildName(discordSession, message.GuildID)
-	}
-
-	message.Username = idToNameCache[message.UserID]
-	message.ChannelName = idToNameCache[message.ChannelID]
-	message.GuildName = idToNameCache[message.GuildID]
+	m.resolveNames(&message)
 	message.TimestampString = util.GetTimestampOfMessage(message.MessageID).Format("2006-01-02 15:04:05")
 	return &message, nil
 }
 
 // getUserPrivacy returns true (privacy on) by default; explicit opt-out returns false.
-func getUserPrivacy(userID string) bool {
+func (m *Module) getUserPrivacy(userID string) bool {
+	db := m.getDB()
+	if db == nil {
+		return true
+	}
 	var enabled int
-	err := database.QueryRow(`SELECT privacy_enabled FROM user_privacy WHERE user_id = ?`, userID).Scan(&enabled)
+	err := db.QueryRow(`SELECT privacy_enabled FROM user_privacy WHERE user_id = ?`, userID).Scan(&enabled)
 	if err == sql.ErrNoRows {
 		return true
 	}
@@ -287,14 +301,53 @@ func getUserPrivacy(userID string) bool {
 }
 
 // setUserPrivacy stores or updates the privacy preference for a user.
-func setUserPrivacy(userID string, enabled bool) error {
+func (m *Module) setUserPrivacy(userID string, enabled bool) error {
+	db := m.getDB()
+	if db == nil {
+		return errDBClosed
+	}
 	enabledInt := 0
 	if enabled {
 		enabledInt = 1
 	}
-	_, err := database.Exec(
+	_, err := db.Exec(
 		`INSERT INTO user_privacy (user_id, privacy_enabled) VALUES (?, ?) ON CONFLICT(user_id) DO UPDATE SET privacy_enabled = excluded.privacy_enabled`,
 		userID, enabledInt,
 	)
 	return err
 }
+
+// resolveNames fills in the display names for a stored message from the name cache.
+func (m *Module) resolveNames(message *LLMChatMessage) {
+	message.Username = m.cachedName(message.UserID, func() string {
+		return util.GetUsernameForUserIDInGuild(m.session, message.UserID, message.GuildID)
+	})
+	message.ChannelName = m.cachedName(message.ChannelID, func() string {
+		return util.GetChannelName(m.session, message.ChannelID)
+	})
+	message.GuildName = m.cachedName(message.GuildID, func() string {
+		return util.GetGuildName(m.session, message.GuildID)
+	})
+}
+
+// cachedName returns the cached display name for id, resolving and storing it on a miss.
+func (m *Module) cachedName(id string, resolve func() string) string {
+	m.namesMu.Lock()
+	name, ok := m.idToNameCache[id]
+	m.namesMu.Unlock()
+	if ok && name != "" {
+		return name
+	}
+	name = resolve()
+	m.namesMu.Lock()
+	m.idToNameCache[id] = name
+	m.namesMu.Unlock()
+	return name
+}
+
+// resetNameCache drops every cached display name.
+func (m *Module) resetNameCache() {
+	m.namesMu.Lock()
+	m.idToNameCache = make(map[string]string)
+	m.namesMu.Unlock()
+}
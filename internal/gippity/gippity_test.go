@@ -3,47 +3,33 @@ package gippity
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	openai "github.com/openai/openai-go/v3"
+	"github.com/toksikk/gidbig/internal/bot"
+	"github.com/toksikk/gidbig/internal/cfg"
 	"github.com/toksikk/gidbig/internal/llm"
 )
 
-var previousDescribeImagesFunc func([]string) (string, error)
-
-func setupGippityTest(t *testing.T) *discordgo.Session {
+// newTestModule returns a Module backed by an in-memory database with
+// allowed-guild enabled and no-op Discord hooks.
+func newTestModule(t *testing.T) *Module {
 	t.Helper()
 
-	previousDatabase := database
-	previousDiscordSession := discordSession
-	previousAllowedGuildIDs := allowedGuildIDs
-	previousIgnoredUserIDs := ignoredUserIDs
-	previousUserMessageCount := userMessageCount
-	previousUserMessageCountLastReset := userMessageCountLastReset
-	previousGenerateAnswerFunc := generateAnswerFunc
-	previousDescribeImagesFunc = describeImagesFunc
-	previousChatCompletionFunc := chatCompletionFunc
-	previousVisionCompletionFunc := visionCompletionFunc
-	previousChannelTypingFunc := channelTypingFunc
-
 	testDB, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
 		t.Fatalf("open test database: %v", err)
 	}
-	if _, err := testDB.Exec(`CREATE TABLE chat_history (user_id text, channel_id text, timestamp integer, message text, message_id text, guild_id text, is_bot_mention integer default 0)`); err != nil {
-		t.Fatalf("create chat_history table: %v", err)
-	}
-	if _, err := testDB.Exec(`CREATE TABLE user_privacy (user_id TEXT PRIMARY KEY, privacy_enabled INTEGER NOT NULL DEFAULT 1)`); err != nil {
-		t.Fatalf("create user_privacy table: %v", err)
-	}
-	if _, err := testDB.Exec(`CREATE TABLE chat_attachments (id INTEGER PRIMARY KEY AUTOINCREMENT, message_id TEXT, attachment_url TEXT, image_description TEXT)`); err != nil {
-		t.Fatalf("create chat_attachments table: %v", err)
-	}
-	if _, err := testDB.Exec(`CREATE TABLE chat_history_edits (id INTEGER PRIMARY KEY AUTOINCREMENT, original_message_id TEXT, edited_content TEXT, version INTEGER, edited_at INTEGER)`); err != nil {
-		t.Fatalf("create chat_history_edits table: %v", err)
+	// every pooled connection to :memory: would otherwise get its own empty database
+	testDB.SetMaxOpenConns(1)
+	if err := migrateDB(testDB); err != nil {
+		t.Fatalf("migrate test database: %v", err)
 	}
 
 	session, err := discordgo.New("")
@@ -52,44 +38,29 @@ func setupGippityTest(t *testing.T) *discordgo.Session {
 	}
 	session.State.User = &discordgo.User{ID: "bot-user"}
 
-	database = testDB
-	discordSession = session
-	allowedGuildIDs = map[string]bool{"allowed-guild": true}
-	ignoredUserIDs = map[string]bool{}
-	userMessageCount = map[string]int{}
-	userMessageCountLastReset = map[string]time.Time{}
-	generateAnswerFunc = generateAnswer
-	channelTypingFunc = func(_ *discordgo.Session, _ string) {}
-
-	t.Cleanup(func() {
-		_ = testDB.Close()
-		database = previousDatabase
-		discordSession = previousDiscordSession
-		allowedGuildIDs = previousAllowedGuildIDs
-		ignoredUserIDs = previousIgnoredUserIDs
-		userMessageCount = previousUserMessageCount
-		userMessageCountLastReset = previousUserMessageCountLastReset
-		generateAnswerFunc = previousGenerateAnswerFunc
-		describeImagesFunc = previousDescribeImagesFunc
-		chatCompletionFunc = previousChatCompletionFunc
-		visionCompletionFunc = previousVisionCompletionFunc
-		channelTypingFunc = previousChannelTypingFunc
-	})
-
-	return session
+	m := New()
+	m.session = session
+	m.db = testDB
+	m.allowedGuildIDs["allowed-guild"] = true
+	m.channelTyping = func(_ *discordgo.Session, _ string) {}
+
+	t.Cleanup(func() { _ = m.closeDB() })
+
+	return m
 }
 
 func TestDescribeImagesUsesConfiguredVisionModel(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 	var model string
-	visionCompletionFunc = func(_ context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	m.visionCompletion = func(_ context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
 		model = params.Model
 		return &openai.ChatCompletion{
 			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "description"}}},
 		}, nil
 	}
 
-	got, err := describeImages([]string{"https://example.com/image.png"})
+	got, err := m.describeImagesImpl([]string{"https://example.com/image.png"})
 	if err != nil {
 		t.Fatalf("describeImages: %v", err)
 	}
@@ -118,59 +89,65 @@ func gippityTestMessage(content string, mentions ...*discordgo.User) *discordgo.
 }
 
 func TestOnMessageCreate_StoresNonMentionedMessageWithoutGeneratingAnswer(t *testing.T) {
-	session := setupGippityTest(t)
-	generateAnswerFunc = func(_ *discordgo.MessageCreate, _ []string) (string, error) {
-		t.Fatal("generateAnswerFunc should not be called for non-mentioned messages")
+	t.Parallel()
+	m := newTestModule(t)
+	session := m.session
+	m.generateAnswer = func(_ *discordgo.MessageCreate, _ []string) (string, error) {
+		t.Fatal("generateAnswer should not be called for non-mentioned messages")
 		return "", nil
 	}
 
-	onMessageCreate(session, gippityTestMessage("ordinary channel message"))
+	m.onMessageCreate(session, gippityTestMessage("ordinary channel message"))
 
 	var message string
-	err := database.QueryRow("SELECT message FROM chat_history WHERE message_id = ?", "1367540149316120650").Scan(&message)
+	err := m.db.QueryRow("SELECT message FROM chat_history WHERE message_id = ?", "1367540149316120650").Scan(&message)
 	if err != nil {
 		t.Fatalf("expected non-mentioned message to be stored: %v", err)
 	}
 	if message != "ordinary channel message" {
 		t.Errorf("stored message = %q, want %q", message, "ordinary channel message")
 	}
-	if len(userMessageCount) != 0 {
-		t.Errorf("non-mentioned message should not count toward mention rate limit, got %d users", len(userMessageCount))
+	if len(m.userMessageCount) != 0 {
+		t.Errorf("non-mentioned message should not count toward mention rate limit, got %d users", len(m.userMessageCount))
 	}
 }
 
 func TestLimited_AllowsMentionedMessageInAllowedGuild(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	m := gippityTestMessage("hey <@bot-user>", &discordgo.User{ID: "bot-user"})
+	mc := gippityTestMessage("hey <@bot-user>", &discordgo.User{ID: "bot-user"})
 
-	if limited(m) {
+	if m.limited(mc) {
 		t.Fatal("mentioned message in allowed guild should not be limited")
 	}
 }
 
 func TestLimited_BlocksNonMentionedMessageInAllowedGuild(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if !limited(gippityTestMessage("ordinary channel message")) {
+	if !m.limited(gippityTestMessage("ordinary channel message")) {
 		t.Fatal("non-mentioned message in allowed guild should be limited")
 	}
 }
 
 func TestOnMessageCreate_StoresBotMentionFlag(t *testing.T) {
-	session := setupGippityTest(t)
-	generateAnswerFunc = func(_ *discordgo.MessageCreate, _ []string) (string, error) {
+	t.Parallel()
+	m := newTestModule(t)
+	session := m.session
+	m.generateAnswer = func(_ *discordgo.MessageCreate, _ []string) (string, error) {
 		return "", nil
 	}
 
 	botUser := &discordgo.User{ID: "bot-user"}
-	m := gippityTestMessage("hey <@bot-user>", botUser)
-	m.ID = "mention-msg-id"
+	mc := gippityTestMessage("hey <@bot-user>", botUser)
+	mc.ID = "mention-msg-id"
 
-	onMessageCreate(session, m)
+	m.onMessageCreate(session, mc)
 
 	var isBotMention int
-	err := database.QueryRow("SELECT is_bot_mention FROM chat_history WHERE message_id = ?", "mention-msg-id").Scan(&isBotMention)
+	err := m.db.QueryRow("SELECT is_bot_mention FROM chat_history WHERE message_id = ?", "mention-msg-id").Scan(&isBotMention)
 	if err != nil {
 		t.Fatalf("expected message to be stored: %v", err)
 	}
@@ -180,18 +157,20 @@ func TestOnMessageCreate_StoresBotMentionFlag(t *testing.T) {
 }
 
 func TestOnMessageCreate_StoresNonMentionWithZeroFlag(t *testing.T) {
-	session := setupGippityTest(t)
-	generateAnswerFunc = func(_ *discordgo.MessageCreate, _ []string) (string, error) {
+	t.Parallel()
+	m := newTestModule(t)
+	session := m.session
+	m.generateAnswer = func(_ *discordgo.MessageCreate, _ []string) (string, error) {
 		return "", nil
 	}
 
-	m := gippityTestMessage("just chatting")
-	m.ID = "non-mention-msg-id"
+	mc := gippityTestMessage("just chatting")
+	mc.ID = "non-mention-msg-id"
 
-	onMessageCreate(session, m)
+	m.onMessageCreate(session, mc)
 
 	var isBotMention int
-	err := database.QueryRow("SELECT is_bot_mention FROM chat_history WHERE message_id = ?", "non-mention-msg-id").Scan(&isBotMention)
+	err := m.db.QueryRow("SELECT is_bot_mention FROM chat_history WHERE message_id = ?", "non-mention-msg-id").Scan(&isBotMention)
 	if err != nil {
 		t.Fatalf("expected message to be stored: %v", err)
 	}
@@ -201,27 +180,29 @@ func TestOnMessageCreate_StoresNonMentionWithZeroFlag(t *testing.T) {
 }
 
 func TestGetUserPrivacy_DefaultsToTrue(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if !getUserPrivacy("unknown-user") {
+	if !m.getUserPrivacy("unknown-user") {
 		t.Error("getUserPrivacy for unknown user should default to true (privacy on)")
 	}
 }
 
 func TestSetAndGetUserPrivacy(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if err := setUserPrivacy("user-a", false); err != nil {
+	if err := m.setUserPrivacy("user-a", false); err != nil {
 		t.Fatalf("setUserPrivacy: %v", err)
 	}
-	if getUserPrivacy("user-a") {
+	if m.getUserPrivacy("user-a") {
 		t.Error("getUserPrivacy should return false after setting privacy off")
 	}
 
-	if err := setUserPrivacy("user-a", true); err != nil {
+	if err := m.setUserPrivacy("user-a", true); err != nil {
 		t.Fatalf("setUserPrivacy: %v", err)
 	}
-	if !getUserPrivacy("user-a") {
+	if !m.getUserPrivacy("user-a") {
 		t.Error("getUserPrivacy should return true after re-enabling privacy")
 	}
 }
@@ -249,13 +230,15 @@ func gippityTestMessageWithImage(content string, imageURL string) *discordgo.Mes
 }
 
 func TestOnMessageCreate_DescribesImageForNonMentionMessage(t *testing.T) {
-	session := setupGippityTest(t)
-	generateAnswerFunc = func(_ *discordgo.MessageCreate, _ []string) (string, error) {
-		t.Fatal("generateAnswerFunc should not be called for non-mention message")
+	t.Parallel()
+	m := newTestModule(t)
+	session := m.session
+	m.generateAnswer = func(_ *discordgo.MessageCreate, _ []string) (string, error) {
+		t.Fatal("generateAnswer should not be called for non-mention message")
 		return "", nil
 	}
 	describeCalled := false
-	describeImagesFunc = func(urls []string) (string, error) {
+	m.describeImages = func(urls []string) (string, error) {
 		describeCalled = true
 		if len(urls) != 1 || urls[0] != "https://cdn.example.com/photo.png" {
 			t.Errorf("unexpected image URLs: %v", urls)
@@ -263,16 +246,16 @@ func TestOnMessageCreate_DescribesImageForNonMentionMessage(t *testing.T) {
 		return "a cat on a mat", nil
 	}
 
-	m := gippityTestMessageWithImage("check this out", "https://cdn.example.com/photo.png")
+	mc := gippityTestMessageWithImage("check this out", "https://cdn.example.com/photo.png")
 
-	onMessageCreate(session, m)
+	m.onMessageCreate(session, mc)
 
 	if !describeCalled {
 		t.Error("describeImagesFunc should have been called for image attachment")
 	}
 
 	var url, desc string
-	err := database.QueryRow("SELECT attachment_url, image_description FROM chat_attachments WHERE message_id = ?", "img-msg-id").Scan(&url, &desc)
+	err := m.db.QueryRow("SELECT attachment_url, image_description FROM chat_attachments WHERE message_id = ?", "img-msg-id").Scan(&url, &desc)
 	if err != nil {
 		t.Fatalf("expected attachment row to exist: %v", err)
 	}
@@ -285,17 +268,18 @@ func TestOnMessageCreate_DescribesImageForNonMentionMessage(t *testing.T) {
 }
 
 func TestGetMessageFromDatabase_Found(t *testing.T) {
-	setupGippityTest(t)
-	idToNameCache["user-1"] = "Alice"
-	idToNameCache["channel-1"] = "general"
-	idToNameCache["allowed-guild"] = "Test Guild"
+	t.Parallel()
+	m := newTestModule(t)
+	m.idToNameCache["user-1"] = "Alice"
+	m.idToNameCache["channel-1"] = "general"
+	m.idToNameCache["allowed-guild"] = "Test Guild"
 
-	if _, err := database.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		"user-1", "channel-1", 1000, "hello from db", "db-msg-id", "allowed-guild", 0); err != nil {
 		t.Fatalf("insert: %v", err)
 	}
 
-	msg, err := getMessageFromDatabase("db-msg-id")
+	msg, err := m.getMessageFromDatabase("db-msg-id")
 	if err != nil {
 		t.Fatalf("getMessageFromDatabase: %v", err)
 	}
@@ -312,9 +296,10 @@ func TestGetMessageFromDatabase_Found(t *testing.T) {
 }
 
 func TestGetMessageFromDatabase_NotFound(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	msg, err := getMessageFromDatabase("nonexistent-msg-id")
+	msg, err := m.getMessageFromDatabase("nonexistent-msg-id")
 	if err != nil {
 		t.Fatalf("getMessageFromDatabase returned unexpected error: %v", err)
 	}
@@ -324,19 +309,18 @@ func TestGetMessageFromDatabase_NotFound(t *testing.T) {
 }
 
 func TestGenerateAnswer_NoReference_NoSystemNoteInjected(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
 	fetchCalled := false
-	prev := fetchReferencedMessageFunc
-	t.Cleanup(func() { fetchReferencedMessageFunc = prev })
-	fetchReferencedMessageFunc = func(_ *discordgo.Session, _ *discordgo.MessageReference) (*discordgo.Message, error) {
+	m.fetchReferencedMessage = func(_ *discordgo.Session, _ *discordgo.MessageReference) (*discordgo.Message, error) {
 		fetchCalled = true
 		return nil, nil
 	}
 
 	var capturedMessages []openai.ChatCompletionMessageParamUnion
 	var capturedModel string
-	chatCompletionFunc = func(_ context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	m.chatCompletion = func(_ context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
 		capturedMessages = params.Messages
 		capturedModel = params.Model
 		return &openai.ChatCompletion{
@@ -344,7 +328,7 @@ func TestGenerateAnswer_NoReference_NoSystemNoteInjected(t *testing.T) {
 		}, nil
 	}
 
-	m := &discordgo.MessageCreate{
+	mc := &discordgo.MessageCreate{
 		Message: &discordgo.Message{
 			ID:        "msg-no-ref",
 			ChannelID: "channel-1",
@@ -355,7 +339,7 @@ func TestGenerateAnswer_NoReference_NoSystemNoteInjected(t *testing.T) {
 		},
 	}
 
-	if _, err := generateAnswer(m, nil); err != nil {
+	if _, err := m.generateAnswerImpl(mc, nil); err != nil {
 		t.Fatalf("generateAnswer: %v", err)
 	}
 
@@ -376,15 +360,14 @@ func TestGenerateAnswer_NoReference_NoSystemNoteInjected(t *testing.T) {
 }
 
 func TestGenerateAnswer_ReferencedMessageOptedOutAuthor_PlaceholderInjected(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if !getUserPrivacy("opted-out-user") {
+	if !m.getUserPrivacy("opted-out-user") {
 		t.Fatal("test precondition: opted-out-user should have privacy ON by default")
 	}
 
-	prev := fetchReferencedMessageFunc
-	t.Cleanup(func() { fetchReferencedMessageFunc = prev })
-	fetchReferencedMessageFunc = func(_ *discordgo.Session, _ *discordgo.MessageReference) (*discordgo.Message, error) {
+	m.fetchReferencedMessage = func(_ *discordgo.Session, _ *discordgo.MessageReference) (*discordgo.Message, error) {
 		return &discordgo.Message{
 			ID:      "ref-id",
 			Content: "secret content",
@@ -393,14 +376,14 @@ func TestGenerateAnswer_ReferencedMessageOptedOutAuthor_PlaceholderInjected(t *t
 	}
 
 	var capturedMessages []openai.ChatCompletionMessageParamUnion
-	chatCompletionFunc = func(_ context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	m.chatCompletion = func(_ context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
 		capturedMessages = params.Messages
 		return &openai.ChatCompletion{
 			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "ok"}}},
 		}, nil
 	}
 
-	m := &discordgo.MessageCreate{
+	mc := &discordgo.MessageCreate{
 		Message: &discordgo.Message{
 			ID:        "msg-with-ref",
 			ChannelID: "channel-1",
@@ -416,7 +399,7 @@ func TestGenerateAnswer_ReferencedMessageOptedOutAuthor_PlaceholderInjected(t *t
 		},
 	}
 
-	if _, err := generateAnswer(m, nil); err != nil {
+	if _, err := m.generateAnswerImpl(mc, nil); err != nil {
 		t.Fatalf("generateAnswer: %v", err)
 	}
 
@@ -436,15 +419,14 @@ func TestGenerateAnswer_ReferencedMessageOptedOutAuthor_PlaceholderInjected(t *t
 }
 
 func TestGenerateAnswer_ReferencedMessageOptInAuthor_ContentInjected(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if err := setUserPrivacy("optin-user", false); err != nil {
+	if err := m.setUserPrivacy("optin-user", false); err != nil {
 		t.Fatalf("setUserPrivacy: %v", err)
 	}
 
-	prev := fetchReferencedMessageFunc
-	t.Cleanup(func() { fetchReferencedMessageFunc = prev })
-	fetchReferencedMessageFunc = func(_ *discordgo.Session, _ *discordgo.MessageReference) (*discordgo.Message, error) {
+	m.fetchReferencedMessage = func(_ *discordgo.Session, _ *discordgo.MessageReference) (*discordgo.Message, error) {
 		return &discordgo.Message{
 			ID:      "ref-id",
 			Content: "visible content",
@@ -453,14 +435,14 @@ func TestGenerateAnswer_ReferencedMessageOptInAuthor_ContentInjected(t *testing.
 	}
 
 	var capturedMessages []openai.ChatCompletionMessageParamUnion
-	chatCompletionFunc = func(_ context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	m.chatCompletion = func(_ context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
 		capturedMessages = params.Messages
 		return &openai.ChatCompletion{
 			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "ok"}}},
 		}, nil
 	}
 
-	m := &discordgo.MessageCreate{
+	mc := &discordgo.MessageCreate{
 		Message: &discordgo.Message{
 			ID:        "msg-with-ref-optin",
 			ChannelID: "channel-1",
@@ -476,7 +458,7 @@ func TestGenerateAnswer_ReferencedMessageOptInAuthor_ContentInjected(t *testing.
 		},
 	}
 
-	if _, err := generateAnswer(m, nil); err != nil {
+	if _, err := m.generateAnswerImpl(mc, nil); err != nil {
 		t.Fatalf("generateAnswer: %v", err)
 	}
 
@@ -510,18 +492,20 @@ func gippityTestMessageUpdate(msgID, content, guildID, authorID string) *discord
 }
 
 func TestOnMessageUpdate_PrivacyEnabledUser_EditNotPersisted(t *testing.T) {
-	session := setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
+	session := m.session
 
-	if _, err := database.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		"user-1", "channel-1", 1000, "original", "edit-msg-id", "allowed-guild", 0); err != nil {
 		t.Fatalf("insert: %v", err)
 	}
 
 	// privacy on by default for user-1
-	onMessageUpdate(session, gippityTestMessageUpdate("edit-msg-id", "edited content", "allowed-guild", "user-1"))
+	m.onMessageUpdate(session, gippityTestMessageUpdate("edit-msg-id", "edited content", "allowed-guild", "user-1"))
 
 	var count int
-	if err := database.QueryRow(`SELECT COUNT(*) FROM chat_history_edits WHERE original_message_id = ?`, "edit-msg-id").Scan(&count); err != nil {
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM chat_history_edits WHERE original_message_id = ?`, "edit-msg-id").Scan(&count); err != nil {
 		t.Fatalf("query: %v", err)
 	}
 	if count != 0 {
@@ -530,21 +514,23 @@ func TestOnMessageUpdate_PrivacyEnabledUser_EditNotPersisted(t *testing.T) {
 }
 
 func TestOnMessageUpdate_PrivacyDisabledUser_EditPersisted(t *testing.T) {
-	session := setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
+	session := m.session
 
-	if err := setUserPrivacy("user-1", false); err != nil {
+	if err := m.setUserPrivacy("user-1", false); err != nil {
 		t.Fatalf("setUserPrivacy: %v", err)
 	}
-	if _, err := database.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		"user-1", "channel-1", 1000, "original", "edit-msg-id2", "allowed-guild", 0); err != nil {
 		t.Fatalf("insert: %v", err)
 	}
 
-	onMessageUpdate(session, gippityTestMessageUpdate("edit-msg-id2", "first edit", "allowed-guild", "user-1"))
-	onMessageUpdate(session, gippityTestMessageUpdate("edit-msg-id2", "second edit", "allowed-guild", "user-1"))
+	m.onMessageUpdate(session, gippityTestMessageUpdate("edit-msg-id2", "first edit", "allowed-guild", "user-1"))
+	m.onMessageUpdate(session, gippityTestMessageUpdate("edit-msg-id2", "second edit", "allowed-guild", "user-1"))
 
 	var count int
-	if err := database.QueryRow(`SELECT COUNT(*) FROM chat_history_edits WHERE original_message_id = ?`, "edit-msg-id2").Scan(&count); err != nil {
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM chat_history_edits WHERE original_message_id = ?`, "edit-msg-id2").Scan(&count); err != nil {
 		t.Fatalf("query: %v", err)
 	}
 	if count != 2 {
@@ -553,7 +539,7 @@ func TestOnMessageUpdate_PrivacyDisabledUser_EditPersisted(t *testing.T) {
 
 	var version int
 	var content string
-	if err := database.QueryRow(`SELECT version, edited_content FROM chat_history_edits WHERE original_message_id = ? ORDER BY version DESC LIMIT 1`, "edit-msg-id2").Scan(&version, &content); err != nil {
+	if err := m.db.QueryRow(`SELECT version, edited_content FROM chat_history_edits WHERE original_message_id = ? ORDER BY version DESC LIMIT 1`, "edit-msg-id2").Scan(&version, &content); err != nil {
 		t.Fatalf("query latest edit: %v", err)
 	}
 	if version != 2 {
@@ -565,9 +551,11 @@ func TestOnMessageUpdate_PrivacyDisabledUser_EditPersisted(t *testing.T) {
 }
 
 func TestOnMessageUpdate_NilAuthor_Skipped(t *testing.T) {
-	session := setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
+	session := m.session
 
-	m := &discordgo.MessageUpdate{
+	mc := &discordgo.MessageUpdate{
 		Message: &discordgo.Message{
 			ID:        "nil-author-msg",
 			ChannelID: "channel-1",
@@ -576,10 +564,10 @@ func TestOnMessageUpdate_NilAuthor_Skipped(t *testing.T) {
 			Author:    nil,
 		},
 	}
-	onMessageUpdate(session, m)
+	m.onMessageUpdate(session, mc)
 
 	var count int
-	if err := database.QueryRow(`SELECT COUNT(*) FROM chat_history_edits WHERE original_message_id = ?`, "nil-author-msg").Scan(&count); err != nil {
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM chat_history_edits WHERE original_message_id = ?`, "nil-author-msg").Scan(&count); err != nil {
 		t.Fatalf("query: %v", err)
 	}
 	if count != 0 {
@@ -588,16 +576,18 @@ func TestOnMessageUpdate_NilAuthor_Skipped(t *testing.T) {
 }
 
 func TestOnMessageUpdate_MessageNotInHistory_Skipped(t *testing.T) {
-	session := setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
+	session := m.session
 
-	if err := setUserPrivacy("user-1", false); err != nil {
+	if err := m.setUserPrivacy("user-1", false); err != nil {
 		t.Fatalf("setUserPrivacy: %v", err)
 	}
 
-	onMessageUpdate(session, gippityTestMessageUpdate("unknown-msg-id", "edit of unknown", "allowed-guild", "user-1"))
+	m.onMessageUpdate(session, gippityTestMessageUpdate("unknown-msg-id", "edit of unknown", "allowed-guild", "user-1"))
 
 	var count int
-	if err := database.QueryRow(`SELECT COUNT(*) FROM chat_history_edits WHERE original_message_id = ?`, "unknown-msg-id").Scan(&count); err != nil {
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM chat_history_edits WHERE original_message_id = ?`, "unknown-msg-id").Scan(&count); err != nil {
 		t.Fatalf("query: %v", err)
 	}
 	if count != 0 {
@@ -606,25 +596,26 @@ func TestOnMessageUpdate_MessageNotInHistory_Skipped(t *testing.T) {
 }
 
 func TestGetLastNMessagesFromDatabase_ShowsLatestEdit(t *testing.T) {
-	setupGippityTest(t)
-	idToNameCache["user-1"] = "Alice"
-	idToNameCache["channel-1"] = "general"
-	idToNameCache["allowed-guild"] = "Test Guild"
+	t.Parallel()
+	m := newTestModule(t)
+	m.idToNameCache["user-1"] = "Alice"
+	m.idToNameCache["channel-1"] = "general"
+	m.idToNameCache["allowed-guild"] = "Test Guild"
 
-	if _, err := database.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		"user-1", "channel-1", 1000, "original message", "edited-hist-msg", "allowed-guild", 0); err != nil {
 		t.Fatalf("insert chat_history: %v", err)
 	}
-	if _, err := database.Exec(`INSERT INTO chat_history_edits (original_message_id, edited_content, version, edited_at) VALUES (?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history_edits (original_message_id, edited_content, version, edited_at) VALUES (?, ?, ?, ?)`,
 		"edited-hist-msg", "v1 edit", 1, 1001); err != nil {
 		t.Fatalf("insert edit v1: %v", err)
 	}
-	if _, err := database.Exec(`INSERT INTO chat_history_edits (original_message_id, edited_content, version, edited_at) VALUES (?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history_edits (original_message_id, edited_content, version, edited_at) VALUES (?, ?, ?, ?)`,
 		"edited-hist-msg", "v2 edit", 2, 1002); err != nil {
 		t.Fatalf("insert edit v2: %v", err)
 	}
 
-	msgs, err := getLastNMessagesFromDatabase("channel-1", 10)
+	msgs, err := m.getLastNMessagesFromDatabase("channel-1", 10)
 	if err != nil {
 		t.Fatalf("getLastNMessagesFromDatabase: %v", err)
 	}
@@ -637,22 +628,23 @@ func TestGetLastNMessagesFromDatabase_ShowsLatestEdit(t *testing.T) {
 }
 
 func TestGetMessageFromDatabase_ShowsLatestEdit(t *testing.T) {
-	setupGippityTest(t)
+	t.Parallel()
+	m := newTestModule(t)
 
-	if _, err := database.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		"user-1", "channel-1", 1000, "original message", "getmsg-edit-id", "allowed-guild", 0); err != nil {
 		t.Fatalf("insert chat_history: %v", err)
 	}
-	if _, err := database.Exec(`INSERT INTO chat_history_edits (original_message_id, edited_content, version, edited_at) VALUES (?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history_edits (original_message_id, edited_content, version, edited_at) VALUES (?, ?, ?, ?)`,
 		"getmsg-edit-id", "v1 edit", 1, 1001); err != nil {
 		t.Fatalf("insert edit v1: %v", err)
 	}
-	if _, err := database.Exec(`INSERT INTO chat_history_edits (original_message_id, edited_content, version, edited_at) VALUES (?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history_edits (original_message_id, edited_content, version, edited_at) VALUES (?, ?, ?, ?)`,
 		"getmsg-edit-id", "v2 edit", 2, 1002); err != nil {
 		t.Fatalf("insert edit v2: %v", err)
 	}
 
-	msg, err := getMessageFromDatabase("getmsg-edit-id")
+	msg, err := m.getMessageFromDatabase("getmsg-edit-id")
 	if err != nil {
 		t.Fatalf("getMessageFromDatabase: %v", err)
 	}
@@ -662,21 +654,22 @@ func TestGetMessageFromDatabase_ShowsLatestEdit(t *testing.T) {
 }
 
 func TestGetLastNMessagesFromDatabase_IncludesImageDescriptions(t *testing.T) {
-	setupGippityTest(t)
-	idToNameCache["user-1"] = "Alice"
-	idToNameCache["channel-1"] = "general"
-	idToNameCache["allowed-guild"] = "Test Guild"
+	t.Parallel()
+	m := newTestModule(t)
+	m.idToNameCache["user-1"] = "Alice"
+	m.idToNameCache["channel-1"] = "general"
+	m.idToNameCache["allowed-guild"] = "Test Guild"
 
-	if _, err := database.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_history (user_id, channel_id, timestamp, message, message_id, guild_id, is_bot_mention) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		"user-1", "channel-1", 1000, "look at this", "msg-with-img", "allowed-guild", 0); err != nil {
 		t.Fatalf("insert chat_history: %v", err)
 	}
-	if _, err := database.Exec(`INSERT INTO chat_attachments (message_id, attachment_url, image_description) VALUES (?, ?, ?)`,
+	if _, err := m.db.Exec(`INSERT INTO chat_attachments (message_id, attachment_url, image_description) VALUES (?, ?, ?)`,
 		"msg-with-img", "https://cdn.example.com/photo.png", "a fluffy dog"); err != nil {
 		t.Fatalf("insert chat_attachments: %v", err)
 	}
 
-	msgs, err := getLastNMessagesFromDatabase("channel-1", 10)
+	msgs, err := m.getLastNMessagesFromDatabase("channel-1", 10)
 	if err != nil {
 		t.Fatalf("getLastNMessagesFromDatabase: %v", err)
 	}
@@ -690,3 +683,217 @@ func TestGetLastNMessagesFromDatabase_IncludesImageDescriptions(t *testing.T) {
 		t.Errorf("image description = %q, want %q", msgs[0].ImageDescriptions[0], "a fluffy dog")
 	}
 }
+
+func TestModule_InitReadsConfigAndOpensDB(t *testing.T) {
+	t.Parallel()
+	m := New()
+	m.dbPath = filepath.Join(t.TempDir(), "gippity.db")
+	conf := &cfg.Config{}
+	conf.Gippity.AllowedGuilds = []string{"g1"}
+	conf.Gippity.IgnoredUsers = []string{"u1"}
+
+	if err := m.Init(bot.Deps{Config: conf}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Shutdown() })
+
+	if !m.allowedGuildIDs["g1"] {
+		t.Error("allowed guild from config not applied")
+	}
+	if !m.ignoredUserIDs["u1"] {
+		t.Error("ignored user from config not applied")
+	}
+	if err := m.setUserPrivacy("u2", false); err != nil {
+		t.Fatalf("setUserPrivacy after Init: %v", err)
+	}
+}
+
+func TestModule_ShutdownClosesDB(t *testing.T) {
+	t.Parallel()
+	m := newTestModule(t)
+
+	if err := m.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if m.getDB() != nil {
+		t.Fatal("database handle should be cleared after Shutdown")
+	}
+	if err := m.Shutdown(); err != nil {
+		t.Fatalf("second Shutdown: %v", err)
+	}
+
+	// handlers arriving after shutdown must not panic
+	m.onMessageCreate(m.session, gippityTestMessage("late message"))
+}
+
+func TestModule_CommandHandlersCoverCommands(t *testing.T) {
+	t.Parallel()
+	m := New()
+	handlers := m.CommandHandlers()
+	for _, cmd := range m.Commands() {
+		if handlers[cmd.Name] == nil {
+			t.Errorf("no handler for command %q", cmd.Name)
+		}
+	}
+}
+
+func TestModule_NameCacheResetStopsOnCancel(t *testing.T) {
+	t.Parallel()
+	m := New()
+	tasks := m.Background()
+	if len(tasks) != 1 {
+		t.Fatalf("Background() len = %d, want 1", len(tasks))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tasks[0].Run(ctx)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("name cache reset task did not stop on context cancel")
+	}
+}
+
+func TestIsLimitedUser_ResetsAfterAnHour(t *testing.T) {
+	t.Parallel()
+	m := newTestModule(t)
+	now := time.Unix(1000, 0)
+	m.nowFunc = func() time.Time { return now }
+	mc := gippityTestMessage("hey")
+
+	for range userMessageLimit {
+		m.isLimitedUser(mc)
+	}
+	if !m.isLimitedUser(mc) {
+		t.Fatal("user should be limited after exceeding the message limit")
+	}
+
+	now = now.Add(time.Hour)
+	if m.isLimitedUser(mc) {
+		t.Fatal("limit should reset after an hour")
+	}
+}
+
+func TestIsLimitedUser_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+	m := newTestModule(t)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mc := gippityTestMessage("hey")
+			mc.Author = &discordgo.User{ID: fmt.Sprintf("user-%d", i%4)}
+			m.isLimitedUser(mc)
+		}()
+	}
+	wg.Wait()
+
+	m.limitMu.Lock()
+	defer m.limitMu.Unlock()
+	if len(m.userMessageCount) != 4 {
+		t.Errorf("tracked users = %d, want 4", len(m.userMessageCount))
+	}
+}
+
+func TestReconfigure_SwapsAccessLists(t *testing.T) {
+	t.Parallel()
+	m := newTestModule(t)
+	var _ bot.Reconfigurable = m
+
+	conf := &cfg.Config{}
+	conf.Gippity.AllowedGuilds = []string{"new-guild"}
+	conf.Gippity.IgnoredUsers = []string{"troll"}
+	if err := m.Reconfigure(conf); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+
+	if m.guildAllowed("allowed-guild") {
+		t.Error("guild dropped from config should no longer be allowed")
+	}
+	if !m.guildAllowed("new-guild") || !m.userIgnored("troll") {
+		t.Error("reloaded lists not applied")
+	}
+}
+
+// fakeSpeaker records what it was asked to say.
+type fakeSpeaker struct {
+	said []string
+}
+
+func (f *fakeSpeaker) Speak(_ context.Context, guildID, userID, text string) error {
+	f.said = append(f.said, guildID+"/"+userID+": "+text)
+	return nil
+}
+
+func TestSpeak_FollowsTTSConfig(t *testing.T) {
+	t.Parallel()
+	m := newTestModule(t)
+	speaker := &fakeSpeaker{}
+	m.speaker = speaker
+	mc := &discordgo.MessageCreate{Message: &discordgo.Message{GuildID: "allowed-guild", Author: &discordgo.User{ID: "u1"}}}
+
+	m.speak(mc, "not yet")
+
+	conf := &cfg.Config{}
+	conf.TTS.Gippity = true
+	if err := m.Reconfigure(conf); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	m.speak(mc, "hello")
+	m.speak(&discordgo.MessageCreate{Message: &discordgo.Message{Author: &discordgo.User{ID: "u1"}}}, "in a DM")
+
+	if len(speaker.said) != 1 || speaker.said[0] != "allowed-guild/u1: hello" {
+		t.Errorf("said = %v, want only the guild answer after enabling tts.gippity", speaker.said)
+	}
+}
+
+func TestSpeak_CutsLongAnswers(t *testing.T) {
+	t.Parallel()
+	m := newTestModule(t)
+	speaker := &fakeSpeaker{}
+	m.speaker = speaker
+	conf := &cfg.Config{}
+	conf.TTS.Gippity = true
+	conf.TTS.MaxLength = 40
+	if err := m.Reconfigure(conf); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	mc := &discordgo.MessageCreate{Message: &discordgo.Message{GuildID: "allowed-guild", Author: &discordgo.User{ID: "u1"}}}
+
+	m.speak(mc, "The first sentence is short. The second one goes on\nand on until well past the limit.")
+
+	if len(speaker.said) != 1 || speaker.said[0] != "allowed-guild/u1: The first sentence is short." {
+		t.Errorf("said = %q, want the answer cut after its first sentence", speaker.said)
+	}
+}
+
+func TestShortenForSpeech(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		answer string
+		limit  int
+		want   string
+		cut    bool
+	}{
+		{"short  answer\n", 40, "short answer", false},
+		{"no limit at all", 0, "no limit at all", false},
+		{"Done. And then a very long second sentence", 20, "Done. And then a", true},
+		{"Half way there. Then more words follow", 22, "Half way there.", true},
+		{"one two three four", 11, "one two", true},
+		{"one two three four", 13, "one two three", true},
+		{"Überlänge äöü", 5, "Überl", true},
+	} {
+		got, cut := shortenForSpeech(tc.answer, tc.limit)
+		if got != tc.want || cut != tc.cut {
+			t.Errorf("shortenForSpeech(%q, %d) = %q, %v; want %q, %v", tc.answer, tc.limit, got, cut, tc.want, tc.cut)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/toksikk/gidbig/internal/bot"
+	"github.com/toksikk/gidbig/internal/cfg"
 	"github.com/toksikk/gidbig/internal/leetoclock/util/datastore"
 	"github.com/toksikk/gidbig/internal/util"
 )
@@ -26,6 +27,12 @@ const (
 	wat           = ":gustaff:721122751145967679"
 	defaultHour   = 13
 	defaultMinute = 37
+
+	// gameLeadIn and gameRunOut are how long a game runs before and after
+	// its target: from the preparation announcement until a while after the
+	// winners are announced.
+	gameLeadIn = time.Minute
+	gameRunOut = 3 * time.Minute
 )
 
 // Module implements bot.Module for the daily Leet o'Clock game.
@@ -39,6 +46,9 @@ type Module struct {
 	targetMinute              int
 	playersWithClockReactions map[string]struct{}
 	announcementChannels      []string
+	debug                     bool
+	debugHour                 int
+	debugMinute               int
 	renewReactionsMu          sync.Mutex
 	lifecycleMu               sync.Mutex
 	accepting                 bool
@@ -70,7 +80,8 @@ func New() *Module {
 // Name returns the module identifier.
 func (m *Module) Name() string { return "leetoclock" }
 
-// Init opens the shared database and captures runtime dependencies.
+// Init opens the shared database, applies modules.leetoclock, and captures
+// runtime dependencies. The LEETOCLOCK_DEBUG variables override the config.
 func (m *Module) Init(d bot.Deps) error {
 	dbPath := "gidbig.db"
 	if d.Config != nil && d.Config.Database.Path != "" {
@@ -87,15 +98,52 @@ func (m *Module) Init(d bot.Deps) error {
 
 	if os.Getenv("LEETOCLOCK_DEBUG") != "" {
 		target := m.now().Add(time.Minute)
-		m.targetHour, m.targetMinute = target.Hour(), target.Minute()
+		m.debugHour, m.debugMinute = target.Hour(), target.Minute()
+		m.debug = true
 		m.tickInterval = time.Second
 	}
+	m.applyConfig(d.Config)
+	slog.Info("leetoclock: initialized")
+	return nil
+}
+
+// Reconfigure picks up a changed target time or channel list. A game that is
+// already running keeps its target; a new target time applies once it ended.
+func (m *Module) Reconfigure(c *cfg.Config) error {
+	m.applyConfig(c)
+	slog.Info("leetoclock: reconfigured", "target", m.currentTarget().Format("15:04"))
+	return nil
+}
+
+// applyConfig sets the target time and announcement channels from
+// modules.leetoclock. The LEETOCLOCK_DEBUG variables take precedence.
+func (m *Module) applyConfig(c *cfg.Config) {
+	hour, minute := defaultHour, defaultMinute
+	var channels []string
+	if c != nil {
+		if h, mi, ok := c.Modules.Leetoclock.Clock(); ok {
+			hour, minute = h, mi
+		}
+		channels = append(channels, c.Modules.Leetoclock.Channels...)
+	}
+	if m.debug {
+		hour, minute = m.debugHour, m.debugMinute
+	}
 	if channel := os.Getenv("LEETOCLOCK_DEBUG_CHANNEL"); channel != "" {
-		m.announcementChannels = append(m.announcementChannels, channel)
+		channels = append(channels, channel)
 	}
+
+	m.stateMu.Lock()
+	m.targetHour, m.targetMinute = hour, minute
+	m.announcementChannels = channels
+	m.stateMu.Unlock()
 	m.updateTarget()
-	slog.Info("leetoclock: initialized")
-	return nil
+}
+
+func (m *Module) channels() []string {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.announcementChannels
 }
 
 func (m *Module) Commands() []*discordgo.ApplicationCommand { return nil }
@@ -175,7 +223,7 @@ func wait(ctx context.Context, duration time.Duration) bool {
 
 func (m *Module) announcePreparation() {
 	target := m.currentTarget()
-	for _, channelID := range m.announcementChannels {
+	for _, channelID := range m.channels() {
 		if _, err := m.session.ChannelMessageSend(channelID, fmt.Sprintf("## Leet o'Clock scheduled:\n<t:%d:R>", target.Unix())); err != nil {
 			slog.Error("leetoclock: send preparation announcement", "error", err)
 		}
@@ -196,27 +244,46 @@ func sortScoreArrayByScore(scores []datastore.Score) []datastore.Score {
 	return scores
 }
 
+// rankScores sorts the scores of a game and picks the top three
+// non-negative ones as winners, the other late posts as zonks, and the posts
+// up to five seconds early as early birds. A player appears at most once per
+// group.
+func rankScores(scores []datastore.Score) (earlyBirds, winners, zonks []datastore.Score) {
+	scores = sortScoreArrayByScore(scores)
+	earlyBirds = make([]datastore.Score, 0)
+	winners = make([]datastore.Score, 0)
+	zonks = make([]datastore.Score, 0)
+	for _, score := range scores {
+		if score.Score >= 0 && !isScoreInScoreArray(score, winners) && len(winners) < 3 {
+			winners = append(winners, score)
+		}
+	}
+	for _, score := range scores {
+		if score.Score > 0 && !isScoreInScoreArray(score, zonks) && !isScoreInScoreArray(score, winners) {
+			zonks = append(zonks, score)
+		}
+	}
+	for _, score := range scores {
+		if score.Score >= -5000 && score.Score < 0 && !isScoreInScoreArray(score, earlyBirds) {
+			earlyBirds = append(earlyBirds, score)
+		}
+	}
+	return earlyBirds, winners, zonks
+}
+
 func (m *Module) buildScoreboardForGame(game datastore.Game) (string, []datastore.Score, []datastore.Score, []datastore.Score, error) {
 	scores, err := m.store.GetScoresForGameID(game.ID)
 	if err != nil {
 		return "", nil, nil, nil, err
 	}
-	scores = sortScoreArrayByScore(scores)
 	channel, err := m.session.Channel(game.ChannelID)
 	if err != nil {
 		return "", nil, nil, nil, err
 	}
 
 	scoreboard := fmt.Sprintf("## 1337erboard for <t:%d>\n", m.currentTarget().Unix())
-	earlyBirds := make([]datastore.Score, 0)
-	winners := make([]datastore.Score, 0)
-	zonks := make([]datastore.Score, 0)
+	earlyBirds, winners, zonks := rankScores(scores)
 
-	for _, score := range scores {
-		if score.Score >= 0 && !isScoreInScoreArray(score, winners) && len(winners) < 3 {
-			winners = append(winners, score)
-		}
-	}
 	if len(winners) > 0 {
 		scoreboard += "### Top scorers\n"
 	}
@@ -233,11 +300,6 @@ func (m *Module) buildScoreboardForGame(game datastore.Game) (string, []datastor
 		scoreboard += fmt.Sprintf("%s <@%s> with %d ms (https://discord.com/channels/%s/%s/%s)\n", award, player.UserID, winner.Score, channel.GuildID, game.ChannelID, winner.MessageID)
 	}
 
-	for _, score := range scores {
-		if score.Score > 0 && !isScoreInScoreArray(score, zonks) && !isScoreInScoreArray(score, winners) {
-			zonks = append(zonks, score)
-		}
-	}
 	if len(zonks) > 0 {
 		scoreboard += "### Zonks\n"
 	}
@@ -249,11 +311,6 @@ func (m *Module) buildScoreboardForGame(game datastore.Game) (string, []datastor
 		scoreboard += fmt.Sprintf("😭 <@%s> with %d ms (https://discord.com/channels/%s/%s/%s)\n", player.UserID, score.Score, channel.GuildID, game.ChannelID, score.MessageID)
 	}
 
-	for _, score := range scores {
-		if score.Score >= -5000 && score.Score < 0 && !isScoreInScoreArray(score, earlyBirds) {
-			earlyBirds = append(earlyBirds, score)
-		}
-	}
 	if len(earlyBirds) > 0 {
 		scoreboard += "### Honorlolable mentions\n"
 	}
@@ -331,12 +388,17 @@ func (m *Module) resetGameVars() {
 	m.playersWithClockReactions = make(map[string]struct{})
 }
 
+// updateTarget moves the target to today's target time, except while a game
+// runs: from the preparation announcement a minute before the target until
+// the winners are announced after it.
 func (m *Module) updateTarget() {
 	now := m.now()
-	target := time.Date(now.Year(), now.Month(), now.Day(), m.targetHour, m.targetMinute, 0, 0, now.Location())
 	m.stateMu.Lock()
-	m.target = target
-	m.stateMu.Unlock()
+	defer m.stateMu.Unlock()
+	if !m.target.IsZero() && !now.Before(m.target.Add(-gameLeadIn)) && now.Before(m.target.Add(gameRunOut)) {
+		return
+	}
+	m.target = time.Date(now.Year(), now.Month(), now.Day(), m.targetHour, m.targetMinute, 0, 0, now.Location())
 }
 
 func (m *Module) currentTarget() time.Time {
@@ -427,3 +489,70 @@ func (m *Module) beginHandler() bool {
 	m.handlerWG.Add(1)
 	return true
 }
+
+// Scoreboard is the outcome of one game, as served by the web API.
+type Scoreboard struct {
+	ChannelID  string       `json:"channel_id"`
+	Date       time.Time    `json:"date"`
+	Winners    []ScoreEntry `json:"winners"`
+	Zonks      []ScoreEntry `json:"zonks"`
+	EarlyBirds []ScoreEntry `json:"early_birds"`
+}
+
+// ScoreEntry is a post in a game; Score is its distance from the target in
+// milliseconds, negative when early.
+type ScoreEntry struct {
+	UserID    string `json:"user_id"`
+	Score     int    `json:"score_ms"`
+	MessageID string `json:"message_id"`
+}
+
+// Scoreboards returns the scoreboards of the limit most recent games of
+// guildID, newest first.
+func (m *Module) Scoreboards(guildID string, limit int) ([]Scoreboard, error) {
+	games, err := m.store.GetGamesByGuildID(guildID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].GameDate.After(games[j].GameDate) })
+	games = games[:min(limit, len(games))]
+
+	players := make(map[uint]string)
+	entries := func(scores []datastore.Score) ([]ScoreEntry, error) {
+		out := make([]ScoreEntry, 0, len(scores))
+		for _, score := range scores {
+			userID, ok := players[score.PlayerID]
+			if !ok {
+				player, err := m.store.GetPlayerByID(score.PlayerID)
+				if err != nil {
+					return nil, err
+				}
+				userID = player.UserID
+				players[score.PlayerID] = userID
+			}
+			out = append(out, ScoreEntry{UserID: userID, Score: score.Score, MessageID: score.MessageID})
+		}
+		return out, nil
+	}
+
+	boards := make([]Scoreboard, 0, len(games))
+	for _, game := range games {
+		scores, err := m.store.GetScoresForGameID(game.ID)
+		if err != nil {
+			return nil, err
+		}
+		earlyBirds, winners, zonks := rankScores(scores)
+		board := Scoreboard{ChannelID: game.ChannelID, Date: game.GameDate}
+		if board.Winners, err = entries(winners); err != nil {
+			return nil, err
+		}
+		if board.Zonks, err = entries(zonks); err != nil {
+			return nil, err
+		}
+		if board.EarlyBirds, err = entries(earlyBirds); err != nil {
+			return nil, err
+		}
+		boards = append(boards, board)
+	}
+	return boards, nil
+}
@@ -2,6 +2,7 @@ package leetoclock
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
 	"testing"
 	"time"
@@ -176,3 +177,117 @@ func newTestModule(t *testing.T) (*Module, *discordgo.Session) {
 	})
 	return m, session
 }
+
+func TestInitAppliesModuleConfig(t *testing.T) {
+	conf := &cfg.Config{}
+	conf.Database.Path = filepath.Join(t.TempDir(), "gidbig.db")
+	conf.Modules.Leetoclock.Time = "04:20"
+	conf.Modules.Leetoclock.Channels = []string{"chan-a", "chan-b"}
+
+	m := New()
+	if err := m.Init(bot.Deps{Config: conf}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = m.Shutdown() })
+
+	if m.targetHour != 4 || m.targetMinute != 20 {
+		t.Errorf("target = %02d:%02d, want 04:20", m.targetHour, m.targetMinute)
+	}
+	if len(m.announcementChannels) != 2 || m.announcementChannels[0] != "chan-a" {
+		t.Errorf("announcementChannels = %v, want [chan-a chan-b]", m.announcementChannels)
+	}
+}
+
+func TestReconfigureUpdatesTarget(t *testing.T) {
+	m, _ := newTestModule(t)
+	var _ bot.Reconfigurable = m
+	m.now = func() time.Time { return time.Date(2026, 5, 1, 9, 0, 0, 0, time.Local) }
+
+	conf := &cfg.Config{}
+	conf.Modules.Leetoclock.Time = "23:59"
+	conf.Modules.Leetoclock.Channels = []string{"chan-new"}
+	if err := m.Reconfigure(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := m.currentTarget(); got.Hour() != 23 || got.Minute() != 59 {
+		t.Errorf("target = %s, want 23:59", got.Format("15:04"))
+	}
+	if ch := m.channels(); len(ch) != 1 || ch[0] != "chan-new" {
+		t.Errorf("channels = %v, want [chan-new]", ch)
+	}
+}
+
+func TestReconfigureKeepsTargetOfRunningGame(t *testing.T) {
+	m, _ := newTestModule(t)
+	now := time.Date(2026, 5, 1, 13, 36, 30, 0, time.Local)
+	m.now = func() time.Time { return now }
+	m.updateTarget()
+
+	conf := &cfg.Config{}
+	conf.Modules.Leetoclock.Time = "23:59"
+	if err := m.Reconfigure(conf); err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range []time.Time{now, now.Add(time.Minute), now.Add(3 * time.Minute)} {
+		now = at
+		m.updateTarget()
+		if got := m.currentTarget(); got.Hour() != 13 || got.Minute() != 37 {
+			t.Errorf("target at %s = %s, want the running game's 13:37", at.Format("15:04:05"), got.Format("15:04"))
+		}
+	}
+
+	now = now.Add(time.Minute)
+	m.updateTarget()
+	if got := m.currentTarget(); got.Hour() != 23 || got.Minute() != 59 {
+		t.Errorf("target after the game = %s, want 23:59", got.Format("15:04"))
+	}
+}
+
+func TestScoreboards(t *testing.T) {
+	m, _ := newTestModule(t)
+	day := time.Date(2026, time.August, 13, 13, 37, 0, 0, time.Local)
+	season, err := m.store.EnsureSeason(day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addGame := func(guildID string, date time.Time, scores map[string]int) {
+		t.Helper()
+		game, err := m.store.EnsureGame("channel-"+guildID, guildID, date, season.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for userID, score := range scores {
+			player, err := m.store.EnsurePlayer(userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgID := fmt.Sprintf("%s-%s-%d", userID, guildID, date.Day())
+			if err := m.store.CreateScore(msgID, player.ID, score, game.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	addGame("guild", day, map[string]int{"alice": 120, "bob": 5, "carol": -300})
+	addGame("guild", day.AddDate(0, 0, 1), map[string]int{"bob": 0})
+	addGame("other", day, map[string]int{"dave": 1})
+
+	boards, err := m.Scoreboards("guild", 5)
+	if err != nil {
+		t.Fatalf("Scoreboards: %v", err)
+	}
+	if len(boards) != 2 || !boards[0].Date.Equal(day.AddDate(0, 0, 1)) {
+		t.Fatalf("boards = %+v, want the two games of guild, newest first", boards)
+	}
+	b := boards[1]
+	if b.ChannelID != "channel-guild" || len(b.Winners) != 2 || b.Winners[0].UserID != "bob" || b.Winners[1] != (ScoreEntry{"alice", 120, "alice-guild-13"}) {
+		t.Errorf("winners = %+v, want bob then alice", b.Winners)
+	}
+	if len(b.Zonks) != 0 || len(b.EarlyBirds) != 1 || b.EarlyBirds[0].UserID != "carol" {
+		t.Errorf("zonks = %+v, early birds = %+v, want only carol early", b.Zonks, b.EarlyBirds)
+	}
+
+	if boards, err := m.Scoreboards("guild", 1); err != nil || len(boards) != 1 {
+		t.Errorf("Scoreboards(limit 1) = %d boards, %v", len(boards), err)
+	}
+}
@@ -35,13 +35,19 @@ var PersonalityPresets = map[string]string{
 
 // activePersonality is the resolved persona appended to every LLM system prompt.
 // Centralised here so all plugins express the same character. Defaults to the built-in
-// persona until ResolvePersonality overrides it from config.
-var activePersonality = defaultPersonality
+// persona until ResolvePersonality overrides it from config. Guarded by personalityMu
+// because a config reload may swap it while handlers read it.
+var (
+	personalityMu     sync.RWMutex
+	activePersonality = defaultPersonality
+)
 
 // ResolvePersonality sets the active persona from config. A non-empty custom string wins;
 // otherwise a known preset key is used; otherwise the built-in default is kept. An unknown
 // preset logs a warning and falls back to the default.
 func ResolvePersonality(custom, preset string) {
+	personalityMu.Lock()
+	defer personalityMu.Unlock()
 	switch {
 	case strings.TrimSpace(custom) != "":
 		activePersonality = custom
@@ -60,7 +66,11 @@ func ResolvePersonality(custom, preset string) {
 }
 
 // Personality returns the active bot persona for inclusion in system prompts.
-func Personality() string { return activePersonality }
+func Personality() string {
+	personalityMu.RLock()
+	defer personalityMu.RUnlock()
+	return activePersonality
+}
 
 const llmTimeout = 30 * time.Second
 const langCacheTTL = 1 * time.Hour
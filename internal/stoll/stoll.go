@@ -31,10 +31,12 @@ func (m *Module) Commands() []*discordgo.ApplicationCommand {
 	}
 }
 
-func (m *Module) Listeners() []bot.EventListener {
-	return []bot.EventListener{m.onInteractionCreate}
+func (m *Module) CommandHandlers() map[string]bot.HandlerFunc {
+	return map[string]bot.HandlerFunc{"stoll": m.onInteractionCreate}
 }
 
+func (m *Module) Listeners() []bot.EventListener { return nil }
+
 func (m *Module) Components() []bot.ComponentHandler { return nil }
 func (m *Module) Background() []bot.BackgroundTask   { return nil }
 func (m *Module) Shutdown() error                    { return nil }
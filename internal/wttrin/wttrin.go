@@ -14,6 +14,7 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/toksikk/gidbig/internal/bot"
+	"github.com/toksikk/gidbig/internal/cfg"
 	"github.com/toksikk/gidbig/internal/llm"
 )
 
@@ -246,14 +247,16 @@ type wttrinResponse struct {
 
 // Module implements bot.Module for the wttrin weather plugin.
 type Module struct {
-	session      *discordgo.Session
-	detectLang   func(*discordgo.Session, string) (string, error)
-	generateFn   func(context.Context, string, string) (string, error)
-	getWeatherFn func(string) (wttrinResponse, error)
-	now          func() time.Time
-	cacheMu      sync.Mutex
-	cache        map[string]weatherCacheEntry
-	inflight     map[string]*weatherCall
+	session         *discordgo.Session
+	locationMu      sync.RWMutex
+	defaultLocation string
+	detectLang      func(*discordgo.Session, string) (string, error)
+	generateFn      func(context.Context, string, string) (string, error)
+	getWeatherFn    func(string) (wttrinResponse, error)
+	now             func() time.Time
+	cacheMu         sync.Mutex
+	cache           map[string]weatherCacheEntry
+	inflight        map[string]*weatherCall
 }
 
 type weatherCacheEntry struct {
@@ -283,6 +286,9 @@ func (m *Module) Name() string { return "wttrin" }
 
 func (m *Module) Init(d bot.Deps) error {
 	m.session = d.Session
+	if d.Config != nil {
+		m.defaultLocation = d.Config.Modules.Wttrin.DefaultLocation
+	}
 	if d.LLM != nil {
 		llmClient := d.LLM
 		m.generateFn = func(ctx context.Context, system, user string) (string, error) {
@@ -293,6 +299,14 @@ func (m *Module) Init(d bot.Deps) error {
 	return nil
 }
 
+// Reconfigure picks up a changed default location.
+func (m *Module) Reconfigure(c *cfg.Config) error {
+	m.locationMu.Lock()
+	m.defaultLocation = c.Modules.Wttrin.DefaultLocation
+	m.locationMu.Unlock()
+	return nil
+}
+
 func (m *Module) Commands() []*discordgo.ApplicationCommand { return nil }
 
 func (m *Module) Listeners() []bot.EventListener {
@@ -335,10 +349,16 @@ func (m *Module) sendMessage(s *discordgo.Session, mc *discordgo.MessageCreate,
 }
 
 func (m *Module) constructDiscordMessage(s *discordgo.Session, mc *discordgo.MessageCreate, parts []string, g *discordgo.Guild, forecast bool) string {
-	if len(parts) <= 1 {
+	location := strings.Join(parts[1:], "+")
+	if location == "" {
+		// Without an argument fall back to modules.wttrin.default_location.
+		m.locationMu.RLock()
+		location = strings.Join(strings.Fields(m.defaultLocation), "+")
+		m.locationMu.RUnlock()
+	}
+	if location == "" {
 		return ""
 	}
-	location := strings.Join(parts[1:], "+")
 	weatherResult, err := m.getWeatherCached(location)
 	if err != nil {
 		slog.Error("Failed to get weather", "MessageID", mc.ID, "Location", location, "Error", err)
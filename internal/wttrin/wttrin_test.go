@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/toksikk/gidbig/internal/bot"
+	"github.com/toksikk/gidbig/internal/cfg"
 )
 
 func newTestModule() *Module {
@@ -416,3 +418,45 @@ func TestConstructDiscordMessage_LLMFailureReturnsOnlyStructured(t *testing.T) {
 		t.Error("error message must not leak into output")
 	}
 }
+
+func TestConstructDiscordMessage_NoLocationUsesDefault(t *testing.T) {
+	m := newTestModule()
+	var queried string
+	m.getWeatherFn = func(location string) (wttrinResponse, error) {
+		queried = location
+		return minimalWeatherResponse(), nil
+	}
+	mc := &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: "ch1"}}
+
+	if msg := m.constructDiscordMessage(nil, mc, []string{"!wttr"}, &discordgo.Guild{}, false); msg != "" || queried != "" {
+		t.Fatalf("without a default location nothing should be queried, got %q for %q", msg, queried)
+	}
+
+	m.defaultLocation = "Frankfurt am Main"
+	if msg := m.constructDiscordMessage(nil, mc, []string{"!wttr"}, &discordgo.Guild{}, false); msg == "" {
+		t.Fatal("expected weather for the default location")
+	}
+	if queried != "Frankfurt+am+Main" {
+		t.Errorf("queried location = %q, want Frankfurt+am+Main", queried)
+	}
+}
+
+func TestReconfigure_DefaultLocation(t *testing.T) {
+	m := newTestModule()
+	var _ bot.Reconfigurable = m
+	var queried string
+	m.getWeatherFn = func(location string) (wttrinResponse, error) {
+		queried = location
+		return minimalWeatherResponse(), nil
+	}
+
+	conf := &cfg.Config{}
+	conf.Modules.Wttrin.DefaultLocation = "Köln"
+	if err := m.Reconfigure(conf); err != nil {
+		t.Fatal(err)
+	}
+	m.constructDiscordMessage(nil, &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: "ch1"}}, []string{"!wttr"}, &discordgo.Guild{}, false)
+	if queried != "Köln" {
+		t.Errorf("queried location = %q, want Köln", queried)
+	}
+}